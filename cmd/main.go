@@ -2,25 +2,68 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/Goalt/service-exporter/internal/app"
+	"github.com/Goalt/service-exporter/internal/logging"
 	"github.com/oklog/run"
 )
 
+// commands are the subcommands run instead of the interactive exporter
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"config":  app.RunConfig,
+	"doctor":  app.RunDoctor,
+	"expose":  app.RunExpose,
+	"history": app.RunHistory,
+	"list":    app.RunList,
+	"login":   app.RunLogin,
+	"logout":  app.RunLogout,
+	"ports":   app.RunPorts,
+	"replay":  app.RunReplay,
+	"status":  app.RunStatus,
+}
+
 func main() {
-	log.SetFlags(0)
+	if err := logging.Setup(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		os.Exit(1)
+	}
 
 	ctx, cancelCtx := context.WithCancel(context.Background())
 	defer cancelCtx()
 
-	app := app.New()
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if err := command(ctx, os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+				slog.Error("❌ "+os.Args[1]+" failed", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	config := app.Config{}
+	config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// Layer the configuration files, profile and environment under the flags
+	if _, err := config.Resolve(flag.CommandLine); err != nil {
+		slog.Error("❌ Error loading config", "error", err)
+		return
+	}
+
+	app := app.New(config)
 	if err := app.LoadConfig(); err != nil {
-		log.Print("❌ Error loading config: ", err)
+		slog.Error("❌ Error loading config", "error", err)
 		return
 	}
 
@@ -40,7 +83,7 @@ func main() {
 	{
 		g.Add(func() error {
 			if err := app.Run(ctx); err != nil {
-				log.Print("❌ ", err)
+				slog.Error("❌ Exporter failed", "error", err)
 			}
 
 			return nil
@@ -50,6 +93,10 @@ func main() {
 	}
 
 	if err := g.Run(); err != nil {
-		log.Print("❌ Stopped with error: ", err)
+		slog.Error("❌ Stopped with error", "error", err)
+	}
+
+	if err := app.Cleanup(); err != nil {
+		slog.Error("❌ Cleanup failed", "error", err)
 	}
 }
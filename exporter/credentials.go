@@ -0,0 +1,43 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Goalt/service-exporter/internal/k8s"
+)
+
+// resolveAuth replaces the credentials of auth referencing Secrets with their values and validates it.
+// Basic auth may reference the whole "username:password" or only the password, as in "admin:secret://..."
+func (ex *Exporter) resolveAuth(ctx context.Context, auth TunnelAuth) (TunnelAuth, error) {
+	var err error
+	resolve := func(name string, value *string) {
+		if err != nil || !k8s.IsSecretRef(*value) {
+			return
+		}
+		var resolved string
+		if resolved, err = ex.kubeClient.ResolveCredential(ctx, *value); err != nil {
+			err = fmt.Errorf("failed to read %s: %w", name, err)
+			return
+		}
+		*value = resolved
+	}
+
+	if username, password, ok := strings.Cut(auth.BasicAuth, ":"); ok && k8s.IsSecretRef(password) {
+		resolve("basic auth password", &password)
+		auth.BasicAuth = username + ":" + password
+	} else {
+		resolve("basic auth", &auth.BasicAuth)
+	}
+	resolve("OAuth client ID", &auth.OAuthClientID)
+	resolve("OAuth client secret", &auth.OAuthClientSecret)
+	if err != nil {
+		return TunnelAuth{}, err
+	}
+
+	if err := auth.Validate(); err != nil {
+		return TunnelAuth{}, fmt.Errorf("invalid authentication: %w", err)
+	}
+	return auth, nil
+}
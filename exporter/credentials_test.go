@@ -0,0 +1,53 @@
+package exporter
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestResolveAuth(t *testing.T) {
+	ex := &Exporter{kubeClient: &fakeKube{secrets: map[string]string{
+		"secret://ops/auth/basic":         "admin:correct-horse",
+		"secret://ops/auth/password":      "correct-horse",
+		"secret://ops/oauth/client-id":    "id",
+		"secret://ops/oauth/client-token": "token",
+	}}}
+
+	tests := []struct {
+		name     string
+		auth     TunnelAuth
+		expected TunnelAuth
+		err      string
+	}{
+		{name: "none", auth: TunnelAuth{}, expected: TunnelAuth{}},
+		{name: "plain", auth: TunnelAuth{BasicAuth: "admin:plain-password"}, expected: TunnelAuth{BasicAuth: "admin:plain-password"}},
+		{name: "basic auth", auth: TunnelAuth{BasicAuth: "secret://ops/auth/basic"}, expected: TunnelAuth{BasicAuth: "admin:correct-horse"}},
+		{name: "password", auth: TunnelAuth{BasicAuth: "admin:secret://ops/auth/password"}, expected: TunnelAuth{BasicAuth: "admin:correct-horse"}},
+		{
+			name:     "oauth",
+			auth:     TunnelAuth{OAuthProvider: "github", OAuthClientID: "secret://ops/oauth/client-id", OAuthClientSecret: "secret://ops/oauth/client-token"},
+			expected: TunnelAuth{OAuthProvider: "github", OAuthClientID: "id", OAuthClientSecret: "token"},
+		},
+		{name: "missing", auth: TunnelAuth{BasicAuth: "admin:secret://ops/auth/missing"}, err: "failed to read basic auth password"},
+		{name: "invalid", auth: TunnelAuth{BasicAuth: "secret://ops/auth/password"}, err: "invalid authentication: basic auth must be in the username:password format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := ex.resolveAuth(context.Background(), tt.auth)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveAuth should not return an error: %v", err)
+			}
+			if auth.BasicAuth != tt.expected.BasicAuth || auth.OAuthClientID != tt.expected.OAuthClientID || auth.OAuthClientSecret != tt.expected.OAuthClientSecret {
+				t.Errorf("Expected %+v, got %+v", tt.expected, auth)
+			}
+		})
+	}
+}
@@ -0,0 +1,485 @@
+// Package exporter exposes ports of Kubernetes services on public ngrok URLs from Go programs, such as test
+// harnesses and chat bots. It is the stable API the service-exporter command is built on:
+//
+//	ex, err := exporter.New(ctx, exporter.WithNgrokAuthToken(os.Getenv("NGROK_AUTH_TOKEN")))
+//	if err != nil {
+//		return err
+//	}
+//	defer ex.Close()
+//
+//	exposure, err := ex.Expose(ctx, exporter.Target{Namespace: "staging", Service: "api", Port: "http"})
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(exposure.PublicURL)
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/audit"
+	"github.com/Goalt/service-exporter/internal/health"
+	"github.com/Goalt/service-exporter/internal/hooks"
+	"github.com/Goalt/service-exporter/internal/k8s"
+	"github.com/Goalt/service-exporter/internal/ngrok"
+	"github.com/Goalt/service-exporter/internal/proxy"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// ProviderNgrok publishes exposures on ngrok endpoints, the only provider so far
+const ProviderNgrok = "ngrok"
+
+// kubeClient is the Kubernetes client of an Exporter, it reads the credentials referenced as secret://namespace/name/key
+type kubeClient interface {
+	service.K8s
+	ResolveCredential(ctx context.Context, value string) (string, error)
+}
+
+// options are the settings of New
+type options struct {
+	kubeconfig  string
+	kubeContext string
+	provider    string
+	authToken   string
+	auth        TunnelAuth
+	policy      Policy
+	auditLog    string
+	hooks       []Hook
+
+	// kubeClient and ngrokClient replace the clients New creates
+	kubeClient  kubeClient
+	ngrokClient service.NgrokClient
+}
+
+// Option configures an Exporter
+type Option func(*options)
+
+// WithKubeconfig reads the cluster from the kubeconfig file at path, $KUBECONFIG or ~/.kube/config if empty
+func WithKubeconfig(path string) Option {
+	return func(o *options) { o.kubeconfig = path }
+}
+
+// WithKubeContext uses the named kubeconfig context instead of the current one
+func WithKubeContext(name string) Option {
+	return func(o *options) { o.kubeContext = name }
+}
+
+// WithProvider publishes exposures with the named tunnel provider, ProviderNgrok by default
+func WithProvider(name string) Option {
+	return func(o *options) { o.provider = name }
+}
+
+// WithNgrokAuthToken authenticates with ngrok, the token may reference a Secret as secret://namespace/name/key
+func WithNgrokAuthToken(token string) Option {
+	return func(o *options) { o.authToken = token }
+}
+
+// WithAuth protects the public URLs of the exposures whose target sets no authentication.
+// Credentials may reference Secrets as secret://namespace/name/key, basic auth only its password as in "admin:secret://..."
+func WithAuth(auth TunnelAuth) Option {
+	return func(o *options) { o.auth = auth }
+}
+
+// WithPolicy evaluates the rules of policy before exposing a service port
+func WithPolicy(policy Policy) Option {
+	return func(o *options) { o.policy = policy }
+}
+
+// WithAuditLog records the lifecycle transitions of the exposures as JSON lines appended to the file at path
+func WithAuditLog(path string) Option {
+	return func(o *options) { o.auditLog = path }
+}
+
+// WithHooks runs commands and calls webhooks when exposures start, stop or change their public URL
+func WithHooks(hooks ...Hook) Option {
+	return func(o *options) { o.hooks = append(o.hooks, hooks...) }
+}
+
+// Exporter exposes ports of Kubernetes services on public URLs, it is safe for concurrent use
+type Exporter struct {
+	svc         service.Service
+	kubeClient  kubeClient
+	kubeContext string
+	auth        TunnelAuth
+	auditLog    *audit.Log
+	// hooksDone is closed once the hooks of the events published until Close ran
+	hooksDone chan struct{}
+	// cancelHooks kills the running hook once Close stops waiting for it
+	cancelHooks context.CancelFunc
+}
+
+// hooksGrace is how long Close waits for the pending hooks before cancelling them
+var hooksGrace = 30 * time.Second
+
+// New connects to the Kubernetes cluster and creates the tunnel provider client, reading the credentials
+// referenced as secret://namespace/name/key. Close releases the exposures and clients
+func New(ctx context.Context, opts ...Option) (*Exporter, error) {
+	o := options{provider: ProviderNgrok}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.provider != ProviderNgrok {
+		return nil, fmt.Errorf("unknown provider %q, use %s", o.provider, ProviderNgrok)
+	}
+	var runner *hooks.Runner
+	if len(o.hooks) > 0 {
+		var err error
+		if runner, err = hooks.NewRunner(o.hooks); err != nil {
+			return nil, err
+		}
+	}
+
+	client := o.kubeClient
+	if client == nil {
+		k8sClient, err := k8s.New(o.kubeconfig, o.kubeContext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
+		}
+		client = k8sClient
+	}
+
+	ex := &Exporter{kubeClient: client, kubeContext: client.ContextName()}
+	var err error
+	if ex.auth, err = ex.resolveAuth(ctx, o.auth); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	ngrokClient := o.ngrokClient
+	if ngrokClient == nil {
+		if ngrokClient, err = ex.ngrokClient(ctx, o.authToken); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	svc := service.NewService(client, ngrokClient)
+	if len(o.policy.Rules) > 0 {
+		svc.SetPolicy(o.policy)
+	}
+	if o.auditLog != "" {
+		if ex.auditLog, err = audit.Open(o.auditLog); err != nil {
+			ngrokClient.Close()
+			client.Close()
+			return nil, err
+		}
+		svc.SetAuditLog(ex.auditLog)
+	}
+	ex.svc = svc
+
+	if runner != nil {
+		hooksCtx, cancel := context.WithCancel(context.Background())
+		events := svc.Subscribe(hooksCtx)
+		ex.hooksDone, ex.cancelHooks = make(chan struct{}), cancel
+		go func() {
+			defer close(ex.hooksDone)
+			runner.Run(hooksCtx, events)
+		}()
+	}
+
+	return ex, nil
+}
+
+// ngrokClient creates the ngrok client with the auth token, read from its Secret if it references one
+func (ex *Exporter) ngrokClient(ctx context.Context, token string) (service.NgrokClient, error) {
+	if k8s.IsSecretRef(token) {
+		ref := token
+		var err error
+		if token, err = ex.kubeClient.ResolveCredential(ctx, ref); err != nil {
+			return nil, fmt.Errorf("failed to read ngrok auth token: %w", err)
+		}
+		if check := ngrok.CheckAuthToken(token); check.Status == service.CheckFail {
+			return nil, fmt.Errorf("ngrok auth token read from %s: %s, %s", ref, check.Detail, check.Hint)
+		}
+	}
+
+	client, err := ngrok.NewClient(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ngrok client: %v", err)
+	}
+	return client, nil
+}
+
+// KubeContext returns the name of the kubeconfig context the exporter uses
+func (ex *Exporter) KubeContext() string {
+	return ex.kubeContext
+}
+
+// Services returns the services of the cluster, including the ones whose owners opted out of exposure
+func (ex *Exporter) Services(ctx context.Context) ([]ServiceInfo, error) {
+	return ex.svc.GetServices(ctx)
+}
+
+// WatchServices calls onChange with the services of the cluster as they are listed, and whether all of them
+// are, and again whenever they change, until ctx is cancelled
+func (ex *Exporter) WatchServices(ctx context.Context, onChange func(services []ServiceInfo, synced bool)) error {
+	return ex.svc.WatchServices(ctx, onChange)
+}
+
+// Ports returns the ports of a service, the one named by its default-port annotation marked as default
+func (ex *Exporter) Ports(ctx context.Context, namespace string, name string) ([]ServicePort, error) {
+	return ex.svc.GetServicePorts(ctx, ServiceInfo{Name: name, Namespace: namespace}.String())
+}
+
+// Preflight checks that the cluster is reachable and that the current user may list services
+// and port-forward to pods in namespace, all namespaces if empty
+func (ex *Exporter) Preflight(ctx context.Context, namespace string) []CheckResult {
+	return ex.svc.Preflight(ctx, namespace)
+}
+
+// Target is a service port to expose and the settings of its exposure, unset settings use the service's
+// annotations and the options of the Exporter
+type Target struct {
+	Namespace string
+	Service   string
+	// Port is the name or number of the port, the service's default port or its only port if empty
+	Port string
+
+	// TunnelType is the kind of tunnel, the tunnel type annotation of the service or http if empty
+	TunnelType TunnelType
+	// Auth protects the public URL, WithAuth or the basic auth secret annotation of the service if unset.
+	// Credentials may reference Secrets like those of WithAuth
+	Auth TunnelAuth
+	// Domain is the ngrok domain of http tunnels, the domain annotation of the service if empty
+	Domain string
+	// TrafficPolicy is an ngrok traffic policy document in YAML or JSON applied to the tunnel
+	TrafficPolicy string
+
+	// TTL, if set, stops the exposure once it has been running for that long
+	TTL time.Duration
+	// IdleTimeout, if set, stops the exposure once no request went through the tunnel for that long
+	IdleTimeout time.Duration
+	// WarnBefore, if set, warns that long before the exposure is stopped by TTL or IdleTimeout
+	WarnBefore time.Duration
+
+	// HealthCheck, if enabled, is run against the forwarded port
+	HealthCheck HealthCheck
+	// FallbackPage is served with 503 while the health check fails, a default page if empty
+	FallbackPage []byte
+	// Rules rewrites the HTTP traffic going through the tunnel
+	Rules Rules
+	// Limits caps the HTTP traffic accepted through the tunnel
+	Limits Limits
+	// EnvFile, if its path is set, receives the public URL, local port and forwarded address until the exposure stops
+	EnvFile EnvFile
+}
+
+// Expose forwards the target's port and publishes it, returning once its public URL accepts connections.
+// The exposure lasts until it is stopped, expires or the Exporter is closed; ctx only bounds its start
+func (ex *Exporter) Expose(ctx context.Context, target Target) (*Exposure, error) {
+	if target.Namespace == "" || target.Service == "" {
+		return nil, fmt.Errorf("target needs a namespace and a service")
+	}
+	serviceName := ServiceInfo{Name: target.Service, Namespace: target.Namespace}.String()
+
+	ports, err := ex.svc.GetServicePorts(ctx, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service ports: %v", err)
+	}
+	port, err := SelectPort(ports, target.Port)
+	if err != nil {
+		return nil, fmt.Errorf("service %s/%s: %w", target.Namespace, target.Service, err)
+	}
+
+	auth := target.Auth
+	if auth.Enabled() {
+		if auth, err = ex.resolveAuth(ctx, auth); err != nil {
+			return nil, err
+		}
+	} else {
+		auth = ex.auth
+	}
+
+	status, err := ex.svc.Expose(ctx, service.ExposeRequest{
+		Service: serviceName,
+		Port:    port,
+		Rules:   target.Rules.rules(),
+		Limits:  proxy.Limits(target.Limits),
+
+		TTL:         target.TTL,
+		IdleTimeout: target.IdleTimeout,
+		WarnBefore:  target.WarnBefore,
+
+		HealthCheck:  health.Config(target.HealthCheck),
+		FallbackPage: target.FallbackPage,
+
+		Auth:       service.TunnelAuth(auth),
+		TunnelType: service.TunnelType(target.TunnelType),
+		Domain:     target.Domain,
+
+		TrafficPolicy: target.TrafficPolicy,
+		EnvFile:       service.EnvFile(target.EnvFile),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exposure{ExposureStatus: newExposureStatus(status), exporter: ex}, nil
+}
+
+// SelectPort returns the port of ports named by name, its name or number, the default port or the only port
+// if name is empty
+func SelectPort(ports []ServicePort, name string) (ServicePort, error) {
+	if name == "" {
+		if i := slices.IndexFunc(ports, func(p ServicePort) bool { return p.Default }); i != -1 {
+			return ports[i], nil
+		}
+		if len(ports) == 1 {
+			return ports[0], nil
+		}
+		return ServicePort{}, fmt.Errorf("no default port, choose one of %s", portNames(ports))
+	}
+
+	i := slices.IndexFunc(ports, func(p ServicePort) bool {
+		return p.Name == name || strconv.Itoa(int(p.Port)) == name
+	})
+	if i == -1 {
+		return ServicePort{}, fmt.Errorf("no port %q, the ports are %s", name, portNames(ports))
+	}
+	return ports[i], nil
+}
+
+// portNames lists ports as "80 (http), 9090"
+func portNames(ports []ServicePort) string {
+	if len(ports) == 0 {
+		return "none"
+	}
+
+	names := make([]string, len(ports))
+	for i, p := range ports {
+		names[i] = strconv.Itoa(int(p.Port))
+		if p.Name != "" {
+			names[i] += " (" + p.Name + ")"
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Exposures returns a snapshot of the active exposures ordered by local port
+func (ex *Exporter) Exposures() []ExposureStatus {
+	exposures := ex.svc.Exposures()
+	statuses := make([]ExposureStatus, len(exposures))
+	for i, status := range exposures {
+		statuses[i] = newExposureStatus(status)
+	}
+	return statuses
+}
+
+// StopExposure stops the port forwarding and tunnel of the exposure on the given local port
+func (ex *Exporter) StopExposure(localPort int) error {
+	return ex.svc.StopExposure(localPort)
+}
+
+// RestartTunnel replaces the tunnel of the exposure on the given local port, returning its new public URL
+func (ex *Exporter) RestartTunnel(ctx context.Context, localPort int) (string, error) {
+	return ex.svc.RestartTunnel(ctx, localPort)
+}
+
+// Requests returns the HTTP requests recorded for the exposure on the given local port, oldest first
+func (ex *Exporter) Requests(localPort int) ([]Exchange, error) {
+	exchanges, err := ex.svc.Requests(localPort)
+	if err != nil {
+		return nil, err
+	}
+	return newExchanges(exchanges), nil
+}
+
+// Request returns a single recorded request of the exposure on the given local port
+func (ex *Exporter) Request(localPort int, id int64) (Exchange, error) {
+	exchange, err := ex.svc.Request(localPort, id)
+	return Exchange(exchange), err
+}
+
+// Replay sends a recorded request of the exposure on the given local port, modified by opts, again to the
+// forwarded port and compares the new response with the original one
+func (ex *Exporter) Replay(ctx context.Context, localPort int, id int64, opts ReplayOptions) (ReplayResult, error) {
+	result, err := ex.svc.Replay(ctx, localPort, id, proxy.ReplayOptions(opts))
+	if err != nil {
+		return ReplayResult{}, err
+	}
+	return ReplayResult{Original: Exchange(result.Original), Replayed: Exchange(result.Replayed), Diff: result.Diff}, nil
+}
+
+// Subscribe returns the lifecycle events of the exposures published from now on, in order.
+// The channel is closed once ctx is cancelled or the Exporter is closed, after the events of the
+// exposures Close stopped
+func (ex *Exporter) Subscribe(ctx context.Context) <-chan Event {
+	events := ex.svc.Subscribe(ctx)
+	converted := make(chan Event)
+	go func() {
+		defer close(converted)
+		for event := range events {
+			select {
+			case converted <- newEvent(event):
+			case <-ctx.Done():
+				// Drain the subscription until the service closes it
+			}
+		}
+	}()
+	return converted
+}
+
+// Close stops the exposures and releases the clients and the audit log, once the stop hooks ran.
+// Hooks still running after a grace period are cancelled
+func (ex *Exporter) Close() error {
+	var errs []error
+	if err := ex.svc.Cleanup(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to cleanup resources: %v", err))
+	}
+	if ex.hooksDone != nil {
+		ex.waitForHooks()
+	}
+	if ex.auditLog != nil {
+		if err := ex.auditLog.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close audit log: %v", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// waitForHooks waits for the pending hooks, cancelling them once they run longer than hooksGrace
+func (ex *Exporter) waitForHooks() {
+	defer ex.cancelHooks()
+
+	select {
+	case <-ex.hooksDone:
+	case <-time.After(hooksGrace):
+		slog.Warn(fmt.Sprintf("⚠️  Hooks still running after %s, cancelling them", hooksGrace))
+		ex.cancelHooks()
+		<-ex.hooksDone
+	}
+}
+
+// Exposure is a service port published by Expose
+type Exposure struct {
+	// ExposureStatus is the status of the exposure when it became ready
+	ExposureStatus
+
+	exporter *Exporter
+}
+
+// Status returns the current status of the exposure, false once it is stopped
+func (e *Exposure) Status() (ExposureStatus, bool) {
+	for _, status := range e.exporter.Exposures() {
+		// Local ports are reused by later exposures
+		if status.LocalPort == e.LocalPort && status.StartedAt.Equal(e.StartedAt) {
+			return status, true
+		}
+	}
+	return ExposureStatus{}, false
+}
+
+// Stop stops the port forwarding and tunnel of the exposure
+func (e *Exposure) Stop() error {
+	if _, ok := e.Status(); !ok {
+		return fmt.Errorf("exposure of %s port %d is already stopped", e.Service, e.ServicePort)
+	}
+	return e.exporter.svc.StopExposure(e.LocalPort)
+}
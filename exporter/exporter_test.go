@@ -0,0 +1,528 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/k8s"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// fakeKube is a cluster of services with the ports of ports, keyed by "namespace/name"
+type fakeKube struct {
+	ports   map[string][]ServicePort
+	secrets map[string]string
+}
+
+func (f *fakeKube) ListServices(ctx context.Context) ([]ServiceInfo, error) {
+	var services []ServiceInfo
+	for key, ports := range f.ports {
+		namespace, name, _ := strings.Cut(key, "/")
+		services = append(services, ServiceInfo{Name: name, Namespace: namespace, Ports: ports})
+	}
+	return services, nil
+}
+
+func (f *fakeKube) WatchServices(ctx context.Context, onChange func(services []ServiceInfo, synced bool)) error {
+	services, _ := f.ListServices(ctx)
+	onChange(services, true)
+	return nil
+}
+
+func (f *fakeKube) GetServicePorts(ctx context.Context, serviceName string, namespace string) ([]ServicePort, error) {
+	ports, ok := f.ports[namespace+"/"+serviceName]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found in namespace %s", serviceName, namespace)
+	}
+	return ports, nil
+}
+
+func (f *fakeKube) GetService(ctx context.Context, serviceName string, namespace string) (ServiceInfo, error) {
+	return ServiceInfo{Name: serviceName, Namespace: namespace}, nil
+}
+
+func (f *fakeKube) ContextName() string {
+	return "test"
+}
+
+func (f *fakeKube) GetSecret(ctx context.Context, namespace string, name string) (map[string][]byte, error) {
+	return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
+}
+
+// PortForward listens on the local port like a port forwarding, so that exposures get their own local ports
+func (f *fakeKube) PortForward(ctx context.Context, serviceName string, namespace string, localPort int, servicePort int32) (service.PortForwardSession, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort("localhost", strconv.Itoa(localPort)))
+	if err != nil {
+		return service.PortForwardSession{}, err
+	}
+
+	done := make(chan error)
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		close(done)
+	}()
+	return service.PortForwardSession{PodName: serviceName + "-pod", Done: done}, nil
+}
+
+func (f *fakeKube) ServerVersion(ctx context.Context) (string, error) {
+	return "v1.34.0", nil
+}
+
+func (f *fakeKube) CanI(ctx context.Context, namespace string, verb string, resource string, subresource string) (bool, string, error) {
+	return true, "", nil
+}
+
+func (f *fakeKube) Close() {}
+
+func (f *fakeKube) ResolveCredential(ctx context.Context, value string) (string, error) {
+	if !k8s.IsSecretRef(value) {
+		return value, nil
+	}
+	credential, ok := f.secrets[value]
+	if !ok {
+		return "", fmt.Errorf("%s not found", value)
+	}
+	return credential, nil
+}
+
+// fakeNgrok records the options of the tunnels it starts
+type fakeNgrok struct {
+	mu   sync.Mutex
+	opts []service.TunnelOptions
+	// connecting, if set, receives the tunnel starts which then connect until ctx is cancelled
+	connecting chan struct{}
+}
+
+func (f *fakeNgrok) StartTunnel(ctx context.Context, port int, opts service.TunnelOptions) (string, error) {
+	f.mu.Lock()
+	f.opts = append(f.opts, opts)
+	connecting := f.connecting
+	f.mu.Unlock()
+
+	if connecting != nil {
+		connecting <- struct{}{}
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return fmt.Sprintf("https://fake%d.ngrok.io", port), nil
+}
+
+func (f *fakeNgrok) CloseTunnel(url string) error { return nil }
+
+func (f *fakeNgrok) Close() error { return nil }
+
+// withClients replaces the clients New creates
+func withClients(kube kubeClient, ngrokClient service.NgrokClient) Option {
+	return func(o *options) {
+		o.kubeClient = kube
+		o.ngrokClient = ngrokClient
+	}
+}
+
+// newTestExporter returns an exporter of a cluster with the api service of namespace staging
+func newTestExporter(t *testing.T, opts ...Option) (*Exporter, *fakeNgrok) {
+	t.Helper()
+
+	kube := &fakeKube{
+		ports: map[string][]ServicePort{
+			"staging/api": {{Name: "http", Port: 80}, {Name: "metrics", Port: 9090}},
+			"staging/db":  {{Name: "postgres", Port: 5432}},
+		},
+		secrets: map[string]string{"secret://staging/auth/password": "s3cret-password"},
+	}
+	ngrokClient := &fakeNgrok{}
+	ex, err := New(context.Background(), append([]Option{withClients(kube, ngrokClient)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New should not return an error: %v", err)
+	}
+	return ex, ngrokClient
+}
+
+func TestNew(t *testing.T) {
+	kube := &fakeKube{secrets: map[string]string{"secret://ci/ngrok/token": " padded "}}
+
+	tests := []struct {
+		name string
+		opts []Option
+		err  string
+	}{
+		{name: "unknown provider", opts: []Option{WithProvider("cloudflare")}, err: `unknown provider "cloudflare"`},
+		{name: "missing token", opts: []Option{}, err: "auth token is required"},
+		{name: "missing token secret", opts: []Option{WithNgrokAuthToken("secret://ci/ngrok/missing")}, err: "failed to read ngrok auth token"},
+		{name: "invalid token secret", opts: []Option{WithNgrokAuthToken("secret://ci/ngrok/token")}, err: "ngrok auth token read from secret://ci/ngrok/token: authtoken has leading or trailing whitespace"},
+		{name: "invalid auth", opts: []Option{WithNgrokAuthToken("token"), WithAuth(TunnelAuth{BasicAuth: "admin:short"})}, err: "invalid authentication"},
+		{name: "invalid hook", opts: []Option{WithNgrokAuthToken("token"), WithHooks(Hook{Name: "empty"})}, err: `hook "empty" needs a command or a webhook`},
+		{name: "token", opts: []Option{WithNgrokAuthToken("token")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex, err := New(context.Background(), append([]Option{func(o *options) { o.kubeClient = kube }}, tt.opts...)...)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("New should not return an error: %v", err)
+				}
+				if ex.KubeContext() != "test" {
+					t.Errorf("Expected kube context test, got %q", ex.KubeContext())
+				}
+				ex.Close()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestExpose(t *testing.T) {
+	ex, ngrokClient := newTestExporter(t, WithAuth(TunnelAuth{BasicAuth: "admin:secret://staging/auth/password"}))
+	events := ex.Subscribe(context.Background())
+
+	exposure, err := ex.Expose(context.Background(), Target{Namespace: "staging", Service: "api", Port: "metrics", TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	if exposure.ServicePort != 9090 || exposure.PodName != "api-pod" || exposure.PublicURL == "" || exposure.ExpiresAt.IsZero() {
+		t.Errorf("Unexpected exposure %+v", exposure.ExposureStatus)
+	}
+	if auth := ngrokClient.opts[0].Auth.BasicAuth; auth != "admin:s3cret-password" {
+		t.Errorf("Expected the basic auth read from the secret, got %q", auth)
+	}
+
+	// The only port is exposed by default, the target's authentication replaces the exporter's
+	envFile := filepath.Join(t.TempDir(), ".env")
+	db, err := ex.Expose(context.Background(), Target{Namespace: "staging", Service: "db", Auth: TunnelAuth{OAuthProvider: "google"}, EnvFile: EnvFile{Path: envFile}})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	if db.ServicePort != 5432 || ngrokClient.opts[1].Auth.BasicAuth != "" || ngrokClient.opts[1].Auth.OAuthProvider != "google" {
+		t.Errorf("Unexpected exposure %+v with auth %+v", db.ExposureStatus, ngrokClient.opts[1].Auth)
+	}
+	if data, _ := os.ReadFile(envFile); !strings.HasPrefix(string(data), "DB_URL="+db.PublicURL+"\n") {
+		t.Errorf("Expected the public URL in the env file, got %s", data)
+	}
+	if len(ex.Exposures()) != 2 {
+		t.Errorf("Expected 2 exposures, got %d", len(ex.Exposures()))
+	}
+
+	if _, ok := exposure.Status(); !ok {
+		t.Error("Expected the exposure to be active")
+	}
+	if err := exposure.Stop(); err != nil {
+		t.Fatalf("Stop should not return an error: %v", err)
+	}
+	if _, ok := exposure.Status(); ok {
+		t.Error("Expected the exposure to be stopped")
+	}
+	if err := exposure.Stop(); err == nil {
+		t.Error("Expected an error stopping a stopped exposure")
+	}
+
+	if err := ex.Close(); err != nil {
+		t.Fatalf("Close should not return an error: %v", err)
+	}
+
+	if _, err := os.Stat(envFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the env file to be removed, got %v", err)
+	}
+
+	var received []EventType
+	for event := range events {
+		if event.Type == EventReady || event.Type == EventStopped {
+			received = append(received, event.Type)
+		}
+	}
+	expected := []EventType{EventReady, EventReady, EventStopped, EventStopped}
+	if fmt.Sprint(received) != fmt.Sprint(expected) {
+		t.Errorf("Expected events %v, got %v", expected, received)
+	}
+}
+
+func TestExpose_Errors(t *testing.T) {
+	ex, _ := newTestExporter(t, WithPolicy(Policy{Rules: []PolicyRule{{Name: "no-db", Action: PolicyDeny, Ports: []string{"5432"}}}}))
+	defer ex.Close()
+
+	tests := []struct {
+		name   string
+		target Target
+		err    string
+	}{
+		{name: "no namespace", target: Target{Service: "api"}, err: "target needs a namespace and a service"},
+		{name: "unknown service", target: Target{Namespace: "staging", Service: "web"}, err: "service web not found"},
+		{name: "no default port", target: Target{Namespace: "staging", Service: "api"}, err: "no default port, choose one of 80 (http), 9090 (metrics)"},
+		{name: "unknown port", target: Target{Namespace: "staging", Service: "api", Port: "8080"}, err: `no port "8080"`},
+		{name: "denied", target: Target{Namespace: "staging", Service: "db"}, err: "no-db"},
+		{name: "invalid auth", target: Target{Namespace: "staging", Service: "api", Port: "80", Auth: TunnelAuth{BasicAuth: "admin"}}, err: "invalid authentication"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ex.Expose(context.Background(), tt.target)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+	if len(ex.Exposures()) != 0 {
+		t.Errorf("Expected no exposures, got %+v", ex.Exposures())
+	}
+}
+
+func TestSelectPort(t *testing.T) {
+	ports := []ServicePort{{Name: "http", Port: 80}, {Name: "metrics", Port: 9090, Default: true}}
+
+	tests := []struct {
+		name     string
+		ports    []ServicePort
+		port     string
+		expected int32
+		err      string
+	}{
+		{name: "by name", ports: ports, port: "http", expected: 80},
+		{name: "by number", ports: ports, port: "9090", expected: 9090},
+		{name: "default port", ports: ports, expected: 9090},
+		{name: "only port", ports: ports[:1], expected: 80},
+		{name: "no default port", ports: []ServicePort{{Port: 80}, {Port: 81}}, err: "no default port, choose one of 80, 81"},
+		{name: "unknown port", ports: ports, port: "grpc", err: `no port "grpc", the ports are 80 (http), 9090 (metrics)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, err := SelectPort(tt.ports, tt.port)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil || port.Port != tt.expected {
+				t.Errorf("Expected port %d, got %+v %v", tt.expected, port, err)
+			}
+		})
+	}
+}
+
+func TestExposureControls(t *testing.T) {
+	ex, ngrokClient := newTestExporter(t)
+	defer ex.Close()
+
+	exposure, err := ex.Expose(context.Background(), Target{Namespace: "staging", Service: "api", Port: "http"})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+
+	url, err := ex.RestartTunnel(context.Background(), exposure.LocalPort)
+	if err != nil || url == "" {
+		t.Fatalf("RestartTunnel should return the new URL, got %q %v", url, err)
+	}
+	ngrokClient.mu.Lock()
+	tunnels := len(ngrokClient.opts)
+	ngrokClient.mu.Unlock()
+	if tunnels != 2 {
+		t.Errorf("Expected the tunnel to be started again, got %d starts", tunnels)
+	}
+
+	if exchanges, err := ex.Requests(exposure.LocalPort); err != nil || len(exchanges) != 0 {
+		t.Errorf("Expected no recorded requests, got %+v %v", exchanges, err)
+	}
+	if _, err := ex.Request(exposure.LocalPort, 1); err == nil {
+		t.Error("Expected an error for a request that was not recorded")
+	}
+
+	if err := ex.StopExposure(exposure.LocalPort); err != nil {
+		t.Fatalf("StopExposure should not return an error: %v", err)
+	}
+	if _, ok := exposure.Status(); ok {
+		t.Error("Expected the exposure to be stopped")
+	}
+}
+
+func TestSubscribe_Cancelled(t *testing.T) {
+	ex, _ := newTestExporter(t)
+	defer ex.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := ex.Subscribe(ctx)
+	if _, err := ex.Expose(context.Background(), Target{Namespace: "staging", Service: "db"}); err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	cancel()
+
+	// The events published before the cancellation may still be received
+	select {
+	case <-drain(events):
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the events channel to be closed once the context is cancelled")
+	}
+}
+
+// drain returns a channel closed once events is closed
+func drain(events <-chan Event) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range events {
+		}
+	}()
+	return done
+}
+
+func TestMarshalHAR(t *testing.T) {
+	data, err := MarshalHAR([]Exchange{{ID: 1, Method: http.MethodGet, URL: "/health", Proto: "HTTP/1.1", Status: http.StatusOK}})
+	if err != nil {
+		t.Fatalf("MarshalHAR should not return an error: %v", err)
+	}
+
+	var har struct {
+		Log struct {
+			Entries []struct {
+				Response struct {
+					Status int `json:"status"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("Expected a JSON archive, got %s: %v", data, err)
+	}
+	if len(har.Log.Entries) != 1 || har.Log.Entries[0].Response.Status != http.StatusOK {
+		t.Errorf("Unexpected archive %s", data)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		triggers []HookTrigger
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload HookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		triggers = append(triggers, payload.Trigger)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	ex, _ := newTestExporter(t, WithHooks(Hook{Webhook: server.URL}))
+	if _, err := ex.Expose(context.Background(), Target{Namespace: "staging", Service: "db"}); err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	if err := ex.Close(); err != nil {
+		t.Fatalf("Close should not return an error: %v", err)
+	}
+
+	// Close waits for the stop hooks
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []HookTrigger{HookStart, HookStop}
+	if fmt.Sprint(triggers) != fmt.Sprint(expected) {
+		t.Errorf("Expected webhooks %v, got %v", expected, triggers)
+	}
+}
+
+func TestHooks_CloseCancelsHungHooks(t *testing.T) {
+	grace := hooksGrace
+	hooksGrace = 50 * time.Millisecond
+	defer func() { hooksGrace = grace }()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ex, _ := newTestExporter(t, WithHooks(Hook{Webhook: server.URL}))
+	if _, err := ex.Expose(context.Background(), Target{Namespace: "staging", Service: "db"}); err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+
+	start := time.Now()
+	if err := ex.Close(); err != nil {
+		t.Fatalf("Close should not return an error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Close to cancel the hung hooks, took %s", elapsed)
+	}
+}
+
+func TestExpose_OutlivesContext(t *testing.T) {
+	ex, _ := newTestExporter(t)
+	defer ex.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exposure, err := ex.Expose(ctx, Target{Namespace: "staging", Service: "db"})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	cancel()
+
+	// ctx only bounds the start, the port forwarding keeps running
+	time.Sleep(50 * time.Millisecond)
+	status, ok := exposure.Status()
+	if !ok || status.Forwarding != ForwardActive {
+		t.Errorf("Expected the exposure to stay active after its context is cancelled, got %+v %v", status, ok)
+	}
+}
+
+func TestExpose_CancelledStart(t *testing.T) {
+	ex, _ := newTestExporter(t)
+	defer ex.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ex.Expose(ctx, Target{Namespace: "staging", Service: "db"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the start to be cancelled, got %v", err)
+	}
+	if exposures := ex.Exposures(); len(exposures) != 0 {
+		t.Errorf("Expected no exposures, got %+v", exposures)
+	}
+}
+
+func TestExpose_CancelledConnect(t *testing.T) {
+	ex, ngrokClient := newTestExporter(t)
+	defer ex.Close()
+	ngrokClient.connecting = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exposed := make(chan error, 1)
+	go func() {
+		_, err := ex.Expose(ctx, Target{Namespace: "staging", Service: "db"})
+		exposed <- err
+	}()
+
+	<-ngrokClient.connecting
+	cancel()
+	select {
+	case err := <-exposed:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the start to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected cancelling the context to abort the tunnel connection")
+	}
+	if exposures := ex.Exposures(); len(exposures) != 0 {
+		t.Errorf("Expected no exposures, got %+v", exposures)
+	}
+}
@@ -0,0 +1,353 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/health"
+	"github.com/Goalt/service-exporter/internal/hooks"
+	"github.com/Goalt/service-exporter/internal/policy"
+	"github.com/Goalt/service-exporter/internal/proxy"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// Services, pre-flight checks, policies and hooks are described by the same types as in the configuration
+// of the service-exporter command
+type (
+	// ServiceInfo describes a Kubernetes service
+	ServiceInfo = service.ServiceInfo
+	// ServicePort is a port of a Kubernetes service
+	ServicePort = service.ServicePort
+	// CheckResult is the result of a single pre-flight check
+	CheckResult = service.CheckResult
+	// CheckStatus is the outcome of a pre-flight check
+	CheckStatus = service.CheckStatus
+	// Policy is the list of rules evaluated before a service port is exposed
+	Policy = policy.Policy
+	// PolicyRule applies its action to the exposures matching all of its conditions
+	PolicyRule = policy.Rule
+	// PolicyAction is what happens when a policy rule matches an exposure
+	PolicyAction = policy.Action
+	// Hook runs a shell command or calls a webhook when exposures start, stop or change their public URL
+	Hook = hooks.Hook
+	// HookTrigger is the exposure transition a hook runs on
+	HookTrigger = hooks.Trigger
+	// HookPayload is the JSON body of webhooks, commands get it as SERVICE_EXPORTER_* environment variables
+	HookPayload = hooks.Payload
+)
+
+// TunnelType is the kind of ngrok endpoint an exposure is published on
+type TunnelType string
+
+const (
+	// TunnelHTTP publishes the exposure on an HTTPS endpoint through the local proxy
+	TunnelHTTP TunnelType = "http"
+	// TunnelTCP publishes the forwarded port as is on a TCP address, without the local proxy's features
+	TunnelTCP TunnelType = "tcp"
+)
+
+// TunnelAuth protects the public URL of a tunnel, at most one method is used
+type TunnelAuth struct {
+	// BasicAuth is the "username:password" callers must send
+	BasicAuth string
+	// OAuthProvider is the ngrok OAuth provider callers must log in with, e.g. google or github
+	OAuthProvider string
+	// OAuthAllowDomains restricts OAuth logins to these email domains
+	OAuthAllowDomains []string
+	// OAuthClientID and OAuthClientSecret are the credentials of your own OAuth application,
+	// ngrok's managed application if empty
+	OAuthClientID     string
+	OAuthClientSecret string
+}
+
+// Enabled reports whether the tunnel requires authentication
+func (a TunnelAuth) Enabled() bool {
+	return service.TunnelAuth(a).Enabled()
+}
+
+// Validate checks that at most one method is set and that basic auth credentials are accepted by ngrok
+func (a TunnelAuth) Validate() error {
+	return service.TunnelAuth(a).Validate()
+}
+
+// String describes the authentication method without credentials
+func (a TunnelAuth) String() string {
+	return service.TunnelAuth(a).String()
+}
+
+// Rules rewrites the HTTP traffic going through the tunnel
+type Rules struct {
+	// Host, if set, replaces the Host header sent to the backend
+	Host string `json:"host,omitempty"`
+	// StripPathPrefix is removed from the start of the request path, on whole path segments
+	StripPathPrefix string `json:"stripPathPrefix,omitempty"`
+	// AddPathPrefix is prepended to the request path, after StripPathPrefix is removed
+	AddPathPrefix string `json:"addPathPrefix,omitempty"`
+	// RequestHeaders modifies the request headers sent to the backend
+	RequestHeaders HeaderRules `json:"requestHeaders,omitempty"`
+	// ResponseHeaders modifies the response headers returned to the caller
+	ResponseHeaders HeaderRules `json:"responseHeaders,omitempty"`
+}
+
+// HeaderRules modifies a set of headers
+type HeaderRules struct {
+	// Set replaces the values of the given headers
+	Set map[string]string `json:"set,omitempty"`
+	// Add appends a value to the given headers
+	Add map[string]string `json:"add,omitempty"`
+	// Remove deletes the given headers
+	Remove []string `json:"remove,omitempty"`
+}
+
+// rules returns the rules of the local proxy
+func (r Rules) rules() proxy.Rules {
+	return proxy.Rules{
+		Host:            r.Host,
+		StripPathPrefix: r.StripPathPrefix,
+		AddPathPrefix:   r.AddPathPrefix,
+		RequestHeaders:  proxy.HeaderRules(r.RequestHeaders),
+		ResponseHeaders: proxy.HeaderRules(r.ResponseHeaders),
+	}
+}
+
+// Limits caps the HTTP traffic accepted through the tunnel
+type Limits struct {
+	// RequestsPerSecond is the sustained request rate, excess requests get 429 Too Many Requests
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+	// Burst is the number of requests accepted at once above the rate, at least the rate rounded up
+	Burst int `json:"burst,omitempty"`
+	// MaxConcurrentRequests caps the requests served at the same time, excess requests get 503 Service Unavailable
+	MaxConcurrentRequests int `json:"maxConcurrentRequests,omitempty"`
+	// MaxRequestBodySize caps request bodies in bytes, larger requests get 413 Request Entity Too Large
+	MaxRequestBodySize int64 `json:"maxRequestBodySize,omitempty"`
+}
+
+// HealthCheck checks the forwarded port, callers get a fallback page while it fails
+type HealthCheck struct {
+	// Type is HealthCheckTCP or HealthCheckHTTP, empty disables the check
+	Type string
+	// Path is requested by HTTP checks
+	Path string
+	// Interval is the pause between two checks
+	Interval time.Duration
+	// Timeout caps the duration of a single check
+	Timeout time.Duration
+}
+
+const (
+	HealthCheckTCP  = health.TypeTCP
+	HealthCheckHTTP = health.TypeHTTP
+)
+
+// Enabled reports whether the check is run
+func (c HealthCheck) Enabled() bool {
+	return health.Config(c).Enabled()
+}
+
+// EnvFile is a dotenv file, or a JSON object with a .json extension, the details of an exposure are written to.
+// The variables are NAME for the public URL, BASE_LOCAL_PORT and BASE_LOCAL_ADDRESS, where BASE is NAME
+// without its _URL suffix; the other lines are kept and the previous values restored once the exposure stops
+type EnvFile struct {
+	Path string
+	// Var is the NAME of the public URL variable, the service name followed by _URL if empty, e.g. API_URL
+	Var string
+}
+
+// ForwardState describes the state of an exposure's port forwarding
+type ForwardState string
+
+const (
+	// ForwardNone is the state of tunnels to a port that is not forwarded by the exporter
+	ForwardNone ForwardState = ForwardState(service.ForwardNone)
+	// ForwardActive is the state of an established port forwarding
+	ForwardActive ForwardState = ForwardState(service.ForwardActive)
+	// ForwardReconnecting is the state of a port forwarding being re-established
+	ForwardReconnecting ForwardState = ForwardState(service.ForwardReconnecting)
+)
+
+// HealthState describes the result of an exposure's health checks
+type HealthState string
+
+const (
+	HealthUnknown   HealthState = HealthState(service.HealthUnknown)
+	HealthHealthy   HealthState = HealthState(service.HealthHealthy)
+	HealthUnhealthy HealthState = HealthState(service.HealthUnhealthy)
+)
+
+// ExposureStatus is a snapshot of an active exposure
+type ExposureStatus struct {
+	Service     string     `json:"service"`
+	ServicePort int32      `json:"servicePort"`
+	LocalPort   int        `json:"localPort"`
+	PodName     string     `json:"podName,omitempty"`
+	PublicURL   string     `json:"publicURL"`
+	TunnelType  TunnelType `json:"tunnelType,omitempty"`
+	// Auth describes the authentication of the public URL, empty if none
+	Auth       string       `json:"auth,omitempty"`
+	Forwarding ForwardState `json:"forwarding"`
+	TunnelUp   bool         `json:"tunnelUp"`
+	Requests   int64        `json:"requests"`
+	BytesIn    int64        `json:"bytesIn"`
+	BytesOut   int64        `json:"bytesOut"`
+	Failures   int64        `json:"failures"`
+	Rejected   int64        `json:"rejected"`
+	Errors     []string     `json:"errors,omitempty"`
+	StartedAt  time.Time    `json:"startedAt"`
+	// ExpiresAt is when the TTL stops the exposure, zero without TTL
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// IdleExpiresAt is when the idle timeout stops the exposure unless a request comes in, zero without idle timeout
+	IdleExpiresAt time.Time `json:"idleExpiresAt,omitzero"`
+	// Warning is set shortly before the exposure expires
+	Warning string `json:"warning,omitempty"`
+	// Health is the result of the health check, empty without health check
+	Health HealthState `json:"health,omitempty"`
+	// HealthError explains why the health check fails
+	HealthError string `json:"healthError,omitempty"`
+	// PolicyWarnings are the explanations of the policy's warn rules matching the exposure
+	PolicyWarnings []string `json:"policyWarnings,omitempty"`
+}
+
+// newExposureStatus returns the status of an exposure of the service
+func newExposureStatus(s service.ExposureStatus) ExposureStatus {
+	return ExposureStatus{
+		Service:        s.Service,
+		ServicePort:    s.ServicePort,
+		LocalPort:      s.LocalPort,
+		PodName:        s.PodName,
+		PublicURL:      s.PublicURL,
+		TunnelType:     TunnelType(s.TunnelType),
+		Auth:           s.Auth,
+		Forwarding:     ForwardState(s.Forwarding),
+		TunnelUp:       s.TunnelUp,
+		Requests:       s.Requests,
+		BytesIn:        s.BytesIn,
+		BytesOut:       s.BytesOut,
+		Failures:       s.Failures,
+		Rejected:       s.Rejected,
+		Errors:         s.Errors,
+		StartedAt:      s.StartedAt,
+		ExpiresAt:      s.ExpiresAt,
+		IdleExpiresAt:  s.IdleExpiresAt,
+		Warning:        s.Warning,
+		Health:         HealthState(s.Health),
+		HealthError:    s.HealthError,
+		PolicyWarnings: s.PolicyWarnings,
+	}
+}
+
+// EventType is the kind of lifecycle transition of an exposure
+type EventType string
+
+const (
+	EventReady            EventType = EventType(service.EventReady)
+	EventDenied           EventType = EventType(service.EventDenied)
+	EventPortForwardReady EventType = EventType(service.EventPortForwardReady)
+	EventPortForwardLost  EventType = EventType(service.EventPortForwardLost)
+	EventPodSwitched      EventType = EventType(service.EventPodSwitched)
+	EventTunnelUp         EventType = EventType(service.EventTunnelUp)
+	EventTunnelDown       EventType = EventType(service.EventTunnelDown)
+	EventHealthChanged    EventType = EventType(service.EventHealthChanged)
+	EventExpired          EventType = EventType(service.EventExpired)
+	EventStopped          EventType = EventType(service.EventStopped)
+)
+
+// Event is a lifecycle transition of an exposure
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Exposure is a snapshot of the exposure after the transition
+	Exposure ExposureStatus `json:"exposure"`
+	// Reason explains the transition, e.g. why the port forwarding was lost or the exposure stopped
+	Reason string `json:"reason,omitempty"`
+	// PreviousURL is the public URL replaced by a tunnel restart
+	PreviousURL string `json:"previousURL,omitempty"`
+}
+
+// newEvent returns an event of the service
+func newEvent(e service.Event) Event {
+	return Event{
+		Type:        EventType(e.Type),
+		Time:        e.Time,
+		Exposure:    newExposureStatus(e.Exposure),
+		Reason:      e.Reason,
+		PreviousURL: e.PreviousURL,
+	}
+}
+
+// Exchange is an HTTP request recorded on its way through the tunnel, with its response
+type Exchange struct {
+	ID        int64         `json:"id"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+
+	Method                string      `json:"method"`
+	URL                   string      `json:"url"`
+	Proto                 string      `json:"proto"`
+	RequestHeaders        http.Header `json:"requestHeaders"`
+	RequestBody           []byte      `json:"requestBody,omitempty"`
+	RequestBodyTruncated  bool        `json:"requestBodyTruncated,omitempty"`
+	RequestSize           int64       `json:"requestSize"`
+	Status                int         `json:"status"`
+	ResponseHeaders       http.Header `json:"responseHeaders"`
+	ResponseBody          []byte      `json:"responseBody,omitempty"`
+	ResponseBodyTruncated bool        `json:"responseBodyTruncated,omitempty"`
+	ResponseSize          int64       `json:"responseSize"`
+
+	// Error is set when the request could not be proxied to the forwarded port
+	Error string `json:"error,omitempty"`
+}
+
+// newExchanges returns the exchanges recorded by the local proxy
+func newExchanges(exchanges []proxy.Exchange) []Exchange {
+	converted := make([]Exchange, len(exchanges))
+	for i, e := range exchanges {
+		converted[i] = Exchange(e)
+	}
+	return converted
+}
+
+// MarshalHAR encodes recorded exchanges as an indented HTTP Archive, the format browsers' developer tools import
+func MarshalHAR(exchanges []Exchange) ([]byte, error) {
+	converted := make([]proxy.Exchange, len(exchanges))
+	for i, e := range exchanges {
+		converted[i] = proxy.Exchange(e)
+	}
+	return json.MarshalIndent(proxy.NewHAR(converted), "", "  ")
+}
+
+// ReplayOptions modifies a recorded request before it is replayed
+type ReplayOptions struct {
+	// SetHeaders replaces the values of the given headers
+	SetHeaders http.Header `json:"setHeaders,omitempty"`
+	// RemoveHeaders removes the given headers
+	RemoveHeaders []string `json:"removeHeaders,omitempty"`
+	// Body, if not nil, replaces the recorded request body
+	Body []byte `json:"body,omitempty"`
+}
+
+// ReplayResult holds a replayed request together with the original one
+type ReplayResult struct {
+	Original Exchange `json:"original"`
+	Replayed Exchange `json:"replayed"`
+	// Diff lists the differences between the original and the replayed response
+	Diff []string `json:"diff,omitempty"`
+}
+
+const (
+	HookStart     = hooks.TriggerStart
+	HookStop      = hooks.TriggerStop
+	HookURLChange = hooks.TriggerURLChange
+)
+
+const (
+	PolicyDeny        = policy.ActionDeny
+	PolicyRequireAuth = policy.ActionRequireAuth
+	PolicyWarn        = policy.ActionWarn
+)
+
+const (
+	CheckPass = service.CheckPass
+	CheckWarn = service.CheckWarn
+	CheckFail = service.CheckFail
+)
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Goalt/service-exporter/exporter"
+)
+
+// Client talks to the control API of a running service-exporter
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	// token authenticates the client, read from the TokenFile of the server
+	token string
+}
+
+// NewClient creates a client for the control API listening on addr, authenticated with the token
+// the server wrote to its TokenFile
+func NewClient(addr string) *Client {
+	var token string
+	if path := TokenFile(addr); path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			token = strings.TrimSpace(string(data))
+		}
+	}
+
+	return &Client{
+		baseURL:    "http://" + addr,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+		token:      token,
+	}
+}
+
+// Exposures returns the active exposures
+func (c *Client) Exposures(ctx context.Context) ([]exporter.ExposureStatus, error) {
+	var exposures []exporter.ExposureStatus
+	err := c.do(ctx, http.MethodGet, "/api/exposures", nil, &exposures)
+	return exposures, err
+}
+
+// Requests returns the requests recorded for the exposure on the given local port
+func (c *Client) Requests(ctx context.Context, localPort int) ([]exporter.Exchange, error) {
+	var exchanges []exporter.Exchange
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/exposures/%d/requests", localPort), nil, &exchanges)
+	return exchanges, err
+}
+
+// Replay replays recorded requests of the exposure on the given local port
+func (c *Client) Replay(ctx context.Context, localPort int, req ReplayRequest) ([]exporter.ReplayResult, error) {
+	var results []exporter.ReplayResult
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/exposures/%d/replay", localPort), req, &results)
+	return results, err
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method string, path string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach control API at %s, is service-exporter running? %w", c.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			return fmt.Errorf("control API returned %s", resp.Status)
+		}
+		return fmt.Errorf("control API: %s", apiErr.Error)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode control API response: %w", err)
+	}
+
+	return nil
+}
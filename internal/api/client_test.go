@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	s := newTestServer()
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+	client.token = s.token
+	return client
+}
+
+func TestClient_Exposures(t *testing.T) {
+	exposures, err := newTestClient(t).Exposures(context.Background())
+	if err != nil {
+		t.Fatalf("Exposures should not return an error: %v", err)
+	}
+
+	if len(exposures) != 1 || exposures[0].LocalPort != 8000 {
+		t.Errorf("Unexpected exposures %+v", exposures)
+	}
+}
+
+func TestClient_Requests(t *testing.T) {
+	client := newTestClient(t)
+
+	exchanges, err := client.Requests(context.Background(), 8000)
+	if err != nil {
+		t.Fatalf("Requests should not return an error: %v", err)
+	}
+	if len(exchanges) != 2 {
+		t.Errorf("Expected 2 requests, got %d", len(exchanges))
+	}
+
+	_, err = client.Requests(context.Background(), 9000)
+	if err == nil || !strings.Contains(err.Error(), "no active tunnel for local port 9000") {
+		t.Errorf("Expected the control API error to be returned, got %v", err)
+	}
+}
+
+func TestClient_Replay(t *testing.T) {
+	req := ReplayRequest{IDs: []int64{1}}
+	req.Body = []byte("edited")
+
+	results, err := newTestClient(t).Replay(context.Background(), 8000, req)
+	if err != nil {
+		t.Fatalf("Replay should not return an error: %v", err)
+	}
+
+	if len(results) != 1 || string(results[0].Replayed.RequestBody) != "edited" {
+		t.Errorf("Unexpected replay results %+v", results)
+	}
+}
+
+func TestClient_Unauthorized(t *testing.T) {
+	client := newTestClient(t)
+	client.token = "guess"
+
+	if _, err := client.Exposures(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid token") {
+		t.Errorf("Expected the token to be rejected, got %v", err)
+	}
+}
+
+func TestClient_Unreachable(t *testing.T) {
+	if _, err := NewClient("127.0.0.1:1").Exposures(context.Background()); err == nil {
+		t.Error("Expected an error when the control API is not running")
+	}
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Goalt/service-exporter/exporter"
+)
+
+// DefaultAddr is the default listen address of the control API
+const DefaultAddr = "127.0.0.1:4041"
+
+// Service is what the control API needs of the exporter running the exposures, implemented by *exporter.Exporter
+type Service interface {
+	Exposures() []exporter.ExposureStatus
+	Requests(localPort int) ([]exporter.Exchange, error)
+	Request(localPort int, id int64) (exporter.Exchange, error)
+	Replay(ctx context.Context, localPort int, id int64, opts exporter.ReplayOptions) (exporter.ReplayResult, error)
+	Subscribe(ctx context.Context) <-chan exporter.Event
+}
+
+// Server is the local control API of a running service-exporter
+type Server struct {
+	addr string
+	svc  Service
+	// token authenticates the clients, it is written to TokenFile while the server runs
+	token string
+}
+
+// New creates a control API server for svc listening on addr, with a new token
+func New(addr string, svc Service) *Server {
+	return &Server{addr: addr, svc: svc, token: rand.Text()}
+}
+
+// TokenFile returns the path of the file holding the token of the control API listening on addr,
+// only readable by the user. Empty if the user configuration directory is unknown
+func TokenFile(addr string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		port = addr
+	}
+	return filepath.Join(dir, "service-exporter", fmt.Sprintf("control-%s.token", port))
+}
+
+// Handler returns the HTTP handler serving the control API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/exposures", s.listExposures)
+	mux.HandleFunc("GET /api/exposures/{port}/requests", s.listRequests)
+	mux.HandleFunc("GET /api/exposures/{port}/requests/{id}", s.getRequest)
+	mux.HandleFunc("POST /api/exposures/{port}/requests/{id}/replay", s.replayRequest)
+	mux.HandleFunc("POST /api/exposures/{port}/replay", s.replayRequests)
+	mux.HandleFunc("GET /api/exposures/{port}/har", s.exportHAR)
+	mux.HandleFunc("GET /api/events", s.streamEvents)
+	return s.guard(mux)
+}
+
+// guard rejects the requests a web page could make: a Host other than localhost or an IP address, sent by
+// a page whose domain was rebound to the loopback address, a missing token, and POST requests without a
+// JSON body, which browsers only send cross-origin after a preflight the API does not answer
+func (s *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowedHost(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("host %q is not allowed, use localhost or 127.0.0.1", r.Host))
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token, send the token of %s as a bearer token", TokenFile(s.addr)))
+			return
+		}
+		if r.Method == http.MethodPost {
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be application/json"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedHost reports whether the Host header names the local machine by localhost or an IP address,
+// a DNS name could have been rebound to the loopback address
+func allowedHost(host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.Trim(host, "[]")
+
+	return strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil
+}
+
+// writeToken writes the token to its file, for the commands talking to the control API
+func (s *Server) writeToken(path string) error {
+	if path == "" {
+		return fmt.Errorf("no user configuration directory")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(s.token+"\n"), 0o600)
+}
+
+// Run serves the control API until ctx is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+
+	server := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Cancelling ctx ends the event streams, which would otherwise hold up the shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	tokenFile := TokenFile(listener.Addr().String())
+	if err := s.writeToken(tokenFile); err != nil {
+		slog.Warn("⚠️  Failed to write the control API token, the status and replay commands cannot authenticate", "error", err)
+	} else {
+		defer os.Remove(tokenFile)
+	}
+
+	log.Printf("🛠️  Control API listening on http://%s/api/exposures, token in %s\n", listener.Addr(), tokenFile)
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("control API stopped: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) listExposures(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.svc.Exposures())
+}
+
+func (s *Server) listRequests(w http.ResponseWriter, r *http.Request) {
+	port, ok := pathPort(w, r)
+	if !ok {
+		return
+	}
+
+	exchanges, err := s.svc.Requests(port)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, exchanges)
+}
+
+func (s *Server) getRequest(w http.ResponseWriter, r *http.Request) {
+	port, ok := pathPort(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request id %q", r.PathValue("id")))
+		return
+	}
+
+	exchange, err := s.svc.Request(port, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, exchange)
+}
+
+// ReplayRequest is the body of a replay call
+type ReplayRequest struct {
+	// IDs are the recorded requests to replay, in order
+	IDs []int64 `json:"ids,omitempty"`
+	exporter.ReplayOptions
+}
+
+func (s *Server) replayRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request id %q", r.PathValue("id")))
+		return
+	}
+
+	s.replay(w, r, []int64{id})
+}
+
+func (s *Server) replayRequests(w http.ResponseWriter, r *http.Request) {
+	s.replay(w, r, nil)
+}
+
+// replay replays the given requests, or those listed in the request body, and writes the results
+func (s *Server) replay(w http.ResponseWriter, r *http.Request, ids []int64) {
+	port, ok := pathPort(w, r)
+	if !ok {
+		return
+	}
+
+	var req ReplayRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid replay request: %w", err))
+			return
+		}
+	}
+	if ids == nil {
+		ids = req.IDs
+	}
+	if len(ids) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("no request ids to replay"))
+		return
+	}
+
+	results := make([]exporter.ReplayResult, 0, len(ids))
+	for _, id := range ids {
+		result, err := s.svc.Replay(r.Context(), port, id, req.ReplayOptions)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		results = append(results, result)
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) exportHAR(w http.ResponseWriter, r *http.Request) {
+	port, ok := pathPort(w, r)
+	if !ok {
+		return
+	}
+
+	exchanges, err := s.svc.Requests(port)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	data, err := exporter.MarshalHAR(exchanges)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("service-exporter-%d.har", port)))
+	if _, err := w.Write(data); err != nil {
+		slog.Error("Error writing control API response", "error", err)
+	}
+}
+
+// streamEvents writes the lifecycle events of exposures as JSON lines as they happen, until the client disconnects
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	events := s.svc.Subscribe(r.Context())
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	encoder := json.NewEncoder(w)
+	for event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return
+		}
+		rc.Flush()
+	}
+}
+
+// pathPort parses the local port path parameter, writing an error response if invalid
+func pathPort(w http.ResponseWriter, r *http.Request) (int, bool) {
+	port, err := strconv.Atoi(r.PathValue("port"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid port %q", r.PathValue("port")))
+		return 0, false
+	}
+
+	return port, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		slog.Error("Error writing control API response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
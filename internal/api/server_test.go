@@ -0,0 +1,238 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Goalt/service-exporter/exporter"
+	"github.com/Goalt/service-exporter/internal/proxy"
+)
+
+// fakeService implements the control API's Service
+type fakeService struct {
+	Service
+	exposures []exporter.ExposureStatus
+	exchanges map[int][]exporter.Exchange
+}
+
+func (f *fakeService) Exposures() []exporter.ExposureStatus {
+	return f.exposures
+}
+
+func (f *fakeService) Requests(localPort int) ([]exporter.Exchange, error) {
+	exchanges, ok := f.exchanges[localPort]
+	if !ok {
+		return nil, fmt.Errorf("no active tunnel for local port %d", localPort)
+	}
+	return exchanges, nil
+}
+
+func (f *fakeService) Request(localPort int, id int64) (exporter.Exchange, error) {
+	for _, e := range f.exchanges[localPort] {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return exporter.Exchange{}, fmt.Errorf("request %d not found", id)
+}
+
+func (f *fakeService) Replay(ctx context.Context, localPort int, id int64, opts exporter.ReplayOptions) (exporter.ReplayResult, error) {
+	original, err := f.Request(localPort, id)
+	if err != nil {
+		return exporter.ReplayResult{}, err
+	}
+	replayed := original
+	replayed.RequestBody = opts.Body
+	return exporter.ReplayResult{Original: original, Replayed: replayed}, nil
+}
+
+func newTestServer() *Server {
+	return New(DefaultAddr, &fakeService{
+		exposures: []exporter.ExposureStatus{{Service: "api (ns: default)", LocalPort: 8000, PublicURL: "https://api.ngrok.io"}},
+		exchanges: map[int][]exporter.Exchange{
+			8000: {
+				{ID: 1, Method: "POST", URL: "https://api.ngrok.io/hook", Status: 200},
+				{ID: 2, Method: "POST", URL: "https://api.ngrok.io/hook", Status: 500},
+			},
+		},
+	})
+}
+
+// newRequest returns a request to the control API as its clients send it
+func newRequest(s *Server, method string, path string, body string) *http.Request {
+	r := httptest.NewRequest(method, "http://"+DefaultAddr+path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+s.token)
+	if method == http.MethodPost {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	return r
+}
+
+func get(t *testing.T, s *Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, newRequest(s, http.MethodGet, path, ""))
+	return rec
+}
+
+func TestListExposures(t *testing.T) {
+	rec := get(t, newTestServer(), "/api/exposures")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var exposures []exporter.ExposureStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &exposures); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(exposures) != 1 || exposures[0].PublicURL != "https://api.ngrok.io" {
+		t.Errorf("Unexpected exposures %+v", exposures)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	s := newTestServer()
+
+	tests := []struct {
+		name   string
+		modify func(r *http.Request)
+		status int
+	}{
+		{name: "localhost", modify: func(r *http.Request) { r.Host = "localhost:4041" }, status: http.StatusOK},
+		{name: "ipv6 loopback", modify: func(r *http.Request) { r.Host = "[::1]:4041" }, status: http.StatusOK},
+		{name: "rebound domain", modify: func(r *http.Request) { r.Host = "attacker.example.com:4041" }, status: http.StatusForbidden},
+		{name: "no token", modify: func(r *http.Request) { r.Header.Del("Authorization") }, status: http.StatusUnauthorized},
+		{name: "wrong token", modify: func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, status: http.StatusUnauthorized},
+		{name: "form post", modify: func(r *http.Request) { r.Header.Set("Content-Type", "text/plain") }, status: http.StatusUnsupportedMediaType},
+		{name: "json post", modify: func(r *http.Request) { r.Header.Set("Content-Type", "application/json; charset=utf-8") }, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest(s, http.MethodPost, "/api/exposures/8000/requests/1/replay", "")
+			tt.modify(r)
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, r)
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequests(t *testing.T) {
+	s := newTestServer()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/exposures/8000/requests", http.StatusOK},
+		{"/api/exposures/8000/requests/1", http.StatusOK},
+		{"/api/exposures/8000/requests/3", http.StatusNotFound},
+		{"/api/exposures/8000/requests/abc", http.StatusBadRequest},
+		{"/api/exposures/9000/requests", http.StatusNotFound},
+		{"/api/exposures/port/requests", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		if rec := get(t, s, tt.path); rec.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestExportHAR(t *testing.T) {
+	rec := get(t, newTestServer(), "/api/exposures/8000/har")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var har proxy.HAR
+	if err := json.Unmarshal(rec.Body.Bytes(), &har); err != nil {
+		t.Fatalf("Failed to decode HAR: %v", err)
+	}
+
+	if len(har.Log.Entries) != 2 || har.Log.Entries[0].Request.URL != "https://api.ngrok.io/hook" {
+		t.Errorf("Unexpected HAR entries %+v", har.Log.Entries)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s := newTestServer()
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+		count  int
+	}{
+		{"/api/exposures/8000/requests/1/replay", "", http.StatusOK, 1},
+		{"/api/exposures/8000/requests/2/replay", `{"body":"ZWRpdGVk"}`, http.StatusOK, 1},
+		{"/api/exposures/8000/replay", `{"ids":[2,1]}`, http.StatusOK, 2},
+		{"/api/exposures/8000/replay", "", http.StatusBadRequest, 0},
+		{"/api/exposures/8000/replay", "{", http.StatusBadRequest, 0},
+		{"/api/exposures/8000/requests/3/replay", "", http.StatusBadGateway, 0},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, newRequest(s, http.MethodPost, tt.path, tt.body))
+		if rec.Code != tt.status {
+			t.Errorf("POST %s %s = %d, want %d", tt.path, tt.body, rec.Code, tt.status)
+			continue
+		}
+
+		if tt.status != http.StatusOK {
+			continue
+		}
+
+		var results []exporter.ReplayResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(results) != tt.count {
+			t.Errorf("POST %s %s returned %d results, want %d", tt.path, tt.body, len(results), tt.count)
+		}
+	}
+}
+
+// eventService publishes events to a single subscriber
+type eventService struct {
+	fakeService
+	events chan exporter.Event
+}
+
+func (f *eventService) Subscribe(ctx context.Context) <-chan exporter.Event {
+	return f.events
+}
+
+func TestStreamEvents(t *testing.T) {
+	svc := &eventService{events: make(chan exporter.Event, 2)}
+	svc.events <- exporter.Event{Type: exporter.EventReady, Exposure: exporter.ExposureStatus{Service: "api (ns: default)", LocalPort: 8000}}
+	svc.events <- exporter.Event{Type: exporter.EventStopped, Reason: "shutdown"}
+	close(svc.events)
+
+	rec := get(t, New(DefaultAddr, svc), "/api/events")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Expected a stream of JSON lines, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected an event per line, got:\n%s", rec.Body.String())
+	}
+	var event exporter.Event
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if event.Type != exporter.EventStopped || event.Reason != "shutdown" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Goalt/service-exporter/internal/ngrok"
+)
+
+// applyAgentEndpoint fills the tunnel settings not set with flags from the NgrokEndpoint of the ngrok agent config
+func (c Config) applyAgentEndpoint() (Config, error) {
+	if c.Agent.Path == "" {
+		return Config{}, fmt.Errorf("--ngrok-endpoint needs an ngrok agent config, none found in NGROK_CONFIG or %s", strings.Join(ngrok.AgentConfigPaths(), ", "))
+	}
+
+	endpoint, err := c.Agent.Endpoint(c.NgrokEndpoint)
+	if err != nil {
+		return Config{}, err
+	}
+
+	c.TunnelType = cmp.Or(c.TunnelType, endpoint.TunnelType)
+	c.Domain = cmp.Or(c.Domain, endpoint.Domain)
+	if !c.Auth.Enabled() {
+		c.Auth = endpoint.Auth
+	}
+	c.TrafficPolicy = endpoint.TrafficPolicy
+
+	log.Printf("🔗 Using ngrok endpoint %q of %s\n", endpoint.Name, c.Agent.Path)
+	return c, nil
+}
+
+// savedToken returns the token saved with login, or else the authtoken of the ngrok agent config, empty if there is none
+func (c Config) savedToken() (string, error) {
+	token, err := storedToken()
+	if err != nil || token != "" {
+		return token, err
+	}
+
+	if c.Agent.AuthToken != "" {
+		log.Printf("🔑 Using the ngrok auth token of the ngrok agent config %s\n", c.Agent.Path)
+	}
+	return c.Agent.AuthToken, nil
+}
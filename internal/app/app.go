@@ -2,22 +2,36 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/Goalt/service-exporter/internal/k8s"
-	"github.com/Goalt/service-exporter/internal/ngrok"
+	"github.com/Goalt/service-exporter/exporter"
+	"github.com/Goalt/service-exporter/internal/api"
 	"github.com/Goalt/service-exporter/internal/prompt"
+	"github.com/Goalt/service-exporter/internal/proxy"
+	"github.com/Goalt/service-exporter/internal/recents"
 	"github.com/Goalt/service-exporter/internal/service"
+	"github.com/Goalt/service-exporter/internal/tui"
 )
 
 type App struct {
-	config Config
-	svc    service.Service
+	config   Config
+	exporter *exporter.Exporter
+
+	// kubeContext is the kube context the favorites and recent exposures are kept for
+	kubeContext string
+	recents     *recents.Store
 }
 
-func New() *App {
-	return &App{}
+func New(config Config) *App {
+	return &App{config: config}
 }
 
 func (a *App) LoadConfig() error {
@@ -25,7 +39,7 @@ func (a *App) LoadConfig() error {
 	log.Println("================================================================")
 
 	// Load configuration from prompts or environment variables
-	config, err := loadConfig()
+	config, err := loadConfig(a.config)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %v", err)
 	}
@@ -35,84 +49,380 @@ func (a *App) LoadConfig() error {
 }
 
 func (a *App) Run(ctx context.Context) error {
-	// create Kubernetes client with kubeconfig path
-	k8sClient, err := k8s.New(a.config.KubeconfigPath)
-	if err != nil {
-		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	if err := a.start(ctx); err != nil {
+		return err
+	}
+
+	if err := a.expose(ctx); err != nil {
+		return err
+	}
+
+	// Replace the static output with the dashboard when running in a terminal
+	if tui.IsTerminal() {
+		dashboard := tui.New(a.exporter, a.expose)
+		if a.recents != nil {
+			dashboard.SetFavorite(a.toggleFavorite)
+		}
+		return dashboard.Run(ctx)
+	}
+
+	log.Println("\n📌 Press Ctrl+C to gracefully shutdown and cleanup resources...")
+
+	<-ctx.Done()
+
+	return nil
+}
+
+// start runs the pre-flight checks, creates the exporter and starts the control API
+func (a *App) start(ctx context.Context) error {
+	if !a.config.NoPreflight {
+		if err := preflight(a.config); err != nil {
+			return err
+		}
 	}
 
 	log.Println("🔑 Found ngrok auth token, creating ngrok client")
-	ngrokClient, err := ngrok.NewClient(a.config.NgrokAuthToken)
+	opts := []exporter.Option{
+		exporter.WithKubeconfig(a.config.KubeconfigPath),
+		exporter.WithKubeContext(a.config.KubeContext),
+		exporter.WithNgrokAuthToken(a.config.NgrokAuthToken),
+		exporter.WithAuth(exporter.TunnelAuth(a.config.Auth)),
+		exporter.WithPolicy(a.config.Policy),
+		exporter.WithAuditLog(a.config.AuditLog),
+		exporter.WithHooks(a.config.hooks()...),
+	}
+	ex, err := exporter.New(ctx, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to create ngrok client: %v", err)
+		return err
 	}
+	a.exporter = ex
+	a.kubeContext = ex.KubeContext()
 
-	a.svc = service.NewService(k8sClient, ngrokClient)
+	if a.config.hasSecretRefs() {
+		log.Println("🔐 Read credentials from Kubernetes Secrets")
+	}
+	if len(a.config.Policy.Rules) > 0 {
+		log.Printf("🛡️  Enforcing %d policy rules\n", len(a.config.Policy.Rules))
+	}
+	if a.config.AuditLog != "" {
+		log.Printf("📜 Recording exposures in audit log %s\n", a.config.AuditLog)
+	}
+	if hooks := a.config.hooks(); len(hooks) > 0 {
+		log.Printf("🪝 Running %d hooks on exposure events\n", len(hooks))
+	}
+
+	// Favorites and recent exposures are a convenience, the picker works without them
+	if a.recents, err = recents.Open(recents.DefaultPath()); err != nil {
+		slog.Warn("⚠️  Ignoring favorites and recent exposures", "error", err)
+	}
 
-	// Step 1: Get list of Kubernetes services
+	if a.config.ControlAddr != "" {
+		go func() {
+			if err := api.New(a.config.ControlAddr, a.exporter).Run(ctx); err != nil {
+				slog.Warn("⚠️  Control API stopped", "error", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// expose interactively selects a service port and exposes it
+func (a *App) expose(ctx context.Context) error {
+	// Step 1: Watch the Kubernetes services, the picker updates as they are listed and change
 	log.Println("\n📋 Fetching available Kubernetes services...")
-	k8sServices, err := a.svc.GetServices(ctx)
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+
+	var (
+		mu       sync.Mutex
+		services []service.ServiceInfo
+		synced   bool
+	)
+	changed := make(chan struct{}, 1)
+	err := a.exporter.WatchServices(watchCtx, func(latest []service.ServiceInfo, listed bool) {
+		mu.Lock()
+		services, synced = latest, listed
+		mu.Unlock()
+
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
 	if err != nil {
 		return fmt.Errorf("failed to get services: %v", err)
 	}
 
+	list := func() prompt.ServiceList {
+		mu.Lock()
+		defer mu.Unlock()
+		return a.serviceList(services, synced)
+	}
+
 	// Step 2: User selects a service
-	selectedK8SService, err := prompt.ServiceSelectPrompt(k8sServices)
+	selection, err := prompt.ServiceSelectPrompt(list, changed)
+	stopWatching()
 	if err != nil {
 		return fmt.Errorf("service selection failed: %v", err)
 	}
+	selected := selection.Service
+	selectedK8SService := selected.String()
 
 	log.Printf("\n✅ Selected service: %s\n", selectedK8SService)
+	for _, warning := range selected.Warnings {
+		slog.Warn("⚠️  Ignoring annotation " + warning)
+	}
+
+	if !a.config.NoPreflight {
+		if err := checkResults(a.exporter.Preflight(ctx, selected.Namespace)); err != nil {
+			return err
+		}
+	}
 
 	// Step 3: Get available ports for the selected service
 	log.Println("\n📋 Fetching available ports for the selected service...")
-	servicePorts, err := a.svc.GetServicePorts(ctx, selectedK8SService)
+	servicePorts, err := a.exporter.Ports(ctx, selected.Namespace, selected.Name)
 	if err != nil {
 		return fmt.Errorf("failed to get service ports: %v", err)
 	}
 
-	// Step 4: User selects a port to forward
-	selectedPort, err := prompt.PortSelectPrompt(servicePorts)
-	if err != nil {
-		return fmt.Errorf("port selection failed: %v", err)
+	// Step 4: User selects the ports to forward, unless a shortcut already names one
+	var selectedPorts []prompt.SelectedPort
+	if selection.Shortcut != nil {
+		i := slices.IndexFunc(servicePorts, func(p service.ServicePort) bool { return p.Port == selection.Shortcut.Port })
+		if i == -1 {
+			return fmt.Errorf("service %s no longer has port %d", selectedK8SService, selection.Shortcut.Port)
+		}
+		selectedPorts = []prompt.SelectedPort{{ServicePort: servicePorts[i], TunnelType: explicitTunnelType(a.config, selected)}}
+	} else {
+		selectedPorts, err = prompt.PortsSelectPrompt(servicePorts, explicitTunnelType(a.config, selected))
+		if err != nil {
+			return fmt.Errorf("port selection failed: %v", err)
+		}
 	}
 
-	log.Printf("\n✅ Selected port: %d (%s)\n", selectedPort.Port, selectedPort.Name)
+	for _, port := range selectedPorts {
+		log.Printf("\n✅ Selected port: %d (%s)\n", port.Port, port.Name)
+	}
+	if a.config.Domain != "" && len(selectedPorts) > 1 {
+		return fmt.Errorf("domain %s can only be used by one port, select a single port or leave the domain out", a.config.Domain)
+	}
+	if a.config.EnvVar != "" && len(selectedPorts) > 1 {
+		return fmt.Errorf("variable %s can only hold the URL of one port, select a single port or leave --env-var out", a.config.EnvVar)
+	}
 
-	// Step 5: Start port forwarding
-	port, err := a.svc.StartPortForwarding(ctx, selectedK8SService, selectedPort.Port)
+	// Step 5: Start port forwarding and create an ngrok session for every port
+	rules := a.config.rulesFor(selectedK8SService)
+	limits := a.config.limitsFor(selectedK8SService)
+	healthCheck := a.config.healthCheckFor(selectedK8SService)
+	fallbackPage, err := a.config.fallbackPageFor(selectedK8SService)
 	if err != nil {
-		return fmt.Errorf("failed to start port forwarding: %v", err)
+		return err
 	}
 
-	// Step 6: Create ngrok session
-	ngrokURL, err := a.svc.CreateNgrokSession(ctx, port)
-	if err != nil {
-		return fmt.Errorf("failed to create ngrok session: %v", err)
+	var exposures []exporter.ExposureStatus
+	var errs []error
+	for _, port := range selectedPorts {
+		exposure, err := a.exporter.Expose(ctx, a.target(selected.Namespace, selected.Name, port.ServicePort, port.TunnelType, fallbackPage, len(selectedPorts) > 1))
+		if err != nil {
+			// The other ports are still exposed
+			errs = append(errs, fmt.Errorf("port %d: %w", port.Port, err))
+			continue
+		}
+		exposures = append(exposures, exposure.ExposureStatus)
+
+		if a.recents != nil {
+			entry := recents.Entry{Namespace: selected.Namespace, Service: selected.Name, Port: port.Port, PortName: port.Name}
+			if err := a.recents.Use(a.kubeContext, entry); err != nil {
+				slog.Warn("⚠️  Failed to record recent exposure", "error", err)
+			}
+		}
+	}
+	if len(exposures) == 0 {
+		return fmt.Errorf("failed to expose service: %v", errors.Join(errs...))
 	}
 
 	// Display final result
 	log.Println("\n🎉 Setup complete!")
 	log.Println("==================")
 	log.Printf("Service: %s\n", selectedK8SService)
-	portName := selectedPort.Name
-	if portName == "" {
-		portName = "unnamed"
-	}
-	log.Printf("Selected Port: %d (%s)\n", selectedPort.Port, portName)
-	log.Printf("Local Port: %d\n", port)
-	log.Printf("Public URL: %s\n", ngrokURL)
-	log.Println("\nYou can now access your service via the public URL above!")
-	log.Println("\n📌 Press Ctrl+C to gracefully shutdown and cleanup resources...")
-
-	<-ctx.Done()
+	for _, exposure := range exposures {
+		i := slices.IndexFunc(selectedPorts, func(p prompt.SelectedPort) bool { return p.Port == exposure.ServicePort })
+		portName := selectedPorts[i].Name
+		if portName == "" {
+			portName = "unnamed"
+		}
+		if len(exposures) > 1 {
+			log.Println()
+		}
+		log.Printf("Selected Port: %d (%s)\n", exposure.ServicePort, portName)
+		log.Printf("Local Port: %d\n", exposure.LocalPort)
+		log.Printf("Public URL: %s\n", exposure.PublicURL)
+		log.Printf("Tunnel Type: %s\n", exposure.TunnelType)
+		if exposure.Auth != "none" {
+			log.Printf("Authentication: %s\n", exposure.Auth)
+		}
+		if !exposure.ExpiresAt.IsZero() {
+			log.Printf("Expires At: %s\n", exposure.ExpiresAt.Format(time.DateTime))
+		}
+		for _, warning := range exposure.PolicyWarnings {
+			slog.Warn("⚠️  Policy warning: " + warning)
+		}
+	}
+	if len(exposures) > 1 {
+		log.Println()
+	}
+	if !rules.IsZero() {
+		log.Printf("Rewrite Rules: %s\n", rules)
+	}
+	if !limits.IsZero() {
+		log.Printf("Limits: %s\n", limits)
+	}
+	if a.config.IdleTimeout > 0 {
+		log.Printf("Idle Timeout: %s\n", a.config.IdleTimeout)
+	}
+	if healthCheck.Enabled() {
+		log.Printf("Health Check: %s\n", healthCheck)
+	}
+	if a.config.NgrokEndpoint != "" {
+		log.Printf("ngrok Endpoint: %s\n", a.config.NgrokEndpoint)
+	}
+	for _, err := range errs {
+		slog.Error("❌ Failed to expose", "error", err)
+	}
+	if len(exposures) > 1 {
+		log.Println("\nYou can now access your service via the public URLs above!")
+	} else {
+		log.Println("\nYou can now access your service via the public URL above!")
+	}
 
 	return nil
 }
 
+// target returns the target exposing a port of a service on tunnelType, the service's default if empty, one of several
+// if several, with the configured settings; the authentication is the exporter's
+func (a *App) target(namespace string, name string, port service.ServicePort, tunnelType service.TunnelType, fallbackPage []byte, several bool) exporter.Target {
+	serviceName := service.ServiceInfo{Name: name, Namespace: namespace}.String()
+	return exporter.Target{
+		Namespace: namespace,
+		Service:   name,
+		Port:      strconv.Itoa(int(port.Port)),
+
+		TunnelType:    exporter.TunnelType(tunnelType),
+		Domain:        a.config.Domain,
+		TrafficPolicy: a.config.TrafficPolicy,
+
+		TTL:         a.config.TTL,
+		IdleTimeout: a.config.IdleTimeout,
+		WarnBefore:  a.config.WarnBefore,
+
+		HealthCheck:  exporter.HealthCheck(a.config.healthCheckFor(serviceName)),
+		FallbackPage: fallbackPage,
+		Rules:        exporterRules(a.config.rulesFor(serviceName)),
+		Limits:       exporter.Limits(a.config.limitsFor(serviceName)),
+		EnvFile:      exporter.EnvFile(a.config.envFile(name, port, several)),
+	}
+}
+
+// exporterRules returns the rewrite rules of the configuration as the exporter's
+func exporterRules(rules proxy.Rules) exporter.Rules {
+	return exporter.Rules{
+		Host:            rules.Host,
+		StripPathPrefix: rules.StripPathPrefix,
+		AddPathPrefix:   rules.AddPathPrefix,
+		RequestHeaders:  exporter.HeaderRules(rules.RequestHeaders),
+		ResponseHeaders: exporter.HeaderRules(rules.ResponseHeaders),
+	}
+}
+
+// serviceList returns the content of the service picker. It hides the services whose owners opted out
+// of exposure and those outside the configured namespaces
+func (a *App) serviceList(services []service.ServiceInfo, synced bool) prompt.ServiceList {
+	visible, optedOut := visibleServices(services, a.config.Namespaces)
+
+	var status []string
+	if optedOut > 0 {
+		status = append(status, fmt.Sprintf("🙈 Hiding %d services whose owners opted out with the %s annotation", optedOut, service.AnnotationExpose))
+	}
+	if len(a.config.Namespaces) > 0 {
+		status = append(status, fmt.Sprintf("🔎 Showing the services of namespaces %s", strings.Join(a.config.Namespaces, ", ")))
+	}
+
+	return prompt.ServiceList{
+		Services:  visible,
+		Shortcuts: a.shortcuts(visible, synced),
+		Loading:   !synced,
+		Status:    strings.Join(status, " · "),
+	}
+}
+
+// visibleServices returns the services whose owners did not opt out of exposure, of namespaces if not empty,
+// and how many services were hidden because their owners opted out
+func visibleServices(services []service.ServiceInfo, namespaces []string) ([]service.ServiceInfo, int) {
+	visible := []service.ServiceInfo{}
+	optedOut := 0
+	for _, info := range services {
+		switch {
+		case info.OptOut:
+			optedOut++
+		case len(namespaces) == 0 || slices.Contains(namespaces, info.Namespace):
+			visible = append(visible, info)
+		}
+	}
+	return visible, optedOut
+}
+
+// shortcuts returns the favorites and recent exposures of the kube context whose service is still listed.
+// Until every service is listed, the ones not listed yet are kept so that the last exposure can be repeated at once
+func (a *App) shortcuts(services []service.ServiceInfo, synced bool) []prompt.Shortcut {
+	if a.recents == nil {
+		return nil
+	}
+
+	var shortcuts []prompt.Shortcut
+	for _, pick := range a.recents.Picks(a.kubeContext) {
+		if len(a.config.Namespaces) > 0 && !slices.Contains(a.config.Namespaces, pick.Namespace) {
+			continue
+		}
+
+		i := slices.IndexFunc(services, func(info service.ServiceInfo) bool {
+			return info.Namespace == pick.Namespace && info.Name == pick.Service
+		})
+		switch {
+		case i != -1:
+			shortcuts = append(shortcuts, prompt.Shortcut{Pick: pick, Service: services[i]})
+		case !synced:
+			stub := service.ServiceInfo{Name: pick.Service, Namespace: pick.Namespace, ReadyEndpoints: -1}
+			shortcuts = append(shortcuts, prompt.Shortcut{Pick: pick, Service: stub})
+		}
+	}
+	return shortcuts
+}
+
+// toggleFavorite stars or unstars the service port of an exposure in the kube context
+func (a *App) toggleFavorite(exposure exporter.ExposureStatus) (bool, error) {
+	name, namespace, err := service.ParseServiceName(exposure.Service)
+	if err != nil {
+		return false, err
+	}
+
+	entry := recents.Entry{Namespace: namespace, Service: name, Port: exposure.ServicePort}
+	for _, recent := range a.recents.Recents(a.kubeContext) {
+		if recent.Namespace == namespace && recent.Service == name && recent.Port == exposure.ServicePort {
+			entry.PortName = recent.PortName
+		}
+	}
+	return a.recents.ToggleFavorite(a.kubeContext, entry)
+}
+
 func (a *App) Cleanup() error {
-	if err := a.svc.Cleanup(); err != nil {
-		return fmt.Errorf("failed to cleanup resources: %v", err)
+	if a.exporter == nil {
+		return nil
+	}
+
+	if err := a.exporter.Close(); err != nil {
+		return err
 	}
 
 	log.Println("\n👋 Goodbye!")
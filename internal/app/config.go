@@ -1,55 +1,313 @@
 package app
 
 import (
+	"cmp"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"time"
 
+	"github.com/Goalt/service-exporter/internal/api"
+	"github.com/Goalt/service-exporter/internal/audit"
+	"github.com/Goalt/service-exporter/internal/health"
+	"github.com/Goalt/service-exporter/internal/hooks"
+	"github.com/Goalt/service-exporter/internal/logging"
+	"github.com/Goalt/service-exporter/internal/ngrok"
+	"github.com/Goalt/service-exporter/internal/policy"
 	"github.com/Goalt/service-exporter/internal/prompt"
+	"github.com/Goalt/service-exporter/internal/proxy"
+	"github.com/Goalt/service-exporter/internal/service"
 )
 
 // Config holds all environment configuration
 type Config struct {
 	NgrokAuthToken string
 	KubeconfigPath string
+	// KubeContext is the kubeconfig context used, the current context if empty
+	KubeContext string
+	// Namespaces limits the listed services to these namespaces, all namespaces if empty
+	Namespaces []string
+	// Provider is the tunnel provider, only ngrok is supported
+	Provider string
+	// Profile names the profile of the configuration files applied, see Resolve
+	Profile string
+	// NonInteractive reads the configuration from the environment and files without prompting
+	NonInteractive bool
+
+	// ControlAddr is the listen address of the local control API, empty disables it
+	ControlAddr string
+
+	// ConfigFile is the path of the YAML configuration file, empty uses the default location
+	ConfigFile string
+	// TrustProjectConfig applies the settings of the project configuration file ignored otherwise, see FileConfig.untrusted
+	TrustProjectConfig bool
+	// Rules rewrites the traffic of every exposure, on top of the configuration file rules
+	Rules proxy.Rules
+	// Limits caps the traffic of every exposure, overriding the configuration file limits
+	Limits proxy.Limits
+	// TTL, IdleTimeout and WarnBefore stop exposures after a while, see service.ExposeRequest
+	TTL         time.Duration
+	IdleTimeout time.Duration
+	WarnBefore  time.Duration
+	// HealthCheck is run against the forwarded port, replacing the configuration file check
+	HealthCheck health.Config
+	// FallbackPage is the path of the HTML page served while the health check fails
+	FallbackPage string
+	// NoPreflight skips the pre-flight checks
+	NoPreflight bool
+	// PolicyFile is the path of the policy file, empty uses the default location
+	PolicyFile string
+	// Policy is evaluated before a service port is exposed
+	Policy policy.Policy
+	// Auth protects the public URL of every exposure
+	Auth service.TunnelAuth
+	// TunnelType and Domain configure the tunnel of every exposure, the service's annotations if empty
+	TunnelType service.TunnelType
+	Domain     string
+	// AuditLog is the path of the audit log, empty disables it
+	AuditLog string
+	// WriteEnv is the dotenv or JSON file the public URL, local port and address are written to, empty disables it
+	WriteEnv string
+	// EnvVar names the public URL variable of WriteEnv, derived from the service name if empty
+	EnvVar string
+	// Hooks run on exposure events, after the configuration file hooks
+	Hooks []hooks.Hook
+	// NgrokEndpoint names the tunnel or endpoint of the ngrok agent config applied to every exposure
+	NgrokEndpoint string
+	// TrafficPolicy is the ngrok traffic policy of the NgrokEndpoint
+	TrafficPolicy string
+	// Agent is the ngrok agent config, the zero value if none was found
+	Agent ngrok.AgentConfig
+	// File is the content of the configuration file
+	File FileConfig
 }
 
-// loadConfig reads configuration from environment variables or prompts user for input
-func loadConfig() (Config, error) {
-	log.Println("\n⚙️  Configuration Setup")
-	log.Println("=====================")
+// providerNgrok is the only supported tunnel provider
+const providerNgrok = "ngrok"
+
+// RegisterFlags registers the command line flags for the configuration values not asked by prompts
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ControlAddr, "control-addr", api.DefaultAddr, "listen address of the local control API, empty to disable")
+	fs.StringVar(&c.ConfigFile, "config", "", fmt.Sprintf("path of the YAML configuration file (default %s)", defaultConfigFile()))
+	fs.BoolVar(&c.TrustProjectConfig, "trust-project-config", false, fmt.Sprintf("apply the hooks, health checks, fallback pages, kubeconfig, context, policy, writeEnv, auditLog, controlAddr and noPreflight of %s, ignored otherwise", projectConfigFile))
+	fs.StringVar(&c.Profile, "profile", "", "profile of the configuration files to use, e.g. staging")
+	fs.StringVar(&c.KubeconfigPath, "kubeconfig", "", "path of the kubeconfig file (default $KUBECONFIG or ~/.kube/config)")
+	fs.StringVar(&c.KubeContext, "context", "", "kubeconfig context to use (default the current context)")
+	fs.Var((*listFlags)(&c.Namespaces), "namespace", "only list services of this namespace, repeatable or comma-separated")
+	fs.StringVar(&c.Provider, "provider", providerNgrok, "tunnel provider, only ngrok is supported")
+
+	c.Rules.RequestHeaders.Set = map[string]string{}
+	c.Rules.RequestHeaders.Add = map[string]string{}
+	c.Rules.ResponseHeaders.Set = map[string]string{}
+	c.Rules.ResponseHeaders.Add = map[string]string{}
+
+	fs.StringVar(&c.Rules.Host, "host-header", "", "Host header sent to the service instead of the public host")
+	fs.StringVar(&c.Rules.StripPathPrefix, "strip-path-prefix", "", "prefix removed from request paths")
+	fs.StringVar(&c.Rules.AddPathPrefix, "add-path-prefix", "", "prefix added to request paths")
+	fs.Var(headerFlags(c.Rules.RequestHeaders.Set), "set-request-header", "set a request header, \"Name: value\", repeatable")
+	fs.Var(headerFlags(c.Rules.RequestHeaders.Add), "add-request-header", "add a request header value, \"Name: value\", repeatable")
+	fs.Var((*listFlags)(&c.Rules.RequestHeaders.Remove), "remove-request-header", "remove a request header, repeatable or comma-separated")
+	fs.Var(headerFlags(c.Rules.ResponseHeaders.Set), "set-response-header", "set a response header, \"Name: value\", repeatable")
+	fs.Var(headerFlags(c.Rules.ResponseHeaders.Add), "add-response-header", "add a response header value, \"Name: value\", repeatable")
+	fs.Var((*listFlags)(&c.Rules.ResponseHeaders.Remove), "remove-response-header", "remove a response header, repeatable or comma-separated")
+
+	fs.Float64Var(&c.Limits.RequestsPerSecond, "rate-limit", 0, "requests per second accepted through the tunnel, 0 for no limit")
+	fs.IntVar(&c.Limits.Burst, "rate-burst", 0, "requests accepted at once above --rate-limit (default the rate)")
+	fs.IntVar(&c.Limits.MaxConcurrentRequests, "max-concurrent-requests", 0, "requests served at the same time, 0 for no limit")
+	fs.Int64Var(&c.Limits.MaxRequestBodySize, "max-body-size", 0, "maximum request body size in bytes, 0 for no limit")
+
+	fs.DurationVar(&c.TTL, "ttl", 0, "stop exposures after this long, e.g. 2h, 0 to keep them running")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", 0, "stop exposures without traffic for this long, e.g. 30m, 0 to keep them running")
+	fs.DurationVar(&c.WarnBefore, "warn-before", 0, "warn this long before an exposure is stopped by --ttl or --idle-timeout")
+
+	fs.StringVar(&c.HealthCheck.Type, "health-check", "", "health check of the forwarded port: tcp or http, empty to disable")
+	fs.StringVar(&c.HealthCheck.Path, "health-path", health.DefaultPath, "path requested by http health checks")
+	fs.DurationVar(&c.HealthCheck.Interval, "health-interval", health.DefaultInterval, "pause between two health checks")
+	fs.DurationVar(&c.HealthCheck.Timeout, "health-timeout", health.DefaultTimeout, "timeout of a single health check")
+	fs.StringVar(&c.FallbackPage, "fallback-page", "", "HTML file served with 503 while the health check fails")
+
+	fs.StringVar(&c.PolicyFile, "policy", "", fmt.Sprintf("path of the policy file (default %s)", defaultPolicyFile()))
+	fs.StringVar((*string)(&c.TunnelType), "tunnel-type", "", "tunnel type: http or tcp (default the service's annotation, or http)")
+	fs.StringVar(&c.Domain, "domain", "", "ngrok domain of http tunnels (default the service's annotation, or a random domain)")
+	fs.StringVar(&c.Auth.BasicAuth, "basic-auth", "", "require callers to log in with \"username:password\", the password or both may be a secret://namespace/name/key reference")
+	fs.StringVar(&c.Auth.OAuthProvider, "oauth", "", "require callers to log in with an ngrok OAuth provider, e.g. google or github")
+	fs.Var((*listFlags)(&c.Auth.OAuthAllowDomains), "oauth-allow-domain", "email domain allowed to log in with --oauth, repeatable or comma-separated")
+	fs.StringVar(&c.Auth.OAuthClientID, "oauth-client-id", "", "client ID of your own OAuth application for --oauth")
+	fs.StringVar(&c.Auth.OAuthClientSecret, "oauth-client-secret", "", "client secret of your own OAuth application for --oauth")
+	fs.StringVar(&c.NgrokEndpoint, "ngrok-endpoint", "", "name of a tunnel or endpoint of the ngrok agent config whose domain, auth and traffic policy are used")
+
+	fs.StringVar(&c.WriteEnv, "write-env", "", "dotenv file, or JSON file with a .json extension, the public URL, local port and address are written to until the exposure stops")
+	fs.StringVar(&c.EnvVar, "env-var", "", "name of the public URL variable of --write-env (default the service name followed by _URL, e.g. API_URL)")
+
+	fs.Func("on-start", "shell command run once an exposure is ready, with SERVICE_EXPORTER_URL and the other SERVICE_EXPORTER_* variables set, repeatable", c.addCommandHook(hooks.TriggerStart))
+	fs.Func("on-stop", "shell command run once an exposure is stopped, repeatable", c.addCommandHook(hooks.TriggerStop))
+	fs.Func("on-url-change", "shell command run when a restarted tunnel changes the public URL, repeatable", c.addCommandHook(hooks.TriggerURLChange))
+	fs.Func("webhook", "URL the exposure is POSTed to as JSON when it starts, stops or changes its public URL, repeatable", func(value string) error {
+		c.Hooks = append(c.Hooks, hooks.Hook{Webhook: value})
+		return nil
+	})
+
+	fs.StringVar(&c.AuditLog, "audit-log", audit.DefaultPath(), "path of the JSON lines audit log of exposures, empty to disable")
+
+	fs.BoolVar(&c.NoPreflight, "no-preflight", false, "skip the pre-flight checks of the kubeconfig, ngrok authtoken and cluster permissions")
+
+	logging.RegisterFlags(fs)
+}
+
+// addCommandHook returns a flag function adding a command hook run on trigger
+func (c *Config) addCommandHook(trigger hooks.Trigger) func(string) error {
+	return func(command string) error {
+		c.Hooks = append(c.Hooks, hooks.Hook{Command: command, Triggers: []hooks.Trigger{trigger}})
+		return nil
+	}
+}
+
+// envFile returns the env file a port of a service writes to. With several ports each one gets
+// its own variables, named after the service and the port
+func (c Config) envFile(name string, port service.ServicePort, several bool) service.EnvFile {
+	if c.WriteEnv == "" {
+		return service.EnvFile{}
+	}
+
+	file := service.EnvFile{Path: c.WriteEnv, Var: c.EnvVar}
+	if several {
+		file.Var = service.EnvVarName(name, cmp.Or(port.Name, strconv.Itoa(int(port.Port))))
+	}
+	return file
+}
+
+// hooks returns the hooks of the configuration file followed by the flag hooks
+func (c Config) hooks() []hooks.Hook {
+	return append(slices.Clone(c.File.Hooks), c.Hooks...)
+}
+
+// rulesFor returns the rewrite rules of a service: the configuration file rules overridden by the flags
+func (c Config) rulesFor(serviceName string) proxy.Rules {
+	return c.File.rulesFor(serviceName).Merge(c.Rules)
+}
+
+// healthCheckFor returns the health check of a service: the flag check, or the configuration file check
+func (c Config) healthCheckFor(serviceName string) health.Config {
+	if c.HealthCheck.Enabled() {
+		return c.HealthCheck
+	}
+	return c.File.healthCheckFor(serviceName)
+}
+
+// fallbackPageFor reads the fallback page of a service, nil for the default page
+func (c Config) fallbackPageFor(serviceName string) ([]byte, error) {
+	path := cmp.Or(c.FallbackPage, c.File.fallbackPageFor(serviceName))
+	if path == "" {
+		return nil, nil
+	}
 
-	// Ask user if they want to use defaults or provide manual input
-	useDefaults, err := prompt.UseDefaultsPrompt()
+	page, err := os.ReadFile(path)
 	if err != nil {
-		return Config{}, fmt.Errorf("failed to get configuration preference: %v", err)
+		return nil, fmt.Errorf("failed to read fallback page: %w", err)
 	}
+	return page, nil
+}
 
-	config := Config{}
+// limitsFor returns the limits of a service: the configuration file limits overridden by the flags
+func (c Config) limitsFor(serviceName string) proxy.Limits {
+	return c.File.limitsFor(serviceName).Merge(c.Limits)
+}
+
+// loadConfig reads the ngrok auth token and kubeconfig path from environment variables or prompts user for input,
+// keeping the values already set by Resolve
+func loadConfig(config Config) (Config, error) {
+	if config.Provider != providerNgrok {
+		return Config{}, fmt.Errorf("unsupported tunnel provider %q, only %s is supported", config.Provider, providerNgrok)
+	}
+
+	var err error
+	config.Agent, err = ngrok.LoadAgentConfig()
+	if err != nil {
+		return Config{}, err
+	}
+	if config.NgrokEndpoint != "" {
+		if config, err = config.applyAgentEndpoint(); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := config.HealthCheck.Validate(); err != nil {
+		return Config{}, err
+	}
+	for _, hook := range config.hooks() {
+		if err := hook.Validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	// Credentials read from Secrets are validated once resolved
+	if !config.hasSecretRefs() {
+		if err := config.Auth.Validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	if config.TunnelType != "" {
+		if _, err := service.ParseTunnelType(string(config.TunnelType)); err != nil {
+			return Config{}, err
+		}
+	}
+
+	config.Policy, err = loadPolicy(cmp.Or(config.PolicyFile, defaultPolicyFile()), config.PolicyFile != "")
+	if err != nil {
+		return Config{}, err
+	}
+
+	log.Println("\n⚙️  Configuration Setup")
+	log.Println("=====================")
+
+	// A profile bundles the configuration, ask user if they want to use defaults or provide manual input otherwise
+	useDefaults := true
+	switch {
+	case config.Profile != "":
+		log.Printf("\n👤 Using profile %q\n", config.Profile)
+	case !config.NonInteractive:
+		if useDefaults, err = prompt.UseDefaultsPrompt(); err != nil {
+			return Config{}, fmt.Errorf("failed to get configuration preference: %v", err)
+		}
+	}
 
 	if useDefaults {
-		log.Println("\n📋 Using environment variables for configuration...")
+		log.Println("\n📋 Using environment variables and configuration files...")
 		config.NgrokAuthToken = os.Getenv("NGROK_AUTH_TOKEN")
-		config.KubeconfigPath = os.Getenv("KUBECONFIG")
+
+		// Fall back to the token saved with login or the ngrok agent config
+		if config.NgrokAuthToken == "" {
+			if config.NgrokAuthToken, err = config.savedToken(); err != nil {
+				return Config{}, err
+			}
+		}
 
 		// Validate required environment variables when using defaults
 		if config.NgrokAuthToken == "" {
-			return Config{}, fmt.Errorf("❌ NGROK_AUTH_TOKEN environment variable is required when using default configuration")
+			return Config{}, fmt.Errorf("❌ NGROK_AUTH_TOKEN environment variable is required when using default configuration, or store the token with service-exporter login")
 		}
 	} else {
 		log.Println("\n📝 Manual configuration mode...")
 
-		// Prompt for ngrok auth token
-		config.NgrokAuthToken, err = prompt.NgrokTokenPrompt()
-		if err != nil {
-			return Config{}, fmt.Errorf("failed to get ngrok auth token: %v", err)
+		// Prompt for ngrok auth token unless one was saved with login or the ngrok agent config
+		if config.NgrokAuthToken, err = config.savedToken(); err != nil {
+			return Config{}, err
+		}
+		if config.NgrokAuthToken == "" {
+			config.NgrokAuthToken, err = prompt.NgrokTokenPrompt()
+			if err != nil {
+				return Config{}, fmt.Errorf("failed to get ngrok auth token: %v", err)
+			}
 		}
 
-		// Prompt for kubeconfig path
-		config.KubeconfigPath, err = prompt.KubeconfigPathPrompt()
+		// Prompt for kubeconfig path, keeping the configured one if none is entered
+		kubeconfigPath, err := prompt.KubeconfigPathPrompt()
 		if err != nil {
 			return Config{}, fmt.Errorf("failed to get kubeconfig path: %v", err)
 		}
+		config.KubeconfigPath = cmp.Or(kubeconfigPath, config.KubeconfigPath)
 	}
 
 	return config, nil
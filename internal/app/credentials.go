@@ -0,0 +1,20 @@
+package app
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Goalt/service-exporter/internal/k8s"
+)
+
+// credentialResolver reads credentials referenced as secret://namespace/name/key
+type credentialResolver interface {
+	ResolveCredential(ctx context.Context, value string) (string, error)
+}
+
+// hasSecretRefs reports whether any credential of the configuration references a Secret, the exporter reads them
+func (c Config) hasSecretRefs() bool {
+	_, password, _ := strings.Cut(c.Auth.BasicAuth, ":")
+	return k8s.IsSecretRef(c.NgrokAuthToken) || k8s.IsSecretRef(c.Auth.BasicAuth) || k8s.IsSecretRef(password) ||
+		k8s.IsSecretRef(c.Auth.OAuthClientID) || k8s.IsSecretRef(c.Auth.OAuthClientSecret)
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/Goalt/service-exporter/internal/k8s"
+	"github.com/Goalt/service-exporter/internal/logging"
+	"github.com/Goalt/service-exporter/internal/ngrok"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// RunDoctor checks the kubeconfig, cluster access and ngrok authtoken and prints a checklist
+func RunDoctor(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	kubeconfig := fs.String("kubeconfig", os.Getenv("KUBECONFIG"), "path of the kubeconfig file")
+	kubeContext := fs.String("context", "", "kubeconfig context to check (default the current context)")
+	namespace := fs.String("namespace", "default", "namespace to check pod access in")
+	token := fs.String("ngrok-token", os.Getenv("NGROK_AUTH_TOKEN"), "ngrok authtoken to check")
+	output := outputTable
+	fs.Var(&output, "output", outputUsage)
+	logging.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-exporter doctor [flags]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Like the exporter, fall back to the authtoken of the ngrok agent config
+	if *token == "" {
+		agent, err := ngrok.LoadAgentConfig()
+		if err != nil {
+			return err
+		}
+		*token = agent.AuthToken
+	}
+
+	results := k8s.CheckKubeconfig(*kubeconfig, *kubeContext)
+	if !k8s.IsSecretRef(*token) {
+		results = append(results, ngrok.CheckAuthToken(*token))
+	}
+
+	// Cluster checks, and reading the token from a Secret, need a usable kubeconfig
+	if !hasFailures(results) {
+		k8sClient, err := k8s.New(*kubeconfig, *kubeContext)
+		if err != nil {
+			return fmt.Errorf("failed to create Kubernetes client: %v", err)
+		}
+		if k8s.IsSecretRef(*token) {
+			results = append(results, checkSecretToken(ctx, k8sClient, *token))
+		}
+		results = append(results, service.NewService(k8sClient, nil).Preflight(ctx, *namespace)...)
+	} else if k8s.IsSecretRef(*token) {
+		results = append(results, service.CheckResult{
+			Name:   "ngrok authtoken",
+			Status: service.CheckWarn,
+			Detail: "not checked, reading " + *token + " needs a usable kubeconfig",
+		})
+	}
+
+	if output != outputTable {
+		if err := output.write(os.Stdout, results); err != nil {
+			return err
+		}
+		if hasFailures(results) {
+			return fmt.Errorf("some checks failed")
+		}
+		return nil
+	}
+
+	printChecks(results)
+
+	if hasFailures(results) {
+		return fmt.Errorf("some checks failed, see the hints above")
+	}
+
+	log.Println("\n🎉 Everything looks good!")
+	return nil
+}
+
+// checkSecretToken checks the ngrok authtoken read from the Secret key ref
+func checkSecretToken(ctx context.Context, resolver credentialResolver, ref string) service.CheckResult {
+	token, err := resolver.ResolveCredential(ctx, ref)
+	if err != nil {
+		return service.CheckResult{
+			Name:   "ngrok authtoken",
+			Status: service.CheckFail,
+			Detail: err.Error(),
+			Hint:   "check the secret://namespace/name/key reference and that you may get the Secret",
+		}
+	}
+
+	result := ngrok.CheckAuthToken(token)
+	result.Detail = strings.TrimSpace("read from " + ref + ", " + result.Detail)
+	return result
+}
+
+// preflight runs the checks that can be done before connecting, printing them if any fails.
+// A token read from a Secret is checked once resolved
+func preflight(config Config) error {
+	results := k8s.CheckKubeconfig(config.KubeconfigPath, config.KubeContext)
+	if !k8s.IsSecretRef(config.NgrokAuthToken) {
+		results = append(results, ngrok.CheckAuthToken(config.NgrokAuthToken))
+	}
+
+	return checkResults(results)
+}
+
+// checkResults prints the checklist and returns an error if any check failed
+func checkResults(results []service.CheckResult) error {
+	if !hasFailures(results) {
+		return nil
+	}
+
+	printChecks(results)
+	return fmt.Errorf("pre-flight checks failed, fix the problems above or run with --no-preflight")
+}
+
+// printChecks prints the check results as a checklist, warned and failed checks at the warn and error levels
+func printChecks(results []service.CheckResult) {
+	log.Println("\n🩺 Pre-flight checks")
+	log.Println("===================")
+
+	for _, r := range results {
+		icon, level := "✅", slog.LevelInfo
+		switch r.Status {
+		case service.CheckWarn:
+			icon, level = "⚠️ ", slog.LevelWarn
+		case service.CheckFail:
+			icon, level = "❌", slog.LevelError
+		}
+		// Plain output drops the emoji, the status is spelled out instead
+		if logging.Plain() {
+			icon = "[" + string(r.Status) + "]"
+		}
+
+		msg := fmt.Sprintf("%s %s", icon, r.Name)
+		if r.Detail != "" {
+			msg += ": " + r.Detail
+		}
+		if level == slog.LevelInfo {
+			log.Println(msg)
+			continue
+		}
+		if r.Hint != "" {
+			slog.Log(context.Background(), level, msg, "hint", r.Hint)
+		} else {
+			slog.Log(context.Background(), level, msg)
+		}
+	}
+}
+
+// hasFailures reports whether any check failed
+func hasFailures(results []service.CheckResult) bool {
+	for _, r := range results {
+		if r.Status == service.CheckFail {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Goalt/service-exporter/exporter"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// RunExpose exposes ports of a service without prompting and writes the lifecycle events of the exposures
+// until they all stop or the command is interrupted
+func RunExpose(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("expose", flag.ContinueOnError)
+	var config Config
+	config.RegisterFlags(fs)
+	var ports listFlags
+	fs.Var(&ports, "port", "name or number of a port to expose, repeatable or comma-separated (default the service's default or only port)")
+	output := outputTable
+	fs.Var(&output, "output", outputUsage+", json writes an event per line")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-exporter expose [flags] NAMESPACE/SERVICE")
+		fmt.Fprintln(fs.Output(), "Accepts the flags of service-exporter, never prompts and reads the ngrok authtoken like the default configuration")
+		fs.PrintDefaults()
+	}
+
+	arg, err := parseWithArg(fs, args)
+	if err != nil {
+		return err
+	}
+	if _, err := config.Resolve(fs); err != nil {
+		return err
+	}
+	name, namespace, err := parseServiceArg(arg)
+	if err != nil {
+		return err
+	}
+	config.NonInteractive = true
+
+	a := New(config)
+	if err := a.LoadConfig(); err != nil {
+		return err
+	}
+	var written chan struct{}
+	defer func() {
+		if err := a.Cleanup(); err != nil {
+			slog.Error("❌ Cleanup failed", "error", err)
+		}
+		// Cleanup closes the events once the exposures it stopped are published
+		if written != nil {
+			<-written
+		}
+	}()
+
+	if err := a.start(ctx); err != nil {
+		return err
+	}
+
+	// Subscribing before exposing writes every event, the ready events as the ports are exposed
+	events := a.exporter.Subscribe(context.WithoutCancel(ctx))
+	stopped := make(chan struct{}, 1)
+	written = make(chan struct{})
+	go func() {
+		defer close(written)
+		w := eventWriter{format: output, out: os.Stdout}
+		for event := range events {
+			// Events are a view of the exposures, failing to write one does not stop them
+			if err := w.write(event); err != nil {
+				slog.Warn("⚠️  Failed to write event", "error", err)
+			}
+			if event.Type == exporter.EventStopped {
+				select {
+				case stopped <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	if !a.config.NoPreflight {
+		if err := checkResults(a.exporter.Preflight(ctx, namespace)); err != nil {
+			return err
+		}
+	}
+
+	servicePorts, err := a.exporter.Ports(ctx, namespace, name)
+	if err != nil {
+		return fmt.Errorf("failed to get service ports: %v", err)
+	}
+	if len(ports) == 0 {
+		ports = []string{""}
+	}
+	var selectedPorts []exporter.ServicePort
+	for _, portName := range ports {
+		port, err := exporter.SelectPort(servicePorts, portName)
+		if err != nil {
+			return fmt.Errorf("service %s/%s: %w", namespace, name, err)
+		}
+		if !slices.Contains(selectedPorts, port) {
+			selectedPorts = append(selectedPorts, port)
+		}
+	}
+	if len(selectedPorts) > 1 && a.config.Domain != "" {
+		return fmt.Errorf("a domain can only be used by one port, expose the ports one at a time with --domain")
+	}
+	if len(selectedPorts) > 1 && a.config.EnvVar != "" {
+		return fmt.Errorf("a variable can only hold the URL of one port, expose the ports one at a time with --env-var")
+	}
+
+	fallbackPage, err := a.config.fallbackPageFor(service.ServiceInfo{Name: name, Namespace: namespace}.String())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, port := range selectedPorts {
+		if _, err := a.exporter.Expose(ctx, a.target(namespace, name, port, a.config.TunnelType, fallbackPage, len(selectedPorts) > 1)); err != nil {
+			slog.Error(fmt.Sprintf("❌ Failed to expose port %d", port.Port), "error", err)
+			errs = append(errs, fmt.Errorf("port %d: %w", port.Port, err))
+		}
+	}
+	if len(errs) == len(selectedPorts) {
+		return fmt.Errorf("failed to expose service: %v", errors.Join(errs...))
+	}
+
+	// Exposures stop on their own once their TTL or idle timeout runs out
+	for len(a.exporter.Exposures()) > 0 {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-stopped:
+		}
+	}
+	return nil
+}
+
+// exposeEvent is a lifecycle event of an exposure written by the expose command
+type exposeEvent struct {
+	Time       time.Time           `json:"time"`
+	Event      exporter.EventType  `json:"event"`
+	Service    string              `json:"service"`
+	Namespace  string              `json:"namespace"`
+	Port       int32               `json:"port"`
+	LocalPort  int                 `json:"localPort,omitempty"`
+	Pod        string              `json:"pod,omitempty"`
+	URL        string              `json:"url,omitempty"`
+	TunnelType exporter.TunnelType `json:"tunnelType,omitempty"`
+	// Health is the health check state of health-changed events
+	Health exporter.HealthState `json:"health,omitempty"`
+	// PreviousURL is the public URL replaced by a restarted tunnel
+	PreviousURL string `json:"previousURL,omitempty"`
+	// Reason explains the transition, such as why the exposure was stopped
+	Reason string `json:"reason,omitempty"`
+}
+
+// eventWriter writes the lifecycle events of exposures
+type eventWriter struct {
+	format outputFormat
+	out    io.Writer
+}
+
+// write writes an event in the output format, a line describing it for the table format
+func (w *eventWriter) write(e exporter.Event) error {
+	name, namespace, _ := service.ParseServiceName(e.Exposure.Service)
+	event := exposeEvent{
+		Time:        e.Time,
+		Event:       e.Type,
+		Service:     name,
+		Namespace:   namespace,
+		Port:        e.Exposure.ServicePort,
+		LocalPort:   e.Exposure.LocalPort,
+		Pod:         e.Exposure.PodName,
+		URL:         e.Exposure.PublicURL,
+		TunnelType:  e.Exposure.TunnelType,
+		PreviousURL: e.PreviousURL,
+		Reason:      e.Reason,
+	}
+	if e.Type == exporter.EventHealthChanged {
+		event.Health = e.Exposure.Health
+	}
+
+	if w.format != outputTable {
+		return w.format.stream(w.out, event)
+	}
+
+	target := fmt.Sprintf("%s/%s port %d", event.Namespace, event.Service, event.Port)
+	var line string
+	switch event.Event {
+	case exporter.EventReady:
+		line = fmt.Sprintf("✅ %s ready at %s (local port %d, pod %s)", target, event.URL, event.LocalPort, dash(event.Pod))
+	case exporter.EventDenied:
+		line = fmt.Sprintf("⛔ %s denied: %s", target, event.Reason)
+	case exporter.EventPortForwardReady:
+		line = fmt.Sprintf("🔗 %s forwarded to pod %s on local port %d", target, dash(event.Pod), event.LocalPort)
+	case exporter.EventPortForwardLost:
+		line = fmt.Sprintf("💥 %s lost its port forwarding, reconnecting: %s", target, event.Reason)
+	case exporter.EventPodSwitched:
+		line = fmt.Sprintf("🔄 %s switched to pod %s: %s", target, dash(event.Pod), event.Reason)
+	case exporter.EventTunnelUp:
+		switch {
+		case event.PreviousURL != "":
+			line = fmt.Sprintf("🔁 %s now at %s, replaced %s", target, event.URL, event.PreviousURL)
+		case event.Reason != "":
+			line = fmt.Sprintf("🌐 %s tunnel up at %s: %s", target, event.URL, event.Reason)
+		default:
+			line = fmt.Sprintf("🌐 %s tunnel up at %s", target, event.URL)
+		}
+	case exporter.EventTunnelDown:
+		line = fmt.Sprintf("🔌 %s tunnel down: %s", target, event.Reason)
+	case exporter.EventHealthChanged:
+		line = fmt.Sprintf("💚 %s is %s", target, event.Health)
+		if event.Health == exporter.HealthUnhealthy {
+			line = fmt.Sprintf("💔 %s is unhealthy: %s", target, event.Reason)
+		}
+	case exporter.EventExpired:
+		line = fmt.Sprintf("⏰ %s expired: %s", target, event.Reason)
+	case exporter.EventStopped:
+		line = fmt.Sprintf("🛑 %s stopped: %s", target, dash(event.Reason))
+	default:
+		line = strings.TrimSpace(fmt.Sprintf("%s %s %s", event.Event, target, event.Reason))
+	}
+
+	_, err := fmt.Fprintln(w.out, line)
+	return err
+}
@@ -0,0 +1,321 @@
+package app
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/Goalt/service-exporter/internal/health"
+	"github.com/Goalt/service-exporter/internal/hooks"
+	"github.com/Goalt/service-exporter/internal/policy"
+	"github.com/Goalt/service-exporter/internal/proxy"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// FileConfig is the content of the YAML configuration file
+type FileConfig struct {
+	// Settings are layered under the environment and flags, see Config.Resolve
+	Settings
+	// Profile is the profile used when none is set with --profile or SERVICE_EXPORTER_PROFILE
+	Profile string `json:"profile,omitempty"`
+	// Profiles are named settings layered over the file's settings, e.g. staging or prod-readonly
+	Profiles map[string]Settings `json:"profiles,omitempty"`
+	// Rewrite is applied to the traffic of every exposure
+	Rewrite proxy.Rules `json:"rewrite,omitempty"`
+	// Limits caps the traffic of every exposure
+	Limits proxy.Limits `json:"limits,omitempty"`
+	// HealthCheck is run against the forwarded port of every exposure
+	HealthCheck health.Config `json:"healthCheck,omitzero"`
+	// FallbackPage is the path of the HTML page served while a health check fails
+	FallbackPage string `json:"fallbackPage,omitempty"`
+	// Services holds per-service settings keyed by "namespace/name"
+	Services map[string]ServiceConfig `json:"services,omitempty"`
+	// Hooks run commands or call webhooks when exposures start, stop or change their public URL
+	Hooks []hooks.Hook `json:"hooks,omitempty"`
+}
+
+// ServiceConfig holds the settings of a single service
+type ServiceConfig struct {
+	// Rewrite is applied on top of the global rewrite rules
+	Rewrite proxy.Rules `json:"rewrite,omitempty"`
+	// Limits override the global limits
+	Limits proxy.Limits `json:"limits,omitempty"`
+	// HealthCheck replaces the global health check
+	HealthCheck health.Config `json:"healthCheck,omitzero"`
+	// FallbackPage replaces the global fallback page
+	FallbackPage string `json:"fallbackPage,omitempty"`
+}
+
+// Settings are the configuration values that can also be set with the environment or flags
+type Settings struct {
+	Kubeconfig        string   `json:"kubeconfig,omitempty"`
+	Context           string   `json:"context,omitempty"`
+	Namespaces        []string `json:"namespaces,omitempty"`
+	Provider          string   `json:"provider,omitempty"`
+	TunnelType        string   `json:"tunnelType,omitempty"`
+	Domain            string   `json:"domain,omitempty"`
+	NgrokEndpoint     string   `json:"ngrokEndpoint,omitempty"`
+	BasicAuth         string   `json:"basicAuth,omitempty"`
+	OAuth             string   `json:"oauth,omitempty"`
+	OAuthAllowDomains []string `json:"oauthAllowDomains,omitempty"`
+	TTL               string   `json:"ttl,omitempty"`
+	IdleTimeout       string   `json:"idleTimeout,omitempty"`
+	WarnBefore        string   `json:"warnBefore,omitempty"`
+	Policy            string   `json:"policy,omitempty"`
+	WriteEnv          string   `json:"writeEnv,omitempty"`
+	EnvVar            string   `json:"envVar,omitempty"`
+	// AuditLog, ControlAddr and NoPreflight may be set to their zero value, e.g. "" to disable the audit log
+	AuditLog    *string `json:"auditLog,omitempty"`
+	ControlAddr *string `json:"controlAddr,omitempty"`
+	NoPreflight *bool   `json:"noPreflight,omitempty"`
+}
+
+// values returns the settings that are set as flag values keyed by their name in the file
+func (s Settings) values() map[string]string {
+	values := map[string]string{}
+
+	v := reflect.ValueOf(s)
+	for i := range v.NumField() {
+		key, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		switch field := v.Field(i); field.Kind() {
+		case reflect.String:
+			if field.String() != "" {
+				values[key] = field.String()
+			}
+		case reflect.Slice:
+			if field.Len() > 0 {
+				values[key] = strings.Join(field.Interface().([]string), ",")
+			}
+		case reflect.Pointer:
+			if !field.IsNil() {
+				values[key] = fmt.Sprint(field.Elem().Interface())
+			}
+		}
+	}
+
+	return values
+}
+
+// merge returns the configuration with other layered on top of it, as the project file over the user's.
+// Settings are not merged, they are layered by Config.Resolve
+func (f FileConfig) merge(other FileConfig) FileConfig {
+	merged := f
+	merged.Profile = cmp.Or(other.Profile, f.Profile)
+	merged.Rewrite = f.Rewrite.Merge(other.Rewrite)
+	merged.Limits = f.Limits.Merge(other.Limits)
+	if other.HealthCheck.Enabled() {
+		merged.HealthCheck = other.HealthCheck
+	}
+	merged.FallbackPage = cmp.Or(other.FallbackPage, f.FallbackPage)
+	merged.Hooks = append(slices.Clone(f.Hooks), other.Hooks...)
+
+	merged.Services = maps.Clone(f.Services)
+	if merged.Services == nil {
+		merged.Services = map[string]ServiceConfig{}
+	}
+	maps.Copy(merged.Services, other.Services)
+
+	merged.Profiles = maps.Clone(f.Profiles)
+	if merged.Profiles == nil {
+		merged.Profiles = map[string]Settings{}
+	}
+	maps.Copy(merged.Profiles, other.Profiles)
+
+	return merged
+}
+
+// defaultPolicyFile returns the path of the policy file used when --policy is not set
+func defaultPolicyFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "service-exporter", "policy.yaml")
+}
+
+// loadPolicy reads the policy file at path, a missing file is only an error when required
+func loadPolicy(path string, required bool) (policy.Policy, error) {
+	var p policy.Policy
+	if path == "" {
+		return p, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return p, nil
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return p, fmt.Errorf("failed to parse policy file %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return p, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+
+	return p, nil
+}
+
+// defaultConfigFile returns the path of the configuration file used when --config is not set
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "service-exporter", "config.yaml")
+}
+
+// loadFileConfig reads the configuration file at path and reports whether it exists,
+// a missing file is only an error when required
+func loadFileConfig(path string, required bool) (FileConfig, bool, error) {
+	var config FileConfig
+	if path == "" {
+		return config, false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return config, false, nil
+	}
+	if err != nil {
+		return config, false, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, true, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return config, true, nil
+}
+
+// untrusted returns the configuration without what a project file cloned with a repository must not set
+// unless trusted: the hooks, which run commands, the health checks and fallback pages, which could serve
+// any local file on the public URL, and the settings listed by Settings.untrusted. The ignored keys are returned too
+func (f FileConfig) untrusted() (FileConfig, []string) {
+	var ignored []string
+	if len(f.Hooks) > 0 {
+		ignored = append(ignored, "hooks")
+		f.Hooks = nil
+	}
+	if f.HealthCheck != (health.Config{}) {
+		ignored = append(ignored, "healthCheck")
+		f.HealthCheck = health.Config{}
+	}
+	if f.FallbackPage != "" {
+		ignored = append(ignored, "fallbackPage")
+		f.FallbackPage = ""
+	}
+
+	var keys []string
+	f.Settings, keys = f.Settings.untrusted()
+	ignored = append(ignored, keys...)
+
+	services := maps.Clone(f.Services)
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		config := services[name]
+		if config.HealthCheck != (health.Config{}) {
+			ignored = append(ignored, fmt.Sprintf("services.%s.healthCheck", name))
+			config.HealthCheck = health.Config{}
+		}
+		if config.FallbackPage != "" {
+			ignored = append(ignored, fmt.Sprintf("services.%s.fallbackPage", name))
+			config.FallbackPage = ""
+		}
+		services[name] = config
+	}
+	f.Services = services
+
+	profiles := maps.Clone(f.Profiles)
+	for _, name := range slices.Sorted(maps.Keys(profiles)) {
+		profiles[name], keys = profiles[name].untrusted()
+		for _, key := range keys {
+			ignored = append(ignored, fmt.Sprintf("profiles.%s.%s", name, key))
+		}
+	}
+	f.Profiles = profiles
+
+	return f, ignored
+}
+
+// untrusted returns the settings without the cluster, which the run must not be pointed at by a project,
+// the policy, audit log and pre-flight settings, which weaken the safeguards, and the env file and control
+// address, which write files and listen where the project chooses; the set keys are returned too
+func (s Settings) untrusted() (Settings, []string) {
+	var ignored []string
+	if s.Kubeconfig != "" {
+		ignored = append(ignored, "kubeconfig")
+		s.Kubeconfig = ""
+	}
+	if s.Context != "" {
+		ignored = append(ignored, "context")
+		s.Context = ""
+	}
+	if s.Policy != "" {
+		ignored = append(ignored, "policy")
+		s.Policy = ""
+	}
+	if s.WriteEnv != "" {
+		ignored = append(ignored, "writeEnv")
+		s.WriteEnv = ""
+	}
+	if s.AuditLog != nil {
+		ignored = append(ignored, "auditLog")
+		s.AuditLog = nil
+	}
+	if s.ControlAddr != nil {
+		ignored = append(ignored, "controlAddr")
+		s.ControlAddr = nil
+	}
+	if s.NoPreflight != nil {
+		ignored = append(ignored, "noPreflight")
+		s.NoPreflight = nil
+	}
+	return s, ignored
+}
+
+// rulesFor returns the rewrite rules of a service in the "service-name (ns: namespace)" format:
+// the global rules, overridden by the service's rules
+func (f FileConfig) rulesFor(serviceName string) proxy.Rules {
+	return f.Rewrite.Merge(f.serviceConfig(serviceName).Rewrite)
+}
+
+// limitsFor returns the limits of a service in the "service-name (ns: namespace)" format:
+// the global limits, overridden by the service's limits
+func (f FileConfig) limitsFor(serviceName string) proxy.Limits {
+	return f.Limits.Merge(f.serviceConfig(serviceName).Limits)
+}
+
+// healthCheckFor returns the health check of a service in the "service-name (ns: namespace)" format
+func (f FileConfig) healthCheckFor(serviceName string) health.Config {
+	if check := f.serviceConfig(serviceName).HealthCheck; check.Enabled() {
+		return check
+	}
+	return f.HealthCheck
+}
+
+// fallbackPageFor returns the fallback page path of a service in the "service-name (ns: namespace)" format
+func (f FileConfig) fallbackPageFor(serviceName string) string {
+	return cmp.Or(f.serviceConfig(serviceName).FallbackPage, f.FallbackPage)
+}
+
+// serviceConfig returns the settings of a service in the "service-name (ns: namespace)" format
+func (f FileConfig) serviceConfig(serviceName string) ServiceConfig {
+	name, namespace, err := service.ParseServiceName(serviceName)
+	if err != nil {
+		return ServiceConfig{}
+	}
+
+	return f.Services[namespace+"/"+name]
+}
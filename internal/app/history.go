@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/audit"
+	"github.com/Goalt/service-exporter/internal/logging"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// RunHistory prints the entries of the audit log
+func RunHistory(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	path := fs.String("audit-log", audit.DefaultPath(), "path of the audit log")
+	since := fs.Duration("since", 0, "only show entries of this last period, e.g. 24h")
+	last := fs.Int("last", 0, "only show the last N entries")
+	jsonOutput := fs.Bool("json", false, "print the entries as JSON lines, like --output json")
+	output := outputTable
+	fs.Var(&output, "output", outputUsage+", json prints an entry per line")
+	var filter audit.Filter
+	fs.StringVar((*string)(&filter.Event), "event", "", "only show entries of this event: started, pod-switched, tunnel-restarted, stopped or denied")
+	fs.StringVar(&filter.User, "user", "", "only show entries of this user")
+	fs.StringVar(&filter.Context, "context", "", "only show entries of this kube context")
+	fs.StringVar(&filter.Namespace, "namespace", "", "only show entries of this namespace")
+	fs.StringVar(&filter.Service, "service", "", "only show entries of this service")
+	logging.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-exporter history [flags]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *since > 0 {
+		filter.Since = time.Now().Add(-*since)
+	}
+
+	entries, err := audit.Read(*path, filter)
+	if err != nil {
+		return err
+	}
+	if *last > 0 {
+		entries = entries[max(len(entries)-*last, 0):]
+	}
+
+	if *jsonOutput {
+		output = outputJSON
+	}
+	if output != outputTable {
+		for _, entry := range entries {
+			if err := output.stream(os.Stdout, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No exposures recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tEVENT\tUSER\tCONTEXT\tSERVICE\tPORT\tPOD\tPUBLIC URL\tAUTH\tDETAILS")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			entry.Time.Local().Format(time.DateTime),
+			entry.Event,
+			entry.User,
+			dash(entry.Context),
+			dash(serviceLabel(entry)),
+			entry.Port,
+			dash(entry.Pod),
+			dash(entry.PublicURL),
+			dash(entry.Auth),
+			dash(details(entry)),
+		)
+	}
+
+	return w.Flush()
+}
+
+// serviceLabel returns the "namespace/name" of the entry's service
+func serviceLabel(entry service.AuditEntry) string {
+	if entry.Service == "" {
+		return ""
+	}
+	return entry.Namespace + "/" + entry.Service
+}
+
+// details describes the reason of the entry, and for stopped exposures how long they ran
+func details(entry service.AuditEntry) string {
+	if entry.Event != service.AuditStopped || entry.StartedAt.IsZero() || entry.StoppedAt.IsZero() {
+		return entry.Reason
+	}
+
+	ran := fmt.Sprintf("ran %s", entry.StoppedAt.Sub(entry.StartedAt).Round(time.Second))
+	if entry.Reason == "" {
+		return ran
+	}
+	return entry.Reason + ", " + ran
+}
+
+// dash returns s, or "-" if empty
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
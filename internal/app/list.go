@@ -0,0 +1,199 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Goalt/service-exporter/internal/k8s"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// RunList prints the services that can be exposed
+func RunList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	var config Config
+	config.RegisterFlags(fs)
+	output := outputTable
+	fs.Var(&output, "output", outputUsage)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-exporter list [flags]")
+		fmt.Fprintln(fs.Output(), "Accepts the flags of service-exporter, --context and --namespace select the services")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := config.Resolve(fs); err != nil {
+		return err
+	}
+
+	k8sClient, err := k8s.New(config.KubeconfigPath, config.KubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	defer k8sClient.Close()
+
+	services, err := k8sClient.ListServices(ctx)
+	if err != nil {
+		return err
+	}
+	visible, optedOut := visibleServices(services, config.Namespaces)
+
+	if output != outputTable {
+		return output.write(os.Stdout, visible)
+	}
+
+	if optedOut > 0 {
+		log.Printf("🙈 Hiding %d services whose owners opted out with the %s annotation\n", optedOut, service.AnnotationExpose)
+	}
+	if len(visible) == 0 {
+		fmt.Println("No services available")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tTYPE\tCLUSTER IP\tPORTS\tREADY")
+	for _, info := range visible {
+		ready := "-"
+		if info.ReadyEndpoints >= 0 {
+			ready = strconv.Itoa(info.ReadyEndpoints)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", info.Namespace, info.Name, dash(info.Type), dash(info.ClusterIP), dash(formatPorts(info.Ports)), ready)
+	}
+	return w.Flush()
+}
+
+// portOutput is a port printed by the ports command, with the tunnel type it is exposed on by default
+// and the one suited to it
+type portOutput struct {
+	service.ServicePort
+	TunnelType          service.TunnelType `json:"tunnelType"`
+	SuggestedTunnelType service.TunnelType `json:"suggestedTunnelType"`
+}
+
+// RunPorts prints the ports of a service
+func RunPorts(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ports", flag.ContinueOnError)
+	var config Config
+	config.RegisterFlags(fs)
+	output := outputTable
+	fs.Var(&output, "output", outputUsage)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-exporter ports [flags] NAMESPACE/SERVICE")
+		fmt.Fprintln(fs.Output(), "Accepts the flags of service-exporter, --tunnel-type overrides the tunnel type of every port")
+		fs.PrintDefaults()
+	}
+
+	arg, err := parseWithArg(fs, args)
+	if err != nil {
+		return err
+	}
+	if _, err := config.Resolve(fs); err != nil {
+		return err
+	}
+	name, namespace, err := parseServiceArg(arg)
+	if err != nil {
+		return err
+	}
+
+	k8sClient, err := k8s.New(config.KubeconfigPath, config.KubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+	defer k8sClient.Close()
+
+	info, err := k8sClient.GetService(ctx, name, namespace)
+	if err != nil {
+		return err
+	}
+
+	ports := make([]portOutput, len(info.Ports))
+	for i, port := range info.Ports {
+		ports[i] = portOutput{ServicePort: port, TunnelType: defaultTunnelType(config, info), SuggestedTunnelType: port.SuggestedTunnelType()}
+	}
+
+	if output != outputTable {
+		return output.write(os.Stdout, ports)
+	}
+
+	if len(ports) == 0 {
+		fmt.Printf("Service %s/%s has no ports\n", namespace, name)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPORT\tTARGET PORT\tPROTOCOL\tAPP PROTOCOL\tTUNNEL\tSUGGESTED\tDEFAULT")
+	for _, port := range ports {
+		isDefault := ""
+		if port.Default {
+			isDefault = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n", dash(port.Name), port.Port, port.TargetPort, port.Protocol,
+			dash(port.AppProtocol), port.TunnelType, port.SuggestedTunnelType, dash(isDefault))
+	}
+	return w.Flush()
+}
+
+// defaultTunnelType returns the tunnel type the ports of a service are exposed on: --tunnel-type,
+// the service's annotation or http
+func defaultTunnelType(config Config, info service.ServiceInfo) service.TunnelType {
+	return cmp.Or(explicitTunnelType(config, info), service.TunnelHTTP)
+}
+
+// explicitTunnelType returns the tunnel type set for the ports of a service: --tunnel-type,
+// the service's annotation or none
+func explicitTunnelType(config Config, info service.ServiceInfo) service.TunnelType {
+	return cmp.Or(config.TunnelType, info.Defaults.TunnelType)
+}
+
+// formatPorts returns the ports of a service as "name:port/protocol" items
+func formatPorts(ports []service.ServicePort) string {
+	items := make([]string, len(ports))
+	for i, port := range ports {
+		items[i] = fmt.Sprintf("%d/%s", port.Port, port.Protocol)
+		if port.Name != "" {
+			items[i] = port.Name + ":" + items[i]
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// parseWithArg parses the flags of a command taking a single argument, accepting flags before and after it
+func parseWithArg(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return "", fmt.Errorf("missing NAMESPACE/SERVICE argument")
+	}
+
+	arg := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return "", err
+	}
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return arg, nil
+}
+
+// parseServiceArg parses a "namespace/name" service argument, a name alone is a service of the default namespace
+func parseServiceArg(arg string) (string, string, error) {
+	namespace, name, found := strings.Cut(arg, "/")
+	if !found {
+		namespace, name = "default", arg
+	}
+	if namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid service %q, use NAMESPACE/SERVICE", arg)
+	}
+	return name, namespace, nil
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Goalt/service-exporter/internal/credstore"
+	"github.com/Goalt/service-exporter/internal/k8s"
+	"github.com/Goalt/service-exporter/internal/logging"
+	"github.com/Goalt/service-exporter/internal/ngrok"
+	"github.com/Goalt/service-exporter/internal/prompt"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// passphraseEnv holds the passphrase of the encrypted token file for non-interactive use
+const passphraseEnv = "SERVICE_EXPORTER_PASSPHRASE"
+
+// passphrase returns the passphrase of the encrypted token file from the environment or a prompt
+func passphrase(confirm bool) (string, error) {
+	if value := os.Getenv(passphraseEnv); value != "" {
+		return value, nil
+	}
+
+	return prompt.PassphrasePrompt(confirm)
+}
+
+// RunLogin stores the ngrok authtoken, taken from NGROK_AUTH_TOKEN or a prompt, in the credential store
+func RunLogin(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	kind := fs.String("store", credstore.KindAuto, "where to store the token: auto, keyring or file")
+	logging.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-exporter login [flags]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := credstore.Open(*kind, passphrase)
+	if err != nil {
+		return err
+	}
+
+	token := os.Getenv("NGROK_AUTH_TOKEN")
+	if token == "" {
+		if token, err = prompt.NgrokTokenPrompt(); err != nil {
+			return fmt.Errorf("failed to get ngrok auth token: %v", err)
+		}
+	} else {
+		log.Println("🔑 Using the ngrok auth token from NGROK_AUTH_TOKEN")
+	}
+
+	// A secret:// reference is stored as is and read when connecting
+	if !k8s.IsSecretRef(token) {
+		if result := ngrok.CheckAuthToken(token); result.Status == service.CheckFail {
+			return fmt.Errorf("refusing to store the ngrok auth token: %s", result.Detail)
+		}
+	}
+
+	if err := store.Set(token); err != nil {
+		return fmt.Errorf("failed to store ngrok auth token: %w", err)
+	}
+
+	log.Printf("🔐 Stored the ngrok auth token in %s\n", store.Name())
+	return nil
+}
+
+// RunLogout removes the stored ngrok authtoken, from every available store unless one is given
+func RunLogout(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("logout", flag.ContinueOnError)
+	kind := fs.String("store", credstore.KindAuto, "where to remove the token from: auto for every store, keyring or file")
+	logging.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-exporter logout [flags]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	stores := credstore.Stores(passphrase)
+	if *kind != credstore.KindAuto {
+		store, err := credstore.Open(*kind, passphrase)
+		if err != nil {
+			return err
+		}
+		stores = []credstore.Store{store}
+	}
+
+	removed := false
+	for _, store := range stores {
+		err := store.Delete()
+		if errors.Is(err, credstore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("🗑️  Removed the ngrok auth token from %s\n", store.Name())
+		removed = true
+	}
+
+	if !removed {
+		log.Println("ℹ️  No stored ngrok auth token found")
+	}
+	return nil
+}
+
+// storedToken returns the ngrok authtoken saved with login, empty if there is none
+func storedToken() (string, error) {
+	token, store, err := credstore.Lookup(passphrase)
+	if errors.Is(err, credstore.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read stored ngrok auth token: %w", err)
+	}
+
+	log.Printf("🔐 Using the ngrok auth token stored in %s\n", store.Name())
+	return token, nil
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/yaml"
+)
+
+// outputFormat is the format of the --output flag of the commands
+type outputFormat string
+
+const (
+	// outputTable prints aligned columns or lines meant for people
+	outputTable outputFormat = "table"
+	// outputJSON prints indented JSON, and streams events as JSON lines
+	outputJSON outputFormat = "json"
+	// outputYAML prints YAML, and streams events as YAML documents
+	outputYAML outputFormat = "yaml"
+)
+
+// outputUsage is the usage of the --output flag
+const outputUsage = "output format: table, json or yaml"
+
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+func (f *outputFormat) Set(value string) error {
+	switch format := outputFormat(value); format {
+	case outputTable, outputJSON, outputYAML:
+		*f = format
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, use table, json or yaml", value)
+}
+
+// write writes v in the JSON or YAML format, the table format is written by the commands
+func (f outputFormat) write(w io.Writer, v any) error {
+	switch f {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(v); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	case outputYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	default:
+		return fmt.Errorf("output format %q cannot be written as data", f)
+	}
+	return nil
+}
+
+// stream writes one item of a stream: a JSON line, or a YAML document
+func (f outputFormat) stream(w io.Writer, v any) error {
+	switch f {
+	case outputJSON:
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	case outputYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	default:
+		return fmt.Errorf("output format %q cannot be streamed as data", f)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/api"
+	"github.com/Goalt/service-exporter/internal/logging"
+)
+
+// RunReplay replays recorded requests of a running service-exporter through its control API
+func RunReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	addr := fs.String("control-addr", api.DefaultAddr, "address of the running service-exporter's control API")
+	port := fs.Int("port", 0, "local port of the exposure, optional when only one exposure is active")
+	last := fs.Int("last", 0, "replay the last N recorded requests")
+	body := fs.String("body", "", "replacement request body, @file reads it from a file")
+	var ids, remove listFlags
+	headers := headerFlags{}
+	fs.Var(&ids, "id", "id of a recorded request to replay, repeatable or comma-separated")
+	fs.Var(headers, "H", "set a request header, \"Name: value\", repeatable")
+	fs.Var(&remove, "remove-header", "remove a request header, repeatable or comma-separated")
+	output := outputTable
+	fs.Var(&output, "output", outputUsage)
+	logging.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-exporter replay [flags]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client := api.NewClient(*addr)
+
+	if *port == 0 {
+		exposures, err := client.Exposures(ctx)
+		if err != nil {
+			return err
+		}
+		if len(exposures) != 1 {
+			return fmt.Errorf("%d active exposures, choose one with --port", len(exposures))
+		}
+		*port = exposures[0].LocalPort
+	}
+
+	var req api.ReplayRequest
+	for _, v := range ids {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid request id %q", v)
+		}
+		req.IDs = append(req.IDs, id)
+	}
+
+	if *last > 0 {
+		exchanges, err := client.Requests(ctx, *port)
+		if err != nil {
+			return err
+		}
+		for _, e := range exchanges[max(len(exchanges)-*last, 0):] {
+			req.IDs = append(req.IDs, e.ID)
+		}
+	}
+
+	if len(req.IDs) == 0 {
+		return fmt.Errorf("no requests to replay, use --id or --last")
+	}
+
+	for name, value := range headers {
+		if req.SetHeaders == nil {
+			req.SetHeaders = http.Header{}
+		}
+		req.SetHeaders.Set(name, value)
+	}
+	req.RemoveHeaders = remove
+
+	if *body != "" {
+		if path, ok := strings.CutPrefix(*body, "@"); ok {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read body file: %w", err)
+			}
+			req.Body = data
+		} else {
+			req.Body = []byte(*body)
+		}
+	}
+
+	results, err := client.Replay(ctx, *port, req)
+	if err != nil {
+		return err
+	}
+
+	if output != outputTable {
+		return output.write(os.Stdout, results)
+	}
+
+	for _, r := range results {
+		fmt.Printf("🔁 #%d %s %s → %d (was %d, %s)\n", r.Original.ID, r.Replayed.Method, r.Replayed.URL,
+			r.Replayed.Status, r.Original.Status, r.Replayed.Duration.Round(time.Millisecond))
+
+		if len(r.Diff) == 0 {
+			fmt.Println("   ✅ response identical")
+			continue
+		}
+		for _, line := range r.Diff {
+			fmt.Println("   " + line)
+		}
+	}
+
+	return nil
+}
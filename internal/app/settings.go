@@ -0,0 +1,228 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Goalt/service-exporter/internal/k8s"
+)
+
+// projectConfigFile is the configuration file of the current directory, layered over the user's
+const projectConfigFile = ".service-exporter.yaml"
+
+// profileEnv selects the profile when --profile is not set
+const profileEnv = "SERVICE_EXPORTER_PROFILE"
+
+// settingDefs are the settings of the configuration files with their flag and environment variable
+var settingDefs = []struct {
+	key  string
+	flag string
+	env  string
+}{
+	{"kubeconfig", "kubeconfig", "KUBECONFIG"},
+	{"context", "context", "SERVICE_EXPORTER_CONTEXT"},
+	{"namespaces", "namespace", "SERVICE_EXPORTER_NAMESPACES"},
+	{"provider", "provider", "SERVICE_EXPORTER_PROVIDER"},
+	{"tunnelType", "tunnel-type", "SERVICE_EXPORTER_TUNNEL_TYPE"},
+	{"domain", "domain", "SERVICE_EXPORTER_DOMAIN"},
+	{"ngrokEndpoint", "ngrok-endpoint", "SERVICE_EXPORTER_NGROK_ENDPOINT"},
+	{"basicAuth", "basic-auth", "SERVICE_EXPORTER_BASIC_AUTH"},
+	{"oauth", "oauth", "SERVICE_EXPORTER_OAUTH"},
+	{"oauthAllowDomains", "oauth-allow-domain", "SERVICE_EXPORTER_OAUTH_ALLOW_DOMAINS"},
+	{"ttl", "ttl", "SERVICE_EXPORTER_TTL"},
+	{"idleTimeout", "idle-timeout", "SERVICE_EXPORTER_IDLE_TIMEOUT"},
+	{"warnBefore", "warn-before", "SERVICE_EXPORTER_WARN_BEFORE"},
+	{"policy", "policy", "SERVICE_EXPORTER_POLICY"},
+	{"writeEnv", "write-env", "SERVICE_EXPORTER_WRITE_ENV"},
+	{"envVar", "env-var", "SERVICE_EXPORTER_ENV_VAR"},
+	{"auditLog", "audit-log", "SERVICE_EXPORTER_AUDIT_LOG"},
+	{"controlAddr", "control-addr", "SERVICE_EXPORTER_CONTROL_ADDR"},
+	{"noPreflight", "no-preflight", "SERVICE_EXPORTER_NO_PREFLIGHT"},
+}
+
+// Setting is the effective value of a setting and where it was set
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// settingsLayer holds the settings of one configuration file or profile
+type settingsLayer struct {
+	source string
+	values map[string]string
+}
+
+// Resolve layers the user configuration file, the project configuration file, the profile and the environment
+// under the flags set on the command line, and returns the effective settings with their source.
+// fs is the parsed flag set the configuration registered its flags with
+func (c *Config) Resolve(fs *flag.FlagSet) ([]Setting, error) {
+	userFile := cmp.Or(c.ConfigFile, defaultConfigFile())
+	user, _, err := loadFileConfig(userFile, c.ConfigFile != "")
+	if err != nil {
+		return nil, err
+	}
+	project, found, err := loadFileConfig(projectConfigFile, false)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		project = c.projectConfig(project)
+	}
+	c.File = user.merge(project)
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	profile := Setting{Key: "profile", Value: c.Profile, Source: "flag --profile"}
+	switch {
+	case set["profile"]:
+	case os.Getenv(profileEnv) != "":
+		profile.Value, profile.Source = os.Getenv(profileEnv), "env "+profileEnv
+	case project.Profile != "":
+		profile.Value, profile.Source = project.Profile, projectConfigFile
+	case user.Profile != "":
+		profile.Value, profile.Source = user.Profile, userFile
+	default:
+		profile.Source = "default"
+	}
+	c.Profile = profile.Value
+
+	layers := []settingsLayer{
+		{source: userFile, values: user.Settings.values()},
+		{source: projectConfigFile, values: project.Settings.values()},
+	}
+	if c.Profile != "" {
+		userProfile, inUser := user.Profiles[c.Profile]
+		projectProfile, inProject := project.Profiles[c.Profile]
+		if !inUser && !inProject {
+			return nil, fmt.Errorf("unknown profile %q, available profiles: %s", c.Profile, strings.Join(c.profileNames(), ", "))
+		}
+		layers = append(layers,
+			settingsLayer{source: fmt.Sprintf("profile %s (%s)", c.Profile, userFile), values: userProfile.values()},
+			settingsLayer{source: fmt.Sprintf("profile %s (%s)", c.Profile, projectConfigFile), values: projectProfile.values()},
+		)
+	}
+
+	settings := []Setting{profile}
+	for _, def := range settingDefs {
+		setting := Setting{Key: def.key, Source: "default"}
+
+		switch {
+		case set[def.flag]:
+			setting.Source = "flag --" + def.flag
+		case os.Getenv(def.env) != "":
+			if err := fs.Set(def.flag, os.Getenv(def.env)); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", def.env, err)
+			}
+			setting.Source = "env " + def.env
+		default:
+			for _, layer := range slices.Backward(layers) {
+				if value, ok := layer.values[def.key]; ok {
+					if err := fs.Set(def.flag, value); err != nil {
+						return nil, fmt.Errorf("invalid %s in %s: %w", def.key, layer.source, err)
+					}
+					setting.Source = layer.source
+					break
+				}
+			}
+		}
+
+		setting.Value = displayValue(def.key, fs.Lookup(def.flag).Value.String())
+		settings = append(settings, setting)
+	}
+
+	return settings, nil
+}
+
+// projectConfig returns the project configuration file loaded from the current directory, without the keys
+// it may only set when trusted with --trust-project-config
+func (c Config) projectConfig(project FileConfig) FileConfig {
+	path, err := filepath.Abs(projectConfigFile)
+	if err != nil {
+		path = projectConfigFile
+	}
+	log.Printf("📄 Using project configuration file %s\n", path)
+
+	if c.TrustProjectConfig {
+		return project
+	}
+	project, ignored := project.untrusted()
+	if len(ignored) > 0 {
+		slog.Warn(fmt.Sprintf("⚠️  Ignoring %s of project configuration file %s, use --trust-project-config to apply them", strings.Join(ignored, ", "), path))
+	}
+	return project
+}
+
+// profileNames returns the names of the profiles of the configuration files
+func (c Config) profileNames() []string {
+	return slices.Sorted(maps.Keys(c.File.Profiles))
+}
+
+// displayValue hides the password of basic auth credentials unless it references a Secret
+func displayValue(key string, value string) string {
+	if key != "basicAuth" || value == "" || k8s.IsSecretRef(value) {
+		return value
+	}
+
+	username, password, _ := strings.Cut(value, ":")
+	if k8s.IsSecretRef(password) {
+		return value
+	}
+	return username + ":********"
+}
+
+// RunConfig prints the effective configuration with the source of each value
+func RunConfig(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	var config Config
+	config.RegisterFlags(fs)
+	jsonOutput := fs.Bool("json", false, "print the settings as JSON, like --output json")
+	output := outputTable
+	fs.Var(&output, "output", outputUsage)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-exporter config [flags]")
+		fmt.Fprintln(fs.Output(), "Accepts the flags of service-exporter to show their effect")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	settings, err := config.Resolve(fs)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		output = outputJSON
+	}
+	if output != outputTable {
+		return output.write(os.Stdout, settings)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	for _, s := range settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, dash(s.Value), s.Source)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if names := config.profileNames(); len(names) > 0 {
+		fmt.Printf("\nProfiles: %s\n", strings.Join(names, ", "))
+	}
+	return nil
+}
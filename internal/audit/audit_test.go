@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open should not return an error: %v", err)
+	}
+
+	started := time.Now().Add(-time.Hour)
+	entries := []service.AuditEntry{
+		{Time: started, Event: service.AuditStarted, User: "alice", Context: "dev", Namespace: "default", Service: "api", Port: 80},
+		{Event: service.AuditStopped, Context: "dev", Namespace: "default", Service: "api", Port: 80, StartedAt: started, Reason: "shutdown"},
+		{Event: service.AuditDenied, Context: "prod", Namespace: "kube-system", Service: "coredns", Port: 53},
+	}
+	for _, entry := range entries {
+		if err := l.Record(entry); err != nil {
+			t.Fatalf("Record should not return an error: %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close should not return an error: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Audit log should exist: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the audit log to be private, got %v", info.Mode().Perm())
+	}
+
+	all, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatalf("Read should not return an error: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(all))
+	}
+	if all[0].User != "alice" {
+		t.Errorf("Record should keep the given user, got %q", all[0].User)
+	}
+	if all[1].User == "" || all[1].Time.IsZero() {
+		t.Errorf("Record should fill in the user and time, got %+v", all[1])
+	}
+	if all[1].Reason != "shutdown" || !all[1].StartedAt.Equal(started) {
+		t.Errorf("Unexpected stopped entry %+v", all[1])
+	}
+
+	denied, err := Read(path, Filter{Event: service.AuditDenied})
+	if err != nil || len(denied) != 1 || denied[0].Service != "coredns" {
+		t.Errorf("Expected the denied entry, got %+v (%v)", denied, err)
+	}
+
+	recent, err := Read(path, Filter{Since: time.Now().Add(-time.Minute), Namespace: "default"})
+	if err != nil || len(recent) != 1 || recent[0].Event != service.AuditStopped {
+		t.Errorf("Expected the recent entry of the default namespace, got %+v (%v)", recent, err)
+	}
+}
+
+func TestOpen_Appends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	for i := 0; i < 2; i++ {
+		l, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open should not return an error: %v", err)
+		}
+		if err := l.Record(service.AuditEntry{Event: service.AuditStarted}); err != nil {
+			t.Fatalf("Record should not return an error: %v", err)
+		}
+		l.Close()
+	}
+
+	entries, err := Read(path, Filter{})
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Expected the second Open to append, got %d entries (%v)", len(entries), err)
+	}
+}
+
+func TestRecord_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open should not return an error: %v", err)
+	}
+	defer l.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Record(service.AuditEntry{Event: service.AuditStarted, Reason: strings.Repeat("x", 1000)})
+		}()
+	}
+	wg.Wait()
+
+	entries, err := Read(path, Filter{})
+	if err != nil || len(entries) != 20 {
+		t.Errorf("Expected 20 intact entries, got %d (%v)", len(entries), err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	entries, err := Read(filepath.Join(t.TempDir(), "missing.jsonl"), Filter{})
+	if err != nil || entries != nil {
+		t.Errorf("A missing audit log should have no entries, got %v (%v)", entries, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	os.WriteFile(path, []byte("{\"event\":\"started\"}\n\nnot json\n"), 0o600)
+
+	if _, err := Read(path, Filter{}); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected an error naming the malformed line, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package credstore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when no ngrok authtoken is stored
+var ErrNotFound = errors.New("no ngrok authtoken stored")
+
+// Kinds of stores accepted by Open
+const (
+	KindAuto    = "auto"
+	KindKeyring = "keyring"
+	KindFile    = "file"
+)
+
+// Store keeps the ngrok authtoken between runs
+type Store interface {
+	// Name describes where the token is stored
+	Name() string
+	// Get returns the stored token, ErrNotFound if there is none
+	Get() (string, error)
+	// Set stores the token, replacing the stored one
+	Set(token string) error
+	// Delete removes the stored token, ErrNotFound if there is none
+	Delete() error
+}
+
+// PassphraseFunc returns the passphrase of the encrypted file, confirm is set when a new one is chosen
+type PassphraseFunc func(confirm bool) (string, error)
+
+// Stores returns the available stores by preference: the keyring if available, then the encrypted file
+func Stores(passphrase PassphraseFunc) []Store {
+	var stores []Store
+	if keyring := NewKeyring(); keyring.Available() {
+		stores = append(stores, keyring)
+	}
+
+	return append(stores, NewFile(DefaultPath(), passphrase))
+}
+
+// Open returns the store of the given kind, auto picks the preferred available store
+func Open(kind string, passphrase PassphraseFunc) (Store, error) {
+	switch kind {
+	case "", KindAuto:
+		return Stores(passphrase)[0], nil
+	case KindKeyring:
+		keyring := NewKeyring()
+		if !keyring.Available() {
+			return nil, fmt.Errorf("the keyring needs secret-tool and a D-Bus session, use --store file instead")
+		}
+		return keyring, nil
+	case KindFile:
+		return NewFile(DefaultPath(), passphrase), nil
+	}
+
+	return nil, fmt.Errorf("invalid store %q, use auto, keyring or file", kind)
+}
+
+// Lookup returns the token from the first available store holding one
+func Lookup(passphrase PassphraseFunc) (string, Store, error) {
+	for _, store := range Stores(passphrase) {
+		token, err := store.Get()
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return token, store, nil
+	}
+
+	return "", nil, ErrNotFound
+}
@@ -0,0 +1,52 @@
+package credstore
+
+import (
+	"errors"
+	"testing"
+)
+
+func noPassphrase(bool) (string, error) {
+	return "", errors.New("unexpected passphrase prompt")
+}
+
+func TestOpen(t *testing.T) {
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+
+	for _, kind := range []string{"", KindAuto, KindFile} {
+		if store, err := Open(kind, noPassphrase); err != nil {
+			t.Errorf("Open(%q) should not return an error: %v", kind, err)
+		} else if _, ok := store.(*File); !ok {
+			t.Errorf("Open(%q) without a keyring should return the file store, got %T", kind, store)
+		}
+	}
+
+	if _, err := Open(KindKeyring, noPassphrase); err == nil {
+		t.Error("Expected an error opening the keyring without a D-Bus session")
+	}
+	if _, err := Open("vault", noPassphrase); err == nil {
+		t.Error("Expected an error for an unknown store")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	// A missing file is reported without asking for the passphrase
+	if _, _, err := Lookup(noPassphrase); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound without a stored token, got %v", err)
+	}
+
+	passphrase := func(bool) (string, error) { return "correct horse battery staple", nil }
+	f := NewFile(DefaultPath(), passphrase)
+	f.workFactor = 10
+	if err := f.Set("2abc_token"); err != nil {
+		t.Fatalf("Set should not return an error: %v", err)
+	}
+
+	token, store, err := Lookup(passphrase)
+	if err != nil || token != "2abc_token" || store.Name() != f.Name() {
+		t.Errorf("Expected the token from the file store, got %q %v %v", token, store, err)
+	}
+}
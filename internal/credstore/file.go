@@ -0,0 +1,144 @@
+package credstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// File stores the token in a file encrypted with a passphrase using age
+type File struct {
+	path       string
+	passphrase PassphraseFunc
+	// workFactor is the scrypt work factor used when encrypting, the age default if zero
+	workFactor int
+}
+
+// DefaultPath returns the path of the encrypted token file
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "service-exporter", "ngrok-token.age")
+}
+
+// NewFile returns the store encrypting the token at path with the passphrase
+func NewFile(path string, passphrase PassphraseFunc) *File {
+	return &File{path: path, passphrase: passphrase}
+}
+
+// Name describes where the token is stored
+func (f *File) Name() string {
+	return "the encrypted file " + f.path
+}
+
+// Get decrypts the stored token, asking for the passphrase
+func (f *File) Get() (string, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	passphrase, err := f.passphrase(false)
+	if err != nil {
+		return "", err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return "", fmt.Errorf("invalid passphrase: %w", err)
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), identity)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s, wrong passphrase?: %w", f.path, err)
+	}
+	token, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", f.path, err)
+	}
+
+	return strings.TrimSpace(string(token)), nil
+}
+
+// Set encrypts the token with a new passphrase and writes it atomically, readable by the user only
+func (f *File) Set(token string) error {
+	passphrase, err := f.passphrase(true)
+	if err != nil {
+		return err
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return fmt.Errorf("invalid passphrase: %w", err)
+	}
+	if f.workFactor > 0 {
+		recipient.SetWorkFactor(f.workFactor)
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipient)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	if _, err := io.WriteString(w, token); err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+
+	return writeFileAtomic(f.path, buf.Bytes())
+}
+
+// Delete removes the token file
+func (f *File) Delete() error {
+	err := os.Remove(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove token file: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file with mode 0600 and renames it to path
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create token file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package credstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestFile returns a file store in a temporary directory using a fast scrypt work factor
+func newTestFile(t *testing.T, passphrase string) *File {
+	f := NewFile(filepath.Join(t.TempDir(), "service-exporter", "ngrok-token.age"), func(bool) (string, error) {
+		return passphrase, nil
+	})
+	f.workFactor = 10
+	return f
+}
+
+func TestFile(t *testing.T) {
+	f := newTestFile(t, "correct horse battery staple")
+
+	if _, err := f.Get(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound before login, got %v", err)
+	}
+
+	if err := f.Set("2abc_token"); err != nil {
+		t.Fatalf("Set should not return an error: %v", err)
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		t.Fatalf("Failed to read token file: %v", err)
+	}
+	if strings.Contains(string(data), "2abc_token") {
+		t.Error("Token file should not contain the token in clear text")
+	}
+	if info, err := os.Stat(f.path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the token file to be readable by the user only, got %v %v", info.Mode(), err)
+	}
+
+	if token, err := f.Get(); err != nil || token != "2abc_token" {
+		t.Errorf("Expected the stored token, got %q %v", token, err)
+	}
+
+	if err := f.Delete(); err != nil {
+		t.Fatalf("Delete should not return an error: %v", err)
+	}
+	if err := f.Delete(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after logout, got %v", err)
+	}
+}
+
+func TestFile_WrongPassphrase(t *testing.T) {
+	f := newTestFile(t, "correct horse battery staple")
+	if err := f.Set("2abc_token"); err != nil {
+		t.Fatalf("Set should not return an error: %v", err)
+	}
+
+	f.passphrase = func(bool) (string, error) { return "wrong", nil }
+	if _, err := f.Get(); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("Expected a wrong passphrase error, got %v", err)
+	}
+}
+
+func TestFile_ReplacesToken(t *testing.T) {
+	f := newTestFile(t, "correct horse battery staple")
+	for _, token := range []string{"first", "second"} {
+		if err := f.Set(token); err != nil {
+			t.Fatalf("Set should not return an error: %v", err)
+		}
+	}
+
+	if token, err := f.Get(); err != nil || token != "second" {
+		t.Errorf("Expected the last stored token, got %q %v", token, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left, got %v %v", entries, err)
+	}
+}
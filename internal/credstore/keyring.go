@@ -0,0 +1,94 @@
+package credstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// keyringAttributes identify the token among the items of the Secret Service
+var keyringAttributes = []string{"service", "service-exporter", "account", "ngrok-authtoken"}
+
+// Keyring stores the token in the Secret Service over D-Bus using secret-tool
+type Keyring struct {
+	command string
+}
+
+// NewKeyring returns the Secret Service store
+func NewKeyring() *Keyring {
+	return &Keyring{command: "secret-tool"}
+}
+
+// Available reports whether secret-tool is installed and a D-Bus session is running
+func (k *Keyring) Available() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return false
+	}
+
+	_, err := exec.LookPath(k.command)
+	return err == nil
+}
+
+// Name describes where the token is stored
+func (k *Keyring) Name() string {
+	return "the system keyring"
+}
+
+// Get returns the stored token
+func (k *Keyring) Get() (string, error) {
+	out, err := k.run(nil, "lookup")
+	if err != nil {
+		return "", err
+	}
+
+	// secret-tool lookup exits with 1 and prints nothing when there is no such item
+	token := strings.TrimSpace(out)
+	if token == "" {
+		return "", ErrNotFound
+	}
+	return token, nil
+}
+
+// Set stores the token, replacing the stored one
+func (k *Keyring) Set(token string) error {
+	_, err := k.run(strings.NewReader(token), "store", "--label=service-exporter ngrok authtoken")
+	return err
+}
+
+// Delete removes the stored token
+func (k *Keyring) Delete() error {
+	if _, err := k.Get(); err != nil {
+		return err
+	}
+
+	_, err := k.run(nil, "clear")
+	return err
+}
+
+// run runs a secret-tool command on the token item
+func (k *Keyring) run(stdin *strings.Reader, command string, args ...string) (string, error) {
+	cmd := exec.Command(k.command, append(append([]string{command}, args...), keyringAttributes...)...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && command == "lookup" && stdout.Len() == 0 && stderr.Len() == 0 {
+		return "", nil
+	}
+	if err != nil && stderr.Len() > 0 {
+		return "", fmt.Errorf("secret-tool %s failed: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return "", fmt.Errorf("secret-tool %s failed: %w", command, err)
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,71 @@
+package credstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeSecretTool mimics secret-tool, keeping the stored secret in a file next to the script
+const fakeSecretTool = `#!/bin/sh
+store="$(dirname "$0")/stored"
+case "$1" in
+store) cat > "$store" ;;
+lookup) [ -f "$store" ] || exit 1; cat "$store" ;;
+clear) rm -f "$store" ;;
+*) echo "unknown command $1" >&2; exit 2 ;;
+esac
+`
+
+func newTestKeyring(t *testing.T) *Keyring {
+	if runtime.GOOS == "windows" {
+		t.Skip("secret-tool is not available on Windows")
+	}
+
+	command := filepath.Join(t.TempDir(), "secret-tool")
+	if err := os.WriteFile(command, []byte(fakeSecretTool), 0o700); err != nil {
+		t.Fatalf("Failed to write fake secret-tool: %v", err)
+	}
+	return &Keyring{command: command}
+}
+
+func TestKeyring(t *testing.T) {
+	k := newTestKeyring(t)
+
+	if _, err := k.Get(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound before login, got %v", err)
+	}
+	if err := k.Delete(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting a missing token, got %v", err)
+	}
+
+	if err := k.Set("2abc_token"); err != nil {
+		t.Fatalf("Set should not return an error: %v", err)
+	}
+	if token, err := k.Get(); err != nil || token != "2abc_token" {
+		t.Errorf("Expected the stored token, got %q %v", token, err)
+	}
+
+	if err := k.Delete(); err != nil {
+		t.Fatalf("Delete should not return an error: %v", err)
+	}
+	if _, err := k.Get(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after logout, got %v", err)
+	}
+}
+
+func TestKeyring_Available(t *testing.T) {
+	k := newTestKeyring(t)
+
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	if k.Available() {
+		t.Error("Keyring should not be available without a D-Bus session")
+	}
+
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path=/run/user/1000/bus")
+	if !k.Available() {
+		t.Error("Keyring should be available with secret-tool and a D-Bus session")
+	}
+}
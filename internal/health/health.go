@@ -0,0 +1,180 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Check types
+const (
+	// TypeTCP checks that the port accepts connections
+	TypeTCP = "tcp"
+	// TypeHTTP checks that a GET request to the port returns a 2xx or 3xx status
+	TypeHTTP = "http"
+)
+
+// Defaults used for unset Config fields
+const (
+	DefaultInterval = 10 * time.Second
+	DefaultTimeout  = 2 * time.Second
+	DefaultPath     = "/"
+)
+
+// Config describes a health check, the zero value disables it
+type Config struct {
+	// Type is TypeTCP or TypeHTTP, empty disables the check
+	Type string
+	// Path is requested by HTTP checks
+	Path string
+	// Interval is the pause between two checks
+	Interval time.Duration
+	// Timeout caps the duration of a single check
+	Timeout time.Duration
+}
+
+// UnmarshalJSON reads a check with durations written as strings, e.g. "10s"
+func (c *Config) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type     string `json:"type"`
+		Path     string `json:"path"`
+		Interval string `json:"interval"`
+		Timeout  string `json:"timeout"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	parsed := Config{Type: raw.Type, Path: raw.Path}
+	for _, d := range []struct {
+		value string
+		dest  *time.Duration
+	}{{raw.Interval, &parsed.Interval}, {raw.Timeout, &parsed.Timeout}} {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid health check duration: %w", err)
+		}
+		*d.dest = duration
+	}
+
+	*c = parsed
+	return c.Validate()
+}
+
+// Enabled reports whether a check is configured
+func (c Config) Enabled() bool {
+	return c.Type != ""
+}
+
+// Validate checks the check type
+func (c Config) Validate() error {
+	switch c.Type {
+	case "", TypeTCP, TypeHTTP:
+		return nil
+	default:
+		return fmt.Errorf("unknown health check type %q, use %q or %q", c.Type, TypeTCP, TypeHTTP)
+	}
+}
+
+// String describes the check
+func (c Config) String() string {
+	c = c.withDefaults()
+	if c.Type == TypeHTTP {
+		return fmt.Sprintf("HTTP GET %s every %s", c.Path, c.Interval)
+	}
+	return fmt.Sprintf("TCP every %s", c.Interval)
+}
+
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Path == "" {
+		c.Path = DefaultPath
+	}
+	return c
+}
+
+// Probe runs the check once against localhost:port
+func Probe(ctx context.Context, c Config, port int) error {
+	c = c.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort("localhost", strconv.Itoa(port))
+
+	switch c.Type {
+	case TypeTCP:
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return fmt.Errorf("port %d not accepting connections: %w", port, err)
+		}
+		return conn.Close()
+
+	case TypeHTTP:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+c.Path, nil)
+		if err != nil {
+			return fmt.Errorf("failed to build health check request: %w", err)
+		}
+
+		client := &http.Client{
+			// A redirect is a valid answer, don't follow it out of the forwarded port
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("GET %s failed: %w", c.Path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("GET %s returned %s", c.Path, resp.Status)
+		}
+		return nil
+
+	default:
+		return c.Validate()
+	}
+}
+
+// Watch probes localhost:port every interval until ctx is cancelled and calls onChange with
+// the result of the first probe and whenever the health changes
+func Watch(ctx context.Context, c Config, port int, onChange func(healthy bool, err error)) {
+	c = c.withDefaults()
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	first := true
+	var healthy bool
+	for {
+		err := Probe(ctx, c, port)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if first || healthy != (err == nil) {
+			first = false
+			healthy = err == nil
+			onChange(healthy, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serverPort returns the port of a test server
+func serverPort(t *testing.T, server *httptest.Server) int {
+	t.Helper()
+	return server.Listener.Addr().(*net.TCPAddr).Port
+}
+
+// closedPort returns a local port nothing listens on
+func closedPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+func TestProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			w.WriteHeader(http.StatusNoContent)
+		case "/login":
+			http.Redirect(w, r, "https://example.com/", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	port := serverPort(t, server)
+
+	tests := []struct {
+		name    string
+		config  Config
+		port    int
+		healthy bool
+	}{
+		{"tcp open", Config{Type: TypeTCP}, port, true},
+		{"tcp closed", Config{Type: TypeTCP}, closedPort(t), false},
+		{"http ok", Config{Type: TypeHTTP, Path: "/healthz"}, port, true},
+		{"http redirect", Config{Type: TypeHTTP, Path: "/login"}, port, true},
+		{"http unavailable", Config{Type: TypeHTTP}, port, false},
+		{"http closed", Config{Type: TypeHTTP}, closedPort(t), false},
+		{"unknown type", Config{Type: "udp"}, port, false},
+	}
+
+	for _, tt := range tests {
+		err := Probe(context.Background(), tt.config, tt.port)
+		if (err == nil) != tt.healthy {
+			t.Errorf("%s: expected healthy %v, got error %v", tt.name, tt.healthy, err)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan bool, 10)
+	go Watch(ctx, Config{Type: TypeHTTP, Interval: 10 * time.Millisecond}, serverPort(t, server), func(healthy bool, err error) {
+		changes <- healthy
+	})
+
+	if healthy := <-changes; !healthy {
+		t.Fatal("Expected the first probe to report healthy")
+	}
+
+	mu.Lock()
+	status = http.StatusBadGateway
+	mu.Unlock()
+
+	select {
+	case healthy := <-changes:
+		if healthy {
+			t.Error("Expected a change to unhealthy")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the health change to be reported")
+	}
+
+	// Unchanged health is not reported again
+	select {
+	case healthy := <-changes:
+		t.Errorf("Unexpected health report %v", healthy)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestConfig(t *testing.T) {
+	if (Config{}).Enabled() {
+		t.Error("Zero config should disable the check")
+	}
+	if err := (Config{Type: "udp"}).Validate(); err == nil {
+		t.Error("Validate should reject unknown types")
+	}
+	if s := (Config{Type: TypeHTTP, Path: "/healthz"}).String(); s != "HTTP GET /healthz every 10s" {
+		t.Errorf("Unexpected description %q", s)
+	}
+}
+
+func TestConfig_UnmarshalJSON(t *testing.T) {
+	var c Config
+	if err := json.Unmarshal([]byte(`{"type":"http","path":"/healthz","interval":"30s","timeout":"1s"}`), &c); err != nil {
+		t.Fatalf("Unmarshal should not return an error: %v", err)
+	}
+
+	expected := Config{Type: TypeHTTP, Path: "/healthz", Interval: 30 * time.Second, Timeout: time.Second}
+	if c != expected {
+		t.Errorf("Expected %+v, got %+v", expected, c)
+	}
+
+	for _, invalid := range []string{`{"type":"udp"}`, `{"type":"tcp","interval":"often"}`} {
+		if err := json.Unmarshal([]byte(invalid), &c); err == nil {
+			t.Errorf("Unmarshal(%s) should return an error", invalid)
+		}
+	}
+}
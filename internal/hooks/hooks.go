@@ -0,0 +1,329 @@
+// Package hooks runs shell commands and calls webhooks when exposures start, stop or change their public URL,
+// e.g. to register the URL in a third-party sandbox or post it to a chat
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/logging"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// Trigger is the exposure transition a hook runs on
+type Trigger string
+
+const (
+	// TriggerStart runs once the exposure is ready and its public URL accepts connections
+	TriggerStart Trigger = "start"
+	// TriggerStop runs once the exposure is stopped
+	TriggerStop Trigger = "stop"
+	// TriggerURLChange runs when a restarted tunnel replaces the public URL
+	TriggerURLChange Trigger = "url-change"
+)
+
+// Defaults of the hooks
+const (
+	// CommandTimeout caps the duration of a command
+	CommandTimeout = 30 * time.Second
+	// WebhookTimeout caps the duration of a single webhook attempt
+	WebhookTimeout = 10 * time.Second
+	// DefaultRetries is the number of retries of a failed webhook when unset
+	DefaultRetries = 3
+)
+
+// Hook runs a shell command or calls a webhook, exactly one of them
+type Hook struct {
+	// Name identifies the hook in logs, the command or webhook URL if empty
+	Name string `json:"name,omitempty"`
+	// Triggers lists the transitions the hook runs on, all of them if empty
+	Triggers []Trigger `json:"triggers,omitempty"`
+
+	// Command is run by the shell with the exposure in SERVICE_EXPORTER_* environment variables
+	Command string `json:"command,omitempty"`
+
+	// Webhook is the URL the exposure is POSTed to as JSON
+	Webhook string `json:"webhook,omitempty"`
+	// Headers are sent with the webhook requests, e.g. Authorization
+	Headers map[string]string `json:"headers,omitempty"`
+	// Retries is how many times a webhook failing with a network error, 429 or 5xx is retried,
+	// DefaultRetries if nil
+	Retries *int `json:"retries,omitempty"`
+}
+
+// Validate checks that the hook has either a command or an http(s) webhook and known triggers
+func (h Hook) Validate() error {
+	switch {
+	case h.Command == "" && h.Webhook == "":
+		return fmt.Errorf("hook %s needs a command or a webhook", h)
+	case h.Command != "" && h.Webhook != "":
+		return fmt.Errorf("hook %s has both a command and a webhook, use two hooks", h)
+	}
+
+	if h.Webhook != "" {
+		u, err := url.Parse(h.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("hook %s: webhook must be an http or https URL", h)
+		}
+	}
+	if h.Retries != nil && *h.Retries < 0 {
+		return fmt.Errorf("hook %s: retries must not be negative", h)
+	}
+	for _, trigger := range h.Triggers {
+		if !slices.Contains([]Trigger{TriggerStart, TriggerStop, TriggerURLChange}, trigger) {
+			return fmt.Errorf("hook %s: unknown trigger %q, use start, stop or url-change", h, trigger)
+		}
+	}
+	return nil
+}
+
+// String returns the name of the hook, its command or the host of its webhook if unnamed
+func (h Hook) String() string {
+	switch {
+	case h.Name != "":
+		return strconv.Quote(h.Name)
+	case h.Command != "":
+		return strconv.Quote(h.Command)
+	}
+	if u, err := url.Parse(h.Webhook); err == nil && u.Host != "" {
+		return "webhook " + u.Host
+	}
+	return "webhook"
+}
+
+// runsOn reports whether the hook runs on trigger
+func (h Hook) runsOn(trigger Trigger) bool {
+	return len(h.Triggers) == 0 || slices.Contains(h.Triggers, trigger)
+}
+
+// Payload is the exposure a hook runs for, the JSON body of webhooks
+type Payload struct {
+	Trigger    Trigger            `json:"trigger"`
+	Time       time.Time          `json:"time"`
+	Service    string             `json:"service"`
+	Namespace  string             `json:"namespace"`
+	Port       int32              `json:"port"`
+	LocalPort  int                `json:"localPort,omitempty"`
+	Pod        string             `json:"pod,omitempty"`
+	URL        string             `json:"url,omitempty"`
+	TunnelType service.TunnelType `json:"tunnelType,omitempty"`
+	// PreviousURL is the public URL replaced on url-change
+	PreviousURL string `json:"previousURL,omitempty"`
+	// Reason is why the exposure stopped
+	Reason string `json:"reason,omitempty"`
+}
+
+// payload returns the payload of an event and whether hooks run on it
+func payload(event service.Event) (Payload, bool) {
+	var trigger Trigger
+	switch {
+	case event.Type == service.EventReady:
+		trigger = TriggerStart
+	case event.Type == service.EventStopped:
+		trigger = TriggerStop
+	case event.Type == service.EventTunnelUp && event.PreviousURL != "":
+		trigger = TriggerURLChange
+	default:
+		return Payload{}, false
+	}
+
+	name, namespace, _ := service.ParseServiceName(event.Exposure.Service)
+	return Payload{
+		Trigger:     trigger,
+		Time:        event.Time,
+		Service:     name,
+		Namespace:   namespace,
+		Port:        event.Exposure.ServicePort,
+		LocalPort:   event.Exposure.LocalPort,
+		Pod:         event.Exposure.PodName,
+		URL:         event.Exposure.PublicURL,
+		TunnelType:  event.Exposure.TunnelType,
+		PreviousURL: event.PreviousURL,
+		Reason:      event.Reason,
+	}, true
+}
+
+// Env returns the payload as the SERVICE_EXPORTER_* environment variables of commands
+func (p Payload) Env() []string {
+	return []string{
+		"SERVICE_EXPORTER_TRIGGER=" + string(p.Trigger),
+		"SERVICE_EXPORTER_SERVICE=" + p.Service,
+		"SERVICE_EXPORTER_NAMESPACE=" + p.Namespace,
+		"SERVICE_EXPORTER_PORT=" + strconv.Itoa(int(p.Port)),
+		"SERVICE_EXPORTER_LOCAL_PORT=" + strconv.Itoa(p.LocalPort),
+		"SERVICE_EXPORTER_POD=" + p.Pod,
+		"SERVICE_EXPORTER_URL=" + p.URL,
+		"SERVICE_EXPORTER_TUNNEL_TYPE=" + string(p.TunnelType),
+		"SERVICE_EXPORTER_PREVIOUS_URL=" + p.PreviousURL,
+		"SERVICE_EXPORTER_REASON=" + p.Reason,
+	}
+}
+
+// Runner runs hooks on the lifecycle events of exposures
+type Runner struct {
+	hooks  []Hook
+	client *http.Client
+	// backoff is the pause before the first webhook retry, doubled before each further one
+	backoff time.Duration
+}
+
+// NewRunner returns a runner of hooks, failing if any of them is invalid
+func NewRunner(hooks []Hook) (*Runner, error) {
+	for _, hook := range hooks {
+		if err := hook.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Runner{
+		hooks:   hooks,
+		client:  &http.Client{Timeout: WebhookTimeout},
+		backoff: time.Second,
+	}, nil
+}
+
+// Run runs the hooks on events until the channel is closed or ctx is cancelled, which kills the running command
+// or cancels the webhook request. Hooks run one at a time in the order of the events, so that the stop hooks
+// of an exposure run after its start hooks; failures are logged
+func (r *Runner) Run(ctx context.Context, events <-chan service.Event) {
+	for {
+		var event service.Event
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			event = e
+		}
+
+		p, ok := payload(event)
+		if !ok {
+			continue
+		}
+
+		for _, hook := range r.hooks {
+			if !hook.runsOn(p.Trigger) {
+				continue
+			}
+			if err := r.run(ctx, hook, p); err != nil {
+				slog.Warn(fmt.Sprintf("⚠️  Hook %s failed on %s of %s/%s port %d", hook, p.Trigger, p.Namespace, p.Service, p.Port), "error", err)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// run runs a single hook
+func (r *Runner) run(ctx context.Context, hook Hook, p Payload) error {
+	if hook.Command != "" {
+		return r.runCommand(ctx, hook, p)
+	}
+	return r.callWebhook(ctx, hook, p)
+}
+
+// runCommand runs the command of a hook with the shell, logging its output
+func (r *Runner) runCommand(ctx context.Context, hook Hook, p Payload) error {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	}
+	cmd.Env = append(os.Environ(), p.Env()...)
+	output := logging.Writer(slog.Default().With("hook", hook.String()), slog.LevelInfo)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	if err := cmd.Run(); err != nil {
+		if parent.Err() != nil {
+			return fmt.Errorf("command cancelled: %w", parent.Err())
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("command timed out after %s", CommandTimeout)
+		}
+		return fmt.Errorf("command failed: %w", err)
+	}
+	return nil
+}
+
+// callWebhook POSTs the payload to the webhook of a hook, retrying network errors, 429 and 5xx responses
+// until ctx is cancelled
+func (r *Runner) callWebhook(ctx context.Context, hook Hook, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	retries := DefaultRetries
+	if hook.Retries != nil {
+		retries = *hook.Retries
+	}
+
+	backoff := r.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := r.post(ctx, hook, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == retries {
+			if attempt > 0 {
+				return fmt.Errorf("%w, after %d retries", err, attempt)
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, retries cancelled: %w", err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends a single webhook request and reports whether a failure is worth retrying
+func (r *Runner) post(ctx context.Context, hook Hook, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "service-exporter")
+	for name, value := range hook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned %s", strings.TrimSpace(resp.Status))
+}
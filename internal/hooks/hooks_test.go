@@ -0,0 +1,217 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// events returns a closed channel of a start, an unrelated, a url-change and a stop event of an exposure
+func events() <-chan service.Event {
+	exposure := service.ExposureStatus{Service: "api (ns: staging)", ServicePort: 80, LocalPort: 8000, PodName: "api-0", PublicURL: "https://a.ngrok.io", TunnelType: service.TunnelHTTP}
+	restarted := exposure
+	restarted.PublicURL = "https://b.ngrok.io"
+
+	ch := make(chan service.Event, 4)
+	ch <- service.Event{Type: service.EventReady, Exposure: exposure}
+	ch <- service.Event{Type: service.EventTunnelUp, Exposure: exposure, Reason: "reconnected"}
+	ch <- service.Event{Type: service.EventTunnelUp, Exposure: restarted, PreviousURL: exposure.PublicURL}
+	ch <- service.Event{Type: service.EventStopped, Exposure: restarted, Reason: "shutdown"}
+	close(ch)
+	return ch
+}
+
+func retries(n int) *int {
+	return &n
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		hook Hook
+		err  string
+	}{
+		{name: "command", hook: Hook{Command: "echo", Triggers: []Trigger{TriggerStart}}},
+		{name: "webhook", hook: Hook{Webhook: "https://hooks.example.com/x", Retries: retries(0)}},
+		{name: "empty", hook: Hook{Name: "none"}, err: `hook "none" needs a command or a webhook`},
+		{name: "both", hook: Hook{Command: "echo", Webhook: "https://example.com"}, err: "has both a command and a webhook"},
+		{name: "scheme", hook: Hook{Webhook: "ftp://example.com"}, err: "webhook must be an http or https URL"},
+		{name: "retries", hook: Hook{Webhook: "https://example.com", Retries: retries(-1)}, err: "retries must not be negative"},
+		{name: "trigger", hook: Hook{Command: "echo", Triggers: []Trigger{"restart"}}, err: `unknown trigger "restart"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hook.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Validate should not return an error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestRun_Command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	out := filepath.Join(t.TempDir(), "hooks.log")
+	runner, err := NewRunner([]Hook{
+		{Command: `echo "$SERVICE_EXPORTER_TRIGGER $SERVICE_EXPORTER_NAMESPACE/$SERVICE_EXPORTER_SERVICE:$SERVICE_EXPORTER_PORT $SERVICE_EXPORTER_LOCAL_PORT $SERVICE_EXPORTER_URL $SERVICE_EXPORTER_PREVIOUS_URL" >> ` + out},
+		{Command: "echo stopped >> " + out, Triggers: []Trigger{TriggerStop}},
+		{Command: "exit 1", Triggers: []Trigger{TriggerStart}},
+	})
+	if err != nil {
+		t.Fatalf("NewRunner should not return an error: %v", err)
+	}
+	runner.Run(context.Background(), events())
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "start staging/api:80 8000 https://a.ngrok.io \n" +
+		"url-change staging/api:80 8000 https://b.ngrok.io https://a.ngrok.io\n" +
+		"stop staging/api:80 8000 https://b.ngrok.io \n" +
+		"stopped\n"
+	if string(data) != expected {
+		t.Errorf("Expected commands to write\n%s\ngot\n%s", expected, data)
+	}
+}
+
+func TestRun_Webhook(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		payloads []Payload
+		attempts int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// The first two attempts fail and are retried
+		if attempts <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var p Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		payloads = append(payloads, p)
+	}))
+	defer server.Close()
+
+	runner, err := NewRunner([]Hook{{Webhook: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}, Triggers: []Trigger{TriggerStart, TriggerURLChange}}})
+	if err != nil {
+		t.Fatalf("NewRunner should not return an error: %v", err)
+	}
+	runner.backoff = time.Millisecond
+	runner.Run(context.Background(), events())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 4 || len(payloads) != 2 {
+		t.Fatalf("Expected 4 attempts and 2 payloads, got %d attempts and %+v", attempts, payloads)
+	}
+	if p := payloads[0]; p.Trigger != TriggerStart || p.Namespace != "staging" || p.Service != "api" || p.Port != 80 || p.URL != "https://a.ngrok.io" || p.Pod != "api-0" {
+		t.Errorf("Unexpected start payload %+v", p)
+	}
+	if p := payloads[1]; p.Trigger != TriggerURLChange || p.URL != "https://b.ngrok.io" || p.PreviousURL != "https://a.ngrok.io" {
+		t.Errorf("Unexpected url-change payload %+v", p)
+	}
+}
+
+func TestCallWebhook_Retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		retries  *int
+		attempts int
+		err      string
+	}{
+		{name: "server error", status: http.StatusBadGateway, attempts: DefaultRetries + 1, err: "webhook returned 502 Bad Gateway, after 3 retries"},
+		{name: "too many requests", status: http.StatusTooManyRequests, retries: retries(1), attempts: 2, err: "after 1 retries"},
+		{name: "client error", status: http.StatusNotFound, attempts: 1, err: "webhook returned 404 Not Found"},
+		{name: "no retries", status: http.StatusInternalServerError, retries: retries(0), attempts: 1, err: "webhook returned 500 Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				attempts++
+				mu.Unlock()
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			runner, err := NewRunner(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner.backoff = time.Millisecond
+
+			err = runner.callWebhook(context.Background(), Hook{Webhook: server.URL, Retries: tt.retries}, Payload{Trigger: TriggerStart})
+			if err == nil || err.Error() != tt.err && !strings.HasSuffix(err.Error(), tt.err) {
+				t.Errorf("Expected error %q, got %v", tt.err, err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if attempts != tt.attempts {
+				t.Errorf("Expected %d attempts, got %d", tt.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestCallWebhook_Cancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	runner, err := NewRunner(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.backoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = runner.callWebhook(ctx, Hook{Webhook: server.URL}, Payload{Trigger: TriggerStart})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the retries to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the retries to stop once cancelled, took %s", elapsed)
+	}
+}
@@ -0,0 +1,74 @@
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// serviceInfo describes a Service with its service-exporter.io annotations parsed
+func serviceInfo(svc *corev1.Service) service.ServiceInfo {
+	info := service.ServiceInfo{
+		Name:        svc.Name,
+		Namespace:   svc.Namespace,
+		Labels:      svc.Labels,
+		Annotations: svc.Annotations,
+
+		Type:           string(svc.Spec.Type),
+		ClusterIP:      svc.Spec.ClusterIP,
+		Ports:          servicePorts(svc),
+		Selector:       svc.Spec.Selector,
+		ReadyEndpoints: -1,
+	}
+
+	if value, ok := svc.Annotations[service.AnnotationExpose]; ok {
+		expose, err := strconv.ParseBool(value)
+		switch {
+		case err != nil:
+			info.Warnings = append(info.Warnings, fmt.Sprintf("%s: %q is not true or false", service.AnnotationExpose, value))
+		case expose:
+			info.OptIn = true
+		default:
+			info.OptOut = true
+		}
+	}
+
+	if value, ok := svc.Annotations[service.AnnotationDefaultPort]; ok {
+		if findPort(svc.Spec.Ports, value) == nil {
+			info.Warnings = append(info.Warnings, fmt.Sprintf("%s: the service has no port %q", service.AnnotationDefaultPort, value))
+		} else {
+			info.Defaults.Port = value
+		}
+	}
+
+	if value, ok := svc.Annotations[service.AnnotationTunnelType]; ok {
+		tunnelType, err := service.ParseTunnelType(value)
+		if err != nil {
+			info.Warnings = append(info.Warnings, fmt.Sprintf("%s: %v", service.AnnotationTunnelType, err))
+		} else {
+			info.Defaults.TunnelType = tunnelType
+		}
+	}
+
+	info.Defaults.BasicAuthSecret = svc.Annotations[service.AnnotationBasicAuthSecret]
+	info.Defaults.Domain = svc.Annotations[service.AnnotationDomain]
+
+	return info
+}
+
+// findPort returns the port with the given name or number, nil if there is none
+func findPort(ports []corev1.ServicePort, nameOrNumber string) *corev1.ServicePort {
+	if nameOrNumber == "" {
+		return nil
+	}
+
+	for i, port := range ports {
+		if port.Name == nameOrNumber || strconv.Itoa(int(port.Port)) == nameOrNumber {
+			return &ports[i]
+		}
+	}
+	return nil
+}
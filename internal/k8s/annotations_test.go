@@ -0,0 +1,83 @@
+package k8s
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+func newService(annotations map[string]string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "web", Annotations: annotations},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: "10.0.0.12",
+			Selector:  map[string]string{"app": "api"},
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80},
+				{Name: "metrics", Port: 9090},
+			},
+		},
+	}
+}
+
+func TestServiceInfo(t *testing.T) {
+	info := serviceInfo(newService(map[string]string{
+		service.AnnotationExpose:          "true",
+		service.AnnotationDefaultPort:     "9090",
+		service.AnnotationTunnelType:      "tcp",
+		service.AnnotationBasicAuthSecret: "api-auth",
+		service.AnnotationDomain:          "api.example.com",
+	}))
+
+	expected := service.ExposeDefaults{Port: "9090", TunnelType: service.TunnelTCP, BasicAuthSecret: "api-auth", Domain: "api.example.com"}
+	if !info.OptIn || info.OptOut || info.Defaults != expected || len(info.Warnings) != 0 {
+		t.Errorf("Unexpected service info %+v", info)
+	}
+	if info.Type != "ClusterIP" || info.ClusterIP != "10.0.0.12" || info.Selector["app"] != "api" || info.ReadyEndpoints != -1 {
+		t.Errorf("Unexpected service details %+v", info)
+	}
+	if len(info.Ports) != 2 || info.Ports[0].Default || !info.Ports[1].Default {
+		t.Errorf("Expected the ports with the default one marked, got %+v", info.Ports)
+	}
+
+	if info := serviceInfo(newService(map[string]string{service.AnnotationExpose: "false"})); !info.OptOut || info.OptIn {
+		t.Errorf("Expected the service to opt out, got %+v", info)
+	}
+
+	if info := serviceInfo(newService(nil)); info.OptIn || info.OptOut || info.Defaults != (service.ExposeDefaults{}) {
+		t.Errorf("Expected no settings without annotations, got %+v", info)
+	}
+}
+
+func TestServiceInfo_InvalidAnnotations(t *testing.T) {
+	info := serviceInfo(newService(map[string]string{
+		service.AnnotationExpose:      "maybe",
+		service.AnnotationDefaultPort: "grpc",
+		service.AnnotationTunnelType:  "udp",
+	}))
+
+	if info.OptIn || info.OptOut || info.Defaults != (service.ExposeDefaults{}) {
+		t.Errorf("Invalid annotations should be ignored, got %+v", info)
+	}
+	if len(info.Warnings) != 3 {
+		t.Errorf("Expected a warning per invalid annotation, got %v", info.Warnings)
+	}
+}
+
+func TestFindPort(t *testing.T) {
+	ports := newService(nil).Spec.Ports
+
+	if port := findPort(ports, "metrics"); port == nil || port.Port != 9090 {
+		t.Errorf("Expected the port named metrics, got %+v", port)
+	}
+	if port := findPort(ports, "80"); port == nil || port.Name != "http" {
+		t.Errorf("Expected port 80, got %+v", port)
+	}
+	if port := findPort([]corev1.ServicePort{{Port: 80}}, ""); port != nil {
+		t.Errorf("Expected no port for an empty name, got %+v", port)
+	}
+}
@@ -1,13 +1,15 @@
 package k8s
 
 import (
+	"cmp"
 	"context"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -18,31 +20,41 @@ import (
 	"k8s.io/client-go/tools/portforward"
 	"k8s.io/client-go/transport/spdy"
 
+	"github.com/Goalt/service-exporter/internal/logging"
 	"github.com/Goalt/service-exporter/internal/service"
 )
 
 type client struct {
-	clientset *kubernetes.Clientset
-	config    *rest.Config
+	clientset   kubernetes.Interface
+	config      *rest.Config
+	contextName string
+
+	// cache serves Services and EndpointSlices once started by the first call that needs it
+	cacheOnce sync.Once
+	cache     *informerCache
 }
 
-func New(kubeconfigPath string) (*client, error) {
+// New creates a client for the kubeconfig at kubeconfigPath, using contextName or the current context if empty
+func New(kubeconfigPath string, contextName string) (*client, error) {
 	// Use provided kubeconfig path or fall back to default
-	if kubeconfigPath == "" {
-		// Fall back to default kubeconfig location
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("kubeconfig path not provided and could not determine home directory: %w", err)
-		}
-
-		kubeconfigPath = filepath.Join(home, ".kube", "config")
+	kubeconfigPath, err := resolveKubeconfigPath(kubeconfigPath)
+	if err != nil {
+		return nil, err
 	}
 
 	// Build config from kubeconfig file
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
+		&clientcmd.ConfigOverrides{CurrentContext: contextName},
+	)
+	config, err := loader.ClientConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build kubeconfig from path %s: %w", kubeconfigPath, err)
 	}
+	rawConfig, err := loader.RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig from path %s: %w", kubeconfigPath, err)
+	}
 
 	// Create the clientset
 	clientset, err := kubernetes.NewForConfig(config)
@@ -50,28 +62,78 @@ func New(kubeconfigPath string) (*client, error) {
 		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 
-	return &client{clientset: clientset, config: config}, nil
+	return &client{clientset: clientset, config: config, contextName: cmp.Or(contextName, rawConfig.CurrentContext)}, nil
 }
 
-func (c *client) ListServices(ctx context.Context) ([]string, error) {
+// resolveKubeconfigPath returns path, or the default kubeconfig location if empty
+func resolveKubeconfigPath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+
+	// Fall back to default kubeconfig location
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("kubeconfig path not provided and could not determine home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+func (c *client) ListServices(ctx context.Context) ([]service.ServiceInfo, error) {
 	if c.clientset == nil {
 		return nil, fmt.Errorf("kubernetes client not initialized")
 	}
 
+	// Serve the services from the cache once every service is listed
+	if ic := c.startCache(ctx); ic != nil {
+		if err := ic.waitForSync(ctx); err != nil {
+			return nil, err
+		}
+		return ic.serviceInfos(), nil
+	}
+
 	// List services in all namespaces
 	services, err := c.clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list services: %w", err)
 	}
 
-	var serviceNames []string
+	// Ready endpoints are a detail, they stay unknown if EndpointSlices cannot be listed
+	var ready map[string]int
+	if endpointSlices, err := c.clientset.DiscoveryV1().EndpointSlices("").List(ctx, metav1.ListOptions{}); err == nil {
+		ready = readyEndpoints(endpointSlices.Items)
+	}
+
+	var infos []service.ServiceInfo
 	for _, svc := range services.Items {
-		// Include namespace in the service name for clarity
-		serviceName := fmt.Sprintf("%s (ns: %s)", svc.Name, svc.Namespace)
-		serviceNames = append(serviceNames, serviceName)
+		info := serviceInfo(&svc)
+		if ready != nil {
+			info.ReadyEndpoints = ready[svc.Namespace+"/"+svc.Name]
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// GetService returns the labels and annotations of a service
+func (c *client) GetService(ctx context.Context, serviceName string, namespace string) (service.ServiceInfo, error) {
+	if c.clientset == nil {
+		return service.ServiceInfo{}, fmt.Errorf("kubernetes client not initialized")
+	}
+
+	svc, err := c.getService(ctx, serviceName, namespace)
+	if err != nil {
+		return service.ServiceInfo{}, fmt.Errorf("failed to get service %s in namespace %s: %w", serviceName, namespace, err)
 	}
 
-	return serviceNames, nil
+	return serviceInfo(svc), nil
+}
+
+// ContextName returns the name of the kubeconfig context the client uses
+func (c *client) ContextName() string {
+	return c.contextName
 }
 
 func (c *client) GetServicePorts(ctx context.Context, serviceName string, namespace string) ([]service.ServicePort, error) {
@@ -80,7 +142,7 @@ func (c *client) GetServicePorts(ctx context.Context, serviceName string, namesp
 	}
 
 	// Get the service to find available ports
-	svc, err := c.clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	svc, err := c.getService(ctx, serviceName, namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get service %s in namespace %s: %w", serviceName, namespace, err)
 	}
@@ -89,7 +151,14 @@ func (c *client) GetServicePorts(ctx context.Context, serviceName string, namesp
 		return nil, fmt.Errorf("service %s has no ports defined", serviceName)
 	}
 
-	var servicePorts []service.ServicePort
+	return servicePorts(svc), nil
+}
+
+// servicePorts returns the ports of a service, marking the default port
+func servicePorts(svc *corev1.Service) []service.ServicePort {
+	defaultPort := findPort(svc.Spec.Ports, svc.Annotations[service.AnnotationDefaultPort])
+
+	var ports []service.ServicePort
 	for _, port := range svc.Spec.Ports {
 		targetPort := port.TargetPort.IntVal
 		if targetPort == 0 {
@@ -97,30 +166,37 @@ func (c *client) GetServicePorts(ctx context.Context, serviceName string, namesp
 			targetPort = port.Port
 		}
 
-		servicePorts = append(servicePorts, service.ServicePort{
-			Name:       port.Name,
-			Port:       port.Port,
-			TargetPort: targetPort,
-			Protocol:   string(port.Protocol),
+		var appProtocol string
+		if port.AppProtocol != nil {
+			appProtocol = *port.AppProtocol
+		}
+
+		ports = append(ports, service.ServicePort{
+			Name:        port.Name,
+			Port:        port.Port,
+			TargetPort:  targetPort,
+			Protocol:    string(port.Protocol),
+			AppProtocol: appProtocol,
+			Default:     defaultPort != nil && defaultPort.Name == port.Name && defaultPort.Port == port.Port,
 		})
 	}
 
-	return servicePorts, nil
+	return ports
 }
 
-func (c *client) PortForward(ctx context.Context, serviceName string, namespace string, localPort int, servicePort int32) error {
+func (c *client) PortForward(ctx context.Context, serviceName string, namespace string, localPort int, servicePort int32) (service.PortForwardSession, error) {
 	if c.clientset == nil || c.config == nil {
-		return fmt.Errorf("kubernetes client not initialized")
+		return service.PortForwardSession{}, fmt.Errorf("kubernetes client not initialized")
 	}
 
 	// Get the service to find target port
-	svc, err := c.clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	svc, err := c.getService(ctx, serviceName, namespace)
 	if err != nil {
-		return fmt.Errorf("failed to get service %s in namespace %s: %w", serviceName, namespace, err)
+		return service.PortForwardSession{}, fmt.Errorf("failed to get service %s in namespace %s: %w", serviceName, namespace, err)
 	}
 
 	if len(svc.Spec.Ports) == 0 {
-		return fmt.Errorf("service %s has no ports defined", serviceName)
+		return service.PortForwardSession{}, fmt.Errorf("service %s has no ports defined", serviceName)
 	}
 
 	// Find the specific port that matches the requested servicePort
@@ -133,40 +209,25 @@ func (c *client) PortForward(ctx context.Context, serviceName string, namespace
 	}
 
 	if selectedPort == nil {
-		return fmt.Errorf("port %d not found in service %s", servicePort, serviceName)
+		return service.PortForwardSession{}, fmt.Errorf("port %d not found in service %s", servicePort, serviceName)
 	}
 
-	// Find pods that match the service selector
-	pods, err := c.findPodsForService(ctx, svc)
+	podName, targetPort, err := c.resolveTarget(ctx, svc, selectedPort)
 	if err != nil {
-		return fmt.Errorf("failed to find pods for service %s: %w", serviceName, err)
-	}
-
-	if len(pods) == 0 {
-		return fmt.Errorf("no running pods found for service %s", serviceName)
-	}
-
-	// Use the first available pod
-	pod := pods[0]
-
-	// Determine the target port on the pod
-	targetPort := selectedPort.TargetPort.IntVal
-	if targetPort == 0 {
-		// If TargetPort is not specified, use the service port
-		targetPort = selectedPort.Port
+		return service.PortForwardSession{}, err
 	}
 
 	// Create port forward request
 	req := c.clientset.CoreV1().RESTClient().Post().
 		Resource("pods").
 		Namespace(namespace).
-		Name(pod.Name).
+		Name(podName).
 		SubResource("portforward")
 
 	// Create SPDY transport
 	transport, upgrader, err := spdy.RoundTripperFor(c.config)
 	if err != nil {
-		return fmt.Errorf("failed to create SPDY transport: %w", err)
+		return service.PortForwardSession{}, fmt.Errorf("failed to create SPDY transport: %w", err)
 	}
 
 	// Create dialer
@@ -178,27 +239,81 @@ func (c *client) PortForward(ctx context.Context, serviceName string, namespace
 
 	ports := []string{fmt.Sprintf("%d:%d", localPort, targetPort)}
 
-	pf, err := portforward.New(dialer, ports, stopCh, readyCh, io.Discard, io.Discard)
+	// The port forwarder reports every connection, only worth seeing when debugging
+	out := logging.Writer(slog.Default().With("component", "port-forward", "pod", podName), slog.LevelDebug)
+	pf, err := portforward.New(dialer, ports, stopCh, readyCh, out, out)
 	if err != nil {
-		return fmt.Errorf("failed to create port forwarder: %w", err)
+		return service.PortForwardSession{}, fmt.Errorf("failed to create port forwarder: %w", err)
 	}
 
 	// Start port forwarding in a goroutine
+	done := make(chan error, 1)
 	go func() {
+		defer close(done)
 		if err := pf.ForwardPorts(); err != nil {
-			log.Printf("Port forwarding error: %v\n", err)
+			slog.Error("Port forwarding error", "error", err)
+			done <- err
 		}
 	}()
 
 	// Wait for port forwarding to be ready or timeout
 	select {
 	case <-readyCh:
-		log.Printf("Port forwarding ready from localhost:%d to pod %s:%d\n", localPort, pod.Name, targetPort)
-		return nil
+		slog.Debug(fmt.Sprintf("Port forwarding ready from localhost:%d to pod %s:%d", localPort, podName, targetPort))
+	case err := <-done:
+		if err == nil {
+			err = fmt.Errorf("port forwarding stopped")
+		}
+		// The port forwarder binds the local port itself and does not wrap the listen error
+		if strings.Contains(err.Error(), "unable to listen on any of the requested ports") {
+			return service.PortForwardSession{}, fmt.Errorf("%w: %d", service.ErrPortInUse, localPort)
+		}
+		return service.PortForwardSession{}, fmt.Errorf("port forwarding to pod %s failed: %w", podName, err)
 	case <-time.After(30 * time.Second):
 		close(stopCh)
-		return fmt.Errorf("timeout waiting for port forwarding to be ready")
+		return service.PortForwardSession{}, fmt.Errorf("timeout waiting for port forwarding to be ready")
+	}
+
+	// Stop forwarding once the caller is done with it
+	go func() {
+		<-ctx.Done()
+		close(stopCh)
+	}()
+
+	return service.PortForwardSession{PodName: podName, Done: done}, nil
+}
+
+// resolveTarget returns a ready pod of the service and its port the service port forwards to.
+// The cached EndpointSlices resolve both, including named target ports, without API calls
+func (c *client) resolveTarget(ctx context.Context, svc *corev1.Service, port *corev1.ServicePort) (string, int32, error) {
+	if ic := c.startCache(ctx); ic != nil {
+		if endpointSlices, ok := ic.serviceEndpointSlices(svc.Namespace, svc.Name); ok {
+			if podName, targetPort, found := readyTarget(endpointSlices, port); found {
+				return podName, targetPort, nil
+			}
+			return "", 0, fmt.Errorf("no ready pods found for service %s", svc.Name)
+		}
+	}
+
+	// Find pods that match the service selector
+	pods, err := c.findPodsForService(ctx, svc)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to find pods for service %s: %w", svc.Name, err)
+	}
+
+	if len(pods) == 0 {
+		return "", 0, fmt.Errorf("no running pods found for service %s", svc.Name)
 	}
+
+	// Determine the target port on the pod
+	targetPort := port.TargetPort.IntVal
+	if targetPort == 0 {
+		// If TargetPort is not specified, use the service port
+		targetPort = port.Port
+	}
+
+	// Use the first available pod
+	return pods[0].Name, targetPort, nil
 }
 
 func (c *client) findPodsForService(ctx context.Context, svc *corev1.Service) ([]corev1.Pod, error) {
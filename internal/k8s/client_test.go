@@ -2,6 +2,8 @@ package k8s
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -40,7 +42,7 @@ users:
 	}
 
 	// Test client creation with explicit kubeconfig path
-	client, err := New(kubeconfigPath)
+	client, err := New(kubeconfigPath, "")
 	if err != nil {
 		t.Fatalf("Failed to create client: %v", err)
 	}
@@ -52,6 +54,14 @@ users:
 	if client.clientset == nil {
 		t.Error("Expected clientset to be initialized, got nil")
 	}
+
+	if client.ContextName() != "fake-context" {
+		t.Errorf("Expected context fake-context, got %q", client.ContextName())
+	}
+
+	if _, err := New(kubeconfigPath, "missing-context"); err == nil {
+		t.Error("Expected an error for a context missing from the kubeconfig")
+	}
 }
 
 func TestNewClient_WithoutKubeconfig(t *testing.T) {
@@ -63,7 +73,7 @@ func TestNewClient_WithoutKubeconfig(t *testing.T) {
 	os.Setenv("HOME", "/non-existent-path")
 
 	// Test client creation with empty kubeconfig path
-	client, err := New("")
+	client, err := New("", "")
 	if err == nil {
 		t.Error("Expected error when no kubeconfig is available, got nil")
 	}
@@ -92,3 +102,33 @@ func TestListServices_WithNilClient(t *testing.T) {
 		t.Errorf("Expected error message '%s', got '%s'", expectedError, err.Error())
 	}
 }
+
+func TestGetService(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/staging/services/api" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"api","namespace":"staging",` +
+			`"labels":{"app":"api"},"annotations":{"team":"payments"}}}`))
+	}))
+	defer server.Close()
+
+	c, err := New(writeKubeconfig(t, server.URL, "    token: fake-token\n"), "")
+	if err != nil {
+		t.Fatalf("New should not return an error: %v", err)
+	}
+
+	info, err := c.GetService(context.Background(), "api", "staging")
+	if err != nil {
+		t.Fatalf("GetService should not return an error: %v", err)
+	}
+	if info.Name != "api" || info.Namespace != "staging" || info.Labels["app"] != "api" || info.Annotations["team"] != "payments" {
+		t.Errorf("Unexpected service info %+v", info)
+	}
+
+	if _, err := c.GetService(context.Background(), "missing", "staging"); err == nil {
+		t.Error("Expected an error for a missing service")
+	}
+}
@@ -0,0 +1,74 @@
+package k8s
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// readyEndpoints counts the ready endpoints of every service, keyed by "namespace/name".
+// An endpoint listed in several slices, such as the IPv4 and IPv6 slices of a dual-stack service, counts once
+func readyEndpoints(endpointSlices []discoveryv1.EndpointSlice) map[string]int {
+	seen := map[string]map[string]bool{}
+	for _, slice := range endpointSlices {
+		name := slice.Labels[discoveryv1.LabelServiceName]
+		if name == "" {
+			continue
+		}
+		key := slice.Namespace + "/" + name
+		if seen[key] == nil {
+			seen[key] = map[string]bool{}
+		}
+
+		for _, endpoint := range slice.Endpoints {
+			// A nil ready condition means ready
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+
+			switch {
+			case endpoint.TargetRef != nil:
+				seen[key][endpoint.TargetRef.Kind+"/"+endpoint.TargetRef.Name] = true
+			case len(endpoint.Addresses) > 0:
+				seen[key][endpoint.Addresses[0]] = true
+			}
+		}
+	}
+
+	ready := make(map[string]int, len(seen))
+	for key, endpoints := range seen {
+		ready[key] = len(endpoints)
+	}
+	return ready
+}
+
+// readyTarget returns a ready pod of the EndpointSlices of a service and the pod port the service port
+// forwards to, resolved by the slices even for named target ports. found is false without a ready pod
+func readyTarget(endpointSlices []discoveryv1.EndpointSlice, port *corev1.ServicePort) (podName string, targetPort int32, found bool) {
+	for _, slice := range endpointSlices {
+		// Slices list the ports of the service by name, the only one of a service with a single port is unnamed
+		targetPort = 0
+		for _, p := range slice.Ports {
+			var name string
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if p.Port != nil && name == port.Name {
+				targetPort = *p.Port
+			}
+		}
+		if targetPort == 0 {
+			continue
+		}
+
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+				return endpoint.TargetRef.Name, targetPort, true
+			}
+		}
+	}
+
+	return "", 0, false
+}
@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReadyEndpoints(t *testing.T) {
+	ready, notReady := true, false
+	pod := func(name string, isReady *bool) discoveryv1.Endpoint {
+		return discoveryv1.Endpoint{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discoveryv1.EndpointConditions{Ready: isReady},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: name},
+		}
+	}
+	slice := func(namespace string, service string, endpoints ...discoveryv1.Endpoint) discoveryv1.EndpointSlice {
+		return discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Labels: map[string]string{discoveryv1.LabelServiceName: service}},
+			Endpoints:  endpoints,
+		}
+	}
+
+	counts := readyEndpoints([]discoveryv1.EndpointSlice{
+		slice("web", "api", pod("api-1", &ready), pod("api-2", nil), pod("api-3", &notReady)),
+		// The IPv6 slice of the dual-stack service lists the same pods
+		slice("web", "api", pod("api-1", &ready), pod("api-2", nil)),
+		slice("data", "db", pod("db-0", &notReady)),
+		slice("data", "", pod("orphan", &ready)),
+	})
+
+	if counts["web/api"] != 2 {
+		t.Errorf("Expected 2 ready endpoints for web/api, got %d", counts["web/api"])
+	}
+	if count, ok := counts["data/db"]; !ok || count != 0 {
+		t.Errorf("Expected no ready endpoint for data/db, got %d %v", count, ok)
+	}
+	if len(counts) != 2 {
+		t.Errorf("Expected slices without a service to be ignored, got %v", counts)
+	}
+}
+
+func TestReadyTarget(t *testing.T) {
+	ready, notReady := true, false
+	http, metrics := "http", "metrics"
+	port8080, port9090 := int32(8080), int32(9090)
+	endpointSlices := []discoveryv1.EndpointSlice{
+		{
+			Ports: []discoveryv1.EndpointPort{{Name: &http, Port: &port8080}, {Name: &metrics, Port: &port9090}},
+			Endpoints: []discoveryv1.Endpoint{
+				{Conditions: discoveryv1.EndpointConditions{Ready: &notReady}, TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "api-1"}},
+				{Conditions: discoveryv1.EndpointConditions{Ready: &ready}, TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "api-2"}},
+			},
+		},
+	}
+
+	podName, targetPort, found := readyTarget(endpointSlices, &corev1.ServicePort{Name: "metrics", Port: 9000})
+	if !found || podName != "api-2" || targetPort != 9090 {
+		t.Errorf("Expected api-2:9090, got %s:%d %v", podName, targetPort, found)
+	}
+
+	if _, _, found := readyTarget(endpointSlices, &corev1.ServicePort{Name: "grpc", Port: 9000}); found {
+		t.Error("Expected no target for a port the slices do not list")
+	}
+
+	// The port of a service with a single port is unnamed, and endpoints without a pod cannot be forwarded to
+	unnamed := []discoveryv1.EndpointSlice{{
+		Ports:     []discoveryv1.EndpointPort{{Port: &port8080}},
+		Endpoints: []discoveryv1.Endpoint{{Addresses: []string{"10.0.0.1"}}},
+	}}
+	if _, _, found := readyTarget(unnamed, &corev1.ServicePort{Port: 80}); found {
+		t.Error("Expected no target without a pod")
+	}
+	unnamed[0].Endpoints[0].TargetRef = &corev1.ObjectReference{Kind: "Pod", Name: "web-0"}
+	if podName, targetPort, found := readyTarget(unnamed, &corev1.ServicePort{Port: 80}); !found || podName != "web-0" || targetPort != 8080 {
+		t.Errorf("Expected web-0:8080, got %s:%d %v", podName, targetPort, found)
+	}
+}
@@ -0,0 +1,278 @@
+package k8s
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// watchBatchDelay coalesces bursts of changes, such as the initial listing of a big cluster, into one update
+const watchBatchDelay = 200 * time.Millisecond
+
+// byServiceIndex indexes EndpointSlices by the "namespace/name" of their service
+const byServiceIndex = "byService"
+
+// informerCache serves Services and EndpointSlices from shared informers kept up to date by watches
+type informerCache struct {
+	services cache.SharedIndexInformer
+	// endpointSlices is nil when the user may not watch them
+	endpointSlices cache.SharedIndexInformer
+	stop           chan struct{}
+	stopOnce       sync.Once
+}
+
+// informers returns the informers of the cache
+func (ic *informerCache) informers() []cache.SharedIndexInformer {
+	if ic.endpointSlices == nil {
+		return []cache.SharedIndexInformer{ic.services}
+	}
+	return []cache.SharedIndexInformer{ic.services, ic.endpointSlices}
+}
+
+// synced reports whether the informers listed every object once
+func (ic *informerCache) synced() bool {
+	for _, informer := range ic.informers() {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForSync waits until the informers listed every object once
+func (ic *informerCache) waitForSync(ctx context.Context) error {
+	var hasSynced []cache.InformerSynced
+	for _, informer := range ic.informers() {
+		hasSynced = append(hasSynced, informer.HasSynced)
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), hasSynced...) {
+		return fmt.Errorf("failed to list services: %w", cmp.Or(ctx.Err(), errors.New("cache stopped")))
+	}
+	return nil
+}
+
+// service returns a service of the cache, a NotFound error if there is none
+func (ic *informerCache) service(namespace string, name string) (*corev1.Service, error) {
+	obj, exists, err := ic.services.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "services"}, name)
+	}
+	return obj.(*corev1.Service), nil
+}
+
+// serviceEndpointSlices returns the EndpointSlices of a service, false if they are not cached
+func (ic *informerCache) serviceEndpointSlices(namespace string, name string) ([]discoveryv1.EndpointSlice, bool) {
+	if ic.endpointSlices == nil || !ic.endpointSlices.HasSynced() {
+		return nil, false
+	}
+
+	objs, err := ic.endpointSlices.GetIndexer().ByIndex(byServiceIndex, namespace+"/"+name)
+	if err != nil {
+		return nil, false
+	}
+
+	endpointSlices := make([]discoveryv1.EndpointSlice, len(objs))
+	for i, obj := range objs {
+		endpointSlices[i] = *obj.(*discoveryv1.EndpointSlice)
+	}
+	return endpointSlices, true
+}
+
+// serviceInfos returns the cached services sorted by namespace and name,
+// with their ready endpoints once the EndpointSlices are synced
+func (ic *informerCache) serviceInfos() []service.ServiceInfo {
+	var ready map[string]int
+	if ic.endpointSlices != nil && ic.endpointSlices.HasSynced() {
+		objs := ic.endpointSlices.GetStore().List()
+		endpointSlices := make([]discoveryv1.EndpointSlice, len(objs))
+		for i, obj := range objs {
+			endpointSlices[i] = *obj.(*discoveryv1.EndpointSlice)
+		}
+		ready = readyEndpoints(endpointSlices)
+	}
+
+	var infos []service.ServiceInfo
+	for _, obj := range ic.services.GetStore().List() {
+		svc := obj.(*corev1.Service)
+		info := serviceInfo(svc)
+		if ready != nil {
+			info.ReadyEndpoints = ready[svc.Namespace+"/"+svc.Name]
+		}
+		infos = append(infos, info)
+	}
+
+	slices.SortFunc(infos, func(a, b service.ServiceInfo) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+	})
+	return infos
+}
+
+// canWatch reports whether the current user may list and watch resource of group in all namespaces
+func (c *client) canWatch(ctx context.Context, group string, resource string) bool {
+	for _, verb := range []string{"list", "watch"} {
+		allowed, _, err := c.access(ctx, authorizationv1.ResourceAttributes{Group: group, Resource: resource, Verb: verb})
+		if err != nil || !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// startCache starts the shared informers of Services and EndpointSlices on first use and returns them.
+// It returns nil if the user may not watch services in all namespaces, the client then keeps using API calls
+func (c *client) startCache(ctx context.Context) *informerCache {
+	c.cacheOnce.Do(func() {
+		if c.clientset == nil || !c.canWatch(ctx, "", "services") {
+			return
+		}
+
+		factory := informers.NewSharedInformerFactory(c.clientset, 0)
+		ic := &informerCache{services: factory.Core().V1().Services().Informer(), stop: make(chan struct{})}
+
+		// Ready endpoints and pods are read from the API without access to EndpointSlices
+		if c.canWatch(ctx, discoveryv1.GroupName, "endpointslices") {
+			ic.endpointSlices = factory.Discovery().V1().EndpointSlices().Informer()
+			err := ic.endpointSlices.AddIndexers(cache.Indexers{byServiceIndex: func(obj any) ([]string, error) {
+				slice := obj.(*discoveryv1.EndpointSlice)
+				if name := slice.Labels[discoveryv1.LabelServiceName]; name != "" {
+					return []string{slice.Namespace + "/" + name}, nil
+				}
+				return nil, nil
+			}})
+			if err != nil {
+				ic.endpointSlices = nil
+			}
+		}
+
+		for _, informer := range ic.informers() {
+			informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+				// Closed and expired watches are restarted as part of normal operation
+				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) && !apierrors.IsResourceExpired(err) && !apierrors.IsGone(err) {
+					slog.Warn("⚠️  Watching the cluster failed, retrying", "error", err)
+				}
+			})
+		}
+
+		factory.Start(ic.stop)
+		c.cache = ic
+	})
+
+	return c.cache
+}
+
+// getService returns a service from the cache once synced, from the API otherwise
+func (c *client) getService(ctx context.Context, serviceName string, namespace string) (*corev1.Service, error) {
+	if ic := c.startCache(ctx); ic != nil && ic.services.HasSynced() {
+		return ic.service(namespace, serviceName)
+	}
+	return c.clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+}
+
+// WatchServices calls onChange with the services, and whether all of them are listed yet, as they are
+// listed and whenever a service or its endpoints change, until ctx is cancelled. Without permission to
+// watch services it lists them once
+func (c *client) WatchServices(ctx context.Context, onChange func(services []service.ServiceInfo, synced bool)) error {
+	if c.clientset == nil {
+		return fmt.Errorf("kubernetes client not initialized")
+	}
+
+	ic := c.startCache(ctx)
+	if ic == nil {
+		services, err := c.ListServices(ctx)
+		if err != nil {
+			return err
+		}
+		onChange(services, true)
+		return nil
+	}
+
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { notify() },
+		UpdateFunc: func(any, any) { notify() },
+		DeleteFunc: func(any) { notify() },
+	}
+
+	var registrations []func()
+	for _, informer := range ic.informers() {
+		registration, err := informer.AddEventHandler(handler)
+		if err != nil {
+			for _, remove := range registrations {
+				remove()
+			}
+			return fmt.Errorf("failed to watch services: %w", err)
+		}
+		registrations = append(registrations, func() { informer.RemoveEventHandler(registration) })
+	}
+
+	go func() {
+		// The last listed objects may be handled before the informers report being synced
+		if ic.waitForSync(ctx) == nil {
+			notify()
+		}
+	}()
+
+	go func() {
+		defer func() {
+			for _, remove := range registrations {
+				remove()
+			}
+		}()
+
+		notify()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchBatchDelay):
+			}
+
+			onChange(ic.serviceInfos(), ic.synced())
+		}
+	}()
+
+	return nil
+}
+
+// Close stops the informers
+func (c *client) Close() {
+	// Prevent the informers from starting after Close
+	c.cacheOnce.Do(func() {})
+
+	if c.cache != nil {
+		c.cache.stopOnce.Do(func() { close(c.cache.stop) })
+	}
+}
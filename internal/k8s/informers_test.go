@@ -0,0 +1,195 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// newFakeClient returns a client of a fake cluster with objs, where the user may watch the allowed resources
+func newFakeClient(t *testing.T, allowed []string, objs ...runtime.Object) (*client, *fake.Clientset) {
+	t.Helper()
+	clientset := fake.NewClientset(objs...)
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		for _, resource := range allowed {
+			if review.Spec.ResourceAttributes.Resource == resource {
+				review.Status.Allowed = true
+			}
+		}
+		return true, review, nil
+	})
+
+	c := &client{clientset: clientset}
+	t.Cleanup(c.Close)
+	return c, clientset
+}
+
+func testService(namespace string, name string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": name},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromString("web")}},
+		},
+	}
+}
+
+func testEndpointSlice(namespace string, service string, pod string) *discoveryv1.EndpointSlice {
+	ready := true
+	name, port := "http", int32(8080)
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      service + "-abcde",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports:       []discoveryv1.EndpointPort{{Name: &name, Port: &port}},
+		Endpoints: []discoveryv1.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Namespace: namespace, Name: pod},
+		}},
+	}
+}
+
+func TestClient_ServesFromInformers(t *testing.T) {
+	c, _ := newFakeClient(t, []string{"services", "endpointslices"},
+		testService("web", "api"),
+		testService("data", "db"),
+		testEndpointSlice("web", "api", "api-7d9f"),
+	)
+	ctx := context.Background()
+
+	services, err := c.ListServices(ctx)
+	if err != nil {
+		t.Fatalf("ListServices failed: %v", err)
+	}
+	if c.cache == nil || c.cache.endpointSlices == nil {
+		t.Fatal("Expected the informers to be started")
+	}
+	if len(services) != 2 || services[0].String() != "db (ns: data)" || services[1].String() != "api (ns: web)" {
+		t.Fatalf("Expected the sorted services, got %v", services)
+	}
+	if services[0].ReadyEndpoints != 0 || services[1].ReadyEndpoints != 1 {
+		t.Errorf("Expected 0 and 1 ready endpoints, got %d and %d", services[0].ReadyEndpoints, services[1].ReadyEndpoints)
+	}
+
+	info, err := c.GetService(ctx, "api", "web")
+	if err != nil || info.Name != "api" {
+		t.Errorf("Expected the cached service, got %+v %v", info, err)
+	}
+	if _, err := c.GetService(ctx, "missing", "web"); !apierrors.IsNotFound(err) {
+		t.Errorf("Expected a NotFound error, got %v", err)
+	}
+
+	// The named target port is resolved by the EndpointSlices, without listing pods
+	svc, _ := c.cache.service("web", "api")
+	podName, targetPort, err := c.resolveTarget(ctx, svc, &svc.Spec.Ports[0])
+	if err != nil || podName != "api-7d9f" || targetPort != 8080 {
+		t.Errorf("Expected api-7d9f:8080, got %s:%d %v", podName, targetPort, err)
+	}
+
+	svc, _ = c.cache.service("data", "db")
+	if _, _, err := c.resolveTarget(ctx, svc, &svc.Spec.Ports[0]); err == nil {
+		t.Error("Expected an error for a service without ready pods")
+	}
+}
+
+func TestClient_WatchServices(t *testing.T) {
+	c, clientset := newFakeClient(t, []string{"services", "endpointslices"}, testService("web", "api"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates := make(chan []service.ServiceInfo, 10)
+	err := c.WatchServices(ctx, func(services []service.ServiceInfo, synced bool) {
+		if synced {
+			updates <- services
+		}
+	})
+	if err != nil {
+		t.Fatalf("WatchServices failed: %v", err)
+	}
+
+	// waitFor waits for an update listing count services
+	waitFor := func(count int) []service.ServiceInfo {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case services := <-updates:
+				if len(services) == count {
+					return services
+				}
+			case <-timeout:
+				t.Fatalf("Timed out waiting for %d services", count)
+				return nil
+			}
+		}
+	}
+
+	waitFor(1)
+
+	if _, err := clientset.CoreV1().Services("data").Create(ctx, testService("data", "db"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	if services := waitFor(2); services[0].Name != "db" {
+		t.Errorf("Expected the new service to be listed, got %v", services)
+	}
+
+	if err := clientset.CoreV1().Services("web").Delete(ctx, "api", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Failed to delete service: %v", err)
+	}
+	if services := waitFor(1); services[0].Name != "db" {
+		t.Errorf("Expected the deleted service to be gone, got %v", services)
+	}
+}
+
+func TestClient_FallsBackWithoutWatchAccess(t *testing.T) {
+	c, _ := newFakeClient(t, nil, testService("web", "api"))
+	ctx := context.Background()
+
+	calls := 0
+	err := c.WatchServices(ctx, func(services []service.ServiceInfo, synced bool) {
+		calls++
+		if !synced || len(services) != 1 || services[0].Name != "api" {
+			t.Errorf("Expected the listed service, got %v synced %v", services, synced)
+		}
+	})
+	if err != nil {
+		t.Fatalf("WatchServices failed: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the services to be listed once, got %d calls", calls)
+	}
+	if c.cache != nil {
+		t.Error("Expected no informers without watch access")
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	c, _ := newFakeClient(t, []string{"services"}, testService("web", "api"))
+	c.Close()
+	c.Close()
+
+	// Informers do not start once the client is closed
+	if ic := c.startCache(context.Background()); ic != nil {
+		t.Error("Expected no informers after Close")
+	}
+	if _, err := c.ListServices(context.Background()); err != nil {
+		t.Errorf("Expected ListServices to fall back to the API, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// ServerVersion returns the version of the Kubernetes API server
+func (c *client) ServerVersion(ctx context.Context) (string, error) {
+	if c.clientset == nil {
+		return "", fmt.Errorf("kubernetes client not initialized")
+	}
+
+	// Request the version endpoint directly, the discovery client does not take a context
+	result := c.clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx)
+	var info struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	raw, err := result.Raw()
+	if err != nil {
+		return "", fmt.Errorf("failed to reach API server %s: %w", c.config.Host, err)
+	}
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return "", fmt.Errorf("failed to decode API server version: %w", err)
+	}
+
+	return info.GitVersion, nil
+}
+
+// CanI reports whether the current user may perform verb on resource (and subresource) in namespace,
+// all namespaces if empty, with the authorizer's reason
+func (c *client) CanI(ctx context.Context, namespace string, verb string, resource string, subresource string) (bool, string, error) {
+	if c.clientset == nil {
+		return false, "", fmt.Errorf("kubernetes client not initialized")
+	}
+
+	return c.access(ctx, authorizationv1.ResourceAttributes{
+		Namespace:   namespace,
+		Verb:        verb,
+		Resource:    resource,
+		Subresource: subresource,
+	})
+}
+
+// access reviews whether the current user may perform the action described by attributes
+func (c *client) access(ctx context.Context, attributes authorizationv1.ResourceAttributes) (bool, string, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+	}
+
+	response, err := c.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to create SelfSubjectAccessReview: %w", err)
+	}
+
+	return response.Status.Allowed, response.Status.Reason, nil
+}
+
+// CheckKubeconfig validates the kubeconfig at path, the default location if empty:
+// that it loads, has the context, the current one if contextName is empty, and that its credentials can be used
+func CheckKubeconfig(path string, contextName string) []service.CheckResult {
+	path, err := resolveKubeconfigPath(path)
+	if err != nil {
+		return []service.CheckResult{{Name: "Kubeconfig", Status: service.CheckFail, Detail: err.Error(), Hint: "set KUBECONFIG or pass the kubeconfig path"}}
+	}
+
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return []service.CheckResult{{
+			Name:   "Kubeconfig",
+			Status: service.CheckFail,
+			Detail: err.Error(),
+			Hint:   "set KUBECONFIG or pass the path of a valid kubeconfig file",
+		}}
+	}
+
+	results := []service.CheckResult{{Name: "Kubeconfig", Status: service.CheckPass, Detail: path}}
+
+	name, hint := config.CurrentContext, "select a context with kubectl config use-context"
+	if contextName != "" {
+		name, hint = contextName, "pick a context listed by kubectl config get-contexts with --context or the profile"
+	}
+
+	kubeContext, ok := config.Contexts[name]
+	if name == "" || !ok {
+		return append(results, service.CheckResult{
+			Name:   "Current context",
+			Status: service.CheckFail,
+			Detail: fmt.Sprintf("context %q not found", name),
+			Hint:   hint,
+		})
+	}
+	results = append(results, service.CheckResult{Name: "Current context", Status: service.CheckPass, Detail: name})
+
+	if cluster, ok := config.Clusters[kubeContext.Cluster]; !ok || cluster.Server == "" {
+		results = append(results, service.CheckResult{
+			Name:   "Cluster",
+			Status: service.CheckFail,
+			Detail: fmt.Sprintf("cluster %q of context %q has no server address", kubeContext.Cluster, name),
+			Hint:   "fix the clusters section of the kubeconfig",
+		})
+	}
+
+	user, ok := config.AuthInfos[kubeContext.AuthInfo]
+	switch {
+	case !ok:
+		results = append(results, service.CheckResult{
+			Name:   "Credentials",
+			Status: service.CheckWarn,
+			Detail: fmt.Sprintf("user %q of context %q not found", kubeContext.AuthInfo, name),
+			Hint:   "requests are sent without credentials, fix the users section of the kubeconfig",
+		})
+	case user.Exec != nil:
+		results = append(results, checkExecPlugin(user.Exec.Command))
+	case user.AuthProvider != nil:
+		results = append(results, service.CheckResult{
+			Name:   "Credentials",
+			Status: service.CheckFail,
+			Detail: fmt.Sprintf("auth provider %q is no longer supported by client-go", user.AuthProvider.Name),
+			Hint:   "migrate to the provider's exec credential plugin, e.g. gke-gcloud-auth-plugin or kubelogin",
+		})
+	case user.Token != "" || user.TokenFile != "":
+		results = append(results, service.CheckResult{Name: "Credentials", Status: service.CheckPass, Detail: "bearer token"})
+	case len(user.ClientCertificateData) > 0 || user.ClientCertificate != "":
+		results = append(results, service.CheckResult{Name: "Credentials", Status: service.CheckPass, Detail: "client certificate"})
+	case user.Username != "":
+		results = append(results, service.CheckResult{Name: "Credentials", Status: service.CheckPass, Detail: "basic auth"})
+	default:
+		results = append(results, service.CheckResult{
+			Name:   "Credentials",
+			Status: service.CheckWarn,
+			Detail: fmt.Sprintf("user %q has no credentials", kubeContext.AuthInfo),
+			Hint:   "requests are sent anonymously, most clusters reject them",
+		})
+	}
+
+	return results
+}
+
+// checkExecPlugin checks that the credential plugin command of the kubeconfig can be found
+func checkExecPlugin(command string) service.CheckResult {
+	result := service.CheckResult{Name: "Credentials"}
+
+	if resolved, err := exec.LookPath(command); err != nil {
+		result.Status = service.CheckFail
+		result.Detail = fmt.Sprintf("exec credential plugin %q not found", command)
+		result.Hint = "install the plugin or add its directory to PATH"
+	} else {
+		result.Status = service.CheckPass
+		result.Detail = "exec credential plugin " + resolved
+	}
+
+	return result
+}
@@ -0,0 +1,147 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// writeKubeconfig writes a kubeconfig for server with the given user section and returns its path
+func writeKubeconfig(t *testing.T, server string, user string) string {
+	t.Helper()
+	content := `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: ` + server + `
+  name: test-cluster
+contexts:
+- context:
+    cluster: test-cluster
+    user: test-user
+  name: test-context
+current-context: test-context
+users:
+- name: test-user
+  user:
+` + user
+
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write kubeconfig: %v", err)
+	}
+	return path
+}
+
+func TestCheckKubeconfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		user        string
+		credentials service.CheckStatus
+		detail      string
+	}{
+		{"token", "    token: fake-token\n", service.CheckPass, "bearer token"},
+		{"missing exec plugin", "    exec:\n      apiVersion: client.authentication.k8s.io/v1\n      command: no-such-auth-plugin\n", service.CheckFail, `exec credential plugin "no-such-auth-plugin" not found`},
+		{"legacy auth provider", "    auth-provider:\n      name: gcp\n", service.CheckFail, `auth provider "gcp" is no longer supported by client-go`},
+		{"no credentials", "    {}\n", service.CheckWarn, `user "test-user" has no credentials`},
+	}
+
+	for _, tt := range tests {
+		results := CheckKubeconfig(writeKubeconfig(t, "https://fake-k8s-server.example.com", tt.user), "")
+
+		if len(results) != 3 || results[0].Status != service.CheckPass || results[1].Detail != "test-context" {
+			t.Errorf("%s: unexpected results %+v", tt.name, results)
+			continue
+		}
+
+		if credentials := results[2]; credentials.Status != tt.credentials || credentials.Detail != tt.detail {
+			t.Errorf("%s: expected credentials %s %q, got %s %q", tt.name, tt.credentials, tt.detail, credentials.Status, credentials.Detail)
+		}
+	}
+}
+
+func TestCheckKubeconfig_Invalid(t *testing.T) {
+	results := CheckKubeconfig(filepath.Join(t.TempDir(), "missing"), "")
+	if len(results) != 1 || results[0].Status != service.CheckFail {
+		t.Errorf("Expected a failed kubeconfig check, got %+v", results)
+	}
+
+	path := writeKubeconfig(t, "https://fake-k8s-server.example.com", "    token: fake-token\n")
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), "current-context: test-context", "current-context: other", 1)), 0600)
+
+	results = CheckKubeconfig(path, "")
+	if len(results) != 2 || results[1].Status != service.CheckFail {
+		t.Errorf("Expected a failed current context check, got %+v", results)
+	}
+
+	// An explicit context replaces the current one
+	results = CheckKubeconfig(path, "test-context")
+	if len(results) != 3 || results[1].Status != service.CheckPass || results[1].Detail != "test-context" {
+		t.Errorf("Expected the given context to be checked, got %+v", results)
+	}
+	results = CheckKubeconfig(path, "missing")
+	if len(results) != 2 || results[1].Status != service.CheckFail {
+		t.Errorf("Expected a failed check for a missing context, got %+v", results)
+	}
+}
+
+func TestServerVersionAndCanI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/version":
+			w.Write([]byte(`{"gitVersion":"v1.34.0"}`))
+		case "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews":
+			// client-go may send protobuf, the universal deserializer reads any format
+			body, _ := io.ReadAll(r.Body)
+			obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(body, nil, nil)
+			if err != nil {
+				t.Errorf("Failed to decode review sent as %s: %v", r.Header.Get("Content-Type"), err)
+				return
+			}
+			review := obj.(*authorizationv1.SelfSubjectAccessReview)
+			attrs := review.Spec.ResourceAttributes
+			review.Status.Allowed = attrs.Verb != "create"
+			if !review.Status.Allowed {
+				review.Status.Reason = "no RBAC policy matched"
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(review)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c, err := New(writeKubeconfig(t, server.URL, "    token: fake-token\n"), "")
+	if err != nil {
+		t.Fatalf("New should not return an error: %v", err)
+	}
+
+	version, err := c.ServerVersion(context.Background())
+	if err != nil || version != "v1.34.0" {
+		t.Errorf("Expected version v1.34.0, got %q (%v)", version, err)
+	}
+
+	allowed, _, err := c.CanI(context.Background(), "default", "get", "pods", "")
+	if err != nil || !allowed {
+		t.Errorf("Expected get pods to be allowed, got %v (%v)", allowed, err)
+	}
+
+	allowed, reason, err := c.CanI(context.Background(), "default", "create", "pods", "portforward")
+	if err != nil || allowed || reason != "no RBAC policy matched" {
+		t.Errorf("Expected create pods/portforward to be denied with a reason, got %v %q (%v)", allowed, reason, err)
+	}
+}
@@ -0,0 +1,77 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecretRefPrefix starts a reference to a credential stored in a Secret: secret://namespace/name/key
+const SecretRefPrefix = "secret://"
+
+// IsSecretRef reports whether value references a Secret key instead of holding a credential
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretRefPrefix)
+}
+
+// ParseSecretRef splits a secret://namespace/name/key reference
+func ParseSecretRef(ref string) (string, string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(ref, SecretRefPrefix), "/")
+	if !IsSecretRef(ref) || len(parts) != 3 || slices.Contains(parts, "") {
+		return "", "", "", fmt.Errorf("invalid secret reference %q, use secret://namespace/name/key", ref)
+	}
+
+	return parts[0], parts[1], parts[2], nil
+}
+
+// GetSecret returns the data of a Secret
+func (c *client) GetSecret(ctx context.Context, namespace string, name string) (map[string][]byte, error) {
+	if c.clientset == nil {
+		return nil, fmt.Errorf("kubernetes client not initialized")
+	}
+
+	secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsForbidden(err):
+		return nil, fmt.Errorf("not allowed to read secret %s/%s, ask for get access to secrets in namespace %s: %w", namespace, name, namespace, err)
+	case apierrors.IsNotFound(err):
+		return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
+	case err != nil:
+		return nil, fmt.Errorf("failed to get secret %s in namespace %s: %w", name, namespace, err)
+	}
+
+	return secret.Data, nil
+}
+
+// ResolveCredential returns value, or the Secret key it references with surrounding whitespace trimmed.
+// Errors name the reference but never the credential
+func (c *client) ResolveCredential(ctx context.Context, value string) (string, error) {
+	if !IsSecretRef(value) {
+		return value, nil
+	}
+
+	namespace, name, key, err := ParseSecretRef(value)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := c.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return "", err
+	}
+
+	credential, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no key %q, available keys: %s", namespace, name, key, strings.Join(slices.Sorted(maps.Keys(data)), ", "))
+	}
+	if len(strings.TrimSpace(string(credential))) == 0 {
+		return "", fmt.Errorf("key %q of secret %s/%s is empty", key, namespace, name)
+	}
+
+	return strings.TrimSpace(string(credential)), nil
+}
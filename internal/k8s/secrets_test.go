@@ -0,0 +1,78 @@
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	namespace, name, key, err := ParseSecretRef("secret://tools/ngrok/authtoken")
+	if err != nil || namespace != "tools" || name != "ngrok" || key != "authtoken" {
+		t.Errorf("Unexpected parse result %q %q %q %v", namespace, name, key, err)
+	}
+
+	for _, ref := range []string{"secret://tools/ngrok", "secret://tools//authtoken", "secret://a/b/c/d", "tools/ngrok/authtoken"} {
+		if _, _, _, err := ParseSecretRef(ref); err == nil {
+			t.Errorf("Expected an error for %q", ref)
+		}
+	}
+}
+
+func TestResolveCredential(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/namespaces/tools/secrets/ngrok":
+			// "c3VwZXItc2VjcmV0Cg==" is "super-secret\n"
+			w.Write([]byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"ngrok","namespace":"tools"},` +
+				`"data":{"authtoken":"c3VwZXItc2VjcmV0Cg==","empty":""}}`))
+		case "/api/v1/namespaces/locked/secrets/ngrok":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"apiVersion":"v1","kind":"Status","status":"Failure","reason":"Forbidden","code":403,` +
+				`"message":"secrets \"ngrok\" is forbidden"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"apiVersion":"v1","kind":"Status","status":"Failure","reason":"NotFound","code":404}`))
+		}
+	}))
+	defer server.Close()
+
+	c, err := New(writeKubeconfig(t, server.URL, "    token: fake-token\n"), "")
+	if err != nil {
+		t.Fatalf("New should not return an error: %v", err)
+	}
+	ctx := context.Background()
+
+	if value, err := c.ResolveCredential(ctx, "plain-token"); err != nil || value != "plain-token" {
+		t.Errorf("Expected a plain value to be returned as is, got %q %v", value, err)
+	}
+	if value, err := c.ResolveCredential(ctx, "secret://tools/ngrok/authtoken"); err != nil || value != "super-secret" {
+		t.Errorf("Expected the trimmed secret value, got %q %v", value, err)
+	}
+
+	tests := []struct {
+		ref     string
+		message string
+	}{
+		{ref: "secret://tools/ngrok/missing", message: "available keys: authtoken, empty"},
+		{ref: "secret://tools/ngrok/empty", message: "is empty"},
+		{ref: "secret://locked/ngrok/authtoken", message: "ask for get access to secrets in namespace locked"},
+		{ref: "secret://tools/other/authtoken", message: "secret tools/other not found"},
+		{ref: "secret://tools/ngrok", message: "invalid secret reference"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			_, err := c.ResolveCredential(ctx, tt.ref)
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("Expected an error containing %q, got %v", tt.message, err)
+			}
+			if strings.Contains(err.Error(), "super-secret") {
+				t.Errorf("Error should not contain the credential: %v", err)
+			}
+		})
+	}
+}
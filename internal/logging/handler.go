@@ -0,0 +1,189 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ANSI colors of the console levels
+const (
+	colorDebug = "\x1b[2m"
+	colorWarn  = "\x1b[33m"
+	colorError = "\x1b[31m"
+	colorReset = "\x1b[0m"
+)
+
+// consoleHandler writes records as the lines service-exporter always printed: the message, the error after
+// a colon and the other attributes as key=value pairs. Levels other than info are colored, or named in plain mode
+type consoleHandler struct {
+	out   *switchWriter
+	level slog.Leveler
+	color bool
+	plain bool
+
+	// attrs and errs are the formatted attributes and errors of WithAttrs, prefix the groups of WithGroup
+	attrs  string
+	errs   string
+	prefix string
+	mu     *sync.Mutex
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	errs, attrs := h.errs, h.attrs
+	r.Attrs(func(a slog.Attr) bool {
+		e, s := h.format(h.prefix, a)
+		errs, attrs = errs+e, attrs+s
+		return true
+	})
+
+	// Leading blank lines separate sections of the output, they stay before the level
+	message := r.Message
+	if h.plain {
+		message = stripEmoji(message)
+	}
+	body := strings.TrimLeft(message, "\n")
+	line := message[:len(message)-len(body)]
+
+	if h.plain && r.Level != slog.LevelInfo {
+		body = r.Level.String() + " " + body
+	}
+	body += errs + attrs
+
+	color := ""
+	if h.color && h.out.isTerminal() {
+		switch {
+		case r.Level >= slog.LevelError:
+			color = colorError
+		case r.Level >= slog.LevelWarn:
+			color = colorWarn
+		case r.Level < slog.LevelInfo:
+			color = colorDebug
+		}
+	}
+	if color != "" {
+		body = color + body + colorReset
+	}
+	line += body + "\n"
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.out.Write([]byte(line))
+	return err
+}
+
+// format returns an attribute as ": error" if it is an error, " key=value" otherwise
+func (h *consoleHandler) format(prefix string, a slog.Attr) (string, string) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return "", ""
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		var errs, attrs string
+		for _, member := range a.Value.Group() {
+			e, s := h.format(prefix, member)
+			errs, attrs = errs+e, attrs+s
+		}
+		return errs, attrs
+	}
+
+	value := a.Value.String()
+	if a.Key == "error" && prefix == "" {
+		return ": " + value, ""
+	}
+	if value == "" || strings.ContainsFunc(value, func(r rune) bool { return unicode.IsSpace(r) || r == '"' || r == '=' }) {
+		value = strconv.Quote(value)
+	}
+	return "", " " + prefix + a.Key + "=" + value
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	for _, a := range attrs {
+		e, s := h.format(h.prefix, a)
+		c.errs, c.attrs = c.errs+e, c.attrs+s
+	}
+	return &c
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix += name + "."
+	return &c
+}
+
+// jsonHandler writes records as JSON lines, leaving out the decoration of the console output
+type jsonHandler struct {
+	slog.Handler
+}
+
+func (h *jsonHandler) Handle(ctx context.Context, r slog.Record) error {
+	// Separator lines such as "=====" only make sense on a console
+	if strings.Trim(stripEmoji(r.Message), "=- \n") == "" {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *jsonHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &jsonHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *jsonHandler) WithGroup(name string) slog.Handler {
+	return &jsonHandler{h.Handler.WithGroup(name)}
+}
+
+// replaceMessage removes the emoji and blank lines of the console output from JSON messages
+func replaceMessage(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.MessageKey {
+		a.Value = slog.StringValue(strings.TrimSpace(stripEmoji(a.Value.String())))
+	}
+	return a
+}
+
+// stripEmoji removes the emoji of a message with the spaces following them
+func stripEmoji(message string) string {
+	var b strings.Builder
+	afterEmoji := false
+	for _, r := range message {
+		switch {
+		case isEmoji(r):
+			afterEmoji = true
+		case afterEmoji && r == ' ':
+		default:
+			afterEmoji = false
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// isEmoji reports whether r is an emoji, a symbol shown as one or a modifier of one
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF, // Emoji and pictographs
+		r >= 0x2600 && r <= 0x27BF, // Miscellaneous symbols and dingbats, such as ⚠ and ✅
+		r >= 0x2B00 && r <= 0x2BFF, // Arrows and symbols, such as ⭐
+		r >= 0x2300 && r <= 0x23FF, // Technical symbols, such as ⏰ and ⏳
+		r == 0x21A9 || r == 0x21AA, // ↩ and ↪
+		r == 0x2139,                // ℹ
+		r == 0x200D,                // Zero width joiner
+		r >= 0xFE00 && r <= 0xFE0F: // Variation selectors
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newConsoleLogger(buf *bytes.Buffer, level slog.Level, plain bool) *slog.Logger {
+	return slog.New(&consoleHandler{out: &switchWriter{w: buf}, level: level, color: !plain, plain: plain, mu: &sync.Mutex{}})
+}
+
+func TestConsoleHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newConsoleLogger(&buf, slog.LevelInfo, false)
+
+	logger.Info("\n🎉 Setup complete!")
+	logger.Warn("⚠️  Watching the cluster failed, retrying", "error", errors.New("connection refused"))
+	logger.With("component", "ngrok").WithGroup("session").Info("connected", "region", "eu west", "id", "")
+	logger.Debug("hidden")
+
+	want := "\n🎉 Setup complete!\n" +
+		"⚠️  Watching the cluster failed, retrying: connection refused\n" +
+		"connected component=ngrok session.region=\"eu west\" session.id=\"\"\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%q\ngot:\n%q", want, buf.String())
+	}
+}
+
+func TestConsoleHandler_Plain(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newConsoleLogger(&buf, slog.LevelDebug, true)
+
+	logger.Info("\n🎉 Setup complete!")
+	logger.Warn("⚠️  Policy warning", "error", errors.New("port 22"))
+	logger.Debug("forwarding", "pod", "api-1")
+	logger.Info("   💡 Run ↩️  again, 8080 → 8000")
+
+	want := "\nSetup complete!\n" +
+		"WARN Policy warning: port 22\n" +
+		"DEBUG forwarding pod=api-1\n" +
+		"   Run again, 8080 → 8000\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%q\ngot:\n%q", want, buf.String())
+	}
+}
+
+func TestJSONHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(&jsonHandler{slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: replaceMessage})})
+
+	logger.Info("\n⚙️  Configuration Setup")
+	logger.Info("=====================")
+	logger.Warn("⚠️  Failed to write audit log", "error", "disk full")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records without the separator, got %d:\n%s", len(lines), buf.String())
+	}
+
+	var record struct {
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("Failed to parse record: %v", err)
+	}
+	if record.Level != "WARN" || record.Msg != "Failed to write audit log" || record.Error != "disk full" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if !strings.Contains(lines[0], `"msg":"Configuration Setup"`) {
+		t.Errorf("Expected the message without emoji, got %s", lines[0])
+	}
+}
+
+func TestStripEmoji(t *testing.T) {
+	tests := map[string]string{
+		"✅ Selected service":             "Selected service",
+		"\n🔄 Performing shutdown...":     "\nPerforming shutdown...",
+		"   💡 set KUBECONFIG":            "   set KUBECONFIG",
+		"🗑️  Removed the token":          "Removed the token",
+		"no emoji: 80 → 8080 (http)":     "no emoji: 80 → 8080 (http)",
+		"📌 Press Ctrl+C\n⏰ Stopping now": "Press Ctrl+C\nStopping now",
+	}
+	for input, want := range tests {
+		if got := stripEmoji(input); got != want {
+			t.Errorf("stripEmoji(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
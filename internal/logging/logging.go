@@ -0,0 +1,256 @@
+// Package logging configures the log/slog logger of service-exporter: human-readable lines or JSON records,
+// the level and a plain mode without colors and emoji for CI terminals
+package logging
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+	"k8s.io/klog/v2"
+)
+
+// Environment variables setting the defaults of the flags
+const (
+	LevelEnv  = "SERVICE_EXPORTER_LOG_LEVEL"
+	FormatEnv = "SERVICE_EXPORTER_LOG_FORMAT"
+	// NoColorEnv disables colors when set to any value, see https://no-color.org
+	NoColorEnv = "NO_COLOR"
+)
+
+// Format is the format of log records
+type Format string
+
+const (
+	// FormatText writes records as human-readable lines
+	FormatText Format = "text"
+	// FormatJSON writes records as JSON lines
+	FormatJSON Format = "json"
+)
+
+// settings are the logging flags, applied to the default logger whenever one changes
+var settings = struct {
+	mu      sync.Mutex
+	level   slog.LevelVar
+	format  Format
+	noColor bool
+	plain   bool
+}{format: FormatText}
+
+// output is where the records are written, standard error unless captured by SetOutput
+var output = &switchWriter{w: os.Stderr}
+
+// Setup makes the logger of service-exporter the default slog logger, and routes the log package through it.
+// The flags registered with RegisterFlags reconfigure it as they are parsed
+func Setup() error {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+
+	if value := os.Getenv(LevelEnv); value != "" {
+		if err := settings.level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("invalid %s: %w", LevelEnv, err)
+		}
+	}
+	if value := os.Getenv(FormatEnv); value != "" {
+		format, err := parseFormat(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", FormatEnv, err)
+		}
+		settings.format = format
+	}
+	settings.noColor = os.Getenv(NoColorEnv) != ""
+
+	apply()
+	return nil
+}
+
+// apply replaces the default logger with one of the current settings, settings.mu is held
+func apply() {
+	var handler slog.Handler
+	switch settings.format {
+	case FormatJSON:
+		handler = &jsonHandler{slog.NewJSONHandler(output, &slog.HandlerOptions{
+			Level:       &settings.level,
+			ReplaceAttr: replaceMessage,
+		})}
+	default:
+		handler = &consoleHandler{
+			out:   output,
+			level: &settings.level,
+			color: !settings.noColor && !settings.plain,
+			plain: settings.plain,
+			mu:    &sync.Mutex{},
+		}
+	}
+
+	// The log package writes through the handler at the info level from now on
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+
+	// client-go logs retries and watch errors through klog, only worth seeing when debugging.
+	// Settings are applied while parsing flags, before any Kubernetes client logs
+	klog.SetSlogLogger(AtLevel(logger.With("component", "client-go"), slog.LevelDebug))
+}
+
+// RegisterFlags registers the --log-level, --log-format, --no-color and --plain flags, applied as they are parsed
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.Func("log-level", "minimum level of log messages: debug, info, warn or error (default info, or $"+LevelEnv+")", func(value string) error {
+		settings.mu.Lock()
+		defer settings.mu.Unlock()
+		return settings.level.UnmarshalText([]byte(value))
+	})
+	fs.Func("log-format", "format of log messages: text or json (default text, or $"+FormatEnv+")", func(value string) error {
+		format, err := parseFormat(value)
+		if err != nil {
+			return err
+		}
+		settings.mu.Lock()
+		defer settings.mu.Unlock()
+		settings.format = format
+		apply()
+		return nil
+	})
+	fs.BoolFunc("no-color", "disable colors in log messages and prompts (default $"+NoColorEnv+")", func(value string) error {
+		return setBool(value, &settings.noColor)
+	})
+	fs.BoolFunc("plain", "plain output for CI terminals: no colors and no emoji in log messages", func(value string) error {
+		return setBool(value, &settings.plain)
+	})
+}
+
+// setBool sets a boolean setting from a flag value and applies it
+func setBool(value string, setting *bool) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", value)
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	*setting = enabled
+	apply()
+	return nil
+}
+
+// parseFormat parses a log format
+func parseFormat(value string) (Format, error) {
+	switch format := Format(strings.ToLower(value)); format {
+	case FormatText, FormatJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown log format %q, use text or json", value)
+}
+
+// Color reports whether colors may be used, neither --no-color, --plain nor NO_COLOR disable them
+func Color() bool {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	return !settings.noColor && !settings.plain
+}
+
+// Plain reports whether --plain asks for output without emoji
+func Plain() bool {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	return settings.plain
+}
+
+// SetOutput writes the log records to w, such as the log pane of the dashboard, until restore is called
+func SetOutput(w io.Writer) (restore func()) {
+	output.mu.Lock()
+	previous := output.w
+	output.w = w
+	output.mu.Unlock()
+
+	return func() {
+		output.mu.Lock()
+		output.w = previous
+		output.mu.Unlock()
+	}
+}
+
+// switchWriter writes to a writer that can be replaced while in use
+type switchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// isTerminal reports whether records are currently written to a terminal
+func (s *switchWriter) isTerminal() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// Writer returns a writer logging each line written to it with logger at level, for libraries writing their logs to an io.Writer
+func Writer(logger *slog.Logger, level slog.Level) io.Writer {
+	return &lineWriter{logger: logger, level: level}
+}
+
+// lineWriter logs the lines written to it, keeping an incomplete last line until it is completed
+type lineWriter struct {
+	logger *slog.Logger
+	level  slog.Level
+
+	mu      sync.Mutex
+	pending string
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	lines := strings.Split(w.pending+string(p), "\n")
+	w.pending = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		if line = strings.TrimSpace(line); line != "" {
+			w.logger.Log(context.Background(), w.level, line)
+		}
+	}
+	return len(p), nil
+}
+
+// AtLevel returns a logger writing every record of logger at level, to show chatty libraries only when debugging
+func AtLevel(logger *slog.Logger, level slog.Level) *slog.Logger {
+	return slog.New(&levelHandler{Handler: logger.Handler(), level: level})
+}
+
+// levelHandler handles every record at level
+type levelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, _ slog.Level) bool {
+	return h.Handler.Enabled(ctx, h.level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	// Some loggers, such as logr's for errors, handle records without asking whether they are enabled
+	if !h.Handler.Enabled(ctx, h.level) {
+		return nil
+	}
+	r.Level = h.level
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/klog/v2"
+)
+
+// captureOutput sets up the default logger writing to a buffer, restoring the settings after the test
+func captureOutput(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	t.Setenv(LevelEnv, "")
+	t.Setenv(FormatEnv, "")
+	t.Setenv(NoColorEnv, "")
+
+	previous := slog.Default()
+	t.Cleanup(func() {
+		settings.mu.Lock()
+		settings.level.Set(slog.LevelInfo)
+		settings.format, settings.noColor, settings.plain = FormatText, false, false
+		settings.mu.Unlock()
+		slog.SetDefault(previous)
+	})
+
+	if err := Setup(); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	t.Cleanup(SetOutput(&buf))
+	return &buf
+}
+
+func TestRegisterFlags(t *testing.T) {
+	buf := captureOutput(t)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(fs)
+	if err := fs.Parse([]string{"--log-level", "debug", "--log-format", "json", "--plain"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if Color() || !Plain() {
+		t.Errorf("Expected plain output without colors")
+	}
+
+	slog.Debug("forwarding", "pod", "api-1")
+	log.Printf("🎉 Setup complete!")
+	if got := buf.String(); !strings.Contains(got, `"level":"DEBUG","msg":"forwarding","pod":"api-1"`) || !strings.Contains(got, `"msg":"Setup complete!"`) {
+		t.Errorf("Expected JSON records of slog and log, got:\n%s", got)
+	}
+
+	for _, args := range [][]string{{"--log-level", "loud"}, {"--log-format", "xml"}, {"--plain=maybe"}} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(&bytes.Buffer{})
+		RegisterFlags(fs)
+		if err := fs.Parse(args); err == nil {
+			t.Errorf("Expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestSetup_Environment(t *testing.T) {
+	buf := captureOutput(t)
+	t.Setenv(LevelEnv, "warn")
+	t.Setenv(NoColorEnv, "1")
+	if err := Setup(); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	slog.Info("hidden")
+	slog.Warn("shown")
+	if buf.String() != "shown\n" || Color() {
+		t.Errorf("Expected only the warning without colors, got %q", buf.String())
+	}
+
+	t.Setenv(FormatEnv, "yaml")
+	if err := Setup(); err == nil {
+		t.Error("Expected an invalid format to be rejected")
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	buf := captureOutput(t)
+
+	var captured bytes.Buffer
+	restore := SetOutput(&captured)
+	log.Println("captured")
+	restore()
+	log.Println("restored")
+
+	if captured.String() != "captured\n" || buf.String() != "restored\n" {
+		t.Errorf("Expected the output to be captured then restored, got %q and %q", captured.String(), buf.String())
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(&consoleHandler{out: &switchWriter{w: &buf}, level: slog.LevelDebug, mu: &sync.Mutex{}})
+
+	w := Writer(logger.With("component", "port-forward"), slog.LevelDebug)
+	w.Write([]byte("Forwarding from 127.0.0.1:8000 -> 8080\nHandling conn"))
+	w.Write([]byte("ection for 8000\n\n"))
+
+	want := "Forwarding from 127.0.0.1:8000 -> 8080 component=port-forward\nHandling connection for 8000 component=port-forward\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%q\ngot:\n%q", want, buf.String())
+	}
+}
+
+func TestAtLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(&consoleHandler{out: &switchWriter{w: &buf}, level: slog.LevelInfo, plain: true, mu: &sync.Mutex{}})
+
+	AtLevel(logger, slog.LevelDebug).Error("reflector failed")
+	if buf.Len() != 0 {
+		t.Errorf("Expected the error to be logged at debug and hidden, got %q", buf.String())
+	}
+
+	AtLevel(logger, slog.LevelWarn).With("component", "client-go").Info("throttled")
+	if buf.String() != "WARN throttled component=client-go\n" {
+		t.Errorf("Expected a warning, got %q", buf.String())
+	}
+}
+
+func TestSetup_Klog(t *testing.T) {
+	buf := captureOutput(t)
+
+	klog.Error("watch of *v1.Service ended")
+	if buf.Len() != 0 {
+		t.Errorf("Expected client-go logs to be hidden above the debug level, got %q", buf.String())
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(fs)
+	if err := fs.Parse([]string{"--log-level", "debug"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	klog.Error("watch of *v1.Service ended")
+	if !strings.Contains(buf.String(), "watch of *v1.Service ended") || !strings.Contains(buf.String(), "component=client-go") {
+		t.Errorf("Expected the client-go log at the debug level, got %q", buf.String())
+	}
+}
@@ -0,0 +1,241 @@
+package ngrok
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// AgentConfig is the part of the ngrok agent configuration file reused by the exporter
+type AgentConfig struct {
+	// Path is the file the configuration was read from
+	Path string
+	// AuthToken is the authtoken of the agent
+	AuthToken string
+
+	tunnels   map[string]agentTunnel
+	endpoints []agentEndpoint
+}
+
+// AgentEndpoint holds the settings of a named tunnel or endpoint applied to an exposure
+type AgentEndpoint struct {
+	Name          string
+	TunnelType    service.TunnelType
+	Domain        string
+	Auth          service.TunnelAuth
+	TrafficPolicy string
+}
+
+// agentConfigFile is the ngrok agent configuration file, version 2 with tunnels or version 3 with endpoints
+type agentConfigFile struct {
+	AuthToken string `json:"authtoken"`
+	Agent     struct {
+		AuthToken string `json:"authtoken"`
+	} `json:"agent"`
+	Tunnels   map[string]agentTunnel `json:"tunnels"`
+	Endpoints []agentEndpoint        `json:"endpoints"`
+}
+
+// agentTunnel is a named tunnel of a version 2 configuration
+type agentTunnel struct {
+	Proto         string          `json:"proto"`
+	Domain        string          `json:"domain"`
+	Hostname      string          `json:"hostname"`
+	BasicAuth     []string        `json:"basic_auth"`
+	OAuth         *agentOAuth     `json:"oauth"`
+	TrafficPolicy json.RawMessage `json:"traffic_policy"`
+}
+
+// agentOAuth is the OAuth setting of a version 2 tunnel
+type agentOAuth struct {
+	Provider     string   `json:"provider"`
+	AllowDomains []string `json:"allow_domains"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+}
+
+// agentEndpoint is an endpoint of a version 3 configuration
+type agentEndpoint struct {
+	Name          string          `json:"name"`
+	URL           string          `json:"url"`
+	TrafficPolicy json.RawMessage `json:"traffic_policy"`
+}
+
+// AgentConfigPaths returns the standard locations of the ngrok agent configuration file by preference
+func AgentConfigPaths() []string {
+	var paths []string
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("LOCALAPPDATA"); dir != "" {
+			paths = append(paths, filepath.Join(dir, "ngrok", "ngrok.yml"))
+		}
+	} else if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "ngrok", "ngrok.yml"))
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		// ~/.config on macOS, and the location of ngrok v2
+		paths = append(paths, filepath.Join(home, ".config", "ngrok", "ngrok.yml"), filepath.Join(home, ".ngrok2", "ngrok.yml"))
+	}
+
+	return slices.Compact(paths)
+}
+
+// LoadAgentConfig reads the file set with NGROK_CONFIG, or the first one found at the standard locations.
+// The zero AgentConfig is returned if there is none
+func LoadAgentConfig() (AgentConfig, error) {
+	if path := os.Getenv("NGROK_CONFIG"); path != "" {
+		return ReadAgentConfig(path)
+	}
+
+	for _, path := range AgentConfigPaths() {
+		config, err := ReadAgentConfig(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		return config, err
+	}
+
+	return AgentConfig{}, nil
+}
+
+// ReadAgentConfig reads the ngrok agent configuration file at path
+func ReadAgentConfig(path string) (AgentConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return AgentConfig{}, fmt.Errorf("failed to read ngrok agent config: %w", err)
+	}
+
+	config, err := ParseAgentConfig(data)
+	if err != nil {
+		return AgentConfig{}, fmt.Errorf("failed to parse ngrok agent config %s: %w", path, err)
+	}
+	config.Path = path
+
+	return config, nil
+}
+
+// ParseAgentConfig parses an ngrok agent configuration file, ignoring the settings the exporter does not use
+func ParseAgentConfig(data []byte) (AgentConfig, error) {
+	var file agentConfigFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return AgentConfig{}, err
+	}
+
+	for _, e := range file.Endpoints {
+		if e.Name == "" {
+			return AgentConfig{}, fmt.Errorf("endpoint %q has no name", e.URL)
+		}
+	}
+
+	return AgentConfig{
+		AuthToken: strings.TrimSpace(cmp.Or(file.Agent.AuthToken, file.AuthToken)),
+		tunnels:   file.Tunnels,
+		endpoints: file.Endpoints,
+	}, nil
+}
+
+// EndpointNames returns the names of the tunnels and endpoints defined in the configuration
+func (c AgentConfig) EndpointNames() []string {
+	names := make([]string, 0, len(c.tunnels)+len(c.endpoints))
+	for name := range c.tunnels {
+		names = append(names, name)
+	}
+	for _, e := range c.endpoints {
+		names = append(names, e.Name)
+	}
+
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// Endpoint returns the settings of the named tunnel or endpoint
+func (c AgentConfig) Endpoint(name string) (AgentEndpoint, error) {
+	for _, e := range c.endpoints {
+		if e.Name == name {
+			return e.endpoint()
+		}
+	}
+	if t, ok := c.tunnels[name]; ok {
+		return t.endpoint(name)
+	}
+
+	if names := c.EndpointNames(); len(names) > 0 {
+		return AgentEndpoint{}, fmt.Errorf("ngrok agent config has no endpoint %q, available endpoints: %s", name, strings.Join(names, ", "))
+	}
+	return AgentEndpoint{}, fmt.Errorf("ngrok agent config has no endpoint %q", name)
+}
+
+// endpoint converts a version 3 endpoint, taking the tunnel type and domain from its URL
+func (e agentEndpoint) endpoint() (AgentEndpoint, error) {
+	result := AgentEndpoint{Name: e.Name, TunnelType: service.TunnelHTTP, TrafficPolicy: trafficPolicy(e.TrafficPolicy)}
+	if e.URL == "" {
+		return result, nil
+	}
+
+	u, err := url.Parse(e.URL)
+	if err != nil || u.Host == "" {
+		return AgentEndpoint{}, fmt.Errorf("endpoint %q has an invalid url %q", e.Name, e.URL)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		result.Domain = u.Hostname()
+	case "tcp":
+		result.TunnelType = service.TunnelTCP
+	default:
+		return AgentEndpoint{}, fmt.Errorf("endpoint %q uses %s, only http, https and tcp are supported", e.Name, u.Scheme)
+	}
+
+	return result, nil
+}
+
+// endpoint converts a version 2 tunnel
+func (t agentTunnel) endpoint(name string) (AgentEndpoint, error) {
+	result := AgentEndpoint{Name: name, Domain: cmp.Or(t.Domain, t.Hostname), TrafficPolicy: trafficPolicy(t.TrafficPolicy)}
+
+	switch t.Proto {
+	case "", "http":
+		result.TunnelType = service.TunnelHTTP
+	case "tcp":
+		result.TunnelType = service.TunnelTCP
+	default:
+		return AgentEndpoint{}, fmt.Errorf("tunnel %q uses %s, only http and tcp are supported", name, t.Proto)
+	}
+
+	if len(t.BasicAuth) > 1 {
+		return AgentEndpoint{}, fmt.Errorf("tunnel %q has %d basic auth credentials, only one is supported", name, len(t.BasicAuth))
+	}
+	if len(t.BasicAuth) == 1 {
+		result.Auth.BasicAuth = t.BasicAuth[0]
+	}
+	if t.OAuth != nil {
+		result.Auth.OAuthProvider = t.OAuth.Provider
+		result.Auth.OAuthAllowDomains = t.OAuth.AllowDomains
+		result.Auth.OAuthClientID = t.OAuth.ClientID
+		result.Auth.OAuthClientSecret = t.OAuth.ClientSecret
+	}
+	if err := result.Auth.Validate(); err != nil {
+		return AgentEndpoint{}, fmt.Errorf("tunnel %q: %w", name, err)
+	}
+
+	return result, nil
+}
+
+// trafficPolicy returns the traffic policy document as JSON, empty if unset
+func trafficPolicy(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
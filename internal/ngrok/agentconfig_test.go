@@ -0,0 +1,158 @@
+package ngrok
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+const agentConfigV2 = `
+version: "2"
+authtoken: 2abcdefghijklmnopqrstu_vwxyz0123456789
+tunnels:
+  api:
+    proto: http
+    addr: 8080
+    domain: api.example.com
+    basic_auth: ["admin:correct-horse"]
+  admin:
+    proto: http
+    addr: 9000
+    oauth:
+      provider: google
+      allow_domains: [example.com]
+  db:
+    proto: tcp
+    addr: 5432
+  tls:
+    proto: tls
+    addr: 443
+`
+
+const agentConfigV3 = `
+version: 3
+agent:
+  authtoken: 2abcdefghijklmnopqrstu_vwxyz0123456789
+endpoints:
+  - name: web
+    url: https://web.example.com
+    upstream:
+      url: 8080
+    traffic_policy:
+      on_http_request:
+        - actions:
+            - type: deny
+  - name: db
+    url: tcp://1.tcp.ngrok.io:12345
+    upstream:
+      url: 5432
+`
+
+func TestParseAgentConfig_V2(t *testing.T) {
+	config, err := ParseAgentConfig([]byte(agentConfigV2))
+	if err != nil {
+		t.Fatalf("ParseAgentConfig should not return an error: %v", err)
+	}
+
+	if config.AuthToken != "2abcdefghijklmnopqrstu_vwxyz0123456789" {
+		t.Errorf("Unexpected authtoken %q", config.AuthToken)
+	}
+	if names := config.EndpointNames(); !slices.Equal(names, []string{"admin", "api", "db", "tls"}) {
+		t.Errorf("Unexpected endpoint names %v", names)
+	}
+
+	api, err := config.Endpoint("api")
+	if err != nil {
+		t.Fatalf("Endpoint should not return an error: %v", err)
+	}
+	if api.TunnelType != service.TunnelHTTP || api.Domain != "api.example.com" || api.Auth.BasicAuth != "admin:correct-horse" {
+		t.Errorf("Unexpected endpoint %+v", api)
+	}
+
+	admin, err := config.Endpoint("admin")
+	if err != nil || admin.Auth.OAuthProvider != "google" || !slices.Equal(admin.Auth.OAuthAllowDomains, []string{"example.com"}) {
+		t.Errorf("Unexpected endpoint %+v %v", admin, err)
+	}
+
+	if db, err := config.Endpoint("db"); err != nil || db.TunnelType != service.TunnelTCP {
+		t.Errorf("Unexpected endpoint %+v %v", db, err)
+	}
+	if _, err := config.Endpoint("tls"); err == nil {
+		t.Error("Expected an error for a tls tunnel")
+	}
+	if _, err := config.Endpoint("missing"); err == nil || !strings.Contains(err.Error(), "available endpoints: admin, api, db, tls") {
+		t.Errorf("Expected an error listing the endpoints, got %v", err)
+	}
+}
+
+func TestParseAgentConfig_V3(t *testing.T) {
+	config, err := ParseAgentConfig([]byte(agentConfigV3))
+	if err != nil {
+		t.Fatalf("ParseAgentConfig should not return an error: %v", err)
+	}
+
+	if config.AuthToken != "2abcdefghijklmnopqrstu_vwxyz0123456789" {
+		t.Errorf("Unexpected authtoken %q", config.AuthToken)
+	}
+
+	web, err := config.Endpoint("web")
+	if err != nil {
+		t.Fatalf("Endpoint should not return an error: %v", err)
+	}
+	if web.TunnelType != service.TunnelHTTP || web.Domain != "web.example.com" || !strings.Contains(web.TrafficPolicy, `"type":"deny"`) {
+		t.Errorf("Unexpected endpoint %+v", web)
+	}
+
+	if db, err := config.Endpoint("db"); err != nil || db.TunnelType != service.TunnelTCP || db.Domain != "" {
+		t.Errorf("Unexpected endpoint %+v %v", db, err)
+	}
+}
+
+func TestParseAgentConfig_Invalid(t *testing.T) {
+	if _, err := ParseAgentConfig([]byte("endpoints: [{url: https://a.example.com}]")); err == nil {
+		t.Error("Expected an error for an endpoint without a name")
+	}
+	if _, err := ParseAgentConfig([]byte("tunnels: [")); err == nil {
+		t.Error("Expected an error for invalid YAML")
+	}
+}
+
+func TestLoadAgentConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("NGROK_CONFIG", "")
+
+	if config, err := LoadAgentConfig(); err != nil || config.Path != "" {
+		t.Fatalf("Expected no config without a file, got %+v %v", config, err)
+	}
+
+	legacy := filepath.Join(home, ".ngrok2", "ngrok.yml")
+	if err := os.MkdirAll(filepath.Dir(legacy), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, []byte(agentConfigV2), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if config, err := LoadAgentConfig(); err != nil || config.Path != legacy {
+		t.Errorf("Expected the ngrok v2 config, got %+v %v", config, err)
+	}
+
+	custom := filepath.Join(t.TempDir(), "ngrok.yml")
+	if err := os.WriteFile(custom, []byte(agentConfigV3), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NGROK_CONFIG", custom)
+	if config, err := LoadAgentConfig(); err != nil || config.Path != custom {
+		t.Errorf("Expected the config set with NGROK_CONFIG, got %+v %v", config, err)
+	}
+
+	t.Setenv("NGROK_CONFIG", filepath.Join(home, "missing.yml"))
+	if _, err := LoadAgentConfig(); err == nil {
+		t.Error("Expected an error for a missing NGROK_CONFIG file")
+	}
+}
@@ -2,17 +2,24 @@ package ngrok
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
+	"strings"
+	"sync"
 
 	"golang.ngrok.com/ngrok"
 	"golang.ngrok.com/ngrok/config"
+
+	"github.com/Goalt/service-exporter/internal/service"
 )
 
 // Client represents an ngrok client for creating tunnels
 type Client struct {
 	authToken string
-	forwarder ngrok.Forwarder
+
+	mu         sync.Mutex
+	forwarders map[string]ngrok.Forwarder
 }
 
 // NewClient creates a new ngrok client
@@ -22,34 +29,131 @@ func NewClient(authToken string) (*Client, error) {
 	}
 
 	return &Client{
-		authToken: authToken,
+		authToken:  authToken,
+		forwarders: make(map[string]ngrok.Forwarder),
 	}, nil
 }
 
-// StartTunnel creates a new HTTP tunnel for the specified port
-func (c *Client) StartTunnel(ctx context.Context, port int) (string, error) {
+// StartTunnel creates a new HTTP or TCP tunnel for the specified port
+func (c *Client) StartTunnel(ctx context.Context, port int, opts service.TunnelOptions) (string, error) {
+	tunnelConfig, scheme, err := endpoint(opts)
+	if err != nil {
+		return "", err
+	}
+
 	// Create backend URL
-	backendURL, err := url.Parse(fmt.Sprintf("http://localhost:%d", port))
+	backendURL, err := url.Parse(fmt.Sprintf("%s://localhost:%d", scheme, port))
 	if err != nil {
 		return "", fmt.Errorf("failed to parse backend URL: %w", err)
 	}
 
+	connectOpts := []ngrok.ConnectOption{ngrok.WithAuthtoken(c.authToken), ngrok.WithLogger(newLogger())}
+	if opts.OnStatus != nil {
+		connectOpts = append(connectOpts,
+			ngrok.WithConnectHandler(func(ctx context.Context, sess ngrok.Session) {
+				opts.OnStatus(true)
+			}),
+			ngrok.WithDisconnectHandler(func(ctx context.Context, sess ngrok.Session, err error) {
+				opts.OnStatus(false)
+			}),
+		)
+	}
+
 	// Use the simplified ListenAndForward function which handles everything
-	forwarder, err := ngrok.ListenAndForward(ctx, backendURL, config.HTTPEndpoint(), ngrok.WithAuthtoken(c.authToken))
+	forwarder, err := ngrok.ListenAndForward(ctx, backendURL, tunnelConfig, connectOpts...)
 	if err != nil {
 		return "", fmt.Errorf("failed to create tunnel: %w", err)
 	}
 
 	// Store forwarder for cleanup
-	c.forwarder = forwarder
+	c.mu.Lock()
+	if c.forwarders == nil {
+		c.forwarders = make(map[string]ngrok.Forwarder)
+	}
+	c.forwarders[forwarder.URL()] = forwarder
+	c.mu.Unlock()
 
 	return forwarder.URL(), nil
 }
 
-// Close closes the ngrok forwarder
+// endpoint returns the tunnel configuration of opts and the scheme of the backend it forwards to
+func endpoint(opts service.TunnelOptions) (config.Tunnel, string, error) {
+	if opts.Type == service.TunnelTCP {
+		if opts.Auth.Enabled() || opts.Domain != "" {
+			return nil, "", fmt.Errorf("authentication and domains are only supported by http tunnels")
+		}
+		var tcpOpts []config.TCPEndpointOption
+		if opts.TrafficPolicy != "" {
+			tcpOpts = append(tcpOpts, config.WithTrafficPolicy(opts.TrafficPolicy))
+		}
+		return config.TCPEndpoint(tcpOpts...), "tcp", nil
+	}
+
+	endpointOpts, err := authOptions(opts.Auth)
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.Domain != "" {
+		endpointOpts = append(endpointOpts, config.WithDomain(opts.Domain))
+	}
+	if opts.TrafficPolicy != "" {
+		endpointOpts = append(endpointOpts, config.WithTrafficPolicy(opts.TrafficPolicy))
+	}
+
+	return config.HTTPEndpoint(endpointOpts...), "http", nil
+}
+
+// authOptions returns the endpoint options protecting a tunnel with auth
+func authOptions(auth service.TunnelAuth) ([]config.HTTPEndpointOption, error) {
+	var opts []config.HTTPEndpointOption
+
+	if auth.BasicAuth != "" {
+		username, password, ok := strings.Cut(auth.BasicAuth, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("basic auth must be in the username:password format")
+		}
+		opts = append(opts, config.WithBasicAuth(username, password))
+	}
+	if auth.OAuthProvider != "" {
+		var oauthOpts []config.OAuthOption
+		if len(auth.OAuthAllowDomains) > 0 {
+			oauthOpts = append(oauthOpts, config.WithAllowOAuthDomain(auth.OAuthAllowDomains...))
+		}
+		if auth.OAuthClientID != "" {
+			oauthOpts = append(oauthOpts, config.WithOAuthClientID(auth.OAuthClientID), config.WithOAuthClientSecret(auth.OAuthClientSecret))
+		}
+		opts = append(opts, config.WithOAuth(auth.OAuthProvider, oauthOpts...))
+	}
+
+	return opts, nil
+}
+
+// CloseTunnel closes the tunnel with the given public URL
+func (c *Client) CloseTunnel(url string) error {
+	c.mu.Lock()
+	forwarder, ok := c.forwarders[url]
+	delete(c.forwarders, url)
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("tunnel %s not found", url)
+	}
+
+	// Each tunnel runs in its own session, close both
+	return errors.Join(forwarder.Close(), forwarder.Session().Close())
+}
+
+// Close closes all ngrok forwarders
 func (c *Client) Close() error {
-	if c.forwarder != nil {
-		return c.forwarder.Close()
+	c.mu.Lock()
+	forwarders := c.forwarders
+	c.forwarders = make(map[string]ngrok.Forwarder)
+	c.mu.Unlock()
+
+	var errs []error
+	for _, forwarder := range forwarders {
+		errs = append(errs, forwarder.Close(), forwarder.Session().Close())
 	}
-	return nil
+
+	return errors.Join(errs...)
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 	"time"
+
+	"github.com/Goalt/service-exporter/internal/service"
 )
 
 func TestClient_StartTunnel(t *testing.T) {
@@ -30,7 +32,7 @@ func TestClient_StartTunnel_InvalidToken(t *testing.T) {
 	}
 
 	// The error should occur when trying to start a tunnel
-	_, err = client.StartTunnel(ctx, 8080)
+	_, err = client.StartTunnel(ctx, 8080, service.TunnelOptions{})
 	if err == nil {
 		t.Error("Expected error when starting tunnel with invalid auth token")
 	}
@@ -44,3 +46,57 @@ func TestClient_Close(t *testing.T) {
 		t.Errorf("Close() should not return error for nil session, got: %v", err)
 	}
 }
+
+func TestAuthOptions(t *testing.T) {
+	tests := []struct {
+		auth     service.TunnelAuth
+		expected int
+		wantErr  bool
+	}{
+		{service.TunnelAuth{}, 0, false},
+		{service.TunnelAuth{BasicAuth: "admin:correct-horse"}, 1, false},
+		{service.TunnelAuth{OAuthProvider: "google", OAuthAllowDomains: []string{"example.com"}}, 1, false},
+		{service.TunnelAuth{OAuthProvider: "google", OAuthClientID: "client-id", OAuthClientSecret: "client-secret"}, 1, false},
+		{service.TunnelAuth{BasicAuth: "admin"}, 0, true},
+		{service.TunnelAuth{BasicAuth: ":secret-password"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		opts, err := authOptions(tt.auth)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("authOptions(%+v) error = %v, wantErr %v", tt.auth, err, tt.wantErr)
+		}
+		if len(opts) != tt.expected {
+			t.Errorf("authOptions(%+v) returned %d options, want %d", tt.auth, len(opts), tt.expected)
+		}
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		opts    service.TunnelOptions
+		scheme  string
+		wantErr bool
+	}{
+		{service.TunnelOptions{}, "http", false},
+		{service.TunnelOptions{Type: service.TunnelHTTP, Domain: "api.example.com"}, "http", false},
+		{service.TunnelOptions{Type: service.TunnelHTTP, TrafficPolicy: `{"on_http_request":[]}`}, "http", false},
+		{service.TunnelOptions{Type: service.TunnelTCP}, "tcp", false},
+		{service.TunnelOptions{Type: service.TunnelTCP, TrafficPolicy: `{"on_tcp_connect":[]}`}, "tcp", false},
+		{service.TunnelOptions{Type: service.TunnelTCP, Domain: "api.example.com"}, "", true},
+		{service.TunnelOptions{Type: service.TunnelTCP, Auth: service.TunnelAuth{OAuthProvider: "google"}}, "", true},
+	}
+
+	for _, tt := range tests {
+		tunnelConfig, scheme, err := endpoint(tt.opts)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("endpoint(%+v) error = %v, wantErr %v", tt.opts, err, tt.wantErr)
+		}
+		if scheme != tt.scheme {
+			t.Errorf("endpoint(%+v) scheme = %q, want %q", tt.opts, scheme, tt.scheme)
+		}
+		if err == nil && tunnelConfig == nil {
+			t.Errorf("endpoint(%+v) returned no tunnel config", tt.opts)
+		}
+	}
+}
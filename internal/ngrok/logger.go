@@ -0,0 +1,40 @@
+package ngrok
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+
+	ngroklog "golang.ngrok.com/ngrok/log"
+)
+
+// logger writes the logs of the ngrok SDK to a slog logger at the debug level, below it for trace logs.
+// Reconnections the SDK logs are reported by the tunnel status already
+type logger struct {
+	logger *slog.Logger
+}
+
+// newLogger returns the ngrok SDK logger of the default slog logger
+func newLogger() *logger {
+	return &logger{logger: slog.Default().With("component", "ngrok")}
+}
+
+func (l *logger) Log(ctx context.Context, level ngroklog.LogLevel, msg string, data map[string]interface{}) {
+	if level <= ngroklog.LogLevelNone {
+		return
+	}
+	slogLevel := slog.LevelDebug
+	if level >= ngroklog.LogLevelTrace {
+		slogLevel = slog.LevelDebug - 4
+	}
+	if !l.logger.Enabled(ctx, slogLevel) {
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, len(data))
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		attrs = append(attrs, slog.Any(key, data[key]))
+	}
+	l.logger.LogAttrs(ctx, slogLevel, msg, attrs...)
+}
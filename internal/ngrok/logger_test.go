@@ -0,0 +1,33 @@
+package ngrok
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	ngroklog "golang.ngrok.com/ngrok/log"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	l := &logger{logger: slog.New(handler)}
+
+	l.Log(context.Background(), ngroklog.LogLevelError, "session closed", map[string]interface{}{"err": "EOF", "attempt": 2})
+	l.Log(context.Background(), ngroklog.LogLevelTrace, "heartbeat", nil)
+	l.Log(context.Background(), ngroklog.LogLevelInfo, "accept connection", nil)
+
+	want := "level=DEBUG msg=\"session closed\" attempt=2 err=EOF\nlevel=DEBUG msg=\"accept connection\"\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
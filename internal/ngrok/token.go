@@ -0,0 +1,36 @@
+package ngrok
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// authTokenPattern matches the format of ngrok authtokens: an ID and a secret joined by an underscore
+var authTokenPattern = regexp.MustCompile(`^[0-9A-Za-z]{20,}_[0-9A-Za-z]{10,}$`)
+
+// CheckAuthToken checks the format of an ngrok authtoken without contacting ngrok
+func CheckAuthToken(token string) service.CheckResult {
+	result := service.CheckResult{Name: "ngrok authtoken"}
+
+	switch {
+	case token == "":
+		result.Status = service.CheckFail
+		result.Detail = "no authtoken configured"
+		result.Hint = "set NGROK_AUTH_TOKEN, copy it from https://dashboard.ngrok.com/get-started/your-authtoken"
+	case strings.TrimSpace(token) != token:
+		result.Status = service.CheckFail
+		result.Detail = "authtoken has leading or trailing whitespace"
+		result.Hint = "remove the whitespace, it is usually copied along with the token"
+	case !authTokenPattern.MatchString(token):
+		result.Status = service.CheckWarn
+		result.Detail = "authtoken does not look like an ngrok authtoken"
+		result.Hint = "API keys and tunnel credentials are not authtokens, copy it from https://dashboard.ngrok.com/get-started/your-authtoken"
+	default:
+		result.Status = service.CheckPass
+		result.Detail = "format looks valid"
+	}
+
+	return result
+}
@@ -0,0 +1,25 @@
+package ngrok
+
+import (
+	"testing"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+func TestCheckAuthToken(t *testing.T) {
+	tests := []struct {
+		token    string
+		expected service.CheckStatus
+	}{
+		{"2Abcdefghijklmnopqrstuvwxyz1_3ABCDEFGHIJKLMnopqrs", service.CheckPass},
+		{"", service.CheckFail},
+		{"2Abcdefghijklmnopqrstuvwxyz1_3ABCDEFGHIJKLMnopqrs\n", service.CheckFail},
+		{"not-a-token", service.CheckWarn},
+	}
+
+	for _, tt := range tests {
+		if result := CheckAuthToken(tt.token); result.Status != tt.expected {
+			t.Errorf("CheckAuthToken(%q) = %s, want %s", tt.token, result.Status, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package policy
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Action is what happens when a rule matches an exposure
+type Action string
+
+const (
+	// ActionDeny refuses to expose the service port
+	ActionDeny Action = "deny"
+	// ActionRequireAuth only exposes the service port behind basic auth or OAuth
+	ActionRequireAuth Action = "require-auth"
+	// ActionWarn exposes the service port with a warning
+	ActionWarn Action = "warn"
+)
+
+// severity orders the actions, the most severe matching action wins
+var severity = map[Action]int{ActionWarn: 1, ActionRequireAuth: 2, ActionDeny: 3}
+
+// Policy is the list of rules evaluated before a service port is exposed
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule applies its action to the exposures matching all of its conditions, unset conditions match anything.
+// Patterns are shell globs, e.g. "prod-*"
+type Rule struct {
+	Name   string `json:"name"`
+	Action Action `json:"action"`
+	// Message explains why the rule exists
+	Message string `json:"message,omitempty"`
+
+	// Contexts are patterns of kubeconfig context names
+	Contexts []string `json:"contexts,omitempty"`
+	// Namespaces are patterns of namespace names
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Labels are service labels with value patterns, all of them must match
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are service annotations with value patterns, all of them must match
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Ports are port numbers, ranges like "5000-5999" or patterns of port names.
+	// Numbers match the service port or the container port it targets
+	Ports []string `json:"ports,omitempty"`
+	// TunnelTypes are the tunnel types, e.g. "http"
+	TunnelTypes []string `json:"tunnelTypes,omitempty"`
+}
+
+// Target describes the exposure a policy is evaluated for
+type Target struct {
+	Context     string
+	Namespace   string
+	Service     string
+	Labels      map[string]string
+	Annotations map[string]string
+	Port        int32
+	PortName    string
+	// TargetPort is the container port the service port forwards to, 0 if unknown
+	TargetPort int32
+	TunnelType string
+}
+
+// Match is a rule that matched a target
+type Match struct {
+	Rule    string
+	Action  Action
+	Message string
+	// Reasons lists the conditions of the rule the target matched
+	Reasons []string
+}
+
+// String explains the match, e.g. `rule "no-system" (namespace "kube-system" matches "kube-*"): reason`
+func (m Match) String() string {
+	s := fmt.Sprintf("rule %q", m.Rule)
+	if len(m.Reasons) > 0 {
+		s += " (" + strings.Join(m.Reasons, ", ") + ")"
+	}
+	if m.Message != "" {
+		s += ": " + m.Message
+	}
+	return s
+}
+
+// Decision is the result of evaluating a policy
+type Decision struct {
+	Matches []Match
+}
+
+// Action returns the most severe action of the matched rules, empty if no rule matched
+func (d Decision) Action() Action {
+	var action Action
+	for _, m := range d.Matches {
+		if severity[m.Action] > severity[action] {
+			action = m.Action
+		}
+	}
+	return action
+}
+
+// Matched returns the matches of the given action
+func (d Decision) Matched(action Action) []Match {
+	var matches []Match
+	for _, m := range d.Matches {
+		if m.Action == action {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// Validate checks that every rule has a name, a known action and valid patterns
+func (p Policy) Validate() error {
+	for i, r := range p.Rules {
+		if r.Name == "" {
+			return fmt.Errorf("rule %d has no name", i+1)
+		}
+		if _, ok := severity[r.Action]; !ok {
+			return fmt.Errorf("rule %q: unknown action %q, use deny, require-auth or warn", r.Name, r.Action)
+		}
+
+		patterns := slices.Concat(r.Contexts, r.Namespaces, r.TunnelTypes,
+			slices.Collect(maps.Values(r.Labels)), slices.Collect(maps.Values(r.Annotations)))
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %q: invalid pattern %q: %w", r.Name, pattern, err)
+			}
+		}
+		for _, port := range r.Ports {
+			if _, _, err := parsePortRange(port); err != nil {
+				return fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Evaluate returns the rules matching the target
+func (p Policy) Evaluate(t Target) Decision {
+	var d Decision
+	for _, r := range p.Rules {
+		if reasons, ok := r.match(t); ok {
+			d.Matches = append(d.Matches, Match{Rule: r.Name, Action: r.Action, Message: r.Message, Reasons: reasons})
+		}
+	}
+	return d
+}
+
+// match reports whether the target matches all conditions of the rule, with a reason per condition
+func (r Rule) match(t Target) ([]string, bool) {
+	var reasons []string
+
+	conditions := []struct {
+		name     string
+		value    string
+		patterns []string
+	}{
+		{"context", t.Context, r.Contexts},
+		{"namespace", t.Namespace, r.Namespaces},
+		{"tunnel type", t.TunnelType, r.TunnelTypes},
+	}
+	for _, c := range conditions {
+		if len(c.patterns) == 0 {
+			continue
+		}
+		pattern, ok := matchAny(c.patterns, c.value)
+		if !ok {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("%s %q matches %q", c.name, c.value, pattern))
+	}
+
+	for _, m := range []struct {
+		name     string
+		values   map[string]string
+		patterns map[string]string
+	}{
+		{"label", t.Labels, r.Labels},
+		{"annotation", t.Annotations, r.Annotations},
+	} {
+		for _, key := range slices.Sorted(maps.Keys(m.patterns)) {
+			value, ok := m.values[key]
+			if !ok || !matchPattern(m.patterns[key], value) {
+				return nil, false
+			}
+			reasons = append(reasons, fmt.Sprintf("%s %s=%q matches %q", m.name, key, value, m.patterns[key]))
+		}
+	}
+
+	if len(r.Ports) > 0 {
+		port, ok := r.matchPort(t)
+		if !ok {
+			return nil, false
+		}
+		reasons = append(reasons, port)
+	}
+
+	return reasons, true
+}
+
+// matchPort returns the reason the target's port matches one of the rule's ports
+func (r Rule) matchPort(t Target) (string, bool) {
+	for _, port := range r.Ports {
+		if from, to, err := parsePortRange(port); err == nil && from > 0 {
+			if t.Port >= from && t.Port <= to {
+				return fmt.Sprintf("port %d matches %s", t.Port, port), true
+			}
+			if t.TargetPort > 0 && t.TargetPort >= from && t.TargetPort <= to {
+				return fmt.Sprintf("target port %d matches %s", t.TargetPort, port), true
+			}
+			continue
+		}
+		if t.PortName != "" && matchPattern(port, t.PortName) {
+			return fmt.Sprintf("port name %q matches %q", t.PortName, port), true
+		}
+	}
+	return "", false
+}
+
+// parsePortRange parses a port number or range, returning 0, 0 for a port name pattern
+func parsePortRange(s string) (int32, int32, error) {
+	from, to, isRange := strings.Cut(s, "-")
+	if _, err := strconv.Atoi(from); err != nil {
+		// Port names may contain dashes, only digits start a number or range
+		if _, err := path.Match(s, ""); err != nil {
+			return 0, 0, fmt.Errorf("invalid port pattern %q: %w", s, err)
+		}
+		return 0, 0, nil
+	}
+	if !isRange {
+		to = from
+	}
+
+	start, err := strconv.ParseInt(from, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q: %w", s, err)
+	}
+	end, err := strconv.ParseInt(to, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+	if start < 1 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+
+	return int32(start), int32(end), nil
+}
+
+// matchAny returns the first pattern matching value
+func matchAny(patterns []string, value string) (string, bool) {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, value) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// matchPattern reports whether value matches the glob pattern
+func matchPattern(pattern string, value string) bool {
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok
+}
@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+var testPolicy = Policy{Rules: []Rule{
+	{Name: "no-system", Action: ActionDeny, Namespaces: []string{"kube-*"}, Message: "system namespaces stay private"},
+	{Name: "no-prod", Action: ActionDeny, Contexts: []string{"*prod*"}},
+	{Name: "databases", Action: ActionDeny, Ports: []string{"5432", "3306", "27017-27019", "*sql*"}},
+	{Name: "internal", Action: ActionRequireAuth, Labels: map[string]string{"exposure": "internal"}},
+	{Name: "staging", Action: ActionWarn, Namespaces: []string{"staging"}, TunnelTypes: []string{"http"}},
+	{Name: "pii", Action: ActionRequireAuth, Annotations: map[string]string{"data/pii": "*"}},
+}}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   Target
+		expected Action
+		rules    []string
+	}{
+		{"allowed", Target{Context: "dev", Namespace: "default", Port: 80, TunnelType: "http"}, "", nil},
+		{"namespace glob", Target{Context: "dev", Namespace: "kube-system", Port: 53}, ActionDeny, []string{"no-system"}},
+		{"context glob", Target{Context: "eu-prod-1", Namespace: "default", Port: 80}, ActionDeny, []string{"no-prod"}},
+		{"port number", Target{Namespace: "default", Port: 5432}, ActionDeny, []string{"databases"}},
+		{"port range", Target{Namespace: "default", Port: 27018}, ActionDeny, []string{"databases"}},
+		{"target port", Target{Namespace: "default", Port: 80, TargetPort: 5432}, ActionDeny, []string{"databases"}},
+		{"service port of target port", Target{Namespace: "default", Port: 5432, TargetPort: 8080}, ActionDeny, []string{"databases"}},
+		{"port name", Target{Namespace: "default", Port: 8080, PortName: "mysql-admin"}, ActionDeny, []string{"databases"}},
+		{"label", Target{Namespace: "default", Port: 80, Labels: map[string]string{"exposure": "internal"}}, ActionRequireAuth, []string{"internal"}},
+		{"annotation present", Target{Namespace: "default", Port: 80, Annotations: map[string]string{"data/pii": "true"}}, ActionRequireAuth, []string{"pii"}},
+		{"all conditions", Target{Namespace: "staging", Port: 80, TunnelType: "tcp"}, "", nil},
+		{"warn", Target{Namespace: "staging", Port: 80, TunnelType: "http"}, ActionWarn, []string{"staging"}},
+		{
+			"most severe wins",
+			Target{Namespace: "staging", Port: 5432, TunnelType: "http", Labels: map[string]string{"exposure": "internal"}},
+			ActionDeny,
+			[]string{"databases", "internal", "staging"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testPolicy.Evaluate(tt.target)
+
+			if d.Action() != tt.expected {
+				t.Errorf("Expected action %q, got %q", tt.expected, d.Action())
+			}
+			var rules []string
+			for _, m := range d.Matches {
+				rules = append(rules, m.Rule)
+			}
+			if strings.Join(rules, ",") != strings.Join(tt.rules, ",") {
+				t.Errorf("Expected rules %v to match, got %v", tt.rules, rules)
+			}
+		})
+	}
+}
+
+func TestMatch_String(t *testing.T) {
+	d := testPolicy.Evaluate(Target{Namespace: "kube-system", Port: 5432})
+
+	deny := d.Matched(ActionDeny)
+	if len(deny) != 2 {
+		t.Fatalf("Expected 2 deny matches, got %+v", deny)
+	}
+
+	expected := `rule "no-system" (namespace "kube-system" matches "kube-*"): system namespaces stay private`
+	if deny[0].String() != expected {
+		t.Errorf("Expected %q, got %q", expected, deny[0].String())
+	}
+	if deny[1].String() != `rule "databases" (port 5432 matches 5432)` {
+		t.Errorf("Unexpected explanation %q", deny[1].String())
+	}
+	if len(d.Matched(ActionWarn)) != 0 {
+		t.Error("Expected no warn matches")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := testPolicy.Validate(); err != nil {
+		t.Errorf("Validate should not return an error: %v", err)
+	}
+
+	tests := []struct {
+		rule     Rule
+		expected string
+	}{
+		{Rule{Action: ActionDeny}, "no name"},
+		{Rule{Name: "a", Action: "block"}, "unknown action"},
+		{Rule{Name: "a", Action: ActionDeny, Namespaces: []string{"[a"}}, "invalid pattern"},
+		{Rule{Name: "a", Action: ActionDeny, Ports: []string{"9000-8000"}}, "invalid port range"},
+		{Rule{Name: "a", Action: ActionDeny, Ports: []string{"70000"}}, "invalid port range"},
+	}
+
+	for _, tt := range tests {
+		err := Policy{Rules: []Rule{tt.rule}}.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Expected error containing %q for %+v, got %v", tt.expected, tt.rule, err)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package prompt
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/manifoldco/promptui"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// pickerHeight is the number of services listed at once by the picker
+const pickerHeight = 10
+
+// pickerHint explains the search syntax while the input is empty
+const pickerHint = "Type to search, filter with ns:NAMESPACE type:TYPE label:KEY=VALUE"
+
+// ServiceList is the content of the service picker, read again whenever it changes
+type ServiceList struct {
+	Services  []service.ServiceInfo
+	Shortcuts []Shortcut
+	// Loading is set until every service is listed
+	Loading bool
+	// Status describes the list, such as how many services are hidden
+	Status string
+}
+
+// picker is an interactive list of services ranked by a fuzzy search, with the details of the highlighted one
+type picker struct {
+	label string
+	list  func() ServiceList
+
+	// labels, infos and shortcuts describe the entries, shortcuts first; shortcuts[i] is nil for services
+	labels    []string
+	infos     []service.ServiceInfo
+	shortcuts []*Shortcut
+	listed    int
+	loading   bool
+	status    string
+
+	input   string
+	matches []int
+	// cursor is the highlighted entry of matches, start the first one listed
+	cursor int
+	start  int
+}
+
+// newPicker creates a picker of the services returned by list
+func newPicker(label string, list func() ServiceList) *picker {
+	p := &picker{label: label, list: list}
+	p.reload()
+	return p
+}
+
+// reload reads the list again and ranks it, keeping the highlighted entry unless the best match was
+func (p *picker) reload() {
+	highlighted := ""
+	if p.cursor > 0 {
+		highlighted = p.labels[p.selected()]
+	}
+
+	l := p.list()
+	p.labels, p.infos, p.shortcuts = nil, nil, nil
+	for _, s := range l.Shortcuts {
+		p.labels = append(p.labels, shortcutLabel(s))
+		p.infos = append(p.infos, s.Service)
+		p.shortcuts = append(p.shortcuts, &s)
+	}
+	for _, info := range l.Services {
+		p.labels = append(p.labels, serviceLabel(info))
+		p.infos = append(p.infos, info)
+		p.shortcuts = append(p.shortcuts, nil)
+	}
+	p.listed, p.loading, p.status = len(l.Services), l.Loading, l.Status
+
+	p.search()
+	if i := slices.IndexFunc(p.matches, func(m int) bool { return p.labels[m] == highlighted }); highlighted != "" && i != -1 {
+		p.move(i)
+	}
+}
+
+// search ranks the services for the input and highlights the best match
+func (p *picker) search() {
+	p.matches = rank(p.infos, p.input)
+	p.cursor, p.start = 0, 0
+}
+
+// selected returns the index of the highlighted entry, -1 if no entry matches
+func (p *picker) selected() int {
+	if len(p.matches) == 0 {
+		return -1
+	}
+	return p.matches[p.cursor]
+}
+
+// selection returns the highlighted entry
+func (p *picker) selection() Selection {
+	i := p.selected()
+	return Selection{Service: p.infos[i], Shortcut: p.shortcuts[i]}
+}
+
+// handle applies raw terminal input and reports whether a service was picked
+func (p *picker) handle(b []byte) (bool, error) {
+	switch string(b) {
+	case "\r", "\n":
+		return len(p.matches) > 0, nil
+	case "\x03":
+		return false, promptui.ErrInterrupt
+	case "\x04":
+		return false, promptui.ErrEOF
+	case "\x1b[A", "\x10":
+		p.move(-1)
+	case "\x1b[B", "\x0e":
+		p.move(1)
+	case "\x1b[5~":
+		p.move(-pickerHeight)
+	case "\x1b[6~":
+		p.move(pickerHeight)
+	case "\x1b", "\x15":
+		p.input = ""
+		p.search()
+	case "\x7f", "\b":
+		if p.input != "" {
+			_, size := utf8.DecodeLastRuneInString(p.input)
+			p.input = p.input[:len(p.input)-size]
+			p.search()
+		}
+	default:
+		// Ignore other control sequences, typed or pasted text refines the search
+		text := string(b)
+		if !utf8.ValidString(text) || strings.ContainsFunc(text, unicode.IsControl) {
+			return false, nil
+		}
+		p.input += text
+		p.search()
+	}
+	return false, nil
+}
+
+// move moves the highlight by delta entries, scrolling the list to keep it visible
+func (p *picker) move(delta int) {
+	if len(p.matches) == 0 {
+		return
+	}
+
+	p.cursor = min(max(p.cursor+delta, 0), len(p.matches)-1)
+	if p.cursor < p.start {
+		p.start = p.cursor
+	}
+	if p.cursor >= p.start+pickerHeight {
+		p.start = p.cursor - pickerHeight + 1
+	}
+}
+
+// view returns the lines showing the search input, the listed services and the details of the highlighted one
+func (p *picker) view() []string {
+	lines := []string{fmt.Sprintf("🔎 %s: %s█", p.label, p.input)}
+	if p.input == "" {
+		lines = append(lines, "   "+pickerHint)
+	}
+	if p.loading {
+		lines = append(lines, fmt.Sprintf("   ⏳ Loading services, %d so far...", p.listed))
+	}
+	if p.status != "" {
+		lines = append(lines, "   "+p.status)
+	}
+
+	switch {
+	case len(p.matches) > 0:
+	case p.loading:
+		return lines
+	case p.listed == 0:
+		return append(lines, "   No services available")
+	default:
+		return append(lines, "   No matching service")
+	}
+
+	end := min(p.start+pickerHeight, len(p.matches))
+	for i := p.start; i < end; i++ {
+		prefix := "  "
+		if i == p.cursor {
+			prefix = "▸ "
+		}
+		lines = append(lines, prefix+p.labels[p.matches[i]])
+	}
+	if hidden := len(p.matches) - end + p.start; hidden > 0 {
+		lines = append(lines, fmt.Sprintf("   … %d more, %d/%d", hidden, p.cursor+1, len(p.matches)))
+	}
+
+	lines = append(lines, "")
+	for _, detail := range serviceDetails(p.infos[p.selected()]) {
+		lines = append(lines, "   "+detail)
+	}
+	return lines
+}
+
+// serviceDetails returns the details of a service shown below the picker
+func serviceDetails(info service.ServiceInfo) []string {
+	ports := make([]string, len(info.Ports))
+	for i, port := range info.Ports {
+		ports[i] = fmt.Sprintf("%d/%s", port.Port, port.Protocol)
+		if port.Name != "" {
+			ports[i] = port.Name + " " + ports[i]
+		}
+		if port.TargetPort != port.Port {
+			ports[i] += fmt.Sprintf(" → %d", port.TargetPort)
+		}
+		if port.Default {
+			ports[i] += " (default)"
+		}
+	}
+
+	endpoints := "unknown"
+	if info.ReadyEndpoints >= 0 {
+		endpoints = fmt.Sprintf("%d ready", info.ReadyEndpoints)
+	}
+
+	return []string{
+		"Service:    " + info.String(),
+		"Type:       " + orNone(info.Type),
+		"Cluster IP: " + orNone(info.ClusterIP),
+		"Ports:      " + orNone(strings.Join(ports, ", ")),
+		"Selector:   " + orNone(formatLabels(info.Selector)),
+		"Endpoints:  " + endpoints,
+		"Labels:     " + orNone(formatLabels(info.Labels)),
+	}
+}
+
+// formatLabels returns labels as sorted "key=value" pairs
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// orNone returns value, or "none" if it is empty
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// run shows the picker on the terminal until a service is picked, reloading the list whenever changed receives
+func (p *picker) run(in *os.File, out io.Writer, changed <-chan struct{}) (Selection, error) {
+	if err := interact(in, out, p.view, p.handle, changed, p.reload); err != nil {
+		return Selection{}, err
+	}
+	return p.selection(), nil
+}
@@ -0,0 +1,154 @@
+package prompt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/manifoldco/promptui"
+
+	"github.com/Goalt/service-exporter/internal/recents"
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+func newTestPicker() *picker {
+	infos := []service.ServiceInfo{
+		{Name: "my-api", Namespace: "default", Type: "ClusterIP", ReadyEndpoints: 2},
+		{Name: "payment-service", Namespace: "payments", Type: "LoadBalancer", ReadyEndpoints: -1},
+		{Name: "postgres", Namespace: "data", Type: "ClusterIP"},
+	}
+	return newPicker("Select a Kubernetes service", func() ServiceList { return ServiceList{Services: infos} })
+}
+
+func TestPicker_Handle(t *testing.T) {
+	p := newTestPicker()
+
+	if p.selected() != 0 {
+		t.Fatalf("Expected the first service to be highlighted, got %d", p.selected())
+	}
+
+	p.handle([]byte("\x1b[B"))
+	p.handle([]byte("\x1b[B"))
+	p.handle([]byte("\x1b[B"))
+	if p.selected() != 2 {
+		t.Errorf("Expected the highlight to stop at the last service, got %d", p.selected())
+	}
+
+	for _, input := range []string{"p", "a", "y"} {
+		p.handle([]byte(input))
+	}
+	if p.input != "pay" || p.selected() != 1 {
+		t.Errorf("Expected the search to highlight payment-service, got %q %d", p.input, p.selected())
+	}
+
+	p.handle([]byte("\x7f"))
+	if p.input != "pa" {
+		t.Errorf("Expected backspace to remove a letter, got %q", p.input)
+	}
+
+	p.handle([]byte("zzz"))
+	if done, err := p.handle([]byte("\r")); done || err != nil || p.selected() != -1 {
+		t.Errorf("Expected Enter to do nothing without a match, got %v %v %d", done, err, p.selected())
+	}
+
+	p.handle([]byte("\x1b"))
+	if p.input != "" || len(p.matches) != 3 {
+		t.Errorf("Expected Esc to clear the search, got %q %v", p.input, p.matches)
+	}
+
+	if done, err := p.handle([]byte("\r")); !done || err != nil {
+		t.Errorf("Expected Enter to pick the highlighted service, got %v %v", done, err)
+	}
+	if _, err := p.handle([]byte("\x03")); !errors.Is(err, promptui.ErrInterrupt) {
+		t.Errorf("Expected Ctrl+C to interrupt, got %v", err)
+	}
+}
+
+func TestPicker_View(t *testing.T) {
+	p := newTestPicker()
+
+	view := strings.Join(p.view(), "\n")
+	for _, expected := range []string{pickerHint, "▸ my-api (ns: default)", "  postgres (ns: data)", "Endpoints:  2 ready"} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("Expected the view to contain %q, got:\n%s", expected, view)
+		}
+	}
+
+	p.handle([]byte("payment"))
+	view = strings.Join(p.view(), "\n")
+	if !strings.Contains(view, "Type:       LoadBalancer") || !strings.Contains(view, "Endpoints:  unknown") {
+		t.Errorf("Expected the details of payment-service, got:\n%s", view)
+	}
+
+	p.handle([]byte("xyz"))
+	if view := strings.Join(p.view(), "\n"); !strings.Contains(view, "No matching service") {
+		t.Errorf("Expected no match, got:\n%s", view)
+	}
+}
+
+func TestServiceDetails(t *testing.T) {
+	details := strings.Join(serviceDetails(service.ServiceInfo{
+		Name:      "api",
+		Namespace: "web",
+		Type:      "ClusterIP",
+		ClusterIP: "10.0.0.12",
+		Ports: []service.ServicePort{
+			{Name: "http", Port: 80, TargetPort: 8080, Protocol: "TCP", Default: true},
+			{Port: 9090, TargetPort: 9090, Protocol: "TCP"},
+		},
+		Selector: map[string]string{"tier": "web", "app": "api"},
+	}), "\n")
+
+	for _, expected := range []string{
+		"Cluster IP: 10.0.0.12",
+		"Ports:      http 80/TCP → 8080 (default), 9090/TCP",
+		"Selector:   app=api, tier=web",
+		"Endpoints:  0 ready",
+		"Labels:     none",
+	} {
+		if !strings.Contains(details, expected) {
+			t.Errorf("Expected the details to contain %q, got:\n%s", expected, details)
+		}
+	}
+}
+
+func TestPicker_Reload(t *testing.T) {
+	api := service.ServiceInfo{Name: "api", Namespace: "web"}
+	db := service.ServiceInfo{Name: "db", Namespace: "data"}
+	cache := service.ServiceInfo{Name: "cache", Namespace: "data"}
+	last := Shortcut{Pick: recents.Pick{Entry: recents.Entry{Namespace: "web", Service: "api", Port: 80}, Kind: recents.KindLast}, Service: api}
+
+	list := ServiceList{Shortcuts: []Shortcut{last}, Loading: true}
+	p := newPicker("Select a Kubernetes service", func() ServiceList { return list })
+
+	// The shortcuts can be picked while the services are loading
+	view := strings.Join(p.view(), "\n")
+	if !strings.Contains(view, "Loading services, 0 so far") || !strings.Contains(view, "▸ ↩️  Repeat last exposure") {
+		t.Errorf("Expected the loading shortcuts, got:\n%s", view)
+	}
+	if selection := p.selection(); selection.Shortcut == nil || selection.Service.Name != "api" {
+		t.Errorf("Expected the last exposure to be highlighted, got %+v", selection)
+	}
+
+	// The highlighted service stays highlighted as services appear
+	list = ServiceList{Shortcuts: []Shortcut{last}, Services: []service.ServiceInfo{api, db}, Loading: true}
+	p.reload()
+	p.handle([]byte("\x1b[B"))
+	p.handle([]byte("\x1b[B"))
+	list = ServiceList{Shortcuts: []Shortcut{last}, Services: []service.ServiceInfo{api, cache, db}, Status: "🙈 Hiding 1 service"}
+	p.reload()
+	if selection := p.selection(); selection.Shortcut != nil || selection.Service.Name != "db" {
+		t.Errorf("Expected db to stay highlighted, got %+v", selection)
+	}
+
+	view = strings.Join(p.view(), "\n")
+	if strings.Contains(view, "Loading") || !strings.Contains(view, "🙈 Hiding 1 service") || !strings.Contains(view, "  cache (ns: data)") {
+		t.Errorf("Expected the loaded services, got:\n%s", view)
+	}
+
+	list = ServiceList{}
+	p.reload()
+	if view := strings.Join(p.view(), "\n"); !strings.Contains(view, "No services available") {
+		t.Errorf("Expected no services, got:\n%s", view)
+	}
+}
@@ -0,0 +1,114 @@
+package prompt
+
+import (
+	"cmp"
+	"fmt"
+
+	"github.com/manifoldco/promptui"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// SelectedPort is a port chosen to be exposed with the tunnel type it is published on,
+// empty for the service's default
+type SelectedPort struct {
+	service.ServicePort
+	TunnelType service.TunnelType
+}
+
+// portChooser is an interactive list of service ports several of which can be checked,
+// each with its own tunnel type
+type portChooser struct {
+	label       string
+	ports       []service.ServicePort
+	tunnelTypes []service.TunnelType
+	checked     []bool
+	cursor      int
+}
+
+// newPortChooser creates a port chooser highlighting the default port. The ports are published on tunnelType,
+// if set, or on the tunnel type suggested for each of them
+func newPortChooser(label string, ports []service.ServicePort, tunnelType service.TunnelType) *portChooser {
+	c := &portChooser{label: label, ports: ports, tunnelTypes: make([]service.TunnelType, len(ports)), checked: make([]bool, len(ports))}
+	for i, port := range ports {
+		if port.Default {
+			c.cursor = i
+		}
+		c.tunnelTypes[i] = cmp.Or(tunnelType, port.SuggestedTunnelType())
+	}
+	return c
+}
+
+// selected returns the checked ports, or the highlighted one if none is checked
+func (c *portChooser) selected() []SelectedPort {
+	var ports []SelectedPort
+	for i, port := range c.ports {
+		if c.checked[i] {
+			ports = append(ports, SelectedPort{ServicePort: port, TunnelType: c.tunnelTypes[i]})
+		}
+	}
+
+	if len(ports) == 0 {
+		return []SelectedPort{{ServicePort: c.ports[c.cursor], TunnelType: c.tunnelTypes[c.cursor]}}
+	}
+	return ports
+}
+
+// handle applies raw terminal input and reports whether the selection was confirmed
+func (c *portChooser) handle(b []byte) (bool, error) {
+	switch string(b) {
+	case "\r", "\n":
+		return true, nil
+	case "\x03":
+		return false, promptui.ErrInterrupt
+	case "\x04":
+		return false, promptui.ErrEOF
+	case "\x1b[A", "k", "\x10":
+		c.cursor = max(c.cursor-1, 0)
+	case "\x1b[B", "j", "\x0e":
+		c.cursor = min(c.cursor+1, len(c.ports)-1)
+	case " ", "x":
+		c.checked[c.cursor] = !c.checked[c.cursor]
+	case "t":
+		if c.tunnelTypes[c.cursor] == service.TunnelTCP {
+			c.tunnelTypes[c.cursor] = service.TunnelHTTP
+		} else {
+			c.tunnelTypes[c.cursor] = service.TunnelTCP
+		}
+	case "a":
+		// Check every port, or uncheck them all if they already are
+		all := true
+		for _, checked := range c.checked {
+			all = all && checked
+		}
+		for i := range c.checked {
+			c.checked[i] = !all
+		}
+	}
+	return false, nil
+}
+
+// view returns the lines listing the ports with their check box and tunnel type
+func (c *portChooser) view() []string {
+	lines := []string{
+		fmt.Sprintf("🔌 %s:", c.label),
+		"   [space] check  [t] http/tcp  [a] all  [enter] confirm, the highlighted port if none is checked",
+	}
+
+	for i, port := range c.ports {
+		prefix := "  "
+		if i == c.cursor {
+			prefix = "▸ "
+		}
+		box := "[ ]"
+		if c.checked[i] {
+			box = "[x]"
+		}
+		line := fmt.Sprintf("%s%s %s · %s", prefix, box, portLabel(port), c.tunnelTypes[i])
+		if suggested := port.SuggestedTunnelType(); suggested != c.tunnelTypes[i] {
+			line += fmt.Sprintf(", %s suggested", suggested)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
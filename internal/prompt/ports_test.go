@@ -0,0 +1,110 @@
+package prompt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/manifoldco/promptui"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+func newTestPortChooser(tunnelType service.TunnelType) *portChooser {
+	return newPortChooser("Select ports to forward", []service.ServicePort{
+		{Name: "http", Port: 80, TargetPort: 8080, Protocol: "TCP"},
+		{Name: "grpc", Port: 9000, TargetPort: 9000, Protocol: "TCP", Default: true},
+		{Name: "metrics", Port: 9090, TargetPort: 9090, Protocol: "TCP"},
+	}, tunnelType)
+}
+
+func portNumbers(ports []SelectedPort) []int32 {
+	numbers := make([]int32, len(ports))
+	for i, port := range ports {
+		numbers[i] = port.Port
+	}
+	return numbers
+}
+
+func TestPortChooser_Handle(t *testing.T) {
+	c := newTestPortChooser("")
+
+	// Without checked ports the highlighted one, starting on the default port, is selected
+	if ports := portNumbers(c.selected()); len(ports) != 1 || ports[0] != 9000 {
+		t.Errorf("Expected the default port to be selected, got %v", ports)
+	}
+
+	c.handle([]byte("\x1b[A"))
+	c.handle([]byte(" "))
+	c.handle([]byte("\x1b[B"))
+	c.handle([]byte("\x1b[B"))
+	c.handle([]byte(" "))
+	if ports := portNumbers(c.selected()); len(ports) != 2 || ports[0] != 80 || ports[1] != 9090 {
+		t.Errorf("Expected the checked ports, got %v", ports)
+	}
+
+	c.handle([]byte("a"))
+	if ports := c.selected(); len(ports) != 3 {
+		t.Errorf("Expected every port to be checked, got %+v", ports)
+	}
+	c.handle([]byte("a"))
+	if ports := portNumbers(c.selected()); len(ports) != 1 || ports[0] != 9090 {
+		t.Errorf("Expected every port to be unchecked, got %v", ports)
+	}
+
+	if done, err := c.handle([]byte("\r")); !done || err != nil {
+		t.Errorf("Expected Enter to confirm, got %v %v", done, err)
+	}
+	if _, err := c.handle([]byte("\x03")); !errors.Is(err, promptui.ErrInterrupt) {
+		t.Errorf("Expected Ctrl+C to interrupt, got %v", err)
+	}
+}
+
+func TestPortChooser_TunnelType(t *testing.T) {
+	tests := []struct {
+		name       string
+		tunnelType service.TunnelType
+		keys       []string
+		expected   []service.TunnelType
+	}{
+		{name: "suggested", expected: []service.TunnelType{service.TunnelHTTP, service.TunnelTCP, service.TunnelHTTP}},
+		{name: "set", tunnelType: service.TunnelHTTP, expected: []service.TunnelType{service.TunnelHTTP, service.TunnelHTTP, service.TunnelHTTP}},
+		{name: "toggled", keys: []string{"t", "\x1b[B", "t"}, expected: []service.TunnelType{service.TunnelHTTP, service.TunnelHTTP, service.TunnelTCP}},
+		{name: "toggled twice", tunnelType: service.TunnelTCP, keys: []string{"t", "t"}, expected: []service.TunnelType{service.TunnelTCP, service.TunnelTCP, service.TunnelTCP}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestPortChooser(tt.tunnelType)
+			for _, key := range tt.keys {
+				c.handle([]byte(key))
+			}
+			c.handle([]byte("a"))
+
+			ports := c.selected()
+			for i, port := range ports {
+				if port.TunnelType != tt.expected[i] {
+					t.Errorf("Expected port %d on %s, got %s", port.Port, tt.expected[i], port.TunnelType)
+				}
+			}
+		})
+	}
+}
+
+func TestPortChooser_View(t *testing.T) {
+	c := newTestPortChooser("")
+	c.handle([]byte(" "))
+	c.handle([]byte("\x1b[B"))
+	c.handle([]byte("t"))
+
+	view := strings.Join(c.view(), "\n")
+	for _, expected := range []string{
+		"  [ ] http:80/TCP (target: 8080) · http\n",
+		"  [x] grpc:9000/TCP (target: 9000) ⭐ default · tcp\n",
+		"▸ [ ] metrics:9090/TCP (target: 9090) · tcp, http suggested",
+	} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("Expected the view to contain %q, got:\n%s", expected, view)
+		}
+	}
+}
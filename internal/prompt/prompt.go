@@ -3,9 +3,13 @@ package prompt
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"text/template"
 
+	"github.com/Goalt/service-exporter/internal/logging"
+	"github.com/Goalt/service-exporter/internal/recents"
 	"github.com/Goalt/service-exporter/internal/service"
 	"github.com/manifoldco/promptui"
 )
@@ -22,8 +26,9 @@ func NumberPrompt() (string, error) {
 	}
 
 	prompt := promptui.Prompt{
-		Label:    "Number",
-		Validate: validate,
+		Templates: promptTemplates(),
+		Label:     "Number",
+		Validate:  validate,
 	}
 
 	result, err := prompt.Run()
@@ -34,39 +39,81 @@ func NumberPrompt() (string, error) {
 	return result, nil
 }
 
-// serviceSearcher returns a searcher function for case-insensitive service name filtering
-func serviceSearcher(services []string) func(string, int) bool {
-	return func(input string, index int) bool {
-		return strings.Contains(strings.ToLower(services[index]), strings.ToLower(input))
+// serviceLabel returns the display label of a service, flagged with the settings of its annotations
+func serviceLabel(info service.ServiceInfo) string {
+	var flags []string
+	if info.OptIn {
+		flags = append(flags, "⭐ opted in")
 	}
+	if info.Defaults.TunnelType != "" && info.Defaults.TunnelType != service.TunnelHTTP {
+		flags = append(flags, string(info.Defaults.TunnelType))
+	}
+	if info.Defaults.BasicAuthSecret != "" {
+		flags = append(flags, "🔒 basic auth")
+	}
+	if info.Defaults.Domain != "" {
+		flags = append(flags, info.Defaults.Domain)
+	}
+	if len(info.Warnings) > 0 {
+		flags = append(flags, "⚠️  invalid annotations")
+	}
+
+	if len(flags) == 0 {
+		return info.String()
+	}
+	return fmt.Sprintf("%s [%s]", info, strings.Join(flags, ", "))
 }
 
-// ServiceSelectPrompt prompts user to select a Kubernetes service
-func ServiceSelectPrompt(services []string) (string, error) {
-	if len(services) == 0 {
-		return "", errors.New("no services available")
+// Shortcut is a recent or starred service port offered at the top of the service picker
+type Shortcut struct {
+	recents.Pick
+	Service service.ServiceInfo
+}
+
+// shortcutLabel returns the display label of a shortcut
+func shortcutLabel(s Shortcut) string {
+	port := strconv.Itoa(int(s.Port))
+	if s.PortName != "" {
+		port = fmt.Sprintf("%d (%s)", s.Port, s.PortName)
 	}
 
-	prompt := promptui.Select{
-		Label:             "Select a Kubernetes service",
-		Items:             services,
-		Searcher:          serviceSearcher(services),
-		StartInSearchMode: true,
+	switch s.Kind {
+	case recents.KindLast:
+		return fmt.Sprintf("↩️  Repeat last exposure: %s port %s", s.Service, port)
+	case recents.KindFavorite:
+		return fmt.Sprintf("📌 %s port %s", s.Service, port)
+	default:
+		return fmt.Sprintf("🕘 %s port %s", s.Service, port)
+	}
+}
+
+// Selection is the service picked, with the shortcut it was picked from if any
+type Selection struct {
+	Service  service.ServiceInfo
+	Shortcut *Shortcut
+}
+
+// ServiceSelectPrompt prompts user to select a Kubernetes service, or one of the shortcuts listed first.
+// list returns the services to pick from, it is read again whenever changed receives
+func ServiceSelectPrompt(list func() ServiceList, changed <-chan struct{}) (Selection, error) {
+	if l := list(); !l.Loading && len(l.Services) == 0 {
+		return Selection{}, errors.New("no services available")
 	}
 
-	_, result, err := prompt.Run()
+	selection, err := newPicker("Select a Kubernetes service", list).run(os.Stdin, os.Stdout, changed)
 	if err != nil {
-		return "", fmt.Errorf("service selection failed: %v", err)
+		return Selection{}, fmt.Errorf("service selection failed: %v", err)
 	}
 
-	return result, nil
+	return selection, nil
 }
 
 // UseDefaultsPrompt asks user if they want to use default configuration or provide manual input
 func UseDefaultsPrompt() (bool, error) {
 	prompt := promptui.Select{
-		Label: "Configuration mode",
-		Items: []string{"Use default values from environment variables", "Provide parameters manually"},
+		Templates: selectTemplates(),
+		Label:     "Configuration mode",
+		Items:     []string{"Use default values from environment variables", "Provide parameters manually"},
 	}
 
 	index, _, err := prompt.Run()
@@ -88,9 +135,10 @@ func NgrokTokenPrompt() (string, error) {
 	}
 
 	prompt := promptui.Prompt{
-		Label:    "Ngrok Auth Token",
-		Validate: validate,
-		Mask:     '*', // Hide the token input for security
+		Templates: promptTemplates(),
+		Label:     "Ngrok Auth Token",
+		Validate:  validate,
+		Mask:      '*', // Hide the token input for security
 	}
 
 	result, err := prompt.Run()
@@ -101,11 +149,48 @@ func NgrokTokenPrompt() (string, error) {
 	return strings.TrimSpace(result), nil
 }
 
+// PassphrasePrompt prompts user for the passphrase of the encrypted token file, twice when confirm is set
+func PassphrasePrompt(confirm bool) (string, error) {
+	validate := func(input string) error {
+		if input == "" {
+			return errors.New("Passphrase cannot be empty")
+		}
+		return nil
+	}
+
+	prompt := promptui.Prompt{
+		Templates: promptTemplates(),
+		Label:     "Passphrase of the encrypted token file",
+		Validate:  validate,
+		Mask:      '*',
+	}
+
+	passphrase, err := prompt.Run()
+	if err != nil {
+		return "", fmt.Errorf("passphrase input failed: %v", err)
+	}
+	if !confirm {
+		return passphrase, nil
+	}
+
+	prompt.Label = "Repeat the passphrase"
+	repeated, err := prompt.Run()
+	if err != nil {
+		return "", fmt.Errorf("passphrase input failed: %v", err)
+	}
+	if repeated != passphrase {
+		return "", errors.New("passphrases do not match")
+	}
+
+	return passphrase, nil
+}
+
 // KubeconfigPathPrompt prompts user for kubeconfig file path
 func KubeconfigPathPrompt() (string, error) {
 	prompt := promptui.Prompt{
-		Label:   "Kubeconfig file path (press Enter for default)",
-		Default: "", // Empty default means it will use the system default
+		Templates: promptTemplates(),
+		Label:     "Kubeconfig file path (press Enter for default)",
+		Default:   "", // Empty default means it will use the system default
 	}
 
 	result, err := prompt.Run()
@@ -116,36 +201,78 @@ func KubeconfigPathPrompt() (string, error) {
 	return strings.TrimSpace(result), nil
 }
 
-// PortSelectPrompt prompts user to select a port from available service ports
-func PortSelectPrompt(ports []service.ServicePort) (service.ServicePort, error) {
+// portLabel returns the display label of a service port
+func portLabel(port service.ServicePort) string {
+	name := port.Name
+	if name == "" {
+		name = "unnamed"
+	}
+
+	label := fmt.Sprintf("%s:%d/%s (target: %d)", name, port.Port, port.Protocol, port.TargetPort)
+	if port.Default {
+		label += " ⭐ default"
+	}
+	return label
+}
+
+// PortsSelectPrompt prompts user to select one or more ports from available service ports and their tunnel type,
+// tunnelType if set or the one suggested for each port until changed. An only port is selected as is, on tunnelType
+func PortsSelectPrompt(ports []service.ServicePort, tunnelType service.TunnelType) ([]SelectedPort, error) {
 	if len(ports) == 0 {
-		return service.ServicePort{}, errors.New("no ports available")
+		return nil, errors.New("no ports available")
 	}
 
 	// If only one port available, auto-select it
 	if len(ports) == 1 {
-		return ports[0], nil
+		return []SelectedPort{{ServicePort: ports[0], TunnelType: tunnelType}}, nil
 	}
 
-	// Create display items for ports
-	items := make([]string, len(ports))
-	for i, port := range ports {
-		name := port.Name
-		if name == "" {
-			name = "unnamed"
-		}
-		items[i] = fmt.Sprintf("%s:%d/%s (target: %d)", name, port.Port, port.Protocol, port.TargetPort)
+	chooser := newPortChooser("Select ports to forward", ports, tunnelType)
+	if err := interact(os.Stdin, os.Stdout, chooser.view, chooser.handle, nil, nil); err != nil {
+		return nil, fmt.Errorf("port selection failed: %v", err)
 	}
 
-	prompt := promptui.Select{
-		Label: "Select a port to forward",
-		Items: items,
+	return chooser.selected(), nil
+}
+
+// plainFuncs are the template functions of promptui without colors
+var plainFuncs = func() template.FuncMap {
+	funcs := template.FuncMap{}
+	for name, fn := range promptui.FuncMap {
+		funcs[name] = fn
+		if _, ok := fn.(func(interface{}) string); ok {
+			funcs[name] = func(v interface{}) string { return fmt.Sprint(v) }
+		}
 	}
+	return funcs
+}()
 
-	index, _, err := prompt.Run()
-	if err != nil {
-		return service.ServicePort{}, fmt.Errorf("port selection failed: %v", err)
+// promptTemplates returns the templates of a prompt without colors when they are disabled, nil for the defaults
+func promptTemplates() *promptui.PromptTemplates {
+	if logging.Color() {
+		return nil
+	}
+	return &promptui.PromptTemplates{
+		Prompt:          "? {{ . }}: ",
+		Valid:           "✔ {{ . }}: ",
+		Invalid:         "✗ {{ . }}: ",
+		ValidationError: ">> {{ . }}",
+		Success:         "{{ . }}: ",
+		FuncMap:         plainFuncs,
 	}
+}
 
-	return ports[index], nil
+// selectTemplates returns the templates of a selection without colors when they are disabled, nil for the defaults
+func selectTemplates() *promptui.SelectTemplates {
+	if logging.Color() {
+		return nil
+	}
+	return &promptui.SelectTemplates{
+		Label:    "? {{ . }}: ",
+		Active:   "▸ {{ . }}",
+		Inactive: "  {{ . }}",
+		Selected: "✔ {{ . }}",
+		Help:     "Use the arrow keys to navigate: {{ .NextKey }} {{ .PrevKey }} {{ .PageDownKey }} {{ .PageUpKey }}",
+		FuncMap:  plainFuncs,
+	}
 }
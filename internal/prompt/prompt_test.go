@@ -2,14 +2,16 @@ package prompt
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"text/template"
 
+	"github.com/Goalt/service-exporter/internal/recents"
 	"github.com/Goalt/service-exporter/internal/service"
 )
 
 func TestServiceSelectPrompt_EmptyServices(t *testing.T) {
-	services := []string{}
-	_, err := ServiceSelectPrompt(services)
+	_, err := ServiceSelectPrompt(func() ServiceList { return ServiceList{} }, nil)
 
 	if err == nil {
 		t.Fatal("ServiceSelectPrompt should return an error for empty services list")
@@ -30,35 +32,65 @@ func TestServiceSelectPrompt_ValidServices(t *testing.T) {
 	}
 }
 
-func TestServiceSelectPrompt_Searcher(t *testing.T) {
-	services := []string{"my-api (ns: default)", "backend-service (ns: staging)", "My-Frontend (ns: production)"}
+func TestShortcutLabel(t *testing.T) {
+	api := service.ServiceInfo{Name: "api", Namespace: "web"}
 
-	searcher := serviceSearcher(services)
+	tests := []struct {
+		shortcut Shortcut
+		expected string
+	}{
+		{
+			shortcut: Shortcut{Pick: recents.Pick{Entry: recents.Entry{Port: 80, PortName: "http"}, Kind: recents.KindLast}, Service: api},
+			expected: "↩️  Repeat last exposure: api (ns: web) port 80 (http)",
+		},
+		{
+			shortcut: Shortcut{Pick: recents.Pick{Entry: recents.Entry{Port: 8080}, Kind: recents.KindFavorite}, Service: api},
+			expected: "📌 api (ns: web) port 8080",
+		},
+		{
+			shortcut: Shortcut{Pick: recents.Pick{Entry: recents.Entry{Port: 9090}, Kind: recents.KindRecent}, Service: api},
+			expected: "🕘 api (ns: web) port 9090",
+		},
+	}
 
+	for _, tt := range tests {
+		if label := shortcutLabel(tt.shortcut); label != tt.expected {
+			t.Errorf("shortcutLabel() = %q, want %q", label, tt.expected)
+		}
+	}
+}
+
+func TestServiceLabel(t *testing.T) {
 	tests := []struct {
-		input    string
-		index    int
-		expected bool
+		info     service.ServiceInfo
+		expected string
 	}{
-		{"api", 0, true},
-		{"api", 1, false},
-		{"backend", 1, true},
-		{"BACKEND", 1, true},
-		{"my", 0, true},
-		{"my", 2, true},
-		{"my", 1, false},
-		{"", 0, true},
-		{"xyz", 0, false},
+		{service.ServiceInfo{Name: "api", Namespace: "default"}, "api (ns: default)"},
+		{
+			service.ServiceInfo{Name: "api", Namespace: "default", OptIn: true, Defaults: service.ExposeDefaults{
+				TunnelType: service.TunnelTCP, BasicAuthSecret: "api-auth", Domain: "api.example.com",
+			}},
+			"api (ns: default) [⭐ opted in, tcp, 🔒 basic auth, api.example.com]",
+		},
+		{service.ServiceInfo{Name: "db", Namespace: "data", Warnings: []string{"bad"}}, "db (ns: data) [⚠️  invalid annotations]"},
 	}
 
 	for _, tt := range tests {
-		result := searcher(tt.input, tt.index)
-		if result != tt.expected {
-			t.Errorf("searcher(%q, %d) = %v, want %v", tt.input, tt.index, result, tt.expected)
+		if label := serviceLabel(tt.info); label != tt.expected {
+			t.Errorf("serviceLabel() = %q, want %q", label, tt.expected)
 		}
 	}
 }
 
+func TestPortLabel(t *testing.T) {
+	if label := portLabel(service.ServicePort{Port: 80, TargetPort: 8080, Protocol: "TCP"}); label != "unnamed:80/TCP (target: 8080)" {
+		t.Errorf("Unexpected label %q", label)
+	}
+	if label := portLabel(service.ServicePort{Name: "http", Port: 80, TargetPort: 8080, Protocol: "TCP", Default: true}); label != "http:80/TCP (target: 8080) ⭐ default" {
+		t.Errorf("Unexpected label %q", label)
+	}
+}
+
 func TestNgrokTokenPrompt_ValidatesEmptyInput(t *testing.T) {
 	// Note: We can't easily test the interactive prompts without complex mocking,
 	// but we can verify the function signature and that it exists
@@ -98,6 +130,17 @@ func TestKubeconfigPathPrompt_Exists(t *testing.T) {
 	_ = KubeconfigPathPrompt
 }
 
+func TestPassphrasePrompt_Exists(t *testing.T) {
+	// Just verify the function exists and can be referenced
+	// The actual testing of promptui interactions would require complex mocking
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error("PassphrasePrompt function should exist and be callable")
+		}
+	}()
+	_ = PassphrasePrompt
+}
+
 func TestUseDefaultsPrompt_Exists(t *testing.T) {
 	// Just verify the function exists and can be referenced
 	// The actual testing of promptui interactions would require complex mocking
@@ -110,12 +153,12 @@ func TestUseDefaultsPrompt_Exists(t *testing.T) {
 	_ = UseDefaultsPrompt
 }
 
-func TestPortSelectPrompt_EmptyPorts(t *testing.T) {
+func TestPortsSelectPrompt_EmptyPorts(t *testing.T) {
 	ports := []service.ServicePort{}
-	_, err := PortSelectPrompt(ports)
+	_, err := PortsSelectPrompt(ports, "")
 
 	if err == nil {
-		t.Fatal("PortSelectPrompt should return an error for empty ports list")
+		t.Fatal("PortsSelectPrompt should return an error for empty ports list")
 	}
 
 	expectedMsg := "no ports available"
@@ -124,15 +167,19 @@ func TestPortSelectPrompt_EmptyPorts(t *testing.T) {
 	}
 }
 
-func TestPortSelectPrompt_SinglePort(t *testing.T) {
+func TestPortsSelectPrompt_SinglePort(t *testing.T) {
 	ports := []service.ServicePort{
 		{Name: "http", Port: 80, TargetPort: 8080, Protocol: "TCP"},
 	}
 
-	selectedPort, err := PortSelectPrompt(ports)
+	selected, err := PortsSelectPrompt(ports, service.TunnelTCP)
 	if err != nil {
-		t.Fatalf("PortSelectPrompt should not return an error for single port: %v", err)
+		t.Fatalf("PortsSelectPrompt should not return an error for single port: %v", err)
 	}
+	if len(selected) != 1 {
+		t.Fatalf("Expected the single port to be selected, got %+v", selected)
+	}
+	selectedPort := selected[0]
 
 	if selectedPort.Port != 80 {
 		t.Errorf("Expected port 80, got %d", selectedPort.Port)
@@ -140,15 +187,29 @@ func TestPortSelectPrompt_SinglePort(t *testing.T) {
 	if selectedPort.Name != "http" {
 		t.Errorf("Expected name 'http', got '%s'", selectedPort.Name)
 	}
+	if selectedPort.TunnelType != service.TunnelTCP {
+		t.Errorf("Expected tunnel type tcp, got '%s'", selectedPort.TunnelType)
+	}
 }
 
-func TestPortSelectPrompt_Exists(t *testing.T) {
+func TestPortsSelectPrompt_Exists(t *testing.T) {
 	// Just verify the function exists and can be referenced
 	defer func() {
 		if r := recover(); r != nil {
-			t.Error("PortSelectPrompt function should exist and be callable")
+			t.Error("PortsSelectPrompt function should exist and be callable")
 		}
 	}()
 	// This will not actually call the function but verifies it exists
-	_ = PortSelectPrompt
+	_ = PortsSelectPrompt
+}
+
+func TestPlainFuncs(t *testing.T) {
+	var buf strings.Builder
+	tpl := template.Must(template.New("").Funcs(plainFuncs).Parse(`{{ "✔" | green }} {{ . | bold | faint }}`))
+	if err := tpl.Execute(&buf, "api"); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if buf.String() != "✔ api" {
+		t.Errorf("Expected the text without colors, got %q", buf.String())
+	}
 }
@@ -0,0 +1,188 @@
+package prompt
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+// Score bonuses of fuzzy matching
+const (
+	// scoreBoundary is given to a letter at the start of a word, so that "ps" ranks "payment-service" high
+	scoreBoundary = 10
+	// scoreConsecutive is given to a letter following the previous matched letter
+	scoreConsecutive = 5
+	// scorePrefix is given when the term is a prefix of the target
+	scorePrefix = 20
+	// scoreExact is given when the term is the whole target
+	scoreExact = 40
+	// scoreName favors matches of the service name over matches of its namespace
+	scoreName = 5
+)
+
+// query is a search of the service picker: fuzzy terms and filters on namespace, type and labels
+type query struct {
+	terms      []string
+	namespaces []string
+	types      []string
+	// labels are "key" or "key=value" filters
+	labels []string
+}
+
+// parseQuery splits the input of the service picker into fuzzy terms and
+// "ns:", "type:" and "label:" filters, such as "api ns:payments type:LoadBalancer label:app=api"
+func parseQuery(input string) query {
+	var q query
+	for _, token := range strings.Fields(input) {
+		key, value, found := strings.Cut(token, ":")
+		switch {
+		case found && value != "" && (key == "ns" || key == "namespace"):
+			q.namespaces = append(q.namespaces, strings.ToLower(value))
+		case found && value != "" && key == "type":
+			q.types = append(q.types, strings.ToLower(value))
+		case found && value != "" && key == "label":
+			q.labels = append(q.labels, value)
+		case found && value == "" && (key == "ns" || key == "namespace" || key == "type" || key == "label"):
+			// A filter being typed does not filter yet
+		default:
+			q.terms = append(q.terms, strings.ToLower(token))
+		}
+	}
+	return q
+}
+
+// matches reports whether the service passes every filter of the query.
+// Namespace and type filters match prefixes so that results narrow down while typing
+func (q query) matches(info service.ServiceInfo) bool {
+	for _, namespace := range q.namespaces {
+		if !strings.HasPrefix(strings.ToLower(info.Namespace), namespace) {
+			return false
+		}
+	}
+	for _, serviceType := range q.types {
+		if !strings.HasPrefix(strings.ToLower(info.Type), serviceType) {
+			return false
+		}
+	}
+	for _, label := range q.labels {
+		key, value, hasValue := strings.Cut(label, "=")
+		actual, ok := info.Labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// score returns how well the service matches the fuzzy terms of the query, false if a term does not match.
+// A term matches the name, the namespace or "namespace/name"
+func (q query) score(info service.ServiceInfo) (int, bool) {
+	total := 0
+	for _, term := range q.terms {
+		best, found := 0, false
+		if s, ok := fuzzyScore(term, info.Name); ok {
+			best, found = s+scoreName, true
+		}
+		for _, target := range []string{info.Namespace, info.Namespace + "/" + info.Name} {
+			if s, ok := fuzzyScore(term, target); ok && (!found || s > best) {
+				best, found = s, true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+// fuzzyScore returns how well term matches target, false unless the letters of term appear in order in target.
+// Letters starting a word and consecutive letters score higher, so acronyms and substrings rank first
+func fuzzyScore(term string, target string) (int, bool) {
+	term, target = strings.ToLower(term), strings.ToLower(target)
+	if term == "" {
+		return 0, true
+	}
+
+	// best[i] is the best score of the letters matched so far with the last one at target[i], -1 if impossible
+	const impossible = -1
+	var best []int
+	for j := range len(term) {
+		current := make([]int, len(target))
+		previous := impossible
+		for i := range len(target) {
+			current[i] = impossible
+			if j > 0 && i >= 2 {
+				previous = max(previous, best[i-2])
+			}
+			if target[i] != term[j] {
+				continue
+			}
+
+			bonus := 1
+			if isWordStart(target, i) {
+				bonus = scoreBoundary
+			}
+			if j == 0 {
+				current[i] = bonus
+				continue
+			}
+
+			if previous != impossible {
+				current[i] = previous + bonus
+			}
+			if i > 0 && best[i-1] != impossible {
+				current[i] = max(current[i], best[i-1]+max(bonus, scoreConsecutive))
+			}
+		}
+		best = current
+	}
+
+	score := slices.Max(append(best, impossible))
+	if score == impossible {
+		return 0, false
+	}
+
+	switch {
+	case term == target:
+		score += scoreExact
+	case strings.HasPrefix(target, term):
+		score += scorePrefix
+	}
+	return score, true
+}
+
+// isWordStart reports whether target[i] starts a word of a Kubernetes name
+func isWordStart(target string, i int) bool {
+	return i == 0 || strings.ContainsRune("-_./ ", rune(target[i-1]))
+}
+
+// rank returns the indexes of the services matching the input of the picker, best match first.
+// Services scoring the same keep their order, so shortcuts stay above the services
+func rank(services []service.ServiceInfo, input string) []int {
+	q := parseQuery(input)
+
+	type match struct {
+		index int
+		score int
+	}
+	var matches []match
+	for i, info := range services {
+		if !q.matches(info) {
+			continue
+		}
+		if score, ok := q.score(info); ok {
+			matches = append(matches, match{index: i, score: score})
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b match) int { return cmp.Compare(b.score, a.score) })
+
+	indexes := make([]int, len(matches))
+	for i, m := range matches {
+		indexes[i] = m.index
+	}
+	return indexes
+}
@@ -0,0 +1,93 @@
+package prompt
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Goalt/service-exporter/internal/service"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		term   string
+		target string
+		match  bool
+	}{
+		{"api", "my-api", true},
+		{"API", "my-api", true},
+		{"ps", "payment-service", true},
+		{"pmtsvc", "payment-service", true},
+		{"", "anything", true},
+		{"xyz", "my-api", false},
+		{"ipa", "my-api", false},
+	}
+
+	for _, tt := range tests {
+		if _, match := fuzzyScore(tt.term, tt.target); match != tt.match {
+			t.Errorf("fuzzyScore(%q, %q) matched = %v, want %v", tt.term, tt.target, match, tt.match)
+		}
+	}
+
+	better := [][3]string{
+		// term, better target, worse target
+		{"api", "api", "api-gateway"},
+		{"api", "api-gateway", "my-api"},
+		{"ps", "payment-service", "pods"},
+		{"ps", "payment-service", "apps"},
+		{"db", "db-primary", "sandbox"},
+	}
+	for _, b := range better {
+		high, _ := fuzzyScore(b[0], b[1])
+		low, _ := fuzzyScore(b[0], b[2])
+		if high <= low {
+			t.Errorf("Expected %q to rank %q (%d) above %q (%d)", b[0], b[1], high, b[2], low)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q := parseQuery("api ns:payments type:LoadBalancer label:app=api label:team ns:")
+
+	if !slices.Equal(q.terms, []string{"api"}) {
+		t.Errorf("Unexpected terms %v", q.terms)
+	}
+	if !slices.Equal(q.namespaces, []string{"payments"}) || !slices.Equal(q.types, []string{"loadbalancer"}) {
+		t.Errorf("Unexpected filters %+v", q)
+	}
+	if !slices.Equal(q.labels, []string{"app=api", "team"}) {
+		t.Errorf("Unexpected label filters %v", q.labels)
+	}
+}
+
+func TestRank(t *testing.T) {
+	services := []service.ServiceInfo{
+		{Name: "my-api", Namespace: "default", Type: "ClusterIP", Labels: map[string]string{"app": "api"}},
+		{Name: "payment-service", Namespace: "payments", Type: "LoadBalancer", Labels: map[string]string{"app": "payments", "team": "billing"}},
+		{Name: "api", Namespace: "payments", Type: "ClusterIP", Labels: map[string]string{"app": "api", "team": "billing"}},
+		{Name: "postgres", Namespace: "data", Type: "ClusterIP"},
+	}
+
+	tests := []struct {
+		input    string
+		expected []int
+	}{
+		{"", []int{0, 1, 2, 3}},
+		// Loose matches such as "payments/payment-service" come last
+		{"api", []int{2, 0, 1}},
+		{"ps", []int{1, 3, 2}},
+		{"ns:pay", []int{1, 2}},
+		{"type:loadbalancer", []int{1}},
+		{"label:app=api", []int{0, 2}},
+		{"label:team", []int{1, 2}},
+		{"api ns:payments label:team=billing", []int{2, 1}},
+		{"api type:clusterip label:team", []int{2}},
+		{"payments/api", []int{2}},
+		{"label:app=web", nil},
+	}
+
+	for _, tt := range tests {
+		if result := rank(services, tt.input); !slices.Equal(result, tt.expected) {
+			t.Errorf("rank(%q) = %v, want %v", tt.input, result, tt.expected)
+		}
+	}
+}
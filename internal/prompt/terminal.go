@@ -0,0 +1,88 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// interact redraws view below the cursor and passes raw terminal input to handle until it reports
+// completion or an error, then erases the view. update is called, and the view redrawn, whenever changed receives
+func interact(in *os.File, out io.Writer, view func() []string, handle func([]byte) (bool, error), changed <-chan struct{}, update func()) error {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("interactive selection needs a terminal")
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	// Hide the cursor while the view is shown
+	fmt.Fprint(out, "\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h")
+
+	drawn := 0
+	draw := func(lines []string) {
+		if drawn > 0 {
+			fmt.Fprintf(out, "\x1b[%dA", drawn)
+		}
+		fmt.Fprint(out, "\r\x1b[J")
+
+		width, _, err := term.GetSize(fd)
+		for _, line := range lines {
+			// Wrapped lines would break the redraw, so long lines are cut
+			if err == nil && width > 1 && utf8.RuneCountInString(line) >= width {
+				line = string([]rune(line)[:width-2]) + "…"
+			}
+			fmt.Fprint(out, line+"\r\n")
+		}
+		drawn = len(lines)
+	}
+	defer draw(nil)
+
+	// Input is read in the background to redraw on changes meanwhile. The reader waits for each input to
+	// be handled before reading more, so that it does not take the input of the next prompt once done
+	type input struct {
+		data []byte
+		err  error
+	}
+	inputs := make(chan input)
+	next := make(chan struct{})
+	go func() {
+		for {
+			buf := make([]byte, 64)
+			n, err := in.Read(buf)
+			inputs <- input{data: buf[:n], err: err}
+			if err != nil {
+				return
+			}
+			<-next
+		}
+	}()
+
+	for {
+		draw(view())
+
+		select {
+		case <-changed:
+			update()
+		case i := <-inputs:
+			if i.err != nil {
+				return i.err
+			}
+
+			done, err := handle(i.data)
+			if err != nil || done {
+				return err
+			}
+			next <- struct{}{}
+		}
+	}
+}
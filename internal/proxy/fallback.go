@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// DefaultFallbackPage is served with 503 Service Unavailable while the upstream is unhealthy
+const DefaultFallbackPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Service unavailable</title>
+<style>
+body { font-family: system-ui, sans-serif; color: #333; max-width: 36em; margin: 6em auto; padding: 0 1em; }
+h1 { font-size: 1.5em; }
+</style>
+</head>
+<body>
+<h1>Service temporarily unavailable</h1>
+<p>The service behind this address is not responding right now. Please try again in a moment.</p>
+</body>
+</html>
+`
+
+// fallbackRetryAfter is the Retry-After header value of the fallback page, in seconds
+const fallbackRetryAfter = 10
+
+// SetHealthy marks the upstream as healthy or not, the fallback page is served while it is not
+func (p *Proxy) SetHealthy(healthy bool) {
+	p.unhealthy.Store(!healthy)
+}
+
+// fallback serves the fallback page instead of calling next while the upstream is unhealthy
+func (p *Proxy) fallback(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.unhealthy.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Retry-After", strconv.Itoa(fallbackRetryAfter))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(p.fallbackPage)
+	})
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxy_Fallback(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	p, err := New(backendPort(t, backend), Options{FallbackPage: []byte("<h1>down for maintenance</h1>")})
+	if err != nil {
+		t.Fatalf("New should not return an error: %v", err)
+	}
+	defer p.Close()
+
+	get := func() (int, string) {
+		resp, err := http.Get("http://" + p.Addr() + "/")
+		if err != nil {
+			t.Fatalf("Request through proxy failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := get(); status != http.StatusOK || body != "backend" {
+		t.Errorf("Expected the backend response, got %d %q", status, body)
+	}
+
+	p.SetHealthy(false)
+	if status, body := get(); status != http.StatusServiceUnavailable || body != "<h1>down for maintenance</h1>" {
+		t.Errorf("Expected the fallback page while unhealthy, got %d %q", status, body)
+	}
+
+	p.SetHealthy(true)
+	if status, body := get(); status != http.StatusOK || body != "backend" {
+		t.Errorf("Expected the backend response once healthy again, got %d %q", status, body)
+	}
+}
@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR is an HTTP Archive 1.2 document
+// See http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root object of a HAR document
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator identifies the application that created the HAR document
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request and response
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARRequest describes a recorded request
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse describes a recorded response
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a header, cookie or query parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the body of a recorded request
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	// Encoding is base64 for binary bodies, HAR 1.2 only defines it for responses so Comment says so too
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARContent is the body of a recorded response
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings holds the timing of a recorded exchange in milliseconds
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// NewHAR converts recorded exchanges into a HAR document
+func NewHAR(exchanges []Exchange) HAR {
+	entries := make([]HAREntry, 0, len(exchanges))
+	for _, e := range exchanges {
+		entries = append(entries, harEntry(e))
+	}
+
+	return HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "service-exporter", Version: "1.0"},
+		Entries: entries,
+	}}
+}
+
+func harEntry(e Exchange) HAREntry {
+	ms := float64(e.Duration) / float64(time.Millisecond)
+
+	entry := HAREntry{
+		StartedDateTime: e.StartedAt.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request: HARRequest{
+			Method:      e.Method,
+			URL:         e.URL,
+			HTTPVersion: e.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(e.RequestHeaders),
+			QueryString: harQuery(e.URL),
+			HeadersSize: -1,
+			BodySize:    e.RequestSize,
+		},
+		Response: HARResponse{
+			Status:      e.Status,
+			StatusText:  http.StatusText(e.Status),
+			HTTPVersion: e.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(e.ResponseHeaders),
+			Content: HARContent{
+				Size:     e.ResponseSize,
+				MimeType: e.ResponseHeaders.Get("Content-Type"),
+			},
+			HeadersSize: -1,
+			BodySize:    e.ResponseSize,
+		},
+		Timings: HARTimings{Wait: ms},
+		Comment: e.Error,
+	}
+
+	if e.RequestSize > 0 {
+		entry.Request.PostData = &HARPostData{MimeType: e.RequestHeaders.Get("Content-Type")}
+		if utf8.Valid(e.RequestBody) {
+			entry.Request.PostData.Text = string(e.RequestBody)
+		} else {
+			entry.Request.PostData.Text = base64.StdEncoding.EncodeToString(e.RequestBody)
+			entry.Request.PostData.Encoding = "base64"
+			entry.Request.PostData.Comment = "binary body, text is base64 encoded"
+		}
+	}
+
+	if len(e.ResponseBody) > 0 {
+		if utf8.Valid(e.ResponseBody) {
+			entry.Response.Content.Text = string(e.ResponseBody)
+		} else {
+			entry.Response.Content.Text = base64.StdEncoding.EncodeToString(e.ResponseBody)
+			entry.Response.Content.Encoding = "base64"
+		}
+	}
+
+	return entry
+}
+
+// harHeaders flattens headers into sorted name/value pairs
+func harHeaders(header http.Header) []HARNameValue {
+	pairs := []HARNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Name < pairs[j].Name
+	})
+
+	return pairs
+}
+
+// harQuery extracts the query parameters of a URL
+func harQuery(rawURL string) []HARNameValue {
+	pairs := []HARNameValue{}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return pairs
+	}
+
+	for name, values := range u.Query() {
+		for _, value := range values {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Name < pairs[j].Name
+	})
+
+	return pairs
+}
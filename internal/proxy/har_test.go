@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewHAR(t *testing.T) {
+	exchanges := []Exchange{
+		{
+			ID:             1,
+			StartedAt:      time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+			Duration:       15 * time.Millisecond,
+			Method:         http.MethodPost,
+			URL:            "https://abc.ngrok.io/hook?b=2&a=1",
+			Proto:          "HTTP/1.1",
+			RequestHeaders: http.Header{"Content-Type": {"application/json"}},
+			RequestBody:    []byte(`{"ok":true}`),
+			RequestSize:    11,
+			Status:         http.StatusOK,
+			ResponseHeaders: http.Header{
+				"Content-Type": {"application/octet-stream"},
+			},
+			ResponseBody: []byte{0xff, 0xfe},
+			ResponseSize: 2,
+		},
+	}
+
+	har := NewHAR(exchanges)
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 1 {
+		t.Fatalf("Unexpected HAR log %+v", har.Log)
+	}
+
+	entry := har.Log.Entries[0]
+	if entry.Time != 15 || entry.StartedDateTime != "2025-01-02T03:04:05Z" {
+		t.Errorf("Unexpected timing %v at %s", entry.Time, entry.StartedDateTime)
+	}
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != `{"ok":true}` {
+		t.Errorf("Request body should be exported as post data, got %+v", entry.Request.PostData)
+	}
+	if len(entry.Request.QueryString) != 2 || entry.Request.QueryString[0].Name != "a" {
+		t.Errorf("Query string should be exported sorted, got %+v", entry.Request.QueryString)
+	}
+	if entry.Response.StatusText != "OK" {
+		t.Errorf("Expected status text OK, got %s", entry.Response.StatusText)
+	}
+	if entry.Response.Content.Encoding != "base64" || entry.Response.Content.Text != "//4=" {
+		t.Errorf("Binary response should be base64 encoded, got %+v", entry.Response.Content)
+	}
+
+	if _, err := json.Marshal(har); err != nil {
+		t.Errorf("HAR should be serializable: %v", err)
+	}
+}
+
+func TestNewHAR_BinaryBodies(t *testing.T) {
+	body := []byte{0x0a, 0x03, 'a', 'p', 'i', 0x80, 0xff}
+	har := NewHAR([]Exchange{{
+		Method:          http.MethodPost,
+		URL:             "https://abc.ngrok.io/api.Service/Get",
+		RequestHeaders:  http.Header{"Content-Type": {"application/grpc-web+proto"}},
+		RequestBody:     body,
+		RequestSize:     int64(len(body)),
+		Status:          http.StatusOK,
+		ResponseHeaders: http.Header{"Content-Type": {"application/grpc-web+proto"}},
+		ResponseBody:    body,
+		ResponseSize:    int64(len(body)),
+	}})
+
+	data, err := json.Marshal(har)
+	if err != nil {
+		t.Fatalf("HAR should be serializable: %v", err)
+	}
+	var decoded HAR
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("HAR should be readable: %v", err)
+	}
+
+	entry := decoded.Log.Entries[0]
+	postData := entry.Request.PostData
+	if postData == nil || postData.Encoding != "base64" || postData.Comment == "" {
+		t.Fatalf("Binary request body should be base64 encoded, got %+v", postData)
+	}
+	if decodedBody, err := base64.StdEncoding.DecodeString(postData.Text); err != nil || !bytes.Equal(decodedBody, body) {
+		t.Errorf("Expected the request body to round-trip, got %v %v", decodedBody, err)
+	}
+	if decodedBody, err := base64.StdEncoding.DecodeString(entry.Response.Content.Text); err != nil || !bytes.Equal(decodedBody, body) {
+		t.Errorf("Expected the response body to round-trip, got %v %v", decodedBody, err)
+	}
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRecords is the default number of recent requests kept for inspection
+	DefaultMaxRecords = 100
+	// DefaultMaxBodySize is the default number of body bytes recorded per request and response
+	DefaultMaxBodySize = 64 * 1024
+)
+
+// Exchange is a request and its response recorded by the proxy
+type Exchange struct {
+	ID        int64         `json:"id"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+
+	Method                string      `json:"method"`
+	URL                   string      `json:"url"`
+	Proto                 string      `json:"proto"`
+	RequestHeaders        http.Header `json:"requestHeaders"`
+	RequestBody           []byte      `json:"requestBody,omitempty"`
+	RequestBodyTruncated  bool        `json:"requestBodyTruncated,omitempty"`
+	RequestSize           int64       `json:"requestSize"`
+	Status                int         `json:"status"`
+	ResponseHeaders       http.Header `json:"responseHeaders"`
+	ResponseBody          []byte      `json:"responseBody,omitempty"`
+	ResponseBodyTruncated bool        `json:"responseBodyTruncated,omitempty"`
+	ResponseSize          int64       `json:"responseSize"`
+
+	// Error is set when the request could not be proxied to the forwarded port
+	Error string `json:"error,omitempty"`
+}
+
+// Inspector keeps the most recent exchanges that went through a proxy
+type Inspector struct {
+	mu         sync.Mutex
+	maxRecords int
+	nextID     int64
+	exchanges  []Exchange
+}
+
+// NewInspector creates an inspector keeping up to maxRecords exchanges
+func NewInspector(maxRecords int) *Inspector {
+	return &Inspector{maxRecords: maxRecords}
+}
+
+// add records an exchange, dropping the oldest one when full
+func (i *Inspector) add(e Exchange) Exchange {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.nextID++
+	e.ID = i.nextID
+
+	i.exchanges = append(i.exchanges, e)
+	if len(i.exchanges) > i.maxRecords {
+		i.exchanges = i.exchanges[len(i.exchanges)-i.maxRecords:]
+	}
+
+	return e
+}
+
+// Exchanges returns the recorded exchanges, oldest first
+func (i *Inspector) Exchanges() []Exchange {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]Exchange(nil), i.exchanges...)
+}
+
+// Exchange returns the recorded exchange with the given ID
+func (i *Inspector) Exchange(id int64) (Exchange, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, e := range i.exchanges {
+		if e.ID == id {
+			return e, true
+		}
+	}
+
+	return Exchange{}, false
+}
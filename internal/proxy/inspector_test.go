@@ -0,0 +1,36 @@
+package proxy
+
+import "testing"
+
+func TestInspector_KeepsMostRecent(t *testing.T) {
+	inspector := NewInspector(3)
+	for i := 0; i < 5; i++ {
+		inspector.add(Exchange{Method: "GET"})
+	}
+
+	exchanges := inspector.Exchanges()
+	if len(exchanges) != 3 {
+		t.Fatalf("Expected 3 exchanges, got %d", len(exchanges))
+	}
+
+	if exchanges[0].ID != 3 || exchanges[2].ID != 5 {
+		t.Errorf("Expected exchanges 3..5, got %d..%d", exchanges[0].ID, exchanges[2].ID)
+	}
+}
+
+func TestInspector_Exchange(t *testing.T) {
+	inspector := NewInspector(10)
+	added := inspector.add(Exchange{Method: "POST", URL: "https://example.com/hook"})
+
+	e, ok := inspector.Exchange(added.ID)
+	if !ok {
+		t.Fatalf("Exchange %d should be found", added.ID)
+	}
+	if e.URL != "https://example.com/hook" {
+		t.Errorf("Expected URL https://example.com/hook, got %s", e.URL)
+	}
+
+	if _, ok := inspector.Exchange(42); ok {
+		t.Error("Unknown exchange should not be found")
+	}
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+)
+
+// Limits caps the traffic accepted by a proxy, zero values mean no limit
+type Limits struct {
+	// RequestsPerSecond is the sustained request rate, excess requests get 429 Too Many Requests
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+	// Burst is the number of requests accepted at once above the rate, at least the rate rounded up
+	Burst int `json:"burst,omitempty"`
+	// MaxConcurrentRequests caps the requests served at the same time, whatever connection they come on;
+	// excess requests get 503 Service Unavailable
+	MaxConcurrentRequests int `json:"maxConcurrentRequests,omitempty"`
+	// MaxRequestBodySize caps request bodies in bytes, larger requests get 413 Request Entity Too Large
+	MaxRequestBodySize int64 `json:"maxRequestBodySize,omitempty"`
+}
+
+// IsZero reports whether no limit is set
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// Merge returns l overridden by the limits set in other
+func (l Limits) Merge(other Limits) Limits {
+	if other.RequestsPerSecond != 0 {
+		l.RequestsPerSecond = other.RequestsPerSecond
+	}
+	if other.Burst != 0 {
+		l.Burst = other.Burst
+	}
+	if other.MaxConcurrentRequests != 0 {
+		l.MaxConcurrentRequests = other.MaxConcurrentRequests
+	}
+	if other.MaxRequestBodySize != 0 {
+		l.MaxRequestBodySize = other.MaxRequestBodySize
+	}
+	return l
+}
+
+// String describes the limits in a single line
+func (l Limits) String() string {
+	var parts []string
+	if l.RequestsPerSecond > 0 {
+		parts = append(parts, fmt.Sprintf("%g req/s (burst %d)", l.RequestsPerSecond, l.burst()))
+	}
+	if l.MaxConcurrentRequests > 0 {
+		parts = append(parts, fmt.Sprintf("max %d concurrent requests", l.MaxConcurrentRequests))
+	}
+	if l.MaxRequestBodySize > 0 {
+		parts = append(parts, fmt.Sprintf("max %d byte bodies", l.MaxRequestBodySize))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// burst returns the configured burst, at least one second worth of requests
+func (l Limits) burst() int {
+	return max(l.Burst, int(math.Ceil(l.RequestsPerSecond)), 1)
+}
+
+// limiter enforces Limits on the requests going through a proxy
+type limiter struct {
+	limits   Limits
+	rate     *rate.Limiter
+	active   atomic.Int64
+	rejected *atomic.Int64
+}
+
+func newLimiter(limits Limits, rejected *atomic.Int64) *limiter {
+	l := &limiter{limits: limits, rejected: rejected}
+	if limits.RequestsPerSecond > 0 {
+		l.rate = rate.NewLimiter(rate.Limit(limits.RequestsPerSecond), limits.burst())
+	}
+	return l
+}
+
+// wrap rejects the requests over the limits before they reach next
+func (l *limiter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.rate != nil && !l.rate.Allow() {
+			l.rejected.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(1/l.limits.RequestsPerSecond)))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		if l.limits.MaxConcurrentRequests > 0 {
+			defer l.active.Add(-1)
+			if l.active.Add(1) > int64(l.limits.MaxConcurrentRequests) {
+				l.rejected.Add(1)
+				http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		if l.limits.MaxRequestBodySize > 0 {
+			if r.ContentLength > l.limits.MaxRequestBodySize {
+				l.rejected.Add(1)
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			// Bodies of unknown length are cut by the reader, reported through the error handler
+			r.Body = http.MaxBytesReader(w, r.Body, l.limits.MaxRequestBodySize)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
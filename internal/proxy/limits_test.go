@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newLimitedProxy starts a proxy with limits in front of handler
+func newLimitedProxy(t *testing.T, limits Limits, handler http.HandlerFunc) *Proxy {
+	t.Helper()
+	backend := httptest.NewServer(handler)
+	t.Cleanup(backend.Close)
+
+	p, err := New(backendPort(t, backend), Options{Limits: limits})
+	if err != nil {
+		t.Fatalf("New should not return an error: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestLimits_RateLimit(t *testing.T) {
+	p := newLimitedProxy(t, Limits{RequestsPerSecond: 0.5, Burst: 2}, func(w http.ResponseWriter, r *http.Request) {})
+
+	var statuses []int
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get("http://" + p.Addr() + "/")
+		if err != nil {
+			t.Fatalf("Request through proxy failed: %v", err)
+		}
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+
+		if resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "2" {
+			t.Errorf("Expected Retry-After 2, got %q", resp.Header.Get("Retry-After"))
+		}
+	}
+
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusOK || statuses[2] != http.StatusTooManyRequests {
+		t.Errorf("Expected the burst to pass and the next request to be limited, got %v", statuses)
+	}
+	if stats := p.Stats(); stats.Rejected != 1 || stats.Failures != 0 {
+		t.Errorf("Expected 1 rejected request and no failures, got %+v", stats)
+	}
+}
+
+func TestLimits_MaxConcurrentRequests(t *testing.T) {
+	release := make(chan struct{})
+	var once sync.Once
+	started := make(chan struct{})
+	p := newLimitedProxy(t, Limits{MaxConcurrentRequests: 1}, func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(started) })
+		<-release
+	})
+
+	done := make(chan int)
+	go func() {
+		resp, err := http.Get("http://" + p.Addr() + "/slow")
+		if err != nil {
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	<-started
+
+	resp, err := http.Get("http://" + p.Addr() + "/")
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	resp.Body.Close()
+	close(release)
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 over the connection cap, got %d", resp.StatusCode)
+	}
+	if status := <-done; status != http.StatusOK {
+		t.Errorf("Expected the first request to pass, got %d", status)
+	}
+	if rejected := p.Stats().Rejected; rejected != 1 {
+		t.Errorf("Expected 1 rejected request, got %d", rejected)
+	}
+}
+
+func TestLimits_MaxRequestBodySize(t *testing.T) {
+	p := newLimitedProxy(t, Limits{MaxRequestBodySize: 4}, func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+	})
+
+	tests := []struct {
+		name   string
+		body   io.Reader
+		status int
+	}{
+		{"small body", strings.NewReader("abc"), http.StatusOK},
+		{"known length over the limit", strings.NewReader("too large"), http.StatusRequestEntityTooLarge},
+		// Hide the length so the body is sent chunked
+		{"chunked over the limit", io.MultiReader(strings.NewReader("too large")), http.StatusRequestEntityTooLarge},
+	}
+
+	// A rejected request can leave a spare connection behind that delays closing the proxy
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	for _, tt := range tests {
+		resp, err := client.Post("http://"+p.Addr()+"/", "text/plain", tt.body)
+		if err != nil {
+			t.Fatalf("%s: request through proxy failed: %v", tt.name, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+	}
+
+	if stats := p.Stats(); stats.Rejected != 2 || stats.Failures != 0 {
+		t.Errorf("Expected 2 rejected requests and no failures, got %+v", stats)
+	}
+}
+
+func TestLimits_MergeAndString(t *testing.T) {
+	limits := Limits{RequestsPerSecond: 10, MaxConcurrentRequests: 5}.Merge(Limits{MaxConcurrentRequests: 20, MaxRequestBodySize: 1024})
+
+	expected := "10 req/s (burst 10), max 20 concurrent requests, max 1024 byte bodies"
+	if result := limits.String(); result != expected {
+		t.Errorf("String() = %q, want %q", result, expected)
+	}
+
+	if !(Limits{}).IsZero() || limits.IsZero() {
+		t.Error("IsZero should only report empty limits")
+	}
+}
@@ -0,0 +1,332 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds the traffic counters of a proxy
+type Stats struct {
+	Requests int64
+	BytesIn  int64
+	BytesOut int64
+	Failures int64
+	// Rejected counts the requests refused because of the proxy's limits
+	Rejected int64
+	// LastRequest is when the last request was received, zero if none was
+	LastRequest time.Time
+}
+
+// Options configures a proxy
+type Options struct {
+	// OnError, if not nil, is called for every request that could not be proxied
+	OnError func(error)
+	// MaxRecords is the number of recent requests kept for inspection
+	MaxRecords int
+	// MaxBodySize caps the number of body bytes recorded per request and response
+	MaxBodySize int
+	// Rules rewrites the proxied requests and responses
+	Rules Rules
+	// Limits caps the traffic accepted by the proxy
+	Limits Limits
+	// FallbackPage is the HTML page served while the upstream is unhealthy, DefaultFallbackPage if empty
+	FallbackPage []byte
+}
+
+// Proxy is a local HTTP reverse proxy placed between the ngrok tunnel and a
+// forwarded port, so traffic going through the tunnel can be observed
+type Proxy struct {
+	listener   net.Listener
+	server     *http.Server
+	onError    func(error)
+	inspector  *Inspector
+	maxBody    int
+	targetPort int
+	rules      Rules
+
+	unhealthy    atomic.Bool
+	fallbackPage []byte
+
+	requests atomic.Int64
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	failures atomic.Int64
+	rejected atomic.Int64
+	// lastRequest is the Unix time in nanoseconds of the last request
+	lastRequest atomic.Int64
+}
+
+// New starts a proxy on a random local port forwarding to localhost:targetPort
+func New(targetPort int, opts Options) (*Proxy, error) {
+	target, err := url.Parse(fmt.Sprintf("http://localhost:%d", targetPort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse target URL: %w", err)
+	}
+
+	if opts.MaxRecords <= 0 {
+		opts.MaxRecords = DefaultMaxRecords
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = DefaultMaxBodySize
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on local port: %w", err)
+	}
+
+	p := &Proxy{
+		listener:   listener,
+		onError:    opts.OnError,
+		inspector:  NewInspector(opts.MaxRecords),
+		maxBody:    opts.MaxBodySize,
+		targetPort: targetPort,
+		rules:      opts.Rules,
+	}
+	p.fallbackPage = opts.FallbackPage
+	if len(p.fallbackPage) == 0 {
+		p.fallbackPage = []byte(DefaultFallbackPage)
+	}
+
+	reverseProxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			// Keep the public host so the backend sees the same request as without the proxy
+			r.Out.Host = r.In.Host
+			opts.Rules.rewriteRequest(r.Out)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			opts.Rules.rewriteResponse(resp)
+			return nil
+		},
+		ErrorHandler: p.handleError,
+	}
+
+	p.server = &http.Server{
+		Handler:           p.observe(p.fallback(newLimiter(opts.Limits, &p.rejected).wrap(reverseProxy))),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		if err := p.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			p.reportError(fmt.Errorf("proxy stopped: %w", err))
+		}
+	}()
+
+	return p, nil
+}
+
+// Port returns the local port the proxy listens on
+func (p *Proxy) Port() int {
+	return p.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Addr returns the local address the proxy listens on
+func (p *Proxy) Addr() string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(p.Port()))
+}
+
+// Stats returns a snapshot of the proxy's traffic counters
+func (p *Proxy) Stats() Stats {
+	stats := Stats{
+		Requests: p.requests.Load(),
+		BytesIn:  p.bytesIn.Load(),
+		BytesOut: p.bytesOut.Load(),
+		Failures: p.failures.Load(),
+		Rejected: p.rejected.Load(),
+	}
+	if last := p.lastRequest.Load(); last != 0 {
+		stats.LastRequest = time.Unix(0, last)
+	}
+
+	return stats
+}
+
+// Close stops the proxy
+func (p *Proxy) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return p.server.Shutdown(ctx)
+}
+
+// Rules returns the rewrite rules applied by the proxy
+func (p *Proxy) Rules() Rules {
+	return p.rules
+}
+
+// Inspector returns the recorder of the requests that went through the proxy
+func (p *Proxy) Inspector() *Inspector {
+	return p.inspector
+}
+
+// observe wraps the handler to update the traffic counters and record each exchange
+func (p *Proxy) observe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.requests.Add(1)
+		started := time.Now()
+		p.lastRequest.Store(started.UnixNano())
+
+		reqBody := &capturingReader{ReadCloser: r.Body, n: &p.bytesIn, limit: p.maxBody}
+		r.Body = reqBody
+		// Keep a copy of the incoming headers, the reverse proxy modifies them
+		reqHeaders := r.Header.Clone()
+
+		cw := &capturingWriter{ResponseWriter: w, n: &p.bytesOut, limit: p.maxBody}
+		next.ServeHTTP(cw, r)
+
+		status := cw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		body, bodyTruncated, bodySize := reqBody.snapshot()
+
+		p.inspector.add(Exchange{
+			StartedAt:             started,
+			Duration:              time.Since(started),
+			Method:                r.Method,
+			URL:                   requestURL(r),
+			Proto:                 r.Proto,
+			RequestHeaders:        reqHeaders,
+			RequestBody:           body,
+			RequestBodyTruncated:  bodyTruncated,
+			RequestSize:           bodySize,
+			Status:                status,
+			ResponseHeaders:       cw.Header().Clone(),
+			ResponseBody:          cw.captured.Bytes(),
+			ResponseBodyTruncated: cw.truncated,
+			ResponseSize:          cw.size,
+			Error:                 cw.err,
+		})
+	})
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if cw, ok := w.(*capturingWriter); ok {
+		cw.err = err.Error()
+	}
+
+	// A request body of unknown length went over the limit while being sent
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		p.rejected.Add(1)
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	p.failures.Add(1)
+	p.reportError(fmt.Errorf("%s %s: %w", r.Method, r.URL.Path, err))
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+func (p *Proxy) reportError(err error) {
+	if p.onError != nil {
+		p.onError(err)
+	}
+}
+
+// requestURL rebuilds the public URL the request was sent to
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	} else if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// capturingReader counts the bytes read from a request body and records up to limit of them
+type capturingReader struct {
+	io.ReadCloser
+	n     *atomic.Int64
+	limit int
+
+	// The transport may still be sending the body after the response was received
+	mu        sync.Mutex
+	captured  bytes.Buffer
+	size      int64
+	truncated bool
+}
+
+func (r *capturingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.n.Add(int64(n))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.size += int64(n)
+	r.truncated = capture(&r.captured, b[:n], r.limit) || r.truncated
+	return n, err
+}
+
+// snapshot returns a copy of the recorded body, whether it was truncated and the body size so far
+func (r *capturingReader) snapshot() ([]byte, bool, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return bytes.Clone(r.captured.Bytes()), r.truncated, r.size
+}
+
+// capturingWriter counts the bytes written to a response and records the status and up to limit body bytes
+type capturingWriter struct {
+	http.ResponseWriter
+	n     *atomic.Int64
+	limit int
+
+	status    int
+	captured  bytes.Buffer
+	size      int64
+	truncated bool
+	err       string
+}
+
+func (w *capturingWriter) WriteHeader(status int) {
+	// Informational responses are followed by the final status
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.n.Add(int64(n))
+	w.size += int64(n)
+	w.truncated = capture(&w.captured, b[:n], w.limit) || w.truncated
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for flushing and hijacking
+func (w *capturingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// capture appends b to buf without growing it past limit and reports whether bytes were dropped
+func capture(buf *bytes.Buffer, b []byte, limit int) bool {
+	room := limit - buf.Len()
+	if room >= len(b) {
+		buf.Write(b)
+		return false
+	}
+
+	if room > 0 {
+		buf.Write(b[:room])
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backendPort returns the port of a test server
+func backendPort(t *testing.T, server *httptest.Server) int {
+	t.Helper()
+	return server.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestProxy_ForwardsAndCounts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("echo:" + string(body)))
+	}))
+	defer backend.Close()
+
+	p, err := New(backendPort(t, backend), Options{})
+	if err != nil {
+		t.Fatalf("New should not return an error: %v", err)
+	}
+	defer p.Close()
+
+	resp, err := http.Post("http://"+p.Addr()+"/hook", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "echo:hello" {
+		t.Errorf("Expected body %q, got %q", "echo:hello", string(body))
+	}
+
+	stats := p.Stats()
+	if stats.Requests != 1 {
+		t.Errorf("Expected 1 request, got %d", stats.Requests)
+	}
+	if stats.BytesIn != 5 {
+		t.Errorf("Expected 5 bytes in, got %d", stats.BytesIn)
+	}
+	if stats.BytesOut != int64(len("echo:hello")) {
+		t.Errorf("Expected %d bytes out, got %d", len("echo:hello"), stats.BytesOut)
+	}
+	if stats.Failures != 0 {
+		t.Errorf("Expected no failures, got %d", stats.Failures)
+	}
+	if time.Since(stats.LastRequest) > time.Minute {
+		t.Errorf("Expected the last request time to be recorded, got %v", stats.LastRequest)
+	}
+}
+
+func TestProxy_ReportsUpstreamErrors(t *testing.T) {
+	// Grab a free port and release it so nothing listens there
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	var reported []error
+	p, err := New(port, Options{OnError: func(err error) { reported = append(reported, err) }})
+	if err != nil {
+		t.Fatalf("New should not return an error: %v", err)
+	}
+	defer p.Close()
+
+	resp, err := http.Get("http://" + p.Addr() + "/")
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", resp.StatusCode)
+	}
+
+	if p.Stats().Failures != 1 {
+		t.Errorf("Expected 1 failure, got %d", p.Stats().Failures)
+	}
+
+	if len(reported) != 1 {
+		t.Errorf("Expected 1 reported error, got %d", len(reported))
+	}
+}
+
+func TestProxy_RecordsExchanges(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("X-Backend", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created-with-a-long-body"))
+	}))
+	defer backend.Close()
+
+	p, err := New(backendPort(t, backend), Options{MaxBodySize: 8})
+	if err != nil {
+		t.Fatalf("New should not return an error: %v", err)
+	}
+	defer p.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, "http://"+p.Addr()+"/items?id=1", strings.NewReader("0123456789"))
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Signature", "abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// The exchange is recorded once the handler returns, which may race with the client
+	var exchanges []Exchange
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if exchanges = p.Inspector().Exchanges(); len(exchanges) > 0 {
+			break
+		}
+	}
+	if len(exchanges) != 1 {
+		t.Fatalf("Expected 1 recorded exchange, got %d", len(exchanges))
+	}
+
+	e := exchanges[0]
+	if e.Method != http.MethodPut || e.URL != "https://"+p.Addr()+"/items?id=1" {
+		t.Errorf("Unexpected request line %s %s", e.Method, e.URL)
+	}
+	if e.RequestHeaders.Get("X-Signature") != "abc" {
+		t.Error("Request headers should be recorded")
+	}
+	if string(e.RequestBody) != "01234567" || !e.RequestBodyTruncated || e.RequestSize != 10 {
+		t.Errorf("Request body should be capped, got %q (truncated: %v, size: %d)", e.RequestBody, e.RequestBodyTruncated, e.RequestSize)
+	}
+	if e.Status != http.StatusCreated || e.ResponseHeaders.Get("X-Backend") != "yes" {
+		t.Errorf("Unexpected response %d %v", e.Status, e.ResponseHeaders)
+	}
+	if string(e.ResponseBody) != "created-" || !e.ResponseBodyTruncated {
+		t.Errorf("Response body should be capped, got %q", e.ResponseBody)
+	}
+}
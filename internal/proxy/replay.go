@@ -0,0 +1,232 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxDiffLines caps the number of body lines compared line by line
+const maxDiffLines = 1000
+
+// ReplayOptions modifies a recorded request before it is replayed
+type ReplayOptions struct {
+	// SetHeaders replaces the values of the given headers
+	SetHeaders http.Header `json:"setHeaders,omitempty"`
+	// RemoveHeaders removes the given headers
+	RemoveHeaders []string `json:"removeHeaders,omitempty"`
+	// Body, if not nil, replaces the recorded request body
+	Body []byte `json:"body,omitempty"`
+}
+
+// ReplayResult holds a replayed request together with the original one
+type ReplayResult struct {
+	Original Exchange `json:"original"`
+	Replayed Exchange `json:"replayed"`
+	// Diff lists the differences between the original and the replayed response
+	Diff []string `json:"diff,omitempty"`
+}
+
+// Replay sends a recorded request, modified by opts, to localhost:port and records the response
+func Replay(ctx context.Context, port int, original Exchange, opts ReplayOptions) (ReplayResult, error) {
+	return replay(ctx, port, Rules{}, original, opts)
+}
+
+// Replay sends a recorded request, modified by opts, to the proxy's target with the proxy's rules applied
+func (p *Proxy) Replay(ctx context.Context, original Exchange, opts ReplayOptions) (ReplayResult, error) {
+	return replay(ctx, p.targetPort, p.rules, original, opts)
+}
+
+func replay(ctx context.Context, port int, rules Rules, original Exchange, opts ReplayOptions) (ReplayResult, error) {
+	body := original.RequestBody
+	if opts.Body != nil {
+		body = opts.Body
+	} else if original.RequestBodyTruncated {
+		return ReplayResult{}, fmt.Errorf("request %d body was truncated when recorded, provide a body to replay it", original.ID)
+	}
+
+	recorded, err := url.Parse(original.URL)
+	if err != nil {
+		return ReplayResult{}, fmt.Errorf("invalid recorded URL %q: %w", original.URL, err)
+	}
+
+	target := fmt.Sprintf("http://localhost:%d%s", port, recorded.RequestURI())
+	req, err := http.NewRequestWithContext(ctx, original.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return ReplayResult{}, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	req.Header = original.RequestHeaders.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	for name, values := range opts.SetHeaders {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	for _, name := range opts.RemoveHeaders {
+		req.Header.Del(name)
+	}
+	// Send the public host like the proxy does for live requests
+	req.Host = recorded.Host
+	// The recorded request is the one received from the tunnel, rewrite it like a live request
+	rules.rewriteRequest(req)
+
+	client := &http.Client{
+		// Replay exactly one request, the original response was not followed either
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return ReplayResult{}, fmt.Errorf("failed to replay request %d: %w", original.ID, err)
+	}
+	defer resp.Body.Close()
+	rules.rewriteResponse(resp)
+
+	var captured bytes.Buffer
+	size, err := io.Copy(&captured, io.LimitReader(resp.Body, DefaultMaxBodySize))
+	if err != nil {
+		return ReplayResult{}, fmt.Errorf("failed to read replayed response: %w", err)
+	}
+	rest, _ := io.Copy(io.Discard, resp.Body)
+
+	replayed := Exchange{
+		StartedAt:             started,
+		Duration:              time.Since(started),
+		Method:                req.Method,
+		URL:                   original.URL,
+		Proto:                 resp.Proto,
+		RequestHeaders:        req.Header.Clone(),
+		RequestBody:           body,
+		RequestSize:           int64(len(body)),
+		Status:                resp.StatusCode,
+		ResponseHeaders:       resp.Header.Clone(),
+		ResponseBody:          captured.Bytes(),
+		ResponseBodyTruncated: rest > 0,
+		ResponseSize:          size + rest,
+	}
+
+	return ReplayResult{
+		Original: original,
+		Replayed: replayed,
+		Diff:     DiffResponses(original, replayed),
+	}, nil
+}
+
+// DiffResponses lists the differences between the responses of two exchanges:
+// status, headers and body lines, prefixed with "-" for the original and "+" for the other
+func DiffResponses(original, replayed Exchange) []string {
+	var diff []string
+
+	if original.Status != replayed.Status {
+		diff = append(diff, fmt.Sprintf("status: %d → %d", original.Status, replayed.Status))
+	}
+
+	diff = append(diff, diffHeaders(original.ResponseHeaders, replayed.ResponseHeaders)...)
+
+	if !bytes.Equal(original.ResponseBody, replayed.ResponseBody) {
+		diff = append(diff, "body:")
+		diff = append(diff, diffLines(string(original.ResponseBody), string(replayed.ResponseBody))...)
+	}
+
+	return diff
+}
+
+// volatileHeaders change between any two responses and are left out of diffs
+var volatileHeaders = map[string]bool{
+	"Date": true,
+}
+
+func diffHeaders(original, replayed http.Header) []string {
+	names := map[string]bool{}
+	for name := range original {
+		names[name] = true
+	}
+	for name := range replayed {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		if !volatileHeaders[name] {
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+
+	var diff []string
+	for _, name := range sorted {
+		before := strings.Join(original.Values(name), ", ")
+		after := strings.Join(replayed.Values(name), ", ")
+
+		switch {
+		case before == after:
+		case len(original.Values(name)) == 0:
+			diff = append(diff, fmt.Sprintf("+ header %s: %s", name, after))
+		case len(replayed.Values(name)) == 0:
+			diff = append(diff, fmt.Sprintf("- header %s: %s", name, before))
+		default:
+			diff = append(diff, fmt.Sprintf("header %s: %s → %s", name, before, after))
+		}
+	}
+
+	return diff
+}
+
+// diffLines returns a line diff of two texts based on their longest common subsequence
+func diffLines(before, after string) []string {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return []string{fmt.Sprintf("  (bodies differ, too large to compare: %d and %d lines)", len(a), len(b))}
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+ "+b[j])
+	}
+
+	return diff
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	var gotHost, gotAuth, gotTrace, gotBody string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotHost, gotAuth, gotTrace, gotBody = r.Host, r.Header.Get("Authorization"), r.Header.Get("X-Trace"), string(body)
+		w.Header().Set("X-Version", "2")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("line one\nline three"))
+	}))
+	defer backend.Close()
+
+	original := Exchange{
+		ID:              7,
+		Method:          http.MethodPost,
+		URL:             "https://abc.ngrok.io/hook?x=1",
+		RequestHeaders:  http.Header{"Authorization": {"old"}, "X-Trace": {"t1"}},
+		RequestBody:     []byte("original"),
+		Status:          http.StatusOK,
+		ResponseHeaders: http.Header{"X-Version": {"1"}, "X-Old": {"gone"}},
+		ResponseBody:    []byte("line one\nline two"),
+	}
+
+	result, err := Replay(context.Background(), backendPort(t, backend), original, ReplayOptions{
+		SetHeaders:    http.Header{"authorization": {"new"}},
+		RemoveHeaders: []string{"X-Trace"},
+		Body:          []byte("edited"),
+	})
+	if err != nil {
+		t.Fatalf("Replay should not return an error: %v", err)
+	}
+
+	if gotHost != "abc.ngrok.io" || gotAuth != "new" || gotTrace != "" || gotBody != "edited" {
+		t.Errorf("Unexpected replayed request: host=%q auth=%q trace=%q body=%q", gotHost, gotAuth, gotTrace, gotBody)
+	}
+
+	if result.Replayed.Status != http.StatusAccepted || string(result.Replayed.ResponseBody) != "line one\nline three" {
+		t.Errorf("Unexpected replayed response %d %q", result.Replayed.Status, result.Replayed.ResponseBody)
+	}
+
+	diff := strings.Join(result.Diff, "\n")
+	for _, expected := range []string{
+		"status: 200 → 202",
+		"- header X-Old: gone",
+		"header X-Version: 1 → 2",
+		"- line two\n+ line three",
+	} {
+		if !strings.Contains(diff, expected) {
+			t.Errorf("diff should contain %q, got:\n%s", expected, diff)
+		}
+	}
+	if strings.Contains(diff, "line one") {
+		t.Errorf("diff should not contain unchanged lines, got:\n%s", diff)
+	}
+}
+
+func TestReplay_TruncatedBody(t *testing.T) {
+	original := Exchange{ID: 1, Method: http.MethodPost, URL: "https://abc.ngrok.io/", RequestBodyTruncated: true}
+
+	if _, err := Replay(context.Background(), 1, original, ReplayOptions{}); err == nil {
+		t.Error("Replay should refuse to send a truncated body")
+	}
+}
+
+func TestDiffResponses_Identical(t *testing.T) {
+	e := Exchange{
+		Status:          http.StatusOK,
+		ResponseHeaders: http.Header{"Content-Type": {"text/plain"}},
+		ResponseBody:    []byte("same"),
+	}
+	replayed := e
+	replayed.ResponseHeaders = http.Header{"Content-Type": {"text/plain"}, "Date": {"now"}}
+
+	if diff := DiffResponses(e, replayed); len(diff) != 0 {
+		t.Errorf("Expected no differences, got %v", diff)
+	}
+}
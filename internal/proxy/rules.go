@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// HeaderRules modifies a set of headers: Remove is applied first, then Set and Add
+type HeaderRules struct {
+	// Set replaces the values of the given headers
+	Set map[string]string `json:"set,omitempty"`
+	// Add appends a value to the given headers
+	Add map[string]string `json:"add,omitempty"`
+	// Remove deletes the given headers
+	Remove []string `json:"remove,omitempty"`
+}
+
+// Rules rewrites requests before they reach the forwarded port and responses before they reach the caller
+type Rules struct {
+	// Host, if set, replaces the Host header sent to the backend
+	Host string `json:"host,omitempty"`
+	// StripPathPrefix is removed from the start of the request path
+	StripPathPrefix string `json:"stripPathPrefix,omitempty"`
+	// AddPathPrefix is prepended to the request path, after StripPathPrefix is removed
+	AddPathPrefix string `json:"addPathPrefix,omitempty"`
+	// RequestHeaders modifies the request headers sent to the backend
+	RequestHeaders HeaderRules `json:"requestHeaders,omitempty"`
+	// ResponseHeaders modifies the response headers returned to the caller
+	ResponseHeaders HeaderRules `json:"responseHeaders,omitempty"`
+}
+
+// IsZero reports whether the rules leave traffic unchanged
+func (r Rules) IsZero() bool {
+	return r.Host == "" && r.StripPathPrefix == "" && r.AddPathPrefix == "" &&
+		r.RequestHeaders.isZero() && r.ResponseHeaders.isZero()
+}
+
+// String describes the rules in a single line
+func (r Rules) String() string {
+	var parts []string
+	if r.Host != "" {
+		parts = append(parts, "host "+r.Host)
+	}
+	if r.StripPathPrefix != "" || r.AddPathPrefix != "" {
+		parts = append(parts, fmt.Sprintf("path %s* → %s*", cmp.Or(r.StripPathPrefix, "/"), cmp.Or(r.AddPathPrefix, "/")))
+	}
+	parts = append(parts, r.RequestHeaders.describe("request")...)
+	parts = append(parts, r.ResponseHeaders.describe("response")...)
+
+	return strings.Join(parts, ", ")
+}
+
+// Merge returns r overridden by other: set values of other replace those of r,
+// header rules are combined
+func (r Rules) Merge(other Rules) Rules {
+	if other.Host != "" {
+		r.Host = other.Host
+	}
+	if other.StripPathPrefix != "" {
+		r.StripPathPrefix = other.StripPathPrefix
+	}
+	if other.AddPathPrefix != "" {
+		r.AddPathPrefix = other.AddPathPrefix
+	}
+	r.RequestHeaders = r.RequestHeaders.merge(other.RequestHeaders)
+	r.ResponseHeaders = r.ResponseHeaders.merge(other.ResponseHeaders)
+	return r
+}
+
+// rewriteRequest applies the request rules to an outgoing request
+func (r Rules) rewriteRequest(req *http.Request) {
+	if r.Host != "" {
+		req.Host = r.Host
+	}
+
+	if r.StripPathPrefix != "" || r.AddPathPrefix != "" {
+		req.URL.Path = rewritePath(req.URL.Path, r.StripPathPrefix, r.AddPathPrefix)
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = rewritePath(req.URL.RawPath, r.StripPathPrefix, r.AddPathPrefix)
+		}
+	}
+
+	r.RequestHeaders.apply(req.Header)
+}
+
+// rewriteResponse applies the response rules to a backend response
+func (r Rules) rewriteResponse(resp *http.Response) {
+	r.ResponseHeaders.apply(resp.Header)
+}
+
+// rewritePath replaces the strip prefix of path with the add prefix, keeping the path absolute.
+// The strip prefix only matches whole segments: "/api" is stripped from "/api/users" but not from "/apiary"
+func rewritePath(path string, strip string, add string) string {
+	if strip = strings.TrimSuffix(strip, "/"); strip != "" {
+		if rest, ok := strings.CutPrefix(path, strip); ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+			path = rest
+		}
+	}
+
+	if add != "" {
+		path = strings.TrimSuffix(add, "/") + "/" + strings.TrimPrefix(path, "/")
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+func (h HeaderRules) isZero() bool {
+	return len(h.Set) == 0 && len(h.Add) == 0 && len(h.Remove) == 0
+}
+
+// describe lists the header changes, names sorted, for kind "request" or "response"
+func (h HeaderRules) describe(kind string) []string {
+	var parts []string
+	if len(h.Set) > 0 {
+		parts = append(parts, fmt.Sprintf("set %s headers %s", kind, strings.Join(slices.Sorted(maps.Keys(h.Set)), ", ")))
+	}
+	if len(h.Add) > 0 {
+		parts = append(parts, fmt.Sprintf("add %s headers %s", kind, strings.Join(slices.Sorted(maps.Keys(h.Add)), ", ")))
+	}
+	if len(h.Remove) > 0 {
+		parts = append(parts, fmt.Sprintf("remove %s headers %s", kind, strings.Join(h.Remove, ", ")))
+	}
+	return parts
+}
+
+func (h HeaderRules) merge(other HeaderRules) HeaderRules {
+	return HeaderRules{
+		Set:    mergeMaps(h.Set, other.Set),
+		Add:    mergeMaps(h.Add, other.Add),
+		Remove: append(append([]string(nil), h.Remove...), other.Remove...),
+	}
+}
+
+func (h HeaderRules) apply(header http.Header) {
+	for _, name := range h.Remove {
+		header.Del(name)
+	}
+	for name, value := range h.Set {
+		header.Set(name, value)
+	}
+	for name, value := range h.Add {
+		header.Add(name, value)
+	}
+}
+
+// mergeMaps returns a new map with the entries of a overridden by those of b
+func mergeMaps(a, b map[string]string) map[string]string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range b {
+		merged[k] = v
+	}
+	return merged
+}
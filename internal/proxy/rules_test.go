@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRewritePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		strip    string
+		add      string
+		expected string
+	}{
+		{"/public/users", "/public", "", "/users"},
+		{"/public", "/public", "", "/"},
+		{"/users", "/public", "", "/users"},
+		{"/users", "", "/v1", "/v1/users"},
+		{"/users", "", "/v1/", "/v1/users"},
+		{"/public/users", "/public", "/api/v1", "/api/v1/users"},
+		{"/public/users", "/public/", "", "/users"},
+		{"/publicity/users", "/public", "", "/publicity/users"},
+		{"/apiary/x", "/api", "/v1", "/v1/apiary/x"},
+	}
+
+	for _, tt := range tests {
+		if result := rewritePath(tt.path, tt.strip, tt.add); result != tt.expected {
+			t.Errorf("rewritePath(%q, %q, %q) = %q, want %q", tt.path, tt.strip, tt.add, result, tt.expected)
+		}
+	}
+}
+
+func TestRules_Merge(t *testing.T) {
+	base := Rules{
+		Host:           "api.internal",
+		AddPathPrefix:  "/v1",
+		RequestHeaders: HeaderRules{Set: map[string]string{"X-Env": "dev", "X-Team": "a"}, Remove: []string{"Cookie"}},
+	}
+	override := Rules{
+		Host:           "api.staging",
+		RequestHeaders: HeaderRules{Set: map[string]string{"X-Env": "staging"}, Remove: []string{"Authorization"}},
+	}
+
+	merged := base.Merge(override)
+
+	if merged.Host != "api.staging" || merged.AddPathPrefix != "/v1" {
+		t.Errorf("Unexpected merged rules %+v", merged)
+	}
+	if merged.RequestHeaders.Set["X-Env"] != "staging" || merged.RequestHeaders.Set["X-Team"] != "a" {
+		t.Errorf("Unexpected merged headers %+v", merged.RequestHeaders.Set)
+	}
+	if len(merged.RequestHeaders.Remove) != 2 {
+		t.Errorf("Expected both removed headers, got %v", merged.RequestHeaders.Remove)
+	}
+	if len(base.RequestHeaders.Set) != 2 || base.RequestHeaders.Set["X-Env"] != "dev" {
+		t.Errorf("Merge should not modify the receiver, got %+v", base.RequestHeaders.Set)
+	}
+
+	if !(Rules{}).IsZero() || merged.IsZero() {
+		t.Error("IsZero should only report empty rules")
+	}
+}
+
+func TestRules_String(t *testing.T) {
+	rules := Rules{
+		Host:            "api.internal",
+		StripPathPrefix: "/public",
+		RequestHeaders:  HeaderRules{Set: map[string]string{"X-B": "2", "X-A": "1"}},
+		ResponseHeaders: HeaderRules{Remove: []string{"Server"}},
+	}
+
+	expected := "host api.internal, path /public* → /*, set request headers X-A, X-B, remove response headers Server"
+	if result := rules.String(); result != expected {
+		t.Errorf("String() = %q, want %q", result, expected)
+	}
+}
+
+func TestProxy_AppliesRules(t *testing.T) {
+	var gotHost, gotPath, gotKey, gotCookie string
+	var gotTags []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost, gotPath = r.Host, r.URL.Path
+		gotKey, gotCookie, gotTags = r.Header.Get("X-Api-Key"), r.Header.Get("Cookie"), r.Header.Values("X-Tag")
+		w.Header().Set("Server", "internal")
+		w.Header().Set("X-Frame-Options", "DENY")
+	}))
+	defer backend.Close()
+
+	rules := Rules{
+		Host:            "api.internal",
+		StripPathPrefix: "/public",
+		AddPathPrefix:   "/v1",
+		RequestHeaders: HeaderRules{
+			Set:    map[string]string{"X-Api-Key": "secret"},
+			Add:    map[string]string{"X-Tag": "tunnel"},
+			Remove: []string{"Cookie"},
+		},
+		ResponseHeaders: HeaderRules{
+			Set:    map[string]string{"X-Frame-Options": "SAMEORIGIN"},
+			Remove: []string{"Server"},
+		},
+	}
+
+	p, err := New(backendPort(t, backend), Options{Rules: rules})
+	if err != nil {
+		t.Fatalf("New should not return an error: %v", err)
+	}
+	defer p.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+p.Addr()+"/public/users", nil)
+	req.Header.Set("X-Api-Key", "caller")
+	req.Header.Set("X-Tag", "original")
+	req.Header.Set("Cookie", "session=1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if gotHost != "api.internal" || gotPath != "/v1/users" || gotKey != "secret" || gotCookie != "" {
+		t.Errorf("Unexpected proxied request: host=%q path=%q key=%q cookie=%q", gotHost, gotPath, gotKey, gotCookie)
+	}
+	if len(gotTags) != 2 {
+		t.Errorf("Expected the added header next to the original one, got %v", gotTags)
+	}
+	if resp.Header.Get("Server") != "" || resp.Header.Get("X-Frame-Options") != "SAMEORIGIN" {
+		t.Errorf("Unexpected response headers %v", resp.Header)
+	}
+
+	// Replays go through the same rules as live requests
+	gotHost, gotPath = "", ""
+	original := Exchange{ID: 1, Method: http.MethodGet, URL: "https://abc.ngrok.io/public/orders"}
+	result, err := p.Replay(context.Background(), original, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("Replay should not return an error: %v", err)
+	}
+	if gotHost != "api.internal" || gotPath != "/v1/orders" {
+		t.Errorf("Unexpected replayed request: host=%q path=%q", gotHost, gotPath)
+	}
+	if result.Replayed.ResponseHeaders.Get("Server") != "" {
+		t.Errorf("Replayed response should have the response rules applied, got %v", result.Replayed.ResponseHeaders)
+	}
+}
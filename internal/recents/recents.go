@@ -0,0 +1,216 @@
+package recents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxRecents is the number of recent exposures kept per kube context
+const maxRecents = 10
+
+// Entry is a service port that was exposed or starred
+type Entry struct {
+	Namespace string    `json:"namespace"`
+	Service   string    `json:"service"`
+	Port      int32     `json:"port"`
+	PortName  string    `json:"portName,omitempty"`
+	UsedAt    time.Time `json:"usedAt,omitzero"`
+}
+
+// same reports whether both entries are the same service port
+func (e Entry) same(other Entry) bool {
+	return e.Namespace == other.Namespace && e.Service == other.Service && e.Port == other.Port
+}
+
+// Kind tells why an entry is offered at the top of the service picker
+type Kind int
+
+const (
+	// KindLast is the last exposure, repeated with a single keystroke
+	KindLast Kind = iota
+	// KindFavorite is a starred service port
+	KindFavorite
+	// KindRecent is a recent exposure
+	KindRecent
+)
+
+// Pick is an entry offered at the top of the service picker
+type Pick struct {
+	Entry
+	Kind Kind
+}
+
+// lists are the favorites and recent exposures of a kube context, most recent first
+type lists struct {
+	Favorites []Entry `json:"favorites,omitempty"`
+	Recents   []Entry `json:"recents,omitempty"`
+}
+
+// Store keeps the favorites and recent exposures per kube context in a JSON file
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	contexts map[string]*lists
+}
+
+// DefaultPath returns the path of the favorites and recents file
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "service-exporter", "recents.json")
+}
+
+// Open reads the store at path, a missing file is an empty store
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, contexts: map[string]*lists{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recents file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s.contexts); err != nil {
+		return nil, fmt.Errorf("failed to parse recents file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Favorites returns the starred service ports of a kube context, most recently starred first
+func (s *Store) Favorites(kubeContext string) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.contexts[kubeContext]; ok {
+		return slices.Clone(l.Favorites)
+	}
+	return nil
+}
+
+// Recents returns the recently exposed service ports of a kube context, most recent first
+func (s *Store) Recents(kubeContext string) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.contexts[kubeContext]; ok {
+		return slices.Clone(l.Recents)
+	}
+	return nil
+}
+
+// Picks returns the entries offered at the top of the service picker of a kube context:
+// the last exposure, the favorites, then the other recent exposures
+func (s *Store) Picks(kubeContext string) []Pick {
+	favorites, recents := s.Favorites(kubeContext), s.Recents(kubeContext)
+
+	var picks []Pick
+	if len(recents) > 0 {
+		picks = append(picks, Pick{Entry: recents[0], Kind: KindLast})
+	}
+	for _, e := range favorites {
+		if len(recents) == 0 || !e.same(recents[0]) {
+			picks = append(picks, Pick{Entry: e, Kind: KindFavorite})
+		}
+	}
+	for _, e := range recents[min(len(recents), 1):] {
+		if !slices.ContainsFunc(favorites, e.same) {
+			picks = append(picks, Pick{Entry: e, Kind: KindRecent})
+		}
+	}
+
+	return picks
+}
+
+// IsFavorite reports whether the service port is starred in the kube context
+func (s *Store) IsFavorite(kubeContext string, entry Entry) bool {
+	return slices.ContainsFunc(s.Favorites(kubeContext), entry.same)
+}
+
+// Use records the service port as the most recent exposure of the kube context and saves the store
+func (s *Store) Use(kubeContext string, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry.UsedAt.IsZero() {
+		entry.UsedAt = time.Now()
+	}
+
+	l := s.lists(kubeContext)
+	l.Recents = slices.DeleteFunc(l.Recents, entry.same)
+	l.Recents = slices.Insert(l.Recents, 0, entry)
+	l.Recents = l.Recents[:min(len(l.Recents), maxRecents)]
+
+	return s.save()
+}
+
+// ToggleFavorite stars the service port in the kube context, or unstars it if it was, and saves the store.
+// It returns whether the service port is now a favorite
+func (s *Store) ToggleFavorite(kubeContext string, entry Entry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.lists(kubeContext)
+	starred := !slices.ContainsFunc(l.Favorites, entry.same)
+	if starred {
+		if entry.UsedAt.IsZero() {
+			entry.UsedAt = time.Now()
+		}
+		l.Favorites = slices.Insert(l.Favorites, 0, entry)
+	} else {
+		l.Favorites = slices.DeleteFunc(l.Favorites, entry.same)
+	}
+
+	return starred, s.save()
+}
+
+// lists returns the lists of a kube context, creating them if needed; the caller holds the lock
+func (s *Store) lists(kubeContext string) *lists {
+	l, ok := s.contexts[kubeContext]
+	if !ok {
+		l = &lists{}
+		s.contexts[kubeContext] = l
+	}
+	return l
+}
+
+// save writes the store to a temporary file renamed over the previous one; the caller holds the lock
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.contexts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode recents: %w", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create recents directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save recents: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save recents: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save recents: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save recents: %w", err)
+	}
+	return nil
+}
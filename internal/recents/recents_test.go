@@ -0,0 +1,138 @@
+package recents
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_Use(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service-exporter", "recents.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open should not return an error for a missing file: %v", err)
+	}
+
+	api := Entry{Namespace: "web", Service: "api", Port: 80, PortName: "http"}
+	db := Entry{Namespace: "data", Service: "db", Port: 5432}
+	for _, e := range []Entry{api, db, api} {
+		if err := s.Use("staging", e); err != nil {
+			t.Fatalf("Use should not return an error: %v", err)
+		}
+	}
+
+	recents := s.Recents("staging")
+	if len(recents) != 2 || !recents[0].same(api) || !recents[1].same(db) {
+		t.Errorf("Expected api then db without duplicates, got %+v", recents)
+	}
+	if recents[0].UsedAt.IsZero() {
+		t.Error("Expected the time of use to be recorded")
+	}
+	if other := s.Recents("prod"); len(other) != 0 {
+		t.Errorf("Expected recents to be kept per context, got %+v", other)
+	}
+
+	// The store is saved on every change
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open should not return an error: %v", err)
+	}
+	if got := reopened.Recents("staging"); len(got) != 2 || got[0].PortName != "http" {
+		t.Errorf("Expected the saved recents, got %+v", got)
+	}
+}
+
+func TestStore_UseKeepsLatest(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "recents.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range maxRecents + 5 {
+		if err := s.Use("staging", Entry{Namespace: "web", Service: fmt.Sprintf("svc-%d", i), Port: 80}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recents := s.Recents("staging")
+	if len(recents) != maxRecents || recents[0].Service != fmt.Sprintf("svc-%d", maxRecents+4) {
+		t.Errorf("Expected the %d latest exposures, got %+v", maxRecents, recents)
+	}
+}
+
+func TestStore_ToggleFavorite(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "recents.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := Entry{Namespace: "web", Service: "api", Port: 80}
+
+	if starred, err := s.ToggleFavorite("staging", api); err != nil || !starred {
+		t.Fatalf("Expected the entry to be starred, got %v %v", starred, err)
+	}
+	if !s.IsFavorite("staging", api) || s.IsFavorite("prod", api) {
+		t.Error("Expected the entry to be a favorite of the staging context only")
+	}
+
+	if starred, err := s.ToggleFavorite("staging", api); err != nil || starred {
+		t.Fatalf("Expected the entry to be unstarred, got %v %v", starred, err)
+	}
+	if s.IsFavorite("staging", api) {
+		t.Error("Expected the entry to no longer be a favorite")
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recents.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path); err == nil {
+		t.Error("Expected an error for an invalid file")
+	}
+}
+
+func TestStore_Picks(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "recents.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := Entry{Namespace: "web", Service: "api", Port: 80}
+	db := Entry{Namespace: "data", Service: "db", Port: 5432}
+	cache := Entry{Namespace: "data", Service: "cache", Port: 6379}
+	admin := Entry{Namespace: "web", Service: "admin", Port: 8080}
+
+	if picks := s.Picks("staging"); len(picks) != 0 {
+		t.Errorf("Expected no picks without history, got %+v", picks)
+	}
+
+	for _, e := range []Entry{cache, db, api} {
+		if err := s.Use("staging", e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, e := range []Entry{api, db, admin} {
+		if _, err := s.ToggleFavorite("staging", e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The last exposure first, then the favorites and recents without duplicates
+	expected := []Pick{
+		{Entry: api, Kind: KindLast},
+		{Entry: admin, Kind: KindFavorite},
+		{Entry: db, Kind: KindFavorite},
+		{Entry: cache, Kind: KindRecent},
+	}
+	picks := s.Picks("staging")
+	if len(picks) != len(expected) {
+		t.Fatalf("Expected %d picks, got %+v", len(expected), picks)
+	}
+	for i, pick := range picks {
+		if !pick.same(expected[i].Entry) || pick.Kind != expected[i].Kind {
+			t.Errorf("Pick %d: expected %+v, got %+v", i, expected[i], pick)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// SetAuditLog sets the audit log the lifecycle transitions of exposures are recorded in
+func (m *service) SetAuditLog(l AuditLog) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.auditLog = l
+}
+
+// auditEntry returns the audit log entry of an event, with an empty event if the transition is not audited
+func (m *service) auditEntry(event Event) AuditEntry {
+	e := event.Exposure
+	entry := AuditEntry{
+		Time:       event.Time,
+		Port:       e.ServicePort,
+		LocalPort:  e.LocalPort,
+		Pod:        e.PodName,
+		PublicURL:  e.PublicURL,
+		Auth:       e.Auth,
+		TunnelType: e.TunnelType,
+		StartedAt:  e.StartedAt,
+		Reason:     event.Reason,
+	}
+
+	switch {
+	case event.Type == EventReady:
+		entry.Event = AuditStarted
+	case event.Type == EventDenied:
+		entry.Event = AuditDenied
+	case event.Type == EventPodSwitched:
+		entry.Event = AuditPodSwitched
+	case event.Type == EventTunnelUp && event.PreviousURL != "":
+		entry.Event = AuditTunnelRestarted
+		entry.Reason = "replaced " + event.PreviousURL
+	case event.Type == EventStopped:
+		entry.Event = AuditStopped
+		entry.StoppedAt = event.Time
+	default:
+		return AuditEntry{}
+	}
+
+	if m.client != nil {
+		entry.Context = m.client.ContextName()
+	}
+	if e.Service != "" {
+		entry.Service, entry.Namespace, _ = ParseServiceName(e.Service)
+	}
+
+	return entry
+}
+
+// record writes an entry to the audit log, if any and if the entry is of an audited transition
+func (m *service) record(entry AuditEntry) error {
+	m.mu.Lock()
+	l := m.auditLog
+	m.mu.Unlock()
+
+	if l == nil || entry.Event == "" {
+		return nil
+	}
+
+	if err := l.Record(entry); err != nil {
+		slog.Warn("⚠️  Failed to write audit log", "error", err)
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Goalt/service-exporter/internal/policy"
+)
+
+// mockAuditLog records audit entries in memory
+type mockAuditLog struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+	err     error
+}
+
+func (m *mockAuditLog) Record(entry AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *mockAuditLog) events() []AuditEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []AuditEvent
+	for _, entry := range m.entries {
+		events = append(events, entry.Event)
+	}
+	return events
+}
+
+func TestAuditLog(t *testing.T) {
+	auditLog := &mockAuditLog{}
+	svc := NewService(&mockK8sClient{contextName: "dev"}, &mockNgrokClient{})
+	svc.SetAuditLog(auditLog)
+	svc.SetPolicy(policy.Policy{Rules: []policy.Rule{{Name: "no-db", Action: policy.ActionDeny, Ports: []string{"5432"}}}})
+
+	if _, err := svc.Expose(context.Background(), ExposeRequest{Service: "db (ns: data)", Port: ServicePort{Port: 5432}}); err == nil {
+		t.Fatal("Expected the policy to deny the exposure")
+	}
+
+	status, err := svc.Expose(context.Background(), ExposeRequest{
+		Service: "api (ns: staging)",
+		Port:    ServicePort{Name: "http", Port: 80},
+		Auth:    TunnelAuth{OAuthProvider: "github"},
+	})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	if _, err := svc.RestartTunnel(context.Background(), status.LocalPort); err != nil {
+		t.Fatalf("RestartTunnel should not return an error: %v", err)
+	}
+	if err := svc.StopExposure(status.LocalPort); err != nil {
+		t.Fatalf("StopExposure should not return an error: %v", err)
+	}
+
+	expected := []AuditEvent{AuditDenied, AuditStarted, AuditTunnelRestarted, AuditStopped}
+	if events := auditLog.events(); fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, events)
+	}
+
+	denied := auditLog.entries[0]
+	if denied.Namespace != "data" || denied.Service != "db" || denied.Port != 5432 || denied.Reason == "" {
+		t.Errorf("Unexpected denied entry %+v", denied)
+	}
+
+	started := auditLog.entries[1]
+	if started.Context != "dev" || started.Namespace != "staging" || started.Service != "api" || started.Port != 80 ||
+		started.LocalPort != status.LocalPort || started.Pod != "api-pod" || started.PublicURL != status.PublicURL ||
+		started.Auth != "github OAuth" || started.StartedAt.IsZero() {
+		t.Errorf("Unexpected started entry %+v", started)
+	}
+
+	stopped := auditLog.entries[3]
+	if stopped.Reason != "stopped manually" || stopped.StoppedAt.IsZero() || !stopped.StartedAt.Equal(started.StartedAt) {
+		t.Errorf("Unexpected stopped entry %+v", stopped)
+	}
+}
+
+func TestAuditLog_Unwritable(t *testing.T) {
+	svc := NewService(&mockK8sClient{}, &mockNgrokClient{})
+	svc.SetAuditLog(&mockAuditLog{err: fmt.Errorf("disk full")})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := svc.Subscribe(ctx)
+
+	if _, err := svc.Expose(context.Background(), ExposeRequest{Service: "api (ns: staging)", Port: ServicePort{Port: 80}}); err == nil {
+		t.Error("Expected Expose to fail when the audit log cannot be written")
+	}
+	if len(svc.Exposures()) != 0 {
+		t.Error("An exposure that cannot be audited must be stopped")
+	}
+
+	// Events are delivered to the subscribers even though they could not be audited
+	var received []EventType
+	for event := range events {
+		received = append(received, event.Type)
+		if event.Type == EventStopped {
+			cancel()
+		}
+	}
+	if !slices.Contains(received, EventReady) || !slices.Contains(received, EventStopped) {
+		t.Errorf("Expected the ready and stopped events, got %v", received)
+	}
+}
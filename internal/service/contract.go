@@ -1,46 +1,481 @@
 package service
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/health"
+	"github.com/Goalt/service-exporter/internal/proxy"
+)
+
+// Annotations service owners set on their Services to opt in or out of exposure and to set its defaults
+const (
+	// AnnotationExpose is "true" to opt in to exposure or "false" to opt out and hide the service
+	AnnotationExpose = "service-exporter.io/expose"
+	// AnnotationDefaultPort is the name or number of the port selected by default
+	AnnotationDefaultPort = "service-exporter.io/default-port"
+	// AnnotationTunnelType is the default tunnel type, http or tcp
+	AnnotationTunnelType = "service-exporter.io/tunnel-type"
+	// AnnotationBasicAuthSecret is the name of a Secret in the service's namespace holding the
+	// username and password keys callers must log in with
+	AnnotationBasicAuthSecret = "service-exporter.io/basic-auth-secret"
+	// AnnotationDomain is the ngrok domain the service is published on
+	AnnotationDomain = "service-exporter.io/domain"
+)
 
 // ServicePort represents a service port with its details
 type ServicePort struct {
-	Name       string
-	Port       int32
-	TargetPort int32
-	Protocol   string
+	Name       string `json:"name,omitempty"`
+	Port       int32  `json:"port"`
+	TargetPort int32  `json:"targetPort"`
+	Protocol   string `json:"protocol"`
+	// AppProtocol is the application protocol of the port, such as http or kubernetes.io/h2c, empty if unset
+	AppProtocol string `json:"appProtocol,omitempty"`
+	// Default is set on the port named by the default-port annotation
+	Default bool `json:"default,omitempty"`
+}
+
+// ServiceInfo describes a Kubernetes service
+type ServiceInfo struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Type is the service type, such as ClusterIP or LoadBalancer
+	Type      string            `json:"type"`
+	ClusterIP string            `json:"clusterIP,omitempty"`
+	Ports     []ServicePort     `json:"ports"`
+	Selector  map[string]string `json:"selector,omitempty"`
+	// ReadyEndpoints is the number of ready endpoints backing the service, -1 when unknown
+	ReadyEndpoints int `json:"readyEndpoints"`
+
+	// OptIn and OptOut are set when the owners opted in or out of exposure with the expose annotation
+	OptIn  bool `json:"optIn,omitempty"`
+	OptOut bool `json:"optOut,omitempty"`
+	// Defaults are the exposure settings the owners set with annotations
+	Defaults ExposeDefaults `json:"defaults,omitzero"`
+	// Warnings explains annotations that are ignored because of invalid values
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// String returns the service name in the "service-name (ns: namespace)" format
+func (s ServiceInfo) String() string {
+	return fmt.Sprintf("%s (ns: %s)", s.Name, s.Namespace)
+}
+
+// ExposeDefaults are the exposure settings of a service used when the request leaves them empty
+type ExposeDefaults struct {
+	// Port is the name or number of the port selected by default
+	Port       string     `json:"port,omitempty"`
+	TunnelType TunnelType `json:"tunnelType,omitempty"`
+	// BasicAuthSecret is the name of the Secret holding the basic auth username and password
+	BasicAuthSecret string `json:"basicAuthSecret,omitempty"`
+	Domain          string `json:"domain,omitempty"`
+}
+
+// TunnelType is the kind of ngrok endpoint an exposure is published on
+type TunnelType string
+
+const (
+	// TunnelHTTP publishes the exposure on an HTTPS endpoint through the local proxy
+	TunnelHTTP TunnelType = "http"
+	// TunnelTCP publishes the forwarded port as is on a TCP address, without the local proxy's features
+	TunnelTCP TunnelType = "tcp"
+)
+
+// ParseTunnelType parses a tunnel type, empty for the default http
+func ParseTunnelType(s string) (TunnelType, error) {
+	switch t := TunnelType(s); t {
+	case "":
+		return TunnelHTTP, nil
+	case TunnelHTTP, TunnelTCP:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown tunnel type %q, use http or tcp", s)
+}
+
+// TunnelAuth protects the public URL of a tunnel, at most one method is used
+type TunnelAuth struct {
+	// BasicAuth is the "username:password" callers must send
+	BasicAuth string
+	// OAuthProvider is the ngrok OAuth provider callers must log in with, e.g. google or github
+	OAuthProvider string
+	// OAuthAllowDomains restricts OAuth logins to these email domains
+	OAuthAllowDomains []string
+	// OAuthClientID and OAuthClientSecret are the credentials of your own OAuth application,
+	// ngrok's managed application if empty
+	OAuthClientID     string
+	OAuthClientSecret string
+}
+
+// Enabled reports whether the tunnel requires authentication
+func (a TunnelAuth) Enabled() bool {
+	return a.BasicAuth != "" || a.OAuthProvider != ""
+}
+
+// Validate checks that at most one method is set and that basic auth credentials are accepted by ngrok
+func (a TunnelAuth) Validate() error {
+	if a.BasicAuth != "" && a.OAuthProvider != "" {
+		return fmt.Errorf("use either basic auth or OAuth, not both")
+	}
+	if (a.OAuthClientID != "" || a.OAuthClientSecret != "") && a.OAuthProvider == "" {
+		return fmt.Errorf("OAuth client credentials need an OAuth provider")
+	}
+	if (a.OAuthClientID == "") != (a.OAuthClientSecret == "") {
+		return fmt.Errorf("set both the OAuth client ID and secret")
+	}
+	if a.BasicAuth == "" {
+		return nil
+	}
+
+	username, password, ok := strings.Cut(a.BasicAuth, ":")
+	if !ok || username == "" {
+		return fmt.Errorf("basic auth must be in the username:password format")
+	}
+	if len(password) < 8 || len(password) > 128 {
+		return fmt.Errorf("basic auth password must be between 8 and 128 characters long")
+	}
+	return nil
+}
+
+// String describes the authentication method without credentials
+func (a TunnelAuth) String() string {
+	switch {
+	case a.BasicAuth != "":
+		username, _, _ := strings.Cut(a.BasicAuth, ":")
+		return "basic auth as " + username
+	case a.OAuthProvider != "" && len(a.OAuthAllowDomains) > 0:
+		return fmt.Sprintf("%s OAuth for %s", a.OAuthProvider, strings.Join(a.OAuthAllowDomains, ", "))
+	case a.OAuthProvider != "":
+		return a.OAuthProvider + " OAuth"
+	}
+	return "none"
+}
+
+// ForwardState describes the state of an exposure's port forwarding
+type ForwardState string
+
+const (
+	// ForwardNone means the exposure tunnels a local port without port forwarding
+	ForwardNone ForwardState = "none"
+	// ForwardActive means the port forwarding to the pod is established
+	ForwardActive ForwardState = "forwarding"
+	// ForwardReconnecting means the port forwarding broke and is being re-established
+	ForwardReconnecting ForwardState = "reconnecting"
+)
+
+// HealthState describes the result of an exposure's health checks
+type HealthState string
+
+const (
+	// HealthUnknown means the first health check did not complete yet
+	HealthUnknown HealthState = "unknown"
+	// HealthHealthy means the last health check passed
+	HealthHealthy HealthState = "healthy"
+	// HealthUnhealthy means the last health check failed, callers get the fallback page
+	HealthUnhealthy HealthState = "unhealthy"
+)
+
+// ExposeRequest describes a service port to expose
+type ExposeRequest struct {
+	// Service is the service name in the "service-name (ns: namespace)" format
+	Service string
+	Port    ServicePort
+	// Rules rewrites the HTTP traffic going through the tunnel
+	Rules proxy.Rules
+	// Limits caps the HTTP traffic accepted through the tunnel
+	Limits proxy.Limits
+	// TTL, if set, stops the exposure once it has been running for that long
+	TTL time.Duration
+	// IdleTimeout, if set, stops the exposure once no request went through the tunnel for that long
+	IdleTimeout time.Duration
+	// WarnBefore, if set, warns that long before the exposure is stopped by TTL or IdleTimeout
+	WarnBefore time.Duration
+	// HealthCheck, if enabled, is run against the forwarded port
+	HealthCheck health.Config
+	// FallbackPage is served with 503 while the health check fails, a default page if empty
+	FallbackPage []byte
+	// Auth protects the public URL, required by require-auth policy rules;
+	// the basic auth secret annotation of the service if empty
+	Auth TunnelAuth
+	// TunnelType is the kind of tunnel, the tunnel type annotation of the service or http if empty
+	TunnelType TunnelType
+	// Domain is the ngrok domain of http tunnels, the domain annotation of the service if empty
+	Domain string
+	// TrafficPolicy is an ngrok traffic policy document in YAML or JSON applied to the tunnel
+	TrafficPolicy string
+	// EnvFile, if its path is set, receives the public URL, local port and forwarded address until the exposure stops
+	EnvFile EnvFile
+}
+
+// EnvFile is a dotenv file, or a JSON object with a .json extension, the details of an exposure are written to.
+// The variables are NAME for the public URL, BASE_LOCAL_PORT and BASE_LOCAL_ADDRESS, where BASE is NAME
+// without its _URL suffix; the other lines are kept and the previous values restored once the exposure stops
+type EnvFile struct {
+	Path string
+	// Var is the NAME of the public URL variable, the service name followed by _URL if empty, e.g. API_URL
+	Var string
+}
+
+// ExposureStatus is a snapshot of an active exposure
+type ExposureStatus struct {
+	Service     string     `json:"service"`
+	ServicePort int32      `json:"servicePort"`
+	LocalPort   int        `json:"localPort"`
+	PodName     string     `json:"podName,omitempty"`
+	PublicURL   string     `json:"publicURL"`
+	TunnelType  TunnelType `json:"tunnelType,omitempty"`
+	// Auth describes how the public URL is protected, without credentials
+	Auth       string       `json:"auth,omitempty"`
+	Forwarding ForwardState `json:"forwarding"`
+	TunnelUp   bool         `json:"tunnelUp"`
+	Requests   int64        `json:"requests"`
+	BytesIn    int64        `json:"bytesIn"`
+	BytesOut   int64        `json:"bytesOut"`
+	Failures   int64        `json:"failures"`
+	Rejected   int64        `json:"rejected"`
+	Errors     []string     `json:"errors,omitempty"`
+	StartedAt  time.Time    `json:"startedAt"`
+	// ExpiresAt is when the exposure's TTL runs out
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// IdleExpiresAt is when the exposure stops if no further request goes through the tunnel
+	IdleExpiresAt time.Time `json:"idleExpiresAt,omitzero"`
+	// Warning announces that the exposure is about to be stopped
+	Warning string `json:"warning,omitempty"`
+	// Health is the health check state, empty without health check
+	Health HealthState `json:"health,omitempty"`
+	// HealthError is why the last health check failed
+	HealthError string `json:"healthError,omitempty"`
+	// PolicyWarnings explains the warn policy rules that matched the exposure
+	PolicyWarnings []string `json:"policyWarnings,omitempty"`
+}
+
+// EventType is the kind of lifecycle transition of an exposure published to subscribers
+type EventType string
+
+const (
+	// EventReady is published once the service port is exposed and its public URL accepts connections
+	EventReady EventType = "ready"
+	// EventDenied is published when the policy or the service's owners refuse to expose the service port
+	EventDenied EventType = "denied"
+	// EventPortForwardReady is published when the port forwarding to a pod is established or re-established
+	EventPortForwardReady EventType = "port-forward-ready"
+	// EventPortForwardLost is published when the port forwarding breaks, it is re-established until stopped
+	EventPortForwardLost EventType = "port-forward-lost"
+	// EventPodSwitched is published when the port forwarding is re-established to another pod
+	EventPodSwitched EventType = "pod-switched"
+	// EventTunnelUp is published when the tunnel is started, reconnects or is restarted with a new public URL
+	EventTunnelUp EventType = "tunnel-up"
+	// EventTunnelDown is published when the tunnel disconnects or is being restarted
+	EventTunnelDown EventType = "tunnel-down"
+	// EventHealthChanged is published when the health check of the forwarded port passes or fails
+	EventHealthChanged EventType = "health-changed"
+	// EventExpired is published when the TTL or idle timeout of an exposure is reached, before it is stopped
+	EventExpired EventType = "expired"
+	// EventStopped is published once the exposure is stopped
+	EventStopped EventType = "stopped"
+)
+
+// Event is a lifecycle transition of an exposure
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Exposure is a snapshot of the exposure after the transition;
+	// only the service, port, tunnel type and auth of denied exposures are known
+	Exposure ExposureStatus `json:"exposure"`
+	// Reason is why the port forwarding was lost, the pod switched, the tunnel went down,
+	// the health check failed or the exposure expired, stopped or was denied
+	Reason string `json:"reason,omitempty"`
+	// PreviousURL is the public URL replaced by a restarted tunnel
+	PreviousURL string `json:"previousURL,omitempty"`
+}
+
+// AuditEvent is a lifecycle transition of an exposure recorded in the audit log
+type AuditEvent string
+
+const (
+	// AuditStarted is recorded once the service port is exposed
+	AuditStarted AuditEvent = "started"
+	// AuditPodSwitched is recorded when the port forwarding is re-established to another pod
+	AuditPodSwitched AuditEvent = "pod-switched"
+	// AuditTunnelRestarted is recorded when the tunnel is recreated with a new public URL
+	AuditTunnelRestarted AuditEvent = "tunnel-restarted"
+	// AuditStopped is recorded when the exposure is stopped, with the reason
+	AuditStopped AuditEvent = "stopped"
+	// AuditDenied is recorded when the policy refuses to expose the service port
+	AuditDenied AuditEvent = "denied"
+)
+
+// AuditEntry is a record of the audit log
+type AuditEntry struct {
+	Time      time.Time  `json:"time"`
+	Event     AuditEvent `json:"event"`
+	User      string     `json:"user"`
+	Context   string     `json:"context,omitempty"`
+	Namespace string     `json:"namespace,omitempty"`
+	Service   string     `json:"service,omitempty"`
+	Port      int32      `json:"port,omitempty"`
+	LocalPort int        `json:"localPort,omitempty"`
+	Pod       string     `json:"pod,omitempty"`
+	PublicURL string     `json:"publicURL,omitempty"`
+	// TunnelType is the kind of tunnel the service is published on
+	TunnelType TunnelType `json:"tunnelType,omitempty"`
+	// Auth describes how the public URL is protected, without credentials
+	Auth      string    `json:"auth,omitempty"`
+	StartedAt time.Time `json:"startedAt,omitzero"`
+	StoppedAt time.Time `json:"stoppedAt,omitzero"`
+	// Reason is why the exposure was stopped or denied
+	Reason string `json:"reason,omitempty"`
+}
+
+// AuditLog records the lifecycle transitions of exposures
+type AuditLog interface {
+	// Record appends an entry, filling in the user if empty
+	Record(entry AuditEntry) error
+}
+
+// CheckStatus is the outcome of a pre-flight check
+type CheckStatus string
+
+const (
+	// CheckPass means the check succeeded
+	CheckPass CheckStatus = "pass"
+	// CheckWarn means the check found something that may cause problems
+	CheckWarn CheckStatus = "warn"
+	// CheckFail means exposing services will not work until the problem is fixed
+	CheckFail CheckStatus = "fail"
+)
+
+// CheckResult is the result of a single pre-flight check
+type CheckResult struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	// Detail describes what was found
+	Detail string `json:"detail,omitempty"`
+	// Hint tells how to fix a failed or warned check
+	Hint string `json:"hint,omitempty"`
 }
 
 // Service defines the interface for Kubernetes service operations
 type Service interface {
-	// GetServices returns a list of available Kubernetes services
-	GetServices(ctx context.Context) ([]string, error)
+	// GetServices returns the available Kubernetes services, including the ones hidden by their owners
+	GetServices(ctx context.Context) ([]ServiceInfo, error)
+
+	// WatchServices calls onChange with the available services as they are listed, and whether all of them are,
+	// and again whenever they change, until ctx is cancelled
+	WatchServices(ctx context.Context, onChange func(services []ServiceInfo, synced bool)) error
 
 	// GetServicePorts returns available ports for a specific service
 	GetServicePorts(ctx context.Context, serviceName string) ([]ServicePort, error)
 
-	// StartPortForwarding starts port forwarding for the specified service and port
+	// StartPortForwarding starts port forwarding for the specified service and port, which is stopped
+	// once ctx is cancelled
 	StartPortForwarding(ctx context.Context, serviceName string, servicePort int32) (int, error)
 
 	// CreateNgrokSession creates an ngrok session for the forwarded port
 	CreateNgrokSession(ctx context.Context, port int) (string, error)
 
+	// Expose starts port forwarding and an ngrok tunnel for a service port. The exposure lasts until
+	// it is stopped or expires, ctx only bounds its start
+	Expose(ctx context.Context, req ExposeRequest) (ExposureStatus, error)
+
+	// Exposures returns a snapshot of all active exposures ordered by local port
+	Exposures() []ExposureStatus
+
+	// StopExposure stops the port forwarding and tunnel of the exposure on the given local port
+	StopExposure(localPort int) error
+
+	// Requests returns the requests recorded for the exposure on the given local port, oldest first
+	Requests(localPort int) ([]proxy.Exchange, error)
+
+	// Request returns a single recorded request of the exposure on the given local port
+	Request(localPort int, id int64) (proxy.Exchange, error)
+
+	// Replay sends a recorded request of the exposure on the given local port, modified by opts,
+	// again to the forwarded port and compares the new response with the original one
+	Replay(ctx context.Context, localPort int, id int64, opts proxy.ReplayOptions) (proxy.ReplayResult, error)
+
+	// RestartTunnel recreates the ngrok tunnel of the exposure on the given local port
+	RestartTunnel(ctx context.Context, localPort int) (string, error)
+
+	// Subscribe returns the lifecycle events of exposures published from now on, in order.
+	// The channel is closed once ctx is cancelled or the service is cleaned up
+	Subscribe(ctx context.Context) <-chan Event
+
+	// Preflight checks that the cluster is reachable and that the current user may list services
+	// and port-forward to pods in namespace, all namespaces if empty
+	Preflight(ctx context.Context, namespace string) []CheckResult
+
 	// Cleanup performs graceful shutdown of all active sessions
 	Cleanup() error
 }
 
+// ErrPortInUse is returned by PortForward when the local port is taken, another one can be tried
+var ErrPortInUse = errors.New("local port already in use")
+
+// PortForwardSession describes an established port-forward connection
+type PortForwardSession struct {
+	// PodName is the name of the pod the connection is forwarded to
+	PodName string
+	// Done receives the forwarding error, if any, and is closed once forwarding stops
+	Done <-chan error
+}
+
 type K8s interface {
-	// ListServices lists all services in the Kubernetes cluster
-	ListServices(ctx context.Context) ([]string, error)
+	// ListServices lists all services in the Kubernetes cluster with their annotations parsed
+	ListServices(ctx context.Context) ([]ServiceInfo, error)
 
-	// GetServicePorts returns available ports for a specific service
+	// WatchServices calls onChange with the services as they are listed, and whether all of them are,
+	// and again whenever a service or its endpoints change, until ctx is cancelled
+	WatchServices(ctx context.Context, onChange func(services []ServiceInfo, synced bool)) error
+
+	// GetServicePorts returns available ports for a specific service, marking the default port
 	GetServicePorts(ctx context.Context, serviceName string, namespace string) ([]ServicePort, error)
 
-	// PortForward creates a port-forward connection to a service
-	PortForward(ctx context.Context, serviceName string, namespace string, localPort int, servicePort int32) error
+	// GetService returns the labels and annotations of a service with the annotations parsed
+	GetService(ctx context.Context, serviceName string, namespace string) (ServiceInfo, error)
+
+	// ContextName returns the name of the kubeconfig context the client uses
+	ContextName() string
+
+	// GetSecret returns the data of a Secret
+	GetSecret(ctx context.Context, namespace string, name string) (map[string][]byte, error)
+
+	// PortForward creates a port-forward connection to a service that lasts until ctx is cancelled
+	PortForward(ctx context.Context, serviceName string, namespace string, localPort int, servicePort int32) (PortForwardSession, error)
+
+	// ServerVersion returns the version of the Kubernetes API server
+	ServerVersion(ctx context.Context) (string, error)
+
+	// CanI reports whether the current user may perform verb on resource (and subresource) in namespace,
+	// all namespaces if empty, with the authorizer's reason
+	CanI(ctx context.Context, namespace string, verb string, resource string, subresource string) (bool, string, error)
+
+	// Close stops watching the cluster
+	Close()
+}
+
+// TunnelOptions configures a tunnel created by NgrokClient
+type TunnelOptions struct {
+	// OnStatus is called whenever the tunnel's connection to ngrok goes up or down
+	OnStatus func(up bool)
+	// Type is the kind of tunnel, http if empty
+	Type TunnelType
+	// Auth protects the tunnel's public URL, http tunnels only
+	Auth TunnelAuth
+	// Domain is the ngrok domain of http tunnels, a random one if empty
+	Domain string
+	// TrafficPolicy is an ngrok traffic policy document in YAML or JSON, none if empty
+	TrafficPolicy string
 }
 
 // NgrokClient defines the interface for ngrok client operations
 type NgrokClient interface {
-	StartTunnel(ctx context.Context, port int) (string, error)
+	StartTunnel(ctx context.Context, port int, opts TunnelOptions) (string, error)
+	CloseTunnel(url string) error
 	Close() error
 }
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/proxy"
+)
+
+// applyDefaults fills the tunnel settings the request leaves empty from the annotations of the service,
+// refusing services whose owners opted out of exposure. Without a tunnel type, ports are published on http
+// even if tcp suits them better, since tcp tunnels cannot require authentication
+func (m *service) applyDefaults(ctx context.Context, info ServiceInfo, req ExposeRequest) (ExposeRequest, error) {
+	if info.OptOut {
+		reason := fmt.Sprintf("the owners of %s/%s opted out of exposure with the %s annotation", info.Namespace, info.Name, AnnotationExpose)
+		m.publishDenied(info, req, reason)
+		return req, errors.New(reason)
+	}
+
+	if req.TunnelType == "" {
+		req.TunnelType = info.Defaults.TunnelType
+	}
+
+	if req.TunnelType != TunnelTCP && req.Domain == "" {
+		req.Domain = info.Defaults.Domain
+	}
+
+	if !req.Auth.Enabled() && info.Defaults.BasicAuthSecret != "" {
+		auth, err := m.basicAuthFromSecret(ctx, info.Namespace, info.Defaults.BasicAuthSecret)
+		if err != nil {
+			return req, err
+		}
+		req.Auth = auth
+	}
+
+	if req.TunnelType == "" {
+		req.TunnelType = TunnelHTTP
+		if req.Port.SuggestedTunnelType() == TunnelTCP && !req.Auth.Enabled() && req.Domain == "" {
+			log.Printf("💡 %s/%s port %d looks like it does not speak HTTP, expose it with the tcp tunnel type to publish it as a raw TCP address\n",
+				info.Namespace, info.Name, req.Port.Port)
+		}
+	}
+
+	if req.TunnelType != TunnelTCP {
+		return req, nil
+	}
+
+	if req.Auth.Enabled() {
+		return req, fmt.Errorf("basic auth and OAuth need an http tunnel, %s/%s is exposed over tcp", info.Namespace, info.Name)
+	}
+	if req.Domain != "" {
+		return req, fmt.Errorf("domains need an http tunnel, %s/%s is exposed over tcp", info.Namespace, info.Name)
+	}
+	if !req.Rules.IsZero() || !req.Limits.IsZero() || req.IdleTimeout > 0 || req.FallbackPage != nil {
+		slog.Warn(fmt.Sprintf("⚠️  Rewrite rules, limits, idle timeout and fallback page only apply to http tunnels, ignoring them for %s/%s", info.Namespace, info.Name))
+		req.Rules = proxy.Rules{}
+		req.Limits = proxy.Limits{}
+		req.IdleTimeout = 0
+		req.FallbackPage = nil
+	}
+
+	return req, nil
+}
+
+// tcpPortNames are port names and application protocols of services that do not speak HTTP/1
+var tcpPortNames = []string{"grpc", "tcp", "postgres", "postgresql", "mysql", "redis", "mongo", "mongodb", "amqp", "kafka", "nats", "ssh"}
+
+// tcpPorts are well-known ports of databases and brokers that do not speak HTTP
+var tcpPorts = []int32{22, 3306, 5432, 5672, 6379, 9092, 4222, 27017}
+
+// SuggestedTunnelType returns the tunnel type suited to the port: tcp for gRPC, databases and brokers, recognized
+// by their application protocol, name or well-known port number, http otherwise. It is only a suggestion,
+// exposures use tcp when asked to
+func (p ServicePort) SuggestedTunnelType() TunnelType {
+	for _, value := range []string{p.AppProtocol, p.Name} {
+		value = strings.ToLower(value)
+		if strings.HasPrefix(value, "grpc-web") {
+			// gRPC-Web is served over HTTP/1
+			return TunnelHTTP
+		}
+		for _, name := range tcpPortNames {
+			// Port names are often prefixed with the protocol, such as tcp-metrics or grpc-internal
+			if value == name || strings.HasPrefix(value, name+"-") {
+				return TunnelTCP
+			}
+		}
+	}
+
+	if p.AppProtocol == "" && slices.Contains(tcpPorts, p.Port) {
+		return TunnelTCP
+	}
+	return TunnelHTTP
+}
+
+// basicAuthFromSecret reads the basic auth credentials from the username and password keys of a Secret
+func (m *service) basicAuthFromSecret(ctx context.Context, namespace string, name string) (TunnelAuth, error) {
+	data, err := m.client.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return TunnelAuth{}, fmt.Errorf("failed to read basic auth secret: %w", err)
+	}
+
+	username, password := string(data["username"]), string(data["password"])
+	if username == "" || password == "" {
+		return TunnelAuth{}, fmt.Errorf("basic auth secret %s/%s must have username and password keys", namespace, name)
+	}
+
+	auth := TunnelAuth{BasicAuth: username + ":" + password}
+	if err := auth.Validate(); err != nil {
+		return TunnelAuth{}, fmt.Errorf("basic auth secret %s/%s: %w", namespace, name, err)
+	}
+
+	return auth, nil
+}
+
+// publishDenied publishes that exposing the requested service port was refused, recording it in the audit log
+func (m *service) publishDenied(info ServiceInfo, req ExposeRequest, reason string) {
+	m.publish(Event{
+		Type: EventDenied,
+		Time: time.Now(),
+		Exposure: ExposureStatus{
+			Service:     info.String(),
+			ServicePort: req.Port.Port,
+			TunnelType:  req.TunnelType,
+			Auth:        req.Auth.String(),
+		},
+		Reason: reason,
+	})
+}
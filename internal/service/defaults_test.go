@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Goalt/service-exporter/internal/proxy"
+)
+
+func TestExposeDefaults(t *testing.T) {
+	mockClient := &mockK8sClient{
+		services: []ServiceInfo{
+			{Name: "api", Namespace: "web", Defaults: ExposeDefaults{BasicAuthSecret: "api-auth", Domain: "api.example.com"}},
+			{Name: "db", Namespace: "data", Defaults: ExposeDefaults{TunnelType: TunnelTCP}},
+			{Name: "billing", Namespace: "payments", OptOut: true},
+			{Name: "cache", Namespace: "data"},
+		},
+		secrets: map[string]map[string][]byte{
+			"web/api-auth": {"username": []byte("admin"), "password": []byte("correct-horse")},
+		},
+	}
+	mockNgrok := &mockNgrokClient{}
+	auditLog := &mockAuditLog{}
+	svc := NewService(mockClient, mockNgrok)
+	svc.SetAuditLog(auditLog)
+	defer svc.Cleanup()
+
+	_, err := svc.Expose(context.Background(), ExposeRequest{Service: "billing (ns: payments)", Port: ServicePort{Port: 80}})
+	if err == nil || !strings.Contains(err.Error(), "opted out") {
+		t.Errorf("Expected services opted out to be refused, got %v", err)
+	}
+	if events := auditLog.events(); len(events) != 1 || events[0] != AuditDenied {
+		t.Errorf("Expected the refusal to be audited, got %v", events)
+	}
+
+	status, err := svc.Expose(context.Background(), ExposeRequest{Service: "api (ns: web)", Port: ServicePort{Port: 80}})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	if mockNgrok.lastOpts.Auth.BasicAuth != "admin:correct-horse" || mockNgrok.lastOpts.Domain != "api.example.com" || mockNgrok.lastOpts.Type != TunnelHTTP {
+		t.Errorf("Expected the annotation defaults, got %+v", mockNgrok.lastOpts)
+	}
+	if status.Auth != "basic auth as admin" || status.TunnelType != TunnelHTTP {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// Settings of the request win over the annotations
+	_, err = svc.Expose(context.Background(), ExposeRequest{
+		Service: "api (ns: web)",
+		Port:    ServicePort{Port: 80},
+		Auth:    TunnelAuth{OAuthProvider: "github"},
+		Domain:  "preview.example.com",
+	})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	if mockNgrok.lastOpts.Auth.OAuthProvider != "github" || mockNgrok.lastOpts.Auth.BasicAuth != "" || mockNgrok.lastOpts.Domain != "preview.example.com" {
+		t.Errorf("Expected the request settings, got %+v", mockNgrok.lastOpts)
+	}
+
+	// Without a tunnel type annotation ports stay on http, tcp tunnels cannot require authentication
+	if _, err := svc.Expose(context.Background(), ExposeRequest{Service: "cache (ns: data)", Port: ServicePort{Name: "redis", Port: 6379}}); err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	if mockNgrok.lastOpts.Type != TunnelHTTP {
+		t.Errorf("Expected an http tunnel for the redis port, got %+v", mockNgrok.lastOpts)
+	}
+	if _, err := svc.Expose(context.Background(), ExposeRequest{Service: "api (ns: web)", Port: ServicePort{Name: "grpc", Port: 9000}}); err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	if mockNgrok.lastOpts.Type != TunnelHTTP || mockNgrok.lastOpts.Domain != "api.example.com" {
+		t.Errorf("Expected the grpc port on http with the annotated domain, got %+v", mockNgrok.lastOpts)
+	}
+
+	status, err = svc.Expose(context.Background(), ExposeRequest{
+		Service: "db (ns: data)",
+		Port:    ServicePort{Port: 5432},
+		Limits:  proxy.Limits{RequestsPerSecond: 1},
+	})
+	if err != nil {
+		t.Fatalf("Expose over tcp should not return an error: %v", err)
+	}
+	if mockNgrok.lastOpts.Type != TunnelTCP || mockNgrok.lastPort != status.LocalPort {
+		t.Errorf("Expected a tcp tunnel straight to the forwarded port %d, got %+v to port %d", status.LocalPort, mockNgrok.lastOpts, mockNgrok.lastPort)
+	}
+	if len(status.PolicyWarnings) != 1 || !strings.Contains(status.PolicyWarnings[0], "cannot require authentication") {
+		t.Errorf("Expected a warning about the unauthenticated tcp tunnel, got %v", status.PolicyWarnings)
+	}
+	if _, err := svc.Requests(status.LocalPort); err == nil {
+		t.Error("Expected no recorded requests for tcp tunnels")
+	}
+	if _, err := svc.RestartTunnel(context.Background(), status.LocalPort); err != nil {
+		t.Errorf("RestartTunnel should not return an error for tcp tunnels: %v", err)
+	}
+}
+
+func TestExposeDefaults_Invalid(t *testing.T) {
+	mockClient := &mockK8sClient{
+		services: []ServiceInfo{
+			{Name: "api", Namespace: "web", Defaults: ExposeDefaults{BasicAuthSecret: "missing"}},
+			{Name: "weak", Namespace: "web", Defaults: ExposeDefaults{BasicAuthSecret: "weak-auth"}},
+			{Name: "db", Namespace: "data", Defaults: ExposeDefaults{TunnelType: TunnelTCP, BasicAuthSecret: "db-auth"}},
+		},
+		secrets: map[string]map[string][]byte{
+			"web/weak-auth": {"username": []byte("admin"), "password": []byte("short")},
+			"data/db-auth":  {"username": []byte("admin"), "password": []byte("correct-horse")},
+		},
+	}
+	svc := NewService(mockClient, &mockNgrokClient{})
+	defer svc.Cleanup()
+
+	tests := []struct {
+		service  string
+		expected string
+	}{
+		{"api (ns: web)", "failed to read basic auth secret"},
+		{"weak (ns: web)", "password must be between 8 and 128 characters"},
+		{"db (ns: data)", "need an http tunnel"},
+	}
+
+	for _, tt := range tests {
+		_, err := svc.Expose(context.Background(), ExposeRequest{Service: tt.service, Port: ServicePort{Port: 80}})
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Expose(%s): expected error containing %q, got %v", tt.service, tt.expected, err)
+		}
+	}
+
+	if len(svc.Exposures()) != 0 {
+		t.Error("Refused exposures must not be forwarded")
+	}
+}
+
+func TestServicePort_SuggestedTunnelType(t *testing.T) {
+	tests := []struct {
+		port     ServicePort
+		expected TunnelType
+	}{
+		{ServicePort{Name: "http", Port: 80}, TunnelHTTP},
+		{ServicePort{Name: "metrics", Port: 9090}, TunnelHTTP},
+		{ServicePort{Port: 8080}, TunnelHTTP},
+		{ServicePort{Name: "grpc", Port: 9000}, TunnelTCP},
+		{ServicePort{Name: "GRPC-internal", Port: 9001}, TunnelTCP},
+		{ServicePort{Name: "grpc-web", Port: 8081}, TunnelHTTP},
+		{ServicePort{Name: "api", Port: 9000, AppProtocol: "grpc"}, TunnelTCP},
+		{ServicePort{Name: "db", Port: 5432}, TunnelTCP},
+		{ServicePort{Port: 5432, AppProtocol: "http"}, TunnelHTTP},
+		{ServicePort{Name: "web", Port: 443, AppProtocol: "kubernetes.io/h2c"}, TunnelHTTP},
+	}
+
+	for _, tt := range tests {
+		if result := tt.port.SuggestedTunnelType(); result != tt.expected {
+			t.Errorf("%+v.SuggestedTunnelType() = %q, want %q", tt.port, result, tt.expected)
+		}
+	}
+}
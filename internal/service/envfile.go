@@ -0,0 +1,414 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvVarName returns the name of an environment variable holding a public URL, e.g. "API_HTTP_URL"
+// for the parts "api" and "http"
+func EnvVarName(parts ...string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, strings.Join(append(parts, "url"), "_"))
+
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// envWrite is the env file an exposure writes to, with the values its variables had before
+type envWrite struct {
+	path string
+	// vars are the names of the URL, local port and local address variables
+	vars [3]string
+	// previous holds the raw values the variables had, nil for the ones the file did not have
+	previous map[string]*string
+	// created is set when the file did not exist
+	created bool
+	// original is the content of the file before the first write, written is the content of the last write
+	original []byte
+	written  []byte
+}
+
+// newEnvWrite returns the env file an exposure of serviceName writes to, the variables named after
+// the URL variable name or the service if empty
+func newEnvWrite(file EnvFile, serviceName string) (*envWrite, error) {
+	name := file.Var
+	if name == "" {
+		service, _, _ := ParseServiceName(serviceName)
+		name = EnvVarName(service)
+	}
+	if !validEnvVar(name) {
+		return nil, fmt.Errorf("invalid environment variable name %q", name)
+	}
+
+	base := strings.TrimSuffix(name, "_URL")
+	return &envWrite{path: file.Path, vars: [3]string{name, base + "_LOCAL_PORT", base + "_LOCAL_ADDRESS"}}, nil
+}
+
+// validEnvVar reports whether name is a portable environment variable name
+func validEnvVar(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	return !strings.ContainsFunc(name, func(r rune) bool {
+		return r != '_' && (r >= unicode.MaxASCII || (!unicode.IsLetter(r) && !unicode.IsDigit(r)))
+	})
+}
+
+// write sets the variables to the public URL and local port of the exposure, recording the previous values
+// and content the first time. The caller holds the env lock
+func (w *envWrite) write(publicURL string, localPort int) error {
+	data, existed, err := readEnvFile(w.path)
+	if err != nil {
+		return err
+	}
+	doc, err := parseEnvDocument(w.path, data)
+	if err != nil {
+		return err
+	}
+
+	if w.previous == nil {
+		w.previous = map[string]*string{}
+		w.created = !existed
+		w.original = data
+		for _, name := range w.vars {
+			if raw, ok := doc.lookup(name); ok {
+				w.previous[name] = &raw
+			} else {
+				w.previous[name] = nil
+			}
+		}
+	}
+
+	doc.set(w.vars[0], publicURL)
+	doc.set(w.vars[1], strconv.Itoa(localPort))
+	doc.set(w.vars[2], "localhost:"+strconv.Itoa(localPort))
+	data = doc.encode()
+	if err := writeEnvFile(w.path, data); err != nil {
+		return err
+	}
+	w.written = data
+	return nil
+}
+
+// restore puts back the content the file had before the first write, or removes it if it did not exist.
+// If the file changed since the last write, only the variables are restored: the ones the file did not have
+// are removed, as is the file if it did not exist and holds nothing else. The caller holds the env lock
+func (w *envWrite) restore() error {
+	if w.previous == nil {
+		return nil
+	}
+
+	data, existed, err := readEnvFile(w.path)
+	if err != nil || !existed {
+		return err
+	}
+
+	if bytes.Equal(data, w.written) {
+		if w.created {
+			return w.remove()
+		}
+		return writeEnvFile(w.path, w.original)
+	}
+
+	doc, err := parseEnvDocument(w.path, data)
+	if err != nil {
+		return err
+	}
+	for name, raw := range w.previous {
+		if raw != nil {
+			doc.restore(name, *raw)
+		} else {
+			doc.remove(name)
+		}
+	}
+
+	if w.created && doc.empty() {
+		return w.remove()
+	}
+	return writeEnvFile(w.path, doc.encode())
+}
+
+// remove removes the env file the exposure created
+func (w *envWrite) remove() error {
+	if err := os.Remove(w.path); err != nil {
+		return fmt.Errorf("failed to remove env file: %w", err)
+	}
+	return nil
+}
+
+// envDocument is the content of a dotenv or JSON env file
+type envDocument interface {
+	// lookup returns the raw value of a variable, as written in the file
+	lookup(name string) (string, bool)
+	set(name string, value string)
+	// restore sets a variable to a raw value returned by lookup
+	restore(name string, raw string)
+	remove(name string)
+	empty() bool
+	encode() []byte
+}
+
+// readEnvFile reads the env file at path and whether it exists
+func readEnvFile(path string) ([]byte, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read env file: %w", err)
+	}
+	return data, true, nil
+}
+
+// parseEnvDocument parses the content of the env file at path, JSON if it has a .json extension
+func parseEnvDocument(path string, data []byte) (envDocument, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		doc := &jsonEnv{data: data}
+		if len(bytes.TrimSpace(data)) > 0 {
+			var object map[string]json.RawMessage
+			if err := json.Unmarshal(data, &object); err != nil {
+				return nil, fmt.Errorf("failed to parse env file %s: %w", path, err)
+			}
+		}
+		return doc, nil
+	}
+
+	var doc dotEnv
+	if content := strings.TrimSuffix(string(data), "\n"); content != "" {
+		doc.lines = strings.Split(content, "\n")
+	}
+	return &doc, nil
+}
+
+// writeEnvFile writes an env file to a temporary file renamed over the previous one, keeping its permissions.
+// A symbolic link is followed, the file it points to is replaced
+func writeEnvFile(path string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	perm := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write env file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write env file: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write env file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write env file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write env file: %w", err)
+	}
+	return nil
+}
+
+// dotEnv is a dotenv file, its lines other than the variables set are kept as they are
+type dotEnv struct {
+	lines []string
+}
+
+// index returns the line assigning name, "export NAME=value" or "NAME=value", -1 if none
+func (d *dotEnv) index(name string) int {
+	for i, line := range d.lines {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		if key, _, ok := strings.Cut(line, "="); ok && strings.TrimSpace(key) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *dotEnv) lookup(name string) (string, bool) {
+	if i := d.index(name); i != -1 {
+		return d.lines[i], true
+	}
+	return "", false
+}
+
+func (d *dotEnv) set(name string, value string) {
+	// Values are quoted when a shell or a dotenv parser would split or cut them
+	if strings.ContainsAny(value, " \t#\"'$`\\") {
+		value = strconv.Quote(value)
+	}
+
+	line := name + "=" + value
+	i := d.index(name)
+	if i == -1 {
+		d.lines = append(d.lines, line)
+		return
+	}
+	if strings.HasPrefix(strings.TrimSpace(d.lines[i]), "export ") {
+		line = "export " + line
+	}
+	d.lines[i] = line
+}
+
+func (d *dotEnv) restore(name string, raw string) {
+	if i := d.index(name); i != -1 {
+		d.lines[i] = raw
+	} else {
+		d.lines = append(d.lines, raw)
+	}
+}
+
+func (d *dotEnv) remove(name string) {
+	if i := d.index(name); i != -1 {
+		d.lines = append(d.lines[:i], d.lines[i+1:]...)
+	}
+}
+
+func (d *dotEnv) empty() bool {
+	return strings.TrimSpace(strings.Join(d.lines, "")) == ""
+}
+
+func (d *dotEnv) encode() []byte {
+	if len(d.lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(d.lines, "\n") + "\n")
+}
+
+// jsonEnv is a JSON object of variables edited in place: the order, formatting and other members are kept
+type jsonEnv struct {
+	data []byte
+}
+
+// jsonMember locates a member of the object in the document
+type jsonMember struct {
+	name string
+	// after is the end of the previous value, or of the opening brace for the first member
+	after int
+	// keyStart and keyEnd delimit the quoted name, valueStart and valueEnd the value
+	keyStart, keyEnd     int
+	valueStart, valueEnd int
+}
+
+// members returns the members of the object in order, the document is valid JSON
+func (j *jsonEnv) members() []jsonMember {
+	dec := json.NewDecoder(bytes.NewReader(j.data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+
+	var members []jsonMember
+	after := bytes.IndexByte(j.data, '{') + 1
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return members
+		}
+		keyEnd := int(dec.InputOffset())
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return members
+		}
+		valueEnd := int(dec.InputOffset())
+
+		name, _ := tok.(string)
+		keyStart := after + bytes.IndexByte(j.data[after:], '"')
+		members = append(members, jsonMember{name, after, keyStart, keyEnd, valueEnd - len(raw), valueEnd})
+		after = valueEnd
+	}
+	return members
+}
+
+// find returns the members and the index of the one named name, -1 if none
+func (j *jsonEnv) find(name string) ([]jsonMember, int) {
+	members := j.members()
+	for i, m := range members {
+		if m.name == name {
+			return members, i
+		}
+	}
+	return members, -1
+}
+
+// splice replaces the bytes between start and end
+func (j *jsonEnv) splice(start int, end int, replacement string) {
+	j.data = slices.Concat(j.data[:start:start], []byte(replacement), j.data[end:])
+}
+
+func (j *jsonEnv) lookup(name string) (string, bool) {
+	members, i := j.find(name)
+	if i == -1 {
+		return "", false
+	}
+	return string(j.data[members[i].valueStart:members[i].valueEnd]), true
+}
+
+func (j *jsonEnv) set(name string, value string) {
+	raw, _ := json.Marshal(value)
+	j.restore(name, string(raw))
+}
+
+// restore sets the raw value of a member, appending it after the last member in the same layout if missing
+func (j *jsonEnv) restore(name string, raw string) {
+	members, i := j.find(name)
+	if i != -1 {
+		j.splice(members[i].valueStart, members[i].valueEnd, raw)
+		return
+	}
+
+	key, _ := json.Marshal(name)
+	if len(members) == 0 {
+		j.data = []byte("{\n  " + string(key) + ": " + raw + "\n}\n")
+		return
+	}
+
+	last := members[len(members)-1]
+	separator := strings.TrimLeft(string(j.data[last.after:last.keyStart]), ",")
+	colon := string(j.data[last.keyEnd:last.valueStart])
+	j.splice(last.valueEnd, last.valueEnd, ","+separator+string(key)+colon+raw)
+}
+
+func (j *jsonEnv) remove(name string) {
+	members, i := j.find(name)
+	switch {
+	case i == -1:
+	case i > 0:
+		j.splice(members[i].after, members[i].valueEnd, "")
+	case len(members) > 1:
+		j.splice(members[0].keyStart, members[1].keyStart, "")
+	default:
+		j.splice(members[0].after, members[0].valueEnd, "")
+	}
+}
+
+func (j *jsonEnv) empty() bool {
+	return len(j.members()) == 0
+}
+
+func (j *jsonEnv) encode() []byte {
+	return j.data
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvVarName(t *testing.T) {
+	tests := []struct {
+		parts    []string
+		expected string
+	}{
+		{parts: []string{"api"}, expected: "API_URL"},
+		{parts: []string{"payment-gateway", "http"}, expected: "PAYMENT_GATEWAY_HTTP_URL"},
+		{parts: []string{"3scale", "8080"}, expected: "_3SCALE_8080_URL"},
+	}
+
+	for _, tt := range tests {
+		if name := EnvVarName(tt.parts...); name != tt.expected {
+			t.Errorf("EnvVarName(%v) = %q, expected %q", tt.parts, name, tt.expected)
+		}
+	}
+}
+
+func TestNewEnvWrite(t *testing.T) {
+	env, err := newEnvWrite(EnvFile{Path: ".env", Var: "BACKEND_URL"}, "api (ns: staging)")
+	if err != nil {
+		t.Fatalf("newEnvWrite should not return an error: %v", err)
+	}
+	if env.vars != [3]string{"BACKEND_URL", "BACKEND_LOCAL_PORT", "BACKEND_LOCAL_ADDRESS"} {
+		t.Errorf("Unexpected variables %v", env.vars)
+	}
+
+	env, err = newEnvWrite(EnvFile{Path: ".env"}, "my-api (ns: staging)")
+	if err != nil || env.vars[0] != "MY_API_URL" {
+		t.Errorf("Expected the variable named after the service, got %v, %v", env, err)
+	}
+
+	if _, err := newEnvWrite(EnvFile{Path: ".env", Var: "1-URL"}, "api (ns: staging)"); err == nil {
+		t.Error("Expected an error for an invalid variable name")
+	}
+}
+
+func TestEnvWrite_Dotenv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env.local")
+	original := "# Backend\nexport API_URL=http://localhost:3000\nDEBUG=true\n\nAPI_LOCAL_PORT=3000\n"
+	if err := os.WriteFile(path, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	env, _ := newEnvWrite(EnvFile{Path: path}, "api (ns: staging)")
+	if err := env.write("https://a.ngrok.io", 8000); err != nil {
+		t.Fatalf("write should not return an error: %v", err)
+	}
+	// A restarted tunnel rewrites the URL, the values before the first write are kept
+	if err := env.write("https://b.ngrok.io", 8000); err != nil {
+		t.Fatalf("write should not return an error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	expected := "# Backend\nexport API_URL=https://b.ngrok.io\nDEBUG=true\n\nAPI_LOCAL_PORT=8000\nAPI_LOCAL_ADDRESS=localhost:8000\n"
+	if string(data) != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the permissions to be kept, got %v", info.Mode().Perm())
+	}
+
+	if err := env.restore(); err != nil {
+		t.Fatalf("restore should not return an error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != original {
+		t.Errorf("Expected the original content\n%s\ngot\n%s", original, data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected no temporary files, got %v", entries)
+	}
+}
+
+func TestEnvWrite_Created(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+
+	env, _ := newEnvWrite(EnvFile{Path: path, Var: "BACKEND_URL"}, "api (ns: staging)")
+	if err := env.write("https://a.ngrok.io/?a=b c", 8001); err != nil {
+		t.Fatalf("write should not return an error: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	expected := "BACKEND_URL=\"https://a.ngrok.io/?a=b c\"\nBACKEND_LOCAL_PORT=8001\nBACKEND_LOCAL_ADDRESS=localhost:8001\n"
+	if string(data) != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, data)
+	}
+
+	if err := env.restore(); err != nil {
+		t.Fatalf("restore should not return an error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the created file to be removed, got %v", err)
+	}
+}
+
+func TestEnvWrite_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.json")
+	original := "{\n    \"retries\": 3,\n    \"API_URL\": \"http://localhost:3000\",\n    \"debug\": true\n}\n"
+	if err := os.WriteFile(path, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	env, _ := newEnvWrite(EnvFile{Path: path}, "api (ns: staging)")
+	if err := env.write("https://a.ngrok.io", 8000); err != nil {
+		t.Fatalf("write should not return an error: %v", err)
+	}
+	// The members keep their order and layout, the new ones follow the last one
+	data, _ := os.ReadFile(path)
+	expected := "{\n    \"retries\": 3,\n    \"API_URL\": \"https://a.ngrok.io\",\n    \"debug\": true," +
+		"\n    \"API_LOCAL_PORT\": \"8000\",\n    \"API_LOCAL_ADDRESS\": \"localhost:8000\"\n}\n"
+	if string(data) != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, data)
+	}
+
+	if err := env.restore(); err != nil {
+		t.Fatalf("restore should not return an error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != original {
+		t.Errorf("Expected the original content\n%s\ngot\n%s", original, data)
+	}
+}
+
+func TestEnvWrite_ChangedSinceWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.json")
+	if err := os.WriteFile(path, []byte(`{"API_URL": "http://localhost:3000", "retries": 3}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	env, _ := newEnvWrite(EnvFile{Path: path}, "api (ns: staging)")
+	if err := env.write("https://a.ngrok.io", 8000); err != nil {
+		t.Fatalf("write should not return an error: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	edited := strings.Replace(string(data), `"retries": 3`, `"retries": 5`, 1)
+	if err := os.WriteFile(path, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits made while the exposure ran are kept, only the variables are restored
+	if err := env.restore(); err != nil {
+		t.Fatalf("restore should not return an error: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if expected := `{"API_URL": "http://localhost:3000", "retries": 5}`; string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+	var written map[string]any
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Errorf("Expected JSON, got %s", data)
+	}
+}
+
+func TestEnvWrite_Symlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "shared.env")
+	if err := os.WriteFile(target, []byte("DEBUG=true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, ".env")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symbolic links are not supported: %v", err)
+	}
+
+	env, _ := newEnvWrite(EnvFile{Path: link}, "api (ns: staging)")
+	if err := env.write("https://a.ngrok.io", 8000); err != nil {
+		t.Fatalf("write should not return an error: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("Expected the symbolic link to be kept, got %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(target); !strings.Contains(string(data), "API_URL=https://a.ngrok.io") {
+		t.Errorf("Expected the linked file to be written, got\n%s", data)
+	}
+
+	if err := env.restore(); err != nil {
+		t.Fatalf("restore should not return an error: %v", err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "DEBUG=true\n" {
+		t.Errorf("Expected the linked file to be restored, got\n%s", data)
+	}
+}
+
+func TestExpose_EnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("DEBUG=true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewService(&mockK8sClient{}, &mockNgrokClient{})
+	status, err := svc.Expose(context.Background(), ExposeRequest{Service: "api (ns: staging)", Port: ServicePort{Port: 80}, EnvFile: EnvFile{Path: path}})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "API_URL="+status.PublicURL+"\n") {
+		t.Errorf("Expected the public URL in the env file, got\n%s", data)
+	}
+
+	url, err := svc.RestartTunnel(context.Background(), status.LocalPort)
+	if err != nil {
+		t.Fatalf("RestartTunnel should not return an error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "API_URL="+url+"\n") {
+		t.Errorf("Expected the new public URL in the env file, got\n%s", data)
+	}
+
+	svc.Cleanup()
+	if data, _ := os.ReadFile(path); string(data) != "DEBUG=true\n" {
+		t.Errorf("Expected the env file to be restored, got\n%s", data)
+	}
+
+	// A file that cannot be written stops the exposure
+	svc = NewService(&mockK8sClient{}, &mockNgrokClient{})
+	defer svc.Cleanup()
+	_, err = svc.Expose(context.Background(), ExposeRequest{Service: "api (ns: staging)", Port: ServicePort{Port: 80}, EnvFile: EnvFile{Path: filepath.Join(path, "nested")}})
+	if err == nil || !strings.Contains(err.Error(), "env file") {
+		t.Errorf("Expected an env file error, got %v", err)
+	}
+	if len(svc.Exposures()) != 0 {
+		t.Error("Expected the exposure to be stopped")
+	}
+}
+
+func TestJSONEnv_Remove(t *testing.T) {
+	tests := []struct {
+		data     string
+		name     string
+		expected string
+	}{
+		{`{"A": 1, "B": 2, "C": 3}`, "A", `{"B": 2, "C": 3}`},
+		{`{"A": 1, "B": 2, "C": 3}`, "B", `{"A": 1, "C": 3}`},
+		{"{\n  \"A\": 1,\n  \"B\": [2]\n}", "B", "{\n  \"A\": 1\n}"},
+		{"{\n  \"A\": {\"x\": 1}\n}", "A", "{\n}"},
+		{`{"A": 1}`, "B", `{"A": 1}`},
+	}
+
+	for _, tt := range tests {
+		doc := &jsonEnv{data: []byte(tt.data)}
+		doc.remove(tt.name)
+		if string(doc.encode()) != tt.expected {
+			t.Errorf("Removing %s from %s: expected %s, got %s", tt.name, tt.data, tt.expected, doc.encode())
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// eventBus delivers the lifecycle events of exposures to its subscribers
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+// subscriber queues the events of a subscription so that publishing never waits for a slow reader
+type subscriber struct {
+	mu     sync.Mutex
+	queue  []Event
+	closed bool
+	// wake is signalled when events are queued or the bus is closed
+	wake chan struct{}
+}
+
+// Subscribe returns the lifecycle events of exposures published from now on, in order.
+// The channel is closed once ctx is cancelled or the service is cleaned up
+func (m *service) Subscribe(ctx context.Context) <-chan Event {
+	return m.events.subscribe(ctx)
+}
+
+// subscribe returns a channel receiving the events published until ctx is cancelled or the bus is closed,
+// the events queued when the bus is closed are still delivered
+func (b *eventBus) subscribe(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	s := &subscriber{wake: make(chan struct{}, 1)}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(events)
+		return events
+	}
+	if b.subscribers == nil {
+		b.subscribers = make(map[*subscriber]struct{})
+	}
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		defer close(events)
+		defer func() {
+			b.mu.Lock()
+			delete(b.subscribers, s)
+			b.mu.Unlock()
+		}()
+
+		for {
+			s.mu.Lock()
+			queue, closed := s.queue, s.closed
+			s.queue = nil
+			s.mu.Unlock()
+
+			for _, event := range queue {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if closed {
+				return
+			}
+
+			select {
+			case <-s.wake:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// publish queues an event for every subscriber
+func (b *eventBus) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		s.mu.Lock()
+		s.queue = append(s.queue, event)
+		s.mu.Unlock()
+		s.signal()
+	}
+}
+
+// close closes the channels of the subscribers once they received the published events
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subscribers {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		s.signal()
+	}
+}
+
+// signal wakes the subscriber up, unless it is already due to
+func (s *subscriber) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// event returns an event of the exposure, the caller must hold the service lock
+func (e *exposure) event(eventType EventType, reason string) Event {
+	return Event{
+		Type:     eventType,
+		Time:     time.Now(),
+		Exposure: e.status(),
+		Reason:   reason,
+	}
+}
+
+// publish records an event in the audit log, if it is a transition audited, and delivers it to the subscribers.
+// The event is delivered even if it cannot be audited, the error is returned to the callers that must fail closed
+func (m *service) publish(event Event) error {
+	err := m.record(m.auditEntry(event))
+	m.events.publish(event)
+	return err
+}
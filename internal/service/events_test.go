@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/policy"
+)
+
+// receive returns the next n events, failing the test if they do not arrive in time
+func receive(t *testing.T, events <-chan Event, n int) []Event {
+	t.Helper()
+
+	var received []Event
+	timeout := time.After(3 * reconnectDelay)
+	for len(received) < n {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("Events closed after %v", types(received))
+			}
+			received = append(received, event)
+		case <-timeout:
+			t.Fatalf("Expected %d events, got %v", n, types(received))
+		}
+	}
+	return received
+}
+
+// types returns the types of events
+func types(events []Event) []EventType {
+	result := make([]EventType, len(events))
+	for i, event := range events {
+		result[i] = event.Type
+	}
+	return result
+}
+
+func TestSubscribe_Lifecycle(t *testing.T) {
+	auditLog := &mockAuditLog{}
+	svc := NewService(&mockK8sClient{}, &mockNgrokClient{})
+	svc.SetAuditLog(auditLog)
+	svc.SetPolicy(policy.Policy{Rules: []policy.Rule{{Name: "no-db", Action: policy.ActionDeny, Ports: []string{"5432"}}}})
+	events := svc.Subscribe(context.Background())
+
+	svc.Expose(context.Background(), ExposeRequest{Service: "db (ns: data)", Port: ServicePort{Port: 5432}})
+	status, err := svc.Expose(context.Background(), ExposeRequest{Service: "api (ns: staging)", Port: ServicePort{Port: 80}})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+	if _, err := svc.RestartTunnel(context.Background(), status.LocalPort); err != nil {
+		t.Fatalf("RestartTunnel should not return an error: %v", err)
+	}
+	svc.Cleanup()
+
+	received := receive(t, events, 7)
+	expected := []EventType{EventDenied, EventPortForwardReady, EventTunnelUp, EventReady, EventTunnelDown, EventTunnelUp, EventStopped}
+	if fmt.Sprint(types(received)) != fmt.Sprint(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, types(received))
+	}
+	if _, ok := <-events; ok {
+		t.Error("Expected the events to be closed by Cleanup")
+	}
+
+	if denied := received[0]; denied.Exposure.Service != "db (ns: data)" || denied.Exposure.ServicePort != 5432 || denied.Reason == "" {
+		t.Errorf("Unexpected denied event %+v", denied)
+	}
+	if ready := received[3]; ready.Exposure.PublicURL != status.PublicURL || ready.Exposure.PodName != "api-pod" || !ready.Exposure.TunnelUp {
+		t.Errorf("Unexpected ready event %+v", ready)
+	}
+	if restarted := received[5]; restarted.PreviousURL != status.PublicURL || restarted.Exposure.PublicURL == "" {
+		t.Errorf("Unexpected tunnel-up event %+v", restarted)
+	}
+	if stopped := received[6]; stopped.Reason != "shutdown" || stopped.Exposure.LocalPort != status.LocalPort {
+		t.Errorf("Unexpected stopped event %+v", stopped)
+	}
+
+	// Only the transitions the audit log knows are recorded
+	expectedAudit := []AuditEvent{AuditDenied, AuditStarted, AuditTunnelRestarted, AuditStopped}
+	if fmt.Sprint(auditLog.events()) != fmt.Sprint(expectedAudit) {
+		t.Errorf("Expected audit events %v, got %v", expectedAudit, auditLog.events())
+	}
+}
+
+func TestSubscribe_PodSwitched(t *testing.T) {
+	done := make(chan error, 1)
+	svc := NewService(&reconnectingK8sClient{first: done}, &mockNgrokClient{})
+	defer svc.Cleanup()
+	events := svc.Subscribe(context.Background())
+
+	if _, err := svc.StartPortForwarding(context.Background(), "api (ns: staging)", 80); err != nil {
+		t.Fatalf("StartPortForwarding should not return an error: %v", err)
+	}
+	done <- fmt.Errorf("lost connection to pod")
+
+	received := receive(t, events, 4)
+	expected := []EventType{EventPortForwardReady, EventPortForwardLost, EventPortForwardReady, EventPodSwitched}
+	if fmt.Sprint(types(received)) != fmt.Sprint(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, types(received))
+	}
+	if lost := received[1]; lost.Exposure.Forwarding != ForwardReconnecting || lost.Reason != "port forwarding to pod first-pod stopped: lost connection to pod" {
+		t.Errorf("Unexpected port-forward-lost event %+v", lost)
+	}
+	if switched := received[3]; switched.Exposure.PodName != "second-pod" {
+		t.Errorf("Unexpected pod-switched event %+v", switched)
+	}
+}
+
+func TestSubscribe_Expired(t *testing.T) {
+	svc := NewService(&mockK8sClient{}, &mockNgrokClient{})
+	defer svc.Cleanup()
+	events := svc.Subscribe(context.Background())
+
+	if _, err := svc.Expose(context.Background(), ExposeRequest{Service: "api (ns: staging)", Port: ServicePort{Port: 80}, TTL: 50 * time.Millisecond}); err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+
+	received := receive(t, events, 5)
+	if expired := received[3]; expired.Type != EventExpired || expired.Reason != "time-to-live of 50ms reached" {
+		t.Errorf("Unexpected expired event %+v", expired)
+	}
+	if stopped := received[4]; stopped.Type != EventStopped || stopped.Reason != "time-to-live of 50ms reached" {
+		t.Errorf("Unexpected stopped event %+v", stopped)
+	}
+}
+
+func TestSubscribe_Cancel(t *testing.T) {
+	svc := NewService(&mockK8sClient{}, &mockNgrokClient{})
+	defer svc.Cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := svc.Subscribe(ctx)
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("Expected no events")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the events to be closed once the context is cancelled")
+	}
+
+	// Publishing without reader never blocks
+	for i := 0; i < 100; i++ {
+		svc.events.publish(Event{Type: EventTunnelUp})
+	}
+	svc.events.mu.Lock()
+	subscribers := len(svc.events.subscribers)
+	svc.events.mu.Unlock()
+	if subscribers != 0 {
+		t.Error("Expected the subscription to be removed")
+	}
+
+	svc.Cleanup()
+	if _, ok := <-svc.Subscribe(context.Background()); ok {
+		t.Error("Expected subscriptions after Cleanup to be closed")
+	}
+}
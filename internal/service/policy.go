@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/Goalt/service-exporter/internal/policy"
+)
+
+// SetPolicy sets the policy evaluated before a service port is exposed
+func (m *service) SetPolicy(p policy.Policy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.policy = p
+}
+
+// checkPolicy evaluates the policy for the requested exposure of the service, returning an error explaining
+// the matched rules if it is denied or lacks the required authentication, and the explanations of the matched
+// warn rules. Unauthenticated tcp tunnels are always warned about
+func (m *service) checkPolicy(info ServiceInfo, req ExposeRequest) ([]string, error) {
+	m.mu.Lock()
+	p := m.policy
+	m.mu.Unlock()
+
+	target := fmt.Sprintf("%s/%s port %d", info.Namespace, info.Name, req.Port.Port)
+	var warnings []string
+	if len(p.Rules) > 0 {
+		var err error
+		if warnings, err = m.evaluatePolicy(p, info, req, target); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.TunnelType == TunnelTCP {
+		warning := "published over tcp, which cannot require authentication: anyone who finds the address can connect"
+		slog.Warn(fmt.Sprintf("⚠️  %s is %s", target, warning))
+		warnings = append(warnings, warning)
+	}
+
+	return warnings, nil
+}
+
+// evaluatePolicy returns the explanations of the warn rules of p matching the exposure of the service,
+// or an error if a rule denies it or requires the authentication it lacks
+func (m *service) evaluatePolicy(p policy.Policy, info ServiceInfo, req ExposeRequest, target string) ([]string, error) {
+	decision := p.Evaluate(policy.Target{
+		Context:     m.client.ContextName(),
+		Namespace:   info.Namespace,
+		Service:     info.Name,
+		Labels:      info.Labels,
+		Annotations: info.Annotations,
+		Port:        req.Port.Port,
+		PortName:    req.Port.Name,
+		TargetPort:  req.Port.TargetPort,
+		TunnelType:  string(req.TunnelType),
+	})
+
+	denial := ""
+	if denied := decision.Matched(policy.ActionDeny); len(denied) > 0 {
+		denial = fmt.Sprintf("exposing %s is denied by policy: %s", target, explain(denied))
+	} else if required := decision.Matched(policy.ActionRequireAuth); len(required) > 0 && !req.Auth.Enabled() {
+		denial = fmt.Sprintf("exposing %s requires basic auth or OAuth by policy: %s", target, explain(required))
+	}
+	if denial != "" {
+		m.publishDenied(info, req, denial)
+		return nil, errors.New(denial)
+	}
+
+	var warnings []string
+	for _, match := range decision.Matched(policy.ActionWarn) {
+		slog.Warn(fmt.Sprintf("⚠️  Policy warning for %s: %s", target, match))
+		warnings = append(warnings, match.String())
+	}
+
+	return warnings, nil
+}
+
+// explain joins the explanations of the matched rules
+func explain(matches []policy.Match) string {
+	explanations := make([]string, len(matches))
+	for i, match := range matches {
+		explanations[i] = match.String()
+	}
+	return strings.Join(explanations, "; ")
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Goalt/service-exporter/internal/policy"
+)
+
+func TestExposePolicy(t *testing.T) {
+	mockClient := &mockK8sClient{contextName: "eu-prod", labels: map[string]string{"exposure": "internal"}}
+	mockNgrok := &mockNgrokClient{}
+	svc := NewService(mockClient, mockNgrok)
+	defer svc.Cleanup()
+
+	svc.SetPolicy(policy.Policy{Rules: []policy.Rule{
+		{Name: "no-system", Action: policy.ActionDeny, Namespaces: []string{"kube-system"}},
+		{Name: "internal", Action: policy.ActionRequireAuth, Labels: map[string]string{"exposure": "internal"}, Message: "internal tools need a login"},
+		{Name: "prod", Action: policy.ActionWarn, Contexts: []string{"*prod*"}},
+	}})
+
+	_, err := svc.Expose(context.Background(), ExposeRequest{Service: "coredns (ns: kube-system)", Port: ServicePort{Name: "dns", Port: 53}})
+	if err == nil || !strings.Contains(err.Error(), `denied by policy: rule "no-system" (namespace "kube-system" matches "kube-system")`) {
+		t.Errorf("Expected a deny explaining the matched rule, got %v", err)
+	}
+	if len(svc.Exposures()) != 0 {
+		t.Error("A denied service must not be forwarded")
+	}
+
+	req := ExposeRequest{Service: "admin (ns: tools)", Port: ServicePort{Name: "http", Port: 80}}
+	_, err = svc.Expose(context.Background(), req)
+	if err == nil || !strings.Contains(err.Error(), "requires basic auth or OAuth") || !strings.Contains(err.Error(), "internal tools need a login") {
+		t.Errorf("Expected an error requiring auth, got %v", err)
+	}
+
+	req.Auth = TunnelAuth{BasicAuth: "admin:correct-horse"}
+	status, err := svc.Expose(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expose with auth should not return an error: %v", err)
+	}
+	if mockNgrok.lastOpts.Auth.BasicAuth != req.Auth.BasicAuth {
+		t.Errorf("Expected the tunnel to be protected by %+v, got %+v", req.Auth, mockNgrok.lastOpts.Auth)
+	}
+	if len(status.PolicyWarnings) != 1 || !strings.Contains(status.PolicyWarnings[0], `context "eu-prod" matches "*prod*"`) {
+		t.Errorf("Expected the prod warning, got %v", status.PolicyWarnings)
+	}
+}
+
+func TestTunnelAuth_String(t *testing.T) {
+	tests := []struct {
+		auth     TunnelAuth
+		expected string
+	}{
+		{TunnelAuth{}, "none"},
+		{TunnelAuth{BasicAuth: "admin:secret"}, "basic auth as admin"},
+		{TunnelAuth{OAuthProvider: "google"}, "google OAuth"},
+		{TunnelAuth{OAuthProvider: "google", OAuthAllowDomains: []string{"example.com"}}, "google OAuth for example.com"},
+	}
+
+	for _, tt := range tests {
+		if s := tt.auth.String(); s != tt.expected {
+			t.Errorf("String() = %q, want %q", s, tt.expected)
+		}
+	}
+}
+
+func TestTunnelAuth_Validate(t *testing.T) {
+	tests := []struct {
+		auth    TunnelAuth
+		wantErr bool
+	}{
+		{TunnelAuth{}, false},
+		{TunnelAuth{BasicAuth: "admin:correct-horse"}, false},
+		{TunnelAuth{OAuthProvider: "github"}, false},
+		{TunnelAuth{BasicAuth: "admin"}, true},
+		{TunnelAuth{BasicAuth: "admin:short"}, true},
+		{TunnelAuth{BasicAuth: "admin:correct-horse", OAuthProvider: "github"}, true},
+		{TunnelAuth{OAuthProvider: "github", OAuthClientID: "id", OAuthClientSecret: "secret"}, false},
+		{TunnelAuth{OAuthProvider: "github", OAuthClientID: "id"}, true},
+		{TunnelAuth{OAuthClientID: "id", OAuthClientSecret: "secret"}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.auth.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.auth, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+// accessCheck is a permission needed to expose services
+type accessCheck struct {
+	verb        string
+	resource    string
+	subresource string
+	// namespaced is false for checks that always apply to all namespaces
+	namespaced bool
+	hint       string
+}
+
+// accessChecks are the permissions checked by Preflight
+var accessChecks = []accessCheck{
+	{
+		verb:     "list",
+		resource: "services",
+		hint:     "service-exporter lists services in all namespaces, ask a cluster admin for a ClusterRole granting list on services",
+	},
+	{
+		verb:       "get",
+		resource:   "pods",
+		namespaced: true,
+		hint:       "ask a cluster admin for a Role granting get and list on pods in the namespace",
+	},
+	{
+		verb:        "create",
+		resource:    "pods",
+		subresource: "portforward",
+		namespaced:  true,
+		hint:        "ask a cluster admin for a Role granting create on pods/portforward, e.g. kubectl create role port-forward --verb=create --resource=pods/portforward",
+	},
+}
+
+// Preflight checks that the cluster is reachable and that the current user may list services
+// and port-forward to pods in namespace, all namespaces if empty
+func (m *service) Preflight(ctx context.Context, namespace string) []CheckResult {
+	if m.client == nil {
+		return []CheckResult{{Name: "Kubernetes client", Status: CheckFail, Detail: "kubernetes client not available"}}
+	}
+
+	version, err := m.client.ServerVersion(ctx)
+	if err != nil {
+		return []CheckResult{{
+			Name:   "Cluster reachable",
+			Status: CheckFail,
+			Detail: err.Error(),
+			Hint:   "check the server address and credentials of the kubeconfig context, e.g. with kubectl cluster-info",
+		}}
+	}
+
+	results := []CheckResult{{Name: "Cluster reachable", Status: CheckPass, Detail: "Kubernetes " + version}}
+
+	for _, check := range accessChecks {
+		ns := ""
+		if check.namespaced {
+			ns = namespace
+		}
+		results = append(results, m.checkAccess(ctx, ns, check))
+	}
+
+	return results
+}
+
+// checkAccess runs a SelfSubjectAccessReview for a permission
+func (m *service) checkAccess(ctx context.Context, namespace string, check accessCheck) CheckResult {
+	resource := check.resource
+	if check.subresource != "" {
+		resource += "/" + check.subresource
+	}
+
+	scope := "all namespaces"
+	if namespace != "" {
+		scope = "namespace " + namespace
+	}
+
+	result := CheckResult{Name: fmt.Sprintf("%s %s (%s)", check.verb, resource, scope)}
+
+	allowed, reason, err := m.client.CanI(ctx, namespace, check.verb, check.resource, check.subresource)
+	switch {
+	case err != nil:
+		result.Status = CheckWarn
+		result.Detail = fmt.Sprintf("could not check access: %v", err)
+		result.Hint = "the cluster may not allow SelfSubjectAccessReviews, exposing may still work"
+	case allowed:
+		result.Status = CheckPass
+		result.Detail = "allowed"
+	default:
+		result.Status = CheckFail
+		result.Detail = "denied"
+		if reason != "" {
+			result.Detail += ": " + reason
+		}
+		result.Hint = check.hint
+	}
+
+	return result
+}
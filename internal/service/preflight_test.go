@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	mockClient := &mockK8sClient{denied: map[string]string{"create pods/portforward": "no RBAC policy matched"}}
+	svc := NewService(mockClient, &mockNgrokClient{})
+
+	results := svc.Preflight(context.Background(), "staging")
+
+	expected := []struct {
+		name   string
+		status CheckStatus
+	}{
+		{"Cluster reachable", CheckPass},
+		{"list services (all namespaces)", CheckPass},
+		{"get pods (namespace staging)", CheckPass},
+		{"create pods/portforward (namespace staging)", CheckFail},
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), results)
+	}
+
+	for i, e := range expected {
+		if results[i].Name != e.name || results[i].Status != e.status {
+			t.Errorf("Result %d: expected %s %s, got %s %s", i, e.name, e.status, results[i].Name, results[i].Status)
+		}
+	}
+
+	if failed := results[3]; failed.Detail != "denied: no RBAC policy matched" || failed.Hint == "" {
+		t.Errorf("Failed check should explain the denial and how to fix it, got %+v", failed)
+	}
+}
+
+func TestPreflightUnreachable(t *testing.T) {
+	svc := NewService(&mockK8sClient{err: fmt.Errorf("connection refused")}, &mockNgrokClient{})
+
+	results := svc.Preflight(context.Background(), "default")
+	if len(results) != 1 || results[0].Status != CheckFail || results[0].Hint == "" {
+		t.Errorf("Expected a single failed reachability check, got %+v", results)
+	}
+}
@@ -2,33 +2,91 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/health"
+	"github.com/Goalt/service-exporter/internal/policy"
+	"github.com/Goalt/service-exporter/internal/proxy"
 )
 
+// reconnectDelay is the pause between attempts to re-establish a broken port forwarding
+const reconnectDelay = 2 * time.Second
+
+// maxRecentErrors is the number of recent errors kept per exposure
+const maxRecentErrors = 5
+
+// portAttempts is the number of local ports tried when the chosen one is taken before the port forwarding binds it
+const portAttempts = 5
+
+// exposure holds the runtime state of a forwarded and tunneled service port
+type exposure struct {
+	service     string
+	servicePort int32
+	localPort   int
+	podName     string
+	publicURL   string
+	forwarding  ForwardState
+	tunnelUp    bool
+	errors      []string
+	startedAt   time.Time
+
+	expiresAt   time.Time
+	idleTimeout time.Duration
+	warnBefore  time.Duration
+	warning     string
+
+	health      HealthState
+	healthError string
+
+	// tunnel configures the ngrok tunnel to tunnelPort, the local proxy's port for http tunnels
+	tunnel         TunnelOptions
+	tunnelPort     int
+	policyWarnings []string
+	// env is the env file the exposure writes its details to, nil if none
+	env *envWrite
+
+	proxy  *proxy.Proxy
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
 // service implements the Service interface for Kubernetes service operations
 type service struct {
-	activeService  string
-	activePort     int
-	activeNgrokURL string
+	mu        sync.Mutex
+	exposures map[int]*exposure
+	// reserved are the local ports chosen by port forwardings being started
+	reserved map[int]bool
 
 	client      K8s
 	ngrokClient NgrokClient
+	policy      policy.Policy
+	auditLog    AuditLog
+	events      eventBus
+	// envMu serializes the updates of env files, exposures may share one
+	envMu sync.Mutex
 }
 
 // NewService creates a new service instance
 func NewService(client K8s, ngrokClient NgrokClient) *service {
 	return &service{
+		exposures:   make(map[int]*exposure),
+		reserved:    make(map[int]bool),
 		client:      client,
 		ngrokClient: ngrokClient,
 	}
 }
 
 // GetServices returns a list of Kubernetes services from the cluster
-func (m *service) GetServices(ctx context.Context) ([]string, error) {
+func (m *service) GetServices(ctx context.Context) ([]ServiceInfo, error) {
 	if m.client == nil {
 		return nil, fmt.Errorf("kubernetes client not available")
 	}
@@ -36,6 +94,15 @@ func (m *service) GetServices(ctx context.Context) ([]string, error) {
 	return m.client.ListServices(ctx)
 }
 
+// WatchServices calls onChange with the Kubernetes services as they are listed and whenever they change
+func (m *service) WatchServices(ctx context.Context, onChange func(services []ServiceInfo, synced bool)) error {
+	if m.client == nil {
+		return fmt.Errorf("kubernetes client not available")
+	}
+
+	return m.client.WatchServices(ctx, onChange)
+}
+
 // GetServicePorts returns available ports for a specific service
 func (m *service) GetServicePorts(ctx context.Context, serviceName string) ([]ServicePort, error) {
 	if m.client == nil {
@@ -43,7 +110,7 @@ func (m *service) GetServicePorts(ctx context.Context, serviceName string) ([]Se
 	}
 
 	// Parse service name to extract service name and namespace
-	actualServiceName, namespace, err := m.parseServiceName(serviceName)
+	actualServiceName, namespace, err := ParseServiceName(serviceName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse service name: %w", err)
 	}
@@ -51,7 +118,8 @@ func (m *service) GetServicePorts(ctx context.Context, serviceName string) ([]Se
 	return m.client.GetServicePorts(ctx, actualServiceName, namespace)
 }
 
-// StartPortForwarding starts real port forwarding for a service and specific port
+// StartPortForwarding starts real port forwarding for a service and specific port, the exposure is stopped
+// once ctx is cancelled
 func (m *service) StartPortForwarding(ctx context.Context, serviceName string, servicePort int32) (int, error) {
 	if m.client == nil {
 		return 0, fmt.Errorf("kubernetes client not available")
@@ -59,35 +127,97 @@ func (m *service) StartPortForwarding(ctx context.Context, serviceName string, s
 
 	// Parse service name to extract service name and namespace
 	// Format: "service-name (ns: namespace)"
-	actualServiceName, namespace, err := m.parseServiceName(serviceName)
+	actualServiceName, namespace, err := ParseServiceName(serviceName)
 	if err != nil {
 		return 0, fmt.Errorf("failed to parse service name: %w", err)
 	}
 
-	// Find an available local port
-	localPort, err := m.findAvailablePort()
+	forwardCtx, cancel := context.WithCancel(ctx)
+	localPort, session, err := m.forward(forwardCtx, actualServiceName, namespace, servicePort)
 	if err != nil {
-		return 0, fmt.Errorf("failed to find available port: %w", err)
+		cancel()
+		return 0, err
 	}
 
-	// Start port forwarding using the Kubernetes client
-	log.Printf("🔄 Starting port forwarding for service '%s' in namespace '%s' on local port %d (service port %d)...\n", actualServiceName, namespace, localPort, servicePort)
-
-	err = m.client.PortForward(ctx, actualServiceName, namespace, localPort, servicePort)
-	if err != nil {
-		return 0, fmt.Errorf("failed to start port forwarding: %w", err)
+	// Store the active session info
+	e := &exposure{
+		service:     serviceName,
+		servicePort: servicePort,
+		localPort:   localPort,
+		podName:     session.PodName,
+		forwarding:  ForwardActive,
+		startedAt:   time.Now(),
+		ctx:         forwardCtx,
+		cancel:      cancel,
 	}
 
-	// Store the active session info
-	m.activeService = serviceName
-	m.activePort = localPort
+	m.mu.Lock()
+	m.exposures[localPort] = e
+	delete(m.reserved, localPort)
+	m.mu.Unlock()
+	m.publishEvent(e, EventPortForwardReady, "")
+
+	go m.keepForwarding(e, actualServiceName, namespace, session)
 
 	return localPort, nil
 }
 
-// parseServiceName extracts service name and namespace from the formatted string
+// keepForwarding re-establishes the port forwarding of an exposure whenever it breaks,
+// for example because the pod was restarted, until the exposure is stopped
+func (m *service) keepForwarding(e *exposure, serviceName string, namespace string, session PortForwardSession) {
+	for {
+		var err error
+		select {
+		case <-e.ctx.Done():
+			m.release(e, "context cancelled")
+			return
+		case err = <-session.Done:
+		}
+
+		if e.ctx.Err() != nil {
+			m.release(e, "context cancelled")
+			return
+		}
+
+		if err == nil {
+			err = fmt.Errorf("connection closed")
+		}
+		previousPod := session.PodName
+		lost := fmt.Errorf("port forwarding to pod %s stopped: %w", session.PodName, err)
+		slog.Warn(fmt.Sprintf("⚠️  Port forwarding for '%s' lost, reconnecting", e.service), "error", lost)
+		m.recordError(e, lost)
+		m.setForwarding(e, ForwardReconnecting, "")
+		m.publishEvent(e, EventPortForwardLost, lost.Error())
+
+		for {
+			select {
+			case <-e.ctx.Done():
+				m.release(e, "context cancelled")
+				return
+			case <-time.After(reconnectDelay):
+			}
+
+			session, err = m.client.PortForward(e.ctx, serviceName, namespace, e.localPort, e.servicePort)
+			if err == nil {
+				break
+			}
+			slog.Warn(fmt.Sprintf("⚠️  Failed to re-establish port forwarding for '%s', retrying", e.service), "error", err)
+			m.recordError(e, fmt.Errorf("failed to re-establish port forwarding: %w", err))
+		}
+
+		log.Printf("🔁 Port forwarding for '%s' re-established to pod %s\n", e.service, session.PodName)
+		m.setForwarding(e, ForwardActive, session.PodName)
+		m.publishEvent(e, EventPortForwardReady, "")
+
+		if session.PodName != previousPod {
+			m.publishEvent(e, EventPodSwitched, lost.Error())
+		}
+	}
+}
+
+// ParseServiceName extracts service name and namespace from the formatted string
 // Input format: "service-name (ns: namespace)"
-func (m *service) parseServiceName(serviceName string) (string, string, error) {
+func ParseServiceName(serviceName string) (string, string, error) {
 	// Find the namespace part
 	nsIndex := strings.Index(serviceName, " (ns: ")
 	if nsIndex == -1 {
@@ -107,10 +237,55 @@ func (m *service) parseServiceName(serviceName string) (string, string, error) {
 	return actualServiceName, namespace, nil
 }
 
-// findAvailablePort finds an available local port in the range 8000-9000
+// forward starts the port forwarding of a service port on a free local port, reserved until the caller
+// registers the exposure. Another port is tried when the chosen one is taken before the port forwarding binds it
+func (m *service) forward(ctx context.Context, serviceName string, namespace string, servicePort int32) (int, PortForwardSession, error) {
+	// Taken ports stay reserved until another one is found, so that they are not chosen again
+	var taken []int
+	defer func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for _, port := range taken {
+			delete(m.reserved, port)
+		}
+	}()
+
+	var err error
+	for attempt := 0; attempt < portAttempts; attempt++ {
+		localPort, findErr := m.findAvailablePort()
+		if findErr != nil {
+			return 0, PortForwardSession{}, fmt.Errorf("failed to find available port: %w", findErr)
+		}
+		taken = append(taken, localPort)
+
+		log.Printf("🔄 Starting port forwarding for service '%s' in namespace '%s' on local port %d (service port %d)...\n", serviceName, namespace, localPort, servicePort)
+
+		var session PortForwardSession
+		if session, err = m.client.PortForward(ctx, serviceName, namespace, localPort, servicePort); err == nil {
+			taken = taken[:len(taken)-1]
+			return localPort, session, nil
+		}
+		if !errors.Is(err, ErrPortInUse) {
+			break
+		}
+		slog.Warn(fmt.Sprintf("⚠️  Local port %d was taken, trying another one", localPort), "error", err)
+	}
+
+	return 0, PortForwardSession{}, fmt.Errorf("failed to start port forwarding: %w", err)
+}
+
+// findAvailablePort finds and reserves an available local port in the range 8000-9000,
+// skipping the ports of the exposures and the ones reserved by port forwardings being started
 func (m *service) findAvailablePort() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for port := 8000; port <= 9000; port++ {
+		if _, exposed := m.exposures[port]; exposed || m.reserved[port] {
+			continue
+		}
 		if m.isPortAvailable(port) {
+			m.reserved[port] = true
 			return port, nil
 		}
 	}
@@ -131,34 +306,679 @@ func (m *service) isPortAvailable(port int) bool {
 
 // CreateNgrokSession creates an ngrok session for the forwarded port
 func (m *service) CreateNgrokSession(ctx context.Context, port int) (string, error) {
+	return m.createNgrokSession(ctx, port, proxy.Options{}, TunnelOptions{Type: TunnelHTTP})
+}
+
+// createNgrokSession creates an ngrok session configured by tunnel for the forwarded port,
+// through a local proxy configured by opts for http tunnels
+func (m *service) createNgrokSession(ctx context.Context, port int, opts proxy.Options, tunnel TunnelOptions) (string, error) {
 	log.Printf("🌐 Creating ngrok tunnel for port %d...\n", port)
 
-	ngrokURL, err := m.ngrokClient.StartTunnel(ctx, port)
+	m.mu.Lock()
+	e, ok := m.exposures[port]
+	if !ok {
+		// The port is not forwarded by us, tunnel it as is
+		exposureCtx, cancel := context.WithCancel(ctx)
+		e = &exposure{
+			localPort:  port,
+			forwarding: ForwardNone,
+			startedAt:  time.Now(),
+			ctx:        exposureCtx,
+			cancel:     cancel,
+		}
+		m.exposures[port] = e
+	}
+	e.tunnel = tunnel
+	e.tunnelPort = port
+	m.mu.Unlock()
+
+	// TCP tunnels carry any protocol, only HTTP traffic goes through the local proxy
+	var p *proxy.Proxy
+	if tunnel.Type != TunnelTCP {
+		opts.OnError = func(err error) { m.recordError(e, err) }
+		var err error
+		p, err = proxy.New(port, opts)
+		if err != nil {
+			return "", fmt.Errorf("failed to start local proxy: %w", err)
+		}
+	}
+
+	m.mu.Lock()
+	e.proxy = p
+	if p != nil {
+		e.tunnelPort = p.Port()
+	}
+	m.mu.Unlock()
+
+	ngrokURL, err := m.startTunnel(e)
 	if err != nil {
-		return "", fmt.Errorf("failed to start ngrok tunnel: %w", err)
+		if p != nil {
+			p.Close()
+		}
+		return "", err
 	}
 
 	// Store the active ngrok URL
-	m.activeNgrokURL = ngrokURL
+	m.mu.Lock()
+	if m.exposures[port] != e {
+		m.mu.Unlock()
+		// The exposure was stopped while its tunnel started, stop knew no tunnel and maybe no proxy
+		if err := m.ngrokClient.CloseTunnel(ngrokURL); err != nil {
+			slog.Error("Error closing ngrok tunnel", "error", err)
+		}
+		if p != nil {
+			p.Close()
+		}
+		return "", fmt.Errorf("exposure on local port %d was stopped while its tunnel started", port)
+	}
+	e.publicURL = ngrokURL
+	e.tunnelUp = true
+	m.mu.Unlock()
+	m.publishEvent(e, EventTunnelUp, "")
+
+	return ngrokURL, nil
+}
+
+// startTunnel starts the ngrok tunnel of the exposure
+func (m *service) startTunnel(e *exposure) (string, error) {
+	m.mu.Lock()
+	opts := e.tunnel
+	port := e.tunnelPort
+	m.mu.Unlock()
+
+	// Reconnections of an established tunnel are published, the start and restarts are by their callers
+	opts.OnStatus = func(up bool) {
+		m.mu.Lock()
+		changed := e.tunnelUp != up && e.publicURL != ""
+		e.tunnelUp = up
+		m.mu.Unlock()
+
+		switch {
+		case changed && up:
+			m.publishEvent(e, EventTunnelUp, "ngrok session reconnected")
+		case changed:
+			slog.Warn(fmt.Sprintf("⚠️  ngrok session of %s on local port %d disconnected, reconnecting", e.name(), e.localPort))
+			m.publishEvent(e, EventTunnelDown, "ngrok session disconnected")
+		}
+	}
+
+	ngrokURL, err := m.ngrokClient.StartTunnel(e.ctx, port, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to start ngrok tunnel: %w", err)
+	}
+
+	return ngrokURL, nil
+}
+
+// Expose starts port forwarding and an ngrok tunnel for a service port
+func (m *service) Expose(ctx context.Context, req ExposeRequest) (ExposureStatus, error) {
+	if m.client == nil {
+		return ExposureStatus{}, fmt.Errorf("kubernetes client not available")
+	}
+
+	name, namespace, err := ParseServiceName(req.Service)
+	if err != nil {
+		return ExposureStatus{}, fmt.Errorf("failed to parse service name: %w", err)
+	}
+
+	info, err := m.client.GetService(ctx, name, namespace)
+	if err != nil {
+		return ExposureStatus{}, err
+	}
+
+	req, err = m.applyDefaults(ctx, info, req)
+	if err != nil {
+		return ExposureStatus{}, err
+	}
+
+	warnings, err := m.checkPolicy(info, req)
+	if err != nil {
+		return ExposureStatus{}, err
+	}
+
+	var env *envWrite
+	if req.EnvFile.Path != "" {
+		if env, err = newEnvWrite(req.EnvFile, req.Service); err != nil {
+			return ExposureStatus{}, err
+		}
+	}
+
+	// The exposure outlives ctx, which only bounds its start
+	port, err := m.StartPortForwarding(context.WithoutCancel(ctx), req.Service, req.Port.Port)
+	if err != nil {
+		return ExposureStatus{}, err
+	}
+	if err := m.startCancelled(ctx, port); err != nil {
+		return ExposureStatus{}, err
+	}
+
+	// Cancelling ctx before the exposure is ready stops it, which aborts the tunnel connection
+	stopOnCancel := context.AfterFunc(ctx, func() { m.stopExposure(port, "start cancelled") })
+	if _, err := m.createNgrokSession(ctx, port, proxy.Options{
+		Rules:        req.Rules,
+		Limits:       req.Limits,
+		FallbackPage: req.FallbackPage,
+	}, TunnelOptions{
+		Type:          req.TunnelType,
+		Auth:          req.Auth,
+		Domain:        req.Domain,
+		TrafficPolicy: req.TrafficPolicy,
+	}); err != nil {
+		if !stopOnCancel() {
+			return ExposureStatus{}, fmt.Errorf("exposure start cancelled: %w", ctx.Err())
+		}
+		m.stopExposure(port, err.Error())
+		return ExposureStatus{}, err
+	}
+	if !stopOnCancel() {
+		return ExposureStatus{}, fmt.Errorf("exposure start cancelled: %w", ctx.Err())
+	}
+
+	m.mu.Lock()
+	e := m.exposures[port]
+	e.policyWarnings = warnings
+	if req.TTL > 0 {
+		e.expiresAt = e.startedAt.Add(req.TTL)
+	}
+	e.idleTimeout = req.IdleTimeout
+	e.warnBefore = req.WarnBefore
+	if req.HealthCheck.Enabled() {
+		e.health = HealthUnknown
+	}
+	e.env = env
+	m.mu.Unlock()
+
+	// The env file is written by the time the exposure is ready
+	if env != nil {
+		if err := m.writeEnv(e); err != nil {
+			m.stopExposure(port, err.Error())
+			return ExposureStatus{}, err
+		}
+	}
+
+	m.mu.Lock()
+	event := e.event(EventReady, "")
+	m.mu.Unlock()
+
+	// Exposures that cannot be audited are not kept running
+	if err := m.publish(event); err != nil {
+		m.stopExposure(port, err.Error())
+		return ExposureStatus{}, err
+	}
+
+	// Expiry and health events follow the ready event
+	if req.TTL > 0 || req.IdleTimeout > 0 {
+		go m.watchExpiry(e)
+	}
+	if req.HealthCheck.Enabled() {
+		go health.Watch(e.ctx, req.HealthCheck, port, func(healthy bool, err error) {
+			m.setHealth(e, healthy, err)
+		})
+	}
+
+	return event.Exposure, nil
+}
+
+// startCancelled stops the exposure on the given local port and returns an error if ctx, bounding its start,
+// is cancelled
+func (m *service) startCancelled(ctx context.Context, port int) error {
+	if err := ctx.Err(); err != nil {
+		m.stopExposure(port, "start cancelled")
+		return fmt.Errorf("exposure start cancelled: %w", err)
+	}
+	return nil
+}
+
+// setHealth records the result of the exposure's health check and serves the fallback page while unhealthy
+func (m *service) setHealth(e *exposure, healthy bool, err error) {
+	m.mu.Lock()
+	e.health = HealthHealthy
+	e.healthError = ""
+	if !healthy {
+		e.health = HealthUnhealthy
+		e.healthError = err.Error()
+	}
+	p := e.proxy
+	event := e.event(EventHealthChanged, e.healthError)
+	m.mu.Unlock()
+
+	if p != nil {
+		p.SetHealthy(healthy)
+	}
+	m.publish(event)
+
+	if healthy {
+		log.Printf("💚 %s on local port %d is healthy\n", e.name(), e.localPort)
+	} else {
+		slog.Warn(fmt.Sprintf("💔 %s on local port %d is unhealthy, serving the fallback page", e.name(), e.localPort), "error", err)
+	}
+}
+
+// watchExpiry stops the exposure once its TTL or idle timeout is reached, warning before if asked to
+func (m *service) watchExpiry(e *exposure) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		reason, wait := m.checkExpiry(e, time.Now())
+		if reason != "" {
+			log.Printf("⏰ Stopping exposure of %s on local port %d: %s\n", e.name(), e.localPort, reason)
+			m.publishEvent(e, EventExpired, reason)
+			if err := m.stopExposure(e.localPort, reason); err != nil {
+				slog.Error("Error stopping expired exposure", "error", err)
+			}
+			return
+		}
+
+		timer.Reset(wait)
+	}
+}
+
+// checkExpiry returns why the exposure must be stopped at now, or how long to wait before checking again,
+// and updates the exposure's warning
+func (m *service) checkExpiry(e *exposure, now time.Time) (string, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// deadlines are checked in order, the first one reached stops the exposure
+	type deadline struct {
+		at     time.Time
+		limit  string
+		reason string
+	}
+	var deadlines []deadline
+	if !e.expiresAt.IsZero() {
+		ttl := e.expiresAt.Sub(e.startedAt)
+		deadlines = append(deadlines, deadline{e.expiresAt, fmt.Sprintf("time-to-live of %s", ttl), fmt.Sprintf("time-to-live of %s reached", ttl)})
+	}
+	if idleAt := e.idleExpiresAt(); !idleAt.IsZero() {
+		deadlines = append(deadlines, deadline{idleAt, fmt.Sprintf("idle timeout of %s", e.idleTimeout), fmt.Sprintf("no traffic for %s", e.idleTimeout)})
+	}
+
+	wait := time.Duration(-1)
+	warning := ""
+	for _, d := range deadlines {
+		if !now.Before(d.at) {
+			return d.reason, 0
+		}
+
+		next := d.at
+		if e.warnBefore > 0 {
+			if warnAt := d.at.Add(-e.warnBefore); !now.Before(warnAt) {
+				if warning == "" {
+					warning = fmt.Sprintf("stops at %s, %s", d.at.Format(time.TimeOnly), d.limit)
+				}
+			} else {
+				next = warnAt
+			}
+		}
+
+		if wait < 0 || next.Sub(now) < wait {
+			wait = next.Sub(now)
+		}
+	}
+
+	if warning != e.warning {
+		e.warning = warning
+		if warning != "" {
+			slog.Warn(fmt.Sprintf("⚠️  Exposure of %s on local port %d %s", e.name(), e.localPort, warning))
+		}
+	}
+
+	return "", wait
+}
+
+// Exposures returns a snapshot of all active exposures ordered by local port
+func (m *service) Exposures() []ExposureStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]ExposureStatus, 0, len(m.exposures))
+	for _, e := range m.exposures {
+		statuses = append(statuses, e.status())
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].LocalPort < statuses[j].LocalPort
+	})
+
+	return statuses
+}
+
+// StopExposure stops the port forwarding and tunnel of the exposure on the given local port
+func (m *service) StopExposure(localPort int) error {
+	return m.stopExposure(localPort, "stopped manually")
+}
+
+// stopExposure stops the exposure on the given local port, recording reason in the audit log
+func (m *service) stopExposure(localPort int, reason string) error {
+	m.mu.Lock()
+	e, ok := m.exposures[localPort]
+	delete(m.exposures, localPort)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no active exposure on local port %d", localPort)
+	}
+
+	m.stop(e, reason)
+	return nil
+}
+
+// release stops an exposure whose context ended while it is still registered, like a port forwarding
+// started with a context that was since cancelled. Exposures stopped by stopExposure are left alone
+func (m *service) release(e *exposure, reason string) {
+	m.mu.Lock()
+	registered := m.exposures[e.localPort] == e
+	if registered {
+		delete(m.exposures, e.localPort)
+	}
+	m.mu.Unlock()
+
+	if registered {
+		m.stop(e, reason)
+	}
+}
+
+// stop tears down the tunnel, proxy and port forwarding of an exposure and publishes why
+func (m *service) stop(e *exposure, reason string) {
+	m.mu.Lock()
+	event := e.event(EventStopped, reason)
+	publicURL, p := e.publicURL, e.proxy
+	m.mu.Unlock()
+
+	if publicURL != "" {
+		log.Printf("🔌 Closing ngrok tunnel: %s\n", publicURL)
+		if err := m.ngrokClient.CloseTunnel(publicURL); err != nil {
+			slog.Error("Error closing ngrok tunnel", "error", err)
+		}
+	}
+
+	if p != nil {
+		if err := p.Close(); err != nil {
+			slog.Error("Error closing local proxy", "error", err)
+		}
+	}
+
+	e.cancel()
+
+	if err := m.restoreEnv(e); err != nil {
+		slog.Warn("⚠️  Failed to restore env file", "error", err)
+	}
+
+	event.Time = time.Now()
+	m.publish(event)
+}
+
+// Requests returns the requests recorded for the exposure on the given local port, oldest first
+func (m *service) Requests(localPort int) ([]proxy.Exchange, error) {
+	inspector, err := m.inspector(localPort)
+	if err != nil {
+		return nil, err
+	}
+
+	return inspector.Exchanges(), nil
+}
+
+// Request returns a single recorded request of the exposure on the given local port
+func (m *service) Request(localPort int, id int64) (proxy.Exchange, error) {
+	inspector, err := m.inspector(localPort)
+	if err != nil {
+		return proxy.Exchange{}, err
+	}
+
+	exchange, ok := inspector.Exchange(id)
+	if !ok {
+		return proxy.Exchange{}, fmt.Errorf("request %d not found for local port %d", id, localPort)
+	}
+
+	return exchange, nil
+}
+
+// Replay sends a recorded request of the exposure on the given local port, modified by opts,
+// again to the forwarded port and compares the new response with the original one
+func (m *service) Replay(ctx context.Context, localPort int, id int64, opts proxy.ReplayOptions) (proxy.ReplayResult, error) {
+	original, err := m.Request(localPort, id)
+	if err != nil {
+		return proxy.ReplayResult{}, err
+	}
+
+	p, err := m.exposureProxy(localPort)
+	if err != nil {
+		return proxy.ReplayResult{}, err
+	}
+
+	log.Printf("🔁 Replaying request %d (%s %s) on local port %d...\n", id, original.Method, original.URL, localPort)
+
+	return p.Replay(ctx, original, opts)
+}
+
+// inspector returns the request inspector of the exposure on the given local port
+func (m *service) inspector(localPort int) (*proxy.Inspector, error) {
+	p, err := m.exposureProxy(localPort)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Inspector(), nil
+}
+
+// exposureProxy returns the local proxy of the exposure on the given local port
+func (m *service) exposureProxy(localPort int) (*proxy.Proxy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.exposures[localPort]
+	if !ok || e.proxy == nil {
+		return nil, fmt.Errorf("no active tunnel for local port %d", localPort)
+	}
+
+	return e.proxy, nil
+}
+
+// RestartTunnel recreates the ngrok tunnel of the exposure on the given local port
+func (m *service) RestartTunnel(ctx context.Context, localPort int) (string, error) {
+	m.mu.Lock()
+	e, ok := m.exposures[localPort]
+	if !ok || e.tunnelPort == 0 {
+		m.mu.Unlock()
+		return "", fmt.Errorf("no active tunnel for local port %d", localPort)
+	}
+	oldURL := e.publicURL
+	e.publicURL = ""
+	e.tunnelUp = false
+	m.mu.Unlock()
+	m.publishEvent(e, EventTunnelDown, "restarting the tunnel")
+
+	log.Printf("🔁 Restarting ngrok tunnel for port %d...\n", localPort)
+
+	if oldURL != "" {
+		if err := m.ngrokClient.CloseTunnel(oldURL); err != nil {
+			slog.Warn("⚠️  Failed to close ngrok tunnel", "error", err)
+			m.recordError(e, fmt.Errorf("failed to close ngrok tunnel: %w", err))
+		}
+	}
+
+	ngrokURL, err := m.startTunnel(e)
+	if err != nil {
+		m.recordError(e, err)
+		return "", err
+	}
+
+	m.mu.Lock()
+	if m.exposures[localPort] != e {
+		m.mu.Unlock()
+		// The exposure was stopped while its tunnel restarted, stop only knew the old tunnel
+		if err := m.ngrokClient.CloseTunnel(ngrokURL); err != nil {
+			slog.Error("Error closing ngrok tunnel", "error", err)
+		}
+		return "", fmt.Errorf("exposure on local port %d was stopped while its tunnel restarted", localPort)
+	}
+	e.publicURL = ngrokURL
+	e.tunnelUp = true
+	event := e.event(EventTunnelUp, "")
+	event.PreviousURL = oldURL
+	m.mu.Unlock()
+
+	if err := m.writeEnv(e); err != nil {
+		m.recordError(e, err)
+	}
+	m.publish(event)
 
 	return ngrokURL, nil
 }
 
+// writeEnv writes the public URL and local port of the exposure to its env file, if any
+func (m *service) writeEnv(e *exposure) error {
+	m.mu.Lock()
+	env, publicURL, localPort := e.env, e.publicURL, e.localPort
+	m.mu.Unlock()
+	if env == nil {
+		return nil
+	}
+
+	m.envMu.Lock()
+	defer m.envMu.Unlock()
+	if err := env.write(publicURL, localPort); err != nil {
+		return err
+	}
+	log.Printf("📝 Wrote %s to %s\n", env.vars[0], env.path)
+	return nil
+}
+
+// restoreEnv restores the variables of the exposure's env file, if any
+func (m *service) restoreEnv(e *exposure) error {
+	m.mu.Lock()
+	env := e.env
+	m.mu.Unlock()
+	if env == nil {
+		return nil
+	}
+
+	m.envMu.Lock()
+	defer m.envMu.Unlock()
+	return env.restore()
+}
+
+// recordError keeps the error in the exposure's list of recent errors
+func (m *service) recordError(e *exposure, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := fmt.Sprintf("%s %v", time.Now().Format(time.TimeOnly), err)
+	e.errors = append(e.errors, entry)
+	if len(e.errors) > maxRecentErrors {
+		e.errors = e.errors[len(e.errors)-maxRecentErrors:]
+	}
+}
+
+// setForwarding updates the port forwarding state and, if known, the pod name
+func (m *service) setForwarding(e *exposure, state ForwardState, podName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.forwarding = state
+	if podName != "" {
+		e.podName = podName
+	}
+}
+
+// publishEvent publishes an event of the exposure, failing to audit it is only logged
+func (m *service) publishEvent(e *exposure, eventType EventType, reason string) {
+	m.mu.Lock()
+	event := e.event(eventType, reason)
+	m.mu.Unlock()
+
+	m.publish(event)
+}
+
+// name returns the exposed service name, or the local port for bare tunnels
+func (e *exposure) name() string {
+	if e.service == "" {
+		return fmt.Sprintf("port %d", e.localPort)
+	}
+	return e.service
+}
+
+// idleExpiresAt returns when the exposure becomes idle for too long, zero without idle timeout;
+// the caller must hold the service lock
+func (e *exposure) idleExpiresAt() time.Time {
+	if e.idleTimeout <= 0 {
+		return time.Time{}
+	}
+
+	lastActivity := e.startedAt
+	if e.proxy != nil {
+		if last := e.proxy.Stats().LastRequest; last.After(lastActivity) {
+			lastActivity = last
+		}
+	}
+
+	return lastActivity.Add(e.idleTimeout)
+}
+
+// status returns a snapshot of the exposure, the caller must hold the service lock
+func (e *exposure) status() ExposureStatus {
+	s := ExposureStatus{
+		Service:     e.service,
+		ServicePort: e.servicePort,
+		LocalPort:   e.localPort,
+		PodName:     e.podName,
+		PublicURL:   e.publicURL,
+		TunnelType:  e.tunnel.Type,
+		Auth:        e.tunnel.Auth.String(),
+		Forwarding:  e.forwarding,
+		TunnelUp:    e.tunnelUp,
+		Errors:      append([]string(nil), e.errors...),
+		StartedAt:   e.startedAt,
+
+		ExpiresAt:     e.expiresAt,
+		IdleExpiresAt: e.idleExpiresAt(),
+		Warning:       e.warning,
+		Health:        e.health,
+		HealthError:   e.healthError,
+
+		PolicyWarnings: append([]string(nil), e.policyWarnings...),
+	}
+
+	if e.proxy != nil {
+		stats := e.proxy.Stats()
+		s.Requests = stats.Requests
+		s.BytesIn = stats.BytesIn
+		s.BytesOut = stats.BytesOut
+		s.Failures = stats.Failures
+		s.Rejected = stats.Rejected
+	}
+
+	return s
+}
+
 // Cleanup performs graceful shutdown of all active sessions
 func (m *service) Cleanup() error {
 	log.Println("\n🔄 Performing graceful shutdown...")
 
-	if m.activeNgrokURL != "" {
-		log.Printf("🔌 Closing ngrok tunnel: %s\n", m.activeNgrokURL)
-		if err := m.ngrokClient.Close(); err != nil {
-			log.Printf("Error closing ngrok client: %v\n", err)
-		}
+	m.mu.Lock()
+	exposures := m.exposures
+	m.exposures = make(map[int]*exposure)
+	m.mu.Unlock()
+
+	for _, e := range exposures {
+		m.stop(e, "shutdown")
 	}
+	m.events.close()
 
-	// Reset active session state
-	m.activeService = ""
-	m.activePort = 0
-	m.activeNgrokURL = ""
+	if err := m.ngrokClient.Close(); err != nil {
+		slog.Error("Error closing ngrok client", "error", err)
+	}
+	if m.client != nil {
+		m.client.Close()
+	}
 
 	log.Println("✅ Graceful shutdown completed")
 	return nil
@@ -3,22 +3,53 @@ package service
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/Goalt/service-exporter/internal/health"
+	"github.com/Goalt/service-exporter/internal/proxy"
 )
 
 // mockK8sClient implements the K8s interface for testing
 type mockK8sClient struct {
-	services []string
+	services []ServiceInfo
 	err      error
+	// denied maps "verb resource/subresource" to the reason CanI denies it
+	denied map[string]string
+	// labels are the labels of every service not in services
+	labels map[string]string
+	// secrets maps "namespace/name" to the data of a Secret
+	secrets map[string]map[string][]byte
+	// contextName is the name of the kubeconfig context
+	contextName string
+	// portsInUse are the local ports PortForward fails to bind
+	portsInUse map[int]bool
 }
 
-func (m *mockK8sClient) ListServices(ctx context.Context) ([]string, error) {
+func (m *mockK8sClient) ListServices(ctx context.Context) ([]ServiceInfo, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
 	return m.services, nil
 }
 
+func (m *mockK8sClient) WatchServices(ctx context.Context, onChange func(services []ServiceInfo, synced bool)) error {
+	services, err := m.ListServices(ctx)
+	if err != nil {
+		return err
+	}
+	onChange(services, true)
+	return nil
+}
+
+func (m *mockK8sClient) Close() {}
+
 func (m *mockK8sClient) GetServicePorts(ctx context.Context, serviceName string, namespace string) ([]ServicePort, error) {
 	if m.err != nil {
 		return nil, m.err
@@ -30,24 +61,77 @@ func (m *mockK8sClient) GetServicePorts(ctx context.Context, serviceName string,
 	}, nil
 }
 
-func (m *mockK8sClient) PortForward(ctx context.Context, serviceName string, namespace string, localPort int, servicePort int32) error {
+func (m *mockK8sClient) GetService(ctx context.Context, serviceName string, namespace string) (ServiceInfo, error) {
+	if m.err != nil {
+		return ServiceInfo{}, m.err
+	}
+	for _, info := range m.services {
+		if info.Name == serviceName && info.Namespace == namespace {
+			return info, nil
+		}
+	}
+	return ServiceInfo{Name: serviceName, Namespace: namespace, Labels: m.labels}, nil
+}
+
+func (m *mockK8sClient) GetSecret(ctx context.Context, namespace string, name string) (map[string][]byte, error) {
+	data, ok := m.secrets[namespace+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
+	}
+	return data, nil
+}
+
+func (m *mockK8sClient) ContextName() string {
+	return m.contextName
+}
+
+func (m *mockK8sClient) PortForward(ctx context.Context, serviceName string, namespace string, localPort int, servicePort int32) (PortForwardSession, error) {
 	// Mock implementation - just return the error if any
-	return m.err
+	if m.err != nil {
+		return PortForwardSession{}, m.err
+	}
+	if m.portsInUse[localPort] {
+		return PortForwardSession{}, fmt.Errorf("%w: %d", ErrPortInUse, localPort)
+	}
+	return PortForwardSession{PodName: serviceName + "-pod", Done: make(chan error)}, nil
+}
+
+func (m *mockK8sClient) ServerVersion(ctx context.Context) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	return "v1.34.0", nil
+}
+
+func (m *mockK8sClient) CanI(ctx context.Context, namespace string, verb string, resource string, subresource string) (bool, string, error) {
+	if m.denied == nil {
+		return true, "", nil
+	}
+	reason, denied := m.denied[verb+" "+resource+"/"+subresource]
+	return !denied, reason, nil
 }
 
 // mockNgrokClient implements a mock ngrok client for testing
 type mockNgrokClient struct {
 	startTunnelError error
 	closeError       error
+	lastPort         int
+	lastOpts         TunnelOptions
 }
 
-func (m *mockNgrokClient) StartTunnel(ctx context.Context, port int) (string, error) {
+func (m *mockNgrokClient) StartTunnel(ctx context.Context, port int, opts TunnelOptions) (string, error) {
 	if m.startTunnelError != nil {
 		return "", m.startTunnelError
 	}
+	m.lastPort = port
+	m.lastOpts = opts
 	return fmt.Sprintf("https://mock%d.ngrok.io", port), nil
 }
 
+func (m *mockNgrokClient) CloseTunnel(url string) error {
+	return m.closeError
+}
+
 func (m *mockNgrokClient) Close() error {
 	return m.closeError
 }
@@ -62,13 +146,13 @@ func TestNewMockService(t *testing.T) {
 }
 
 func TestGetServices(t *testing.T) {
-	expectedServices := []string{
-		"web-frontend",
-		"api-gateway",
-		"user-service",
-		"database-service",
-		"cache-service",
-		"notification-service",
+	expectedServices := []ServiceInfo{
+		{Name: "web-frontend", Namespace: "default"},
+		{Name: "api-gateway", Namespace: "default"},
+		{Name: "user-service", Namespace: "users"},
+		{Name: "database-service", Namespace: "data", OptOut: true},
+		{Name: "cache-service", Namespace: "data"},
+		{Name: "notification-service", Namespace: "default"},
 	}
 
 	mockClient := &mockK8sClient{
@@ -91,7 +175,7 @@ func TestGetServices(t *testing.T) {
 	}
 
 	for i, expected := range expectedServices {
-		if services[i] != expected {
+		if services[i].String() != expected.String() {
 			t.Errorf("Expected service %s at index %d, got %s", expected, i, services[i])
 		}
 	}
@@ -152,6 +236,51 @@ func TestStartPortForwarding(t *testing.T) {
 	}
 }
 
+func TestStartPortForwarding_PortTaken(t *testing.T) {
+	svc := NewService(&mockK8sClient{}, &mockNgrokClient{})
+	first, err := svc.StartPortForwarding(context.Background(), "api (ns: default)", 80)
+	if err != nil {
+		t.Fatalf("StartPortForwarding should not return an error: %v", err)
+	}
+
+	// The port of an exposure is not chosen again, nor the one taken between the check and the bind
+	svc.client = &mockK8sClient{portsInUse: map[int]bool{first + 1: true}}
+	second, err := svc.StartPortForwarding(context.Background(), "api (ns: default)", 443)
+	if err != nil {
+		t.Fatalf("StartPortForwarding should try another port: %v", err)
+	}
+	if second == first || second == first+1 {
+		t.Errorf("Expected a port other than %d and %d, got %d", first, first+1, second)
+	}
+	if len(svc.reserved) != 0 {
+		t.Errorf("Expected the reservations to be released, got %v", svc.reserved)
+	}
+}
+
+func TestStartPortForwarding_ContextCancelled(t *testing.T) {
+	svc := NewService(&mockK8sClient{}, &mockNgrokClient{})
+	events := svc.Subscribe(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := svc.StartPortForwarding(ctx, "api (ns: default)", 80); err != nil {
+		t.Fatalf("StartPortForwarding should not return an error: %v", err)
+	}
+	cancel()
+
+	// The exposure is stopped and its stop published, not left looking active
+	for event := range events {
+		if event.Type == EventStopped {
+			if event.Reason != "context cancelled" {
+				t.Errorf("Unexpected stop reason %q", event.Reason)
+			}
+			break
+		}
+	}
+	if exposures := svc.Exposures(); len(exposures) != 0 {
+		t.Errorf("Expected no exposures, got %+v", exposures)
+	}
+}
+
 func TestCreateNgrokSession(t *testing.T) {
 	mockClient := &mockK8sClient{}
 	mockNgrok := &mockNgrokClient{}
@@ -192,15 +321,415 @@ func TestCleanup(t *testing.T) {
 		t.Fatalf("Cleanup should not return an error: %v", err)
 	}
 	// Verify cleanup cleared the state
-	if svc.activeService != "" {
-		t.Error("activeService should be empty after cleanup")
+	if len(svc.exposures) != 0 {
+		t.Errorf("exposures should be empty after cleanup, got %d", len(svc.exposures))
+	}
+
+	if len(svc.Exposures()) != 0 {
+		t.Error("Exposures should return no exposures after cleanup")
+	}
+}
+
+func TestExpose(t *testing.T) {
+	mockClient := &mockK8sClient{}
+	mockNgrok := &mockNgrokClient{}
+	svc := NewService(mockClient, mockNgrok)
+	defer svc.Cleanup()
+
+	status, err := svc.Expose(context.Background(), ExposeRequest{
+		Service: "test-service (ns: default)",
+		Port:    ServicePort{Name: "http", Port: 80, TargetPort: 8080, Protocol: "TCP"},
+	})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+
+	if status.PodName != "test-service-pod" {
+		t.Errorf("Expected pod test-service-pod, got %s", status.PodName)
+	}
+
+	if status.Forwarding != ForwardActive || !status.TunnelUp {
+		t.Errorf("Expected active forwarding and tunnel, got %s (tunnel up: %v)", status.Forwarding, status.TunnelUp)
+	}
+
+	if status.PublicURL == "" {
+		t.Error("Expose should return a public URL")
+	}
+
+	exposures := svc.Exposures()
+	if len(exposures) != 1 || exposures[0].LocalPort != status.LocalPort {
+		t.Fatalf("Expected one exposure on port %d, got %+v", status.LocalPort, exposures)
+	}
+}
+
+func TestExposeTunnelError(t *testing.T) {
+	mockClient := &mockK8sClient{}
+	mockNgrok := &mockNgrokClient{startTunnelError: fmt.Errorf("tunnel failed")}
+	svc := NewService(mockClient, mockNgrok)
+
+	_, err := svc.Expose(context.Background(), ExposeRequest{
+		Service: "test-service (ns: default)",
+		Port:    ServicePort{Port: 80},
+	})
+	if err == nil {
+		t.Fatal("Expose should return an error when the tunnel cannot be created")
+	}
+
+	if len(svc.Exposures()) != 0 {
+		t.Error("A failed exposure should be torn down")
+	}
+}
+
+func TestStopExposure(t *testing.T) {
+	mockClient := &mockK8sClient{}
+	mockNgrok := &mockNgrokClient{}
+	svc := NewService(mockClient, mockNgrok)
+
+	status, err := svc.Expose(context.Background(), ExposeRequest{
+		Service: "test-service (ns: default)",
+		Port:    ServicePort{Port: 80},
+	})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+
+	if err := svc.StopExposure(status.LocalPort); err != nil {
+		t.Fatalf("StopExposure should not return an error: %v", err)
+	}
+
+	if len(svc.Exposures()) != 0 {
+		t.Error("Exposures should be empty after StopExposure")
+	}
+
+	if err := svc.StopExposure(status.LocalPort); err == nil {
+		t.Error("StopExposure should return an error for an unknown port")
+	}
+}
+
+func TestRestartTunnel(t *testing.T) {
+	mockClient := &mockK8sClient{}
+	mockNgrok := &mockNgrokClient{}
+	svc := NewService(mockClient, mockNgrok)
+	defer svc.Cleanup()
+
+	status, err := svc.Expose(context.Background(), ExposeRequest{
+		Service: "test-service (ns: default)",
+		Port:    ServicePort{Port: 80},
+	})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+
+	url, err := svc.RestartTunnel(context.Background(), status.LocalPort)
+	if err != nil {
+		t.Fatalf("RestartTunnel should not return an error: %v", err)
+	}
+
+	if url == "" || svc.Exposures()[0].PublicURL != url {
+		t.Errorf("Expected exposure URL to be updated to %q", url)
+	}
+
+	if _, err := svc.RestartTunnel(context.Background(), 1); err == nil {
+		t.Error("RestartTunnel should return an error for an unknown port")
+	}
+}
+
+// blockingNgrokClient starts tunnels with a new URL each time, the restarts waiting for release
+type blockingNgrokClient struct {
+	mu      sync.Mutex
+	started int
+	closed  []string
+	// restarting receives the restarts before they wait for release
+	restarting chan struct{}
+	release    chan struct{}
+}
+
+func (m *blockingNgrokClient) StartTunnel(ctx context.Context, port int, opts TunnelOptions) (string, error) {
+	m.mu.Lock()
+	m.started++
+	url := fmt.Sprintf("https://mock%d-%d.ngrok.io", port, m.started)
+	restart := m.started > 1
+	m.mu.Unlock()
+
+	if restart {
+		m.restarting <- struct{}{}
+		<-m.release
+	}
+	return url, nil
+}
+
+func (m *blockingNgrokClient) CloseTunnel(url string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = append(m.closed, url)
+	return nil
+}
+
+func (m *blockingNgrokClient) Close() error {
+	return nil
+}
+
+func TestRestartTunnel_Stopped(t *testing.T) {
+	ngrokClient := &blockingNgrokClient{restarting: make(chan struct{}), release: make(chan struct{})}
+	svc := NewService(&mockK8sClient{}, ngrokClient)
+	defer svc.Cleanup()
+
+	status, err := svc.Expose(context.Background(), ExposeRequest{Service: "test-service (ns: default)", Port: ServicePort{Port: 80}})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+
+	restarted := make(chan error, 1)
+	go func() {
+		_, err := svc.RestartTunnel(context.Background(), status.LocalPort)
+		restarted <- err
+	}()
+
+	<-ngrokClient.restarting
+	if err := svc.StopExposure(status.LocalPort); err != nil {
+		t.Fatalf("StopExposure should not return an error: %v", err)
+	}
+	close(ngrokClient.release)
+
+	if err := <-restarted; err == nil {
+		t.Error("Expected RestartTunnel to fail for an exposure stopped meanwhile")
+	}
+	ngrokClient.mu.Lock()
+	defer ngrokClient.mu.Unlock()
+	if len(ngrokClient.closed) != 2 || ngrokClient.closed[0] != status.PublicURL || !strings.HasSuffix(ngrokClient.closed[1], "-2.ngrok.io") {
+		t.Errorf("Expected the old and the restarted tunnel to be closed, got %v", ngrokClient.closed)
+	}
+}
+
+func TestKeepForwardingReconnects(t *testing.T) {
+	done := make(chan error, 1)
+	mockClient := &reconnectingK8sClient{first: done}
+	svc := NewService(mockClient, &mockNgrokClient{})
+	defer svc.Cleanup()
+
+	port, err := svc.StartPortForwarding(context.Background(), "test-service (ns: default)", 80)
+	if err != nil {
+		t.Fatalf("StartPortForwarding should not return an error: %v", err)
+	}
+
+	done <- fmt.Errorf("lost connection to pod")
+	close(done)
+
+	deadline := time.Now().Add(3 * reconnectDelay)
+	for time.Now().Before(deadline) {
+		exposures := svc.Exposures()
+		if len(exposures) == 1 && exposures[0].PodName == "second-pod" && exposures[0].Forwarding == ForwardActive {
+			if len(exposures[0].Errors) == 0 {
+				t.Error("The broken port forwarding should be recorded as an error")
+			}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("port forwarding on port %d was not re-established: %+v", port, svc.Exposures())
+}
+
+// reconnectingK8sClient returns a breakable session first and a stable one afterwards
+type reconnectingK8sClient struct {
+	mockK8sClient
+	mu    sync.Mutex
+	first chan error
+	calls int
+}
+
+func (m *reconnectingK8sClient) PortForward(ctx context.Context, serviceName string, namespace string, localPort int, servicePort int32) (PortForwardSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls++
+	if m.calls == 1 {
+		return PortForwardSession{PodName: "first-pod", Done: m.first}, nil
+	}
+	return PortForwardSession{PodName: "second-pod", Done: make(chan error)}, nil
+}
+
+func TestRequestsAndReplay(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("got " + string(body)))
+	}))
+	defer backend.Close()
+	backendPort := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	mockNgrok := &mockNgrokClient{}
+	svc := NewService(&mockK8sClient{}, mockNgrok)
+	defer svc.Cleanup()
+
+	if _, err := svc.CreateNgrokSession(context.Background(), backendPort); err != nil {
+		t.Fatalf("CreateNgrokSession should not return an error: %v", err)
+	}
+
+	// Send a request the way ngrok would, to the local proxy
+	resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/hook", mockNgrok.lastPort), "text/plain", strings.NewReader("first"))
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var requests []proxy.Exchange
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline) && len(requests) == 0; time.Sleep(10 * time.Millisecond) {
+		if requests, err = svc.Requests(backendPort); err != nil {
+			t.Fatalf("Requests should not return an error: %v", err)
+		}
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 recorded request, got %d", len(requests))
+	}
+
+	result, err := svc.Replay(context.Background(), backendPort, requests[0].ID, proxy.ReplayOptions{Body: []byte("second")})
+	if err != nil {
+		t.Fatalf("Replay should not return an error: %v", err)
+	}
+
+	if string(result.Replayed.ResponseBody) != "got second" {
+		t.Errorf("Expected replayed response %q, got %q", "got second", result.Replayed.ResponseBody)
+	}
+	if len(result.Diff) == 0 {
+		t.Error("Replay with a different body should report a response diff")
+	}
+
+	if _, err := svc.Replay(context.Background(), backendPort, 99, proxy.ReplayOptions{}); err == nil {
+		t.Error("Replay should return an error for an unknown request")
+	}
+
+	if _, err := svc.Requests(1); err == nil {
+		t.Error("Requests should return an error for an unknown port")
+	}
+}
+
+func TestExposeTTL(t *testing.T) {
+	svc := NewService(&mockK8sClient{}, &mockNgrokClient{})
+	defer svc.Cleanup()
+
+	status, err := svc.Expose(context.Background(), ExposeRequest{
+		Service: "test-service (ns: default)",
+		Port:    ServicePort{Port: 80},
+		TTL:     100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
 	}
 
-	if svc.activePort != 0 {
-		t.Error("activePort should be 0 after cleanup")
+	if status.ExpiresAt.IsZero() || !status.IdleExpiresAt.IsZero() {
+		t.Errorf("Expected only the TTL expiry to be set, got %v and %v", status.ExpiresAt, status.IdleExpiresAt)
+	}
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline) && len(svc.Exposures()) > 0; {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if exposures := svc.Exposures(); len(exposures) != 0 {
+		t.Errorf("Exposure should be stopped once its TTL is reached, got %+v", exposures)
+	}
+}
+
+func TestCheckExpiry(t *testing.T) {
+	svc := NewService(&mockK8sClient{}, &mockNgrokClient{})
+	started := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		e       *exposure
+		now     time.Time
+		reason  string
+		wait    time.Duration
+		warning string
+	}{
+		{
+			name: "ttl running",
+			e:    &exposure{startedAt: started, expiresAt: started.Add(time.Hour)},
+			now:  started.Add(10 * time.Minute),
+			wait: 50 * time.Minute,
+		},
+		{
+			name:   "ttl reached",
+			e:      &exposure{startedAt: started, expiresAt: started.Add(time.Hour)},
+			now:    started.Add(time.Hour),
+			reason: "time-to-live of 1h0m0s reached",
+		},
+		{
+			name: "wakes up to warn",
+			e:    &exposure{startedAt: started, expiresAt: started.Add(time.Hour), warnBefore: 5 * time.Minute},
+			now:  started.Add(10 * time.Minute),
+			wait: 45 * time.Minute,
+		},
+		{
+			name:    "ttl warning",
+			e:       &exposure{startedAt: started, expiresAt: started.Add(time.Hour), warnBefore: 5 * time.Minute},
+			now:     started.Add(57 * time.Minute),
+			wait:    3 * time.Minute,
+			warning: "stops at 13:00:00, time-to-live of 1h0m0s",
+		},
+		{
+			name:   "idle reached first",
+			e:      &exposure{startedAt: started, expiresAt: started.Add(time.Hour), idleTimeout: 15 * time.Minute},
+			now:    started.Add(15 * time.Minute),
+			reason: "no traffic for 15m0s",
+		},
+		{
+			name:    "idle warning cleared",
+			e:       &exposure{startedAt: started, idleTimeout: 15 * time.Minute, warnBefore: time.Minute, warning: "old"},
+			now:     started.Add(5 * time.Minute),
+			wait:    9 * time.Minute,
+			warning: "",
+		},
+	}
+
+	for _, tt := range tests {
+		reason, wait := svc.checkExpiry(tt.e, tt.now)
+		if reason != tt.reason {
+			t.Errorf("%s: expected reason %q, got %q", tt.name, tt.reason, reason)
+		}
+		if reason == "" && wait != tt.wait {
+			t.Errorf("%s: expected wait %v, got %v", tt.name, tt.wait, wait)
+		}
+		if reason == "" && tt.e.warning != tt.warning {
+			t.Errorf("%s: expected warning %q, got %q", tt.name, tt.warning, tt.e.warning)
+		}
+	}
+}
+
+func TestExposeHealthCheck(t *testing.T) {
+	mockNgrok := &mockNgrokClient{}
+	svc := NewService(&mockK8sClient{}, mockNgrok)
+	defer svc.Cleanup()
+
+	// Nothing listens on the forwarded port of the mock client
+	status, err := svc.Expose(context.Background(), ExposeRequest{
+		Service:      "test-service (ns: default)",
+		Port:         ServicePort{Port: 80},
+		HealthCheck:  health.Config{Type: health.TypeTCP, Interval: 10 * time.Millisecond},
+		FallbackPage: []byte("be right back"),
+	})
+	if err != nil {
+		t.Fatalf("Expose should not return an error: %v", err)
+	}
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline) && status.Health != HealthUnhealthy; {
+		time.Sleep(10 * time.Millisecond)
+		status = svc.Exposures()[0]
+	}
+
+	if status.Health != HealthUnhealthy || status.HealthError == "" {
+		t.Fatalf("Expected the exposure to be unhealthy with an error, got %q (%q)", status.Health, status.HealthError)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", mockNgrok.lastPort))
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
 	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
 
-	if svc.activeNgrokURL != "" {
-		t.Error("activeNgrokURL should be empty after cleanup")
+	if resp.StatusCode != http.StatusServiceUnavailable || string(body) != "be right back" {
+		t.Errorf("Expected the fallback page, got %d %q", resp.StatusCode, body)
 	}
 }
@@ -0,0 +1,688 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/Goalt/service-exporter/exporter"
+	"github.com/Goalt/service-exporter/internal/logging"
+)
+
+// refreshInterval is how often the dashboard is redrawn without user input or lifecycle events
+const refreshInterval = time.Second
+
+// maxLogLines is the number of recent log lines shown below the exposures
+const maxLogLines = 6
+
+// key is a keypress read from the terminal
+type key int
+
+const (
+	keyUnknown key = iota
+	keyUp
+	keyDown
+	keyAdd
+	keyStop
+	keyCopy
+	keyRestart
+	keyInspect
+	keyExport
+	keyFavorite
+	keyBack
+	keyQuit
+)
+
+// maxListedRequests is the number of recent requests listed in the inspector view
+const maxListedRequests = 10
+
+// maxBodyPreview is the number of body bytes shown in the inspector view
+const maxBodyPreview = 512
+
+// IsTerminal reports whether both stdin and stdout are attached to a terminal
+func IsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Service is what the dashboard needs of the exporter running the exposures, implemented by *exporter.Exporter
+type Service interface {
+	Exposures() []exporter.ExposureStatus
+	Subscribe(ctx context.Context) <-chan exporter.Event
+	StopExposure(localPort int) error
+	RestartTunnel(ctx context.Context, localPort int) (string, error)
+	Requests(localPort int) ([]exporter.Exchange, error)
+}
+
+// Dashboard is a full-screen terminal view of the active exposures
+type Dashboard struct {
+	svc Service
+	add func(ctx context.Context) error
+	// favorite toggles whether an exposure's service port is starred, nil when favorites are unavailable
+	favorite func(exporter.ExposureStatus) (bool, error)
+
+	in  *os.File
+	out io.Writer
+
+	selected int
+	message  string
+	// messages delivers the messages of the actions running in the background, like tunnel restarts
+	messages chan string
+	logs     *logBuffer
+
+	// inspecting shows the recorded requests of the selected exposure,
+	// request is the index of the highlighted one counting from the newest
+	inspecting bool
+	request    int
+}
+
+// New creates a dashboard for the exposures of svc. add is called, with the
+// terminal restored to normal mode, when the user asks for another exposure.
+func New(svc Service, add func(ctx context.Context) error) *Dashboard {
+	return &Dashboard{
+		svc:      svc,
+		add:      add,
+		in:       os.Stdin,
+		out:      os.Stdout,
+		messages: make(chan string),
+		logs:     &logBuffer{},
+	}
+}
+
+// SetFavorite sets the function that stars or unstars the service port of an exposure
+func (d *Dashboard) SetFavorite(favorite func(exporter.ExposureStatus) (bool, error)) {
+	d.favorite = favorite
+}
+
+// Run shows the dashboard until ctx is cancelled or the user quits
+func (d *Dashboard) Run(ctx context.Context) error {
+	// Background actions still running when the dashboard quits drop their message
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys := make(chan key)
+	resume := make(chan struct{})
+	restore, err := d.enter(keys, resume)
+	if err != nil {
+		return fmt.Errorf("failed to start dashboard: %v", err)
+	}
+	defer func() { restore() }()
+
+	// Lifecycle events redraw the dashboard at once, the ticker keeps the counters and uptimes current
+	events := d.svc.Subscribe(ctx)
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		d.render()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+			}
+		case message := <-d.messages:
+			d.message = message
+		case k := <-keys:
+			if k == keyQuit {
+				return nil
+			}
+
+			if k == keyAdd {
+				// Hand the terminal over to the interactive prompts, restore stops reading keys
+				restore()
+				d.message = d.addExposure(ctx)
+
+				resumed, err := d.enter(keys, resume)
+				if err != nil {
+					restore = func() {}
+					return fmt.Errorf("failed to resume dashboard: %v", err)
+				}
+				restore = resumed
+				continue
+			}
+
+			d.handleKey(ctx, k)
+			resume <- struct{}{}
+		}
+	}
+}
+
+// enter switches the terminal to raw mode on the alternate screen, captures log output and reads the
+// keypresses into keys until the returned function restores the terminal
+func (d *Dashboard) enter(keys chan<- key, resume <-chan struct{}) (func(), error) {
+	state, err := term.MakeRaw(int(d.in.Fd()))
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := newKeyInput(d.in)
+	if err != nil {
+		term.Restore(int(d.in.Fd()), state)
+		return nil, err
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readKeys(input, keys, resume, stop)
+	}()
+
+	restoreLogs := logging.SetOutput(d.logs)
+
+	// Switch to the alternate screen and hide the cursor
+	fmt.Fprint(d.out, "\x1b[?1049h\x1b[?25l")
+
+	return func() {
+		// Stop reading keys so that the next prompt gets every keypress, where the pending
+		// read cannot be cancelled the reader returns with the next keypress instead
+		close(stop)
+		if input.Close() == nil {
+			<-done
+		}
+
+		fmt.Fprint(d.out, "\x1b[?25h\x1b[?1049l")
+		restoreLogs()
+		term.Restore(int(d.in.Fd()), state)
+	}, nil
+}
+
+// readKeys reads keypresses from input until it fails or stop is closed, and waits for each one
+// to be handled before reading the next, so that prompts opened by a key get exclusive access to stdin
+func readKeys(input io.Reader, keys chan<- key, resume <-chan struct{}, stop <-chan struct{}) {
+	buf := make([]byte, 8)
+	for {
+		n, err := input.Read(buf)
+		if err != nil {
+			return
+		}
+
+		k := parseKey(buf[:n])
+		if k == keyUnknown {
+			continue
+		}
+
+		select {
+		case keys <- k:
+		case <-stop:
+			return
+		}
+		select {
+		case <-resume:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// parseKey maps raw terminal input to a key
+func parseKey(b []byte) key {
+	switch string(b) {
+	case "\x1b[A", "k":
+		return keyUp
+	case "\x1b[B", "j":
+		return keyDown
+	case "a":
+		return keyAdd
+	case "s":
+		return keyStop
+	case "c":
+		return keyCopy
+	case "r":
+		return keyRestart
+	case "i":
+		return keyInspect
+	case "e":
+		return keyExport
+	case "f":
+		return keyFavorite
+	case "\x1b":
+		return keyBack
+	case "q", "\x03":
+		return keyQuit
+	}
+
+	return keyUnknown
+}
+
+// addExposure runs the add callback and returns the message to show
+func (d *Dashboard) addExposure(ctx context.Context) string {
+	if err := d.add(ctx); err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+
+	// Select the newly added exposure, which usually got the highest local port
+	d.selected = len(d.svc.Exposures()) - 1
+	return "✅ Exposure added"
+}
+
+// handleKey performs the action bound to k on the selected exposure
+func (d *Dashboard) handleKey(ctx context.Context, k key) {
+	exposures := d.svc.Exposures()
+
+	if d.inspecting {
+		d.handleInspectorKey(k, exposures)
+		return
+	}
+
+	switch k {
+	case keyUp:
+		if d.selected > 0 {
+			d.selected--
+		}
+		return
+	case keyDown:
+		if d.selected < len(exposures)-1 {
+			d.selected++
+		}
+		return
+	}
+
+	if d.selected >= len(exposures) {
+		d.message = "No exposure selected"
+		return
+	}
+	selected := exposures[d.selected]
+
+	switch k {
+	case keyStop:
+		if err := d.svc.StopExposure(selected.LocalPort); err != nil {
+			d.message = fmt.Sprintf("❌ %v", err)
+			return
+		}
+		d.message = fmt.Sprintf("🛑 Stopped %s", selected.Service)
+		if d.selected > 0 && d.selected >= len(exposures)-1 {
+			d.selected--
+		}
+	case keyCopy:
+		if selected.PublicURL == "" {
+			d.message = "No public URL to copy"
+			return
+		}
+		// OSC 52 asks the terminal emulator to put the text on the clipboard
+		fmt.Fprintf(d.out, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(selected.PublicURL)))
+		d.message = fmt.Sprintf("📋 Copied %s", selected.PublicURL)
+	case keyRestart:
+		d.message = "🔁 Restarting tunnel..."
+		go d.restartTunnel(ctx, selected.LocalPort)
+	case keyInspect:
+		d.inspecting = true
+		d.request = 0
+		d.message = ""
+	case keyExport:
+		d.message = d.exportHAR(selected.LocalPort)
+	case keyFavorite:
+		d.message = d.toggleFavorite(selected)
+	}
+}
+
+// restartTunnel restarts the tunnel of an exposure in the background, so that the dashboard keeps
+// refreshing meanwhile, and sends the message to show once done
+func (d *Dashboard) restartTunnel(ctx context.Context, localPort int) {
+	message := ""
+	if url, err := d.svc.RestartTunnel(ctx, localPort); err != nil {
+		message = fmt.Sprintf("❌ %v", err)
+	} else {
+		message = fmt.Sprintf("🌐 Tunnel restarted: %s", url)
+	}
+
+	select {
+	case d.messages <- message:
+	case <-ctx.Done():
+	}
+}
+
+// toggleFavorite stars or unstars the service port of an exposure and returns the message to show
+func (d *Dashboard) toggleFavorite(exposure exporter.ExposureStatus) string {
+	if d.favorite == nil {
+		return "Favorites are not available"
+	}
+
+	starred, err := d.favorite(exposure)
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+	if starred {
+		return fmt.Sprintf("📌 Added %s port %d to favorites", exposure.Service, exposure.ServicePort)
+	}
+	return fmt.Sprintf("Removed %s port %d from favorites", exposure.Service, exposure.ServicePort)
+}
+
+// handleInspectorKey handles keys while the recorded requests are shown
+func (d *Dashboard) handleInspectorKey(k key, exposures []exporter.ExposureStatus) {
+	switch k {
+	case keyUp:
+		if d.request > 0 {
+			d.request--
+		}
+	case keyDown:
+		d.request++
+	case keyInspect, keyBack:
+		d.inspecting = false
+	case keyExport:
+		if d.selected < len(exposures) {
+			d.message = d.exportHAR(exposures[d.selected].LocalPort)
+		}
+	}
+}
+
+// exportHAR writes the recorded requests of an exposure to a HAR file in the
+// working directory and returns the message to show
+func (d *Dashboard) exportHAR(localPort int) string {
+	exchanges, err := d.svc.Requests(localPort)
+	if err != nil {
+		return fmt.Sprintf("❌ %v", err)
+	}
+
+	data, err := exporter.MarshalHAR(exchanges)
+	if err != nil {
+		return fmt.Sprintf("❌ failed to encode HAR: %v", err)
+	}
+
+	name := fmt.Sprintf("service-exporter-%d-%s.har", localPort, time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		return fmt.Sprintf("❌ failed to write HAR: %v", err)
+	}
+
+	return fmt.Sprintf("💾 Exported %d request(s) to %s", len(exchanges), name)
+}
+
+// render redraws the whole screen
+func (d *Dashboard) render() {
+	exposures := d.svc.Exposures()
+
+	view := d.view(exposures, d.logs.Lines())
+	if d.inspecting && d.selected < len(exposures) {
+		exchanges, _ := d.svc.Requests(exposures[d.selected].LocalPort)
+		view = d.inspectorView(exposures[d.selected], exchanges)
+	}
+
+	// Raw mode does not translate newlines into carriage return + newline
+	fmt.Fprint(d.out, "\x1b[H\x1b[2J"+strings.ReplaceAll(view, "\n", "\r\n"))
+}
+
+// view builds the dashboard text for the given exposures and log lines
+func (d *Dashboard) view(exposures []exporter.ExposureStatus, logs []string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "🚀 Service Exporter — %d active exposure(s)\n", len(exposures))
+	b.WriteString("================================================================\n")
+
+	if len(exposures) == 0 {
+		b.WriteString("\nNo active exposures. Press [a] to expose a service.\n")
+	}
+
+	for i, e := range exposures {
+		cursor := " "
+		if i == d.selected {
+			cursor = "▸"
+		}
+
+		fmt.Fprintf(&b, "\n%s %s :%d → localhost:%d (up %s)\n", cursor, displayName(e), e.ServicePort, e.LocalPort, time.Since(e.StartedAt).Truncate(time.Second))
+		fmt.Fprintf(&b, "    Pod:     %s\n", podLine(e))
+		fmt.Fprintf(&b, "    Tunnel:  %s\n", tunnelLine(e))
+		if e.Health != "" {
+			fmt.Fprintf(&b, "    Health:  %s\n", healthLine(e))
+		}
+		fmt.Fprintf(&b, "    Traffic: %d requests, %s in, %s out, %d failed, %d rejected\n", e.Requests, formatBytes(e.BytesIn), formatBytes(e.BytesOut), e.Failures, e.Rejected)
+		if line := expiryLine(e); line != "" {
+			fmt.Fprintf(&b, "    Expires: %s\n", line)
+		}
+		if e.Warning != "" {
+			fmt.Fprintf(&b, "    ⏰ %s\n", e.Warning)
+		}
+		for _, err := range e.Errors {
+			fmt.Fprintf(&b, "    ⚠️  %s\n", err)
+		}
+	}
+
+	if len(logs) > 0 {
+		b.WriteString("\n📜 Recent log\n")
+		for _, line := range logs {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+
+	b.WriteString("\n[↑/↓] select  [a] add  [s] stop  [c] copy URL  [r] restart tunnel  [i] requests  [e] export HAR  [f] favorite  [q] quit\n")
+	if d.message != "" {
+		fmt.Fprintf(&b, "%s\n", d.message)
+	}
+
+	return b.String()
+}
+
+// expiryLine describes when the exposure is stopped by its TTL or idle timeout, empty if never
+func expiryLine(e exporter.ExposureStatus) string {
+	var parts []string
+	if !e.ExpiresAt.IsZero() {
+		parts = append(parts, fmt.Sprintf("in %s", time.Until(e.ExpiresAt).Truncate(time.Second)))
+	}
+	if !e.IdleExpiresAt.IsZero() {
+		parts = append(parts, fmt.Sprintf("idle in %s", time.Until(e.IdleExpiresAt).Truncate(time.Second)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// inspectorView builds the text listing the recorded requests of an exposure
+// with the details of the highlighted one
+func (d *Dashboard) inspectorView(e exporter.ExposureStatus, exchanges []exporter.Exchange) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "🔍 Requests for %s — %s\n", displayName(e), e.PublicURL)
+	b.WriteString("================================================================\n")
+
+	if len(exchanges) == 0 {
+		b.WriteString("\nNo requests recorded yet.\n")
+	}
+
+	// Show the newest requests first
+	listed := make([]exporter.Exchange, 0, maxListedRequests)
+	for i := len(exchanges) - 1; i >= 0 && len(listed) < maxListedRequests; i-- {
+		listed = append(listed, exchanges[i])
+	}
+	if d.request >= len(listed) {
+		d.request = max(len(listed)-1, 0)
+	}
+
+	for i, x := range listed {
+		cursor := " "
+		if i == d.request {
+			cursor = "▸"
+		}
+		fmt.Fprintf(&b, "%s %s %-7s %s → %d (%s, %s)\n", cursor, x.StartedAt.Format(time.TimeOnly), x.Method, requestPath(x.URL), x.Status, x.Duration.Round(time.Millisecond), formatBytes(x.ResponseSize))
+	}
+
+	if len(listed) > 0 {
+		x := listed[d.request]
+		b.WriteString("\n── Request ──────────────────────────────────────────────────────\n")
+		fmt.Fprintf(&b, "%s %s %s\n", x.Method, x.URL, x.Proto)
+		writeHeaders(&b, x.RequestHeaders)
+		writeBody(&b, x.RequestBody, x.RequestBodyTruncated)
+
+		b.WriteString("\n── Response ─────────────────────────────────────────────────────\n")
+		fmt.Fprintf(&b, "%d %s\n", x.Status, http.StatusText(x.Status))
+		if x.Error != "" {
+			fmt.Fprintf(&b, "⚠️  %s\n", x.Error)
+		}
+		writeHeaders(&b, x.ResponseHeaders)
+		writeBody(&b, x.ResponseBody, x.ResponseBodyTruncated)
+	}
+
+	b.WriteString("\n[↑/↓] select request  [e] export HAR  [i/esc] back\n")
+	if d.message != "" {
+		fmt.Fprintf(&b, "%s\n", d.message)
+	}
+
+	return b.String()
+}
+
+// trimPartialRune drops an incomplete multi-byte character at the end of a capped body
+func trimPartialRune(b []byte) []byte {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return b[:i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// requestPath strips the scheme and host from a recorded URL
+func requestPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.RequestURI()
+}
+
+func writeHeaders(b *strings.Builder, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(b, "%s: %s\n", name, value)
+		}
+	}
+}
+
+// writeBody writes a printable preview of a recorded body
+func writeBody(b *strings.Builder, body []byte, truncated bool) {
+	if len(body) == 0 {
+		return
+	}
+
+	preview := body
+	if len(preview) > maxBodyPreview {
+		preview, truncated = preview[:maxBodyPreview], true
+	}
+
+	if truncated {
+		preview = trimPartialRune(preview)
+	}
+
+	if !utf8.Valid(preview) {
+		fmt.Fprintf(b, "\n<%d bytes of binary data>\n", len(body))
+		return
+	}
+
+	// Keep control characters from the body away from the terminal
+	text := strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, string(preview))
+
+	fmt.Fprintf(b, "\n%s\n", text)
+	if truncated {
+		b.WriteString("… (truncated)\n")
+	}
+}
+
+func displayName(e exporter.ExposureStatus) string {
+	if e.Service == "" {
+		return "local port"
+	}
+	return e.Service
+}
+
+func podLine(e exporter.ExposureStatus) string {
+	switch e.Forwarding {
+	case exporter.ForwardNone:
+		return "- (no port forwarding)"
+	case exporter.ForwardReconnecting:
+		return fmt.Sprintf("%s (🔄 reconnecting)", e.PodName)
+	default:
+		return fmt.Sprintf("%s (✅ forwarding)", e.PodName)
+	}
+}
+
+func tunnelLine(e exporter.ExposureStatus) string {
+	if e.PublicURL == "" {
+		return "🔴 down"
+	}
+	if !e.TunnelUp {
+		return fmt.Sprintf("🔴 down %s", e.PublicURL)
+	}
+	return fmt.Sprintf("🟢 up   %s", e.PublicURL)
+}
+
+// healthLine describes the health check state of an exposure
+func healthLine(e exporter.ExposureStatus) string {
+	switch e.Health {
+	case exporter.HealthHealthy:
+		return "💚 healthy"
+	case exporter.HealthUnhealthy:
+		return fmt.Sprintf("💔 unhealthy, serving fallback page (%s)", e.HealthError)
+	default:
+		return "⏳ checking"
+	}
+}
+
+// formatBytes renders a byte count in human readable units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// logBuffer keeps the most recent log lines written while the dashboard is shown
+type logBuffer struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *logBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, line := range strings.Split(string(bytes.TrimSpace(p)), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			l.lines = append(l.lines, line)
+		}
+	}
+	if len(l.lines) > maxLogLines {
+		l.lines = l.lines[len(l.lines)-maxLogLines:]
+	}
+
+	return len(p), nil
+}
+
+// Lines returns a copy of the buffered log lines
+func (l *logBuffer) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]string(nil), l.lines...)
+}
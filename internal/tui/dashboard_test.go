@@ -0,0 +1,251 @@
+package tui
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Goalt/service-exporter/exporter"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected key
+	}{
+		{"\x1b[A", keyUp},
+		{"k", keyUp},
+		{"\x1b[B", keyDown},
+		{"j", keyDown},
+		{"a", keyAdd},
+		{"s", keyStop},
+		{"c", keyCopy},
+		{"r", keyRestart},
+		{"i", keyInspect},
+		{"e", keyExport},
+		{"f", keyFavorite},
+		{"\x1b", keyBack},
+		{"q", keyQuit},
+		{"\x03", keyQuit},
+		{"x", keyUnknown},
+	}
+
+	for _, tt := range tests {
+		if result := parseKey([]byte(tt.input)); result != tt.expected {
+			t.Errorf("parseKey(%q) = %v, want %v", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{5 * 1024 * 1024, "5.0 MB"},
+	}
+
+	for _, tt := range tests {
+		if result := formatBytes(tt.input); result != tt.expected {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestView(t *testing.T) {
+	d := &Dashboard{selected: 1}
+	exposures := []exporter.ExposureStatus{
+		{
+			Service:     "api (ns: default)",
+			ServicePort: 80,
+			LocalPort:   8000,
+			PodName:     "api-7d9f",
+			PublicURL:   "https://api.ngrok.io",
+			Forwarding:  exporter.ForwardActive,
+			TunnelUp:    true,
+			Requests:    3,
+			BytesIn:     2048,
+			Rejected:    1,
+			Health:      exporter.HealthHealthy,
+			StartedAt:   time.Now(),
+		},
+		{
+			Service:     "web (ns: staging)",
+			ServicePort: 8080,
+			LocalPort:   8001,
+			PodName:     "web-5c4b",
+			Forwarding:  exporter.ForwardReconnecting,
+			Errors:      []string{"12:00:00 lost connection to pod"},
+			StartedAt:   time.Now(),
+			ExpiresAt:   time.Now().Add(90 * time.Second),
+			Health:      exporter.HealthUnhealthy,
+			HealthError: "port 8001 not accepting connections",
+			Warning:     "stops at 12:30:00, time-to-live of 30m0s",
+		},
+	}
+
+	view := d.view(exposures, []string{"Port forwarding ready"})
+
+	for _, expected := range []string{
+		"2 active exposure(s)",
+		"  api (ns: default) :80 → localhost:8000",
+		"▸ web (ns: staging) :8080 → localhost:8001",
+		"🟢 up   https://api.ngrok.io",
+		"web-5c4b (🔄 reconnecting)",
+		"3 requests, 2.0 KB in, 0 B out, 0 failed, 1 rejected",
+		"lost connection to pod",
+		"Expires: in 1m",
+		"Health:  💚 healthy",
+		"💔 unhealthy, serving fallback page (port 8001 not accepting connections)",
+		"⏰ stops at 12:30:00, time-to-live of 30m0s",
+		"Port forwarding ready",
+	} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("view should contain %q, got:\n%s", expected, view)
+		}
+	}
+}
+
+func TestLogBuffer(t *testing.T) {
+	l := &logBuffer{}
+	for i := 0; i < maxLogLines+2; i++ {
+		l.Write([]byte("line\n"))
+	}
+	l.Write([]byte("\nlast one\n"))
+
+	lines := l.Lines()
+	if len(lines) != maxLogLines {
+		t.Fatalf("Expected %d lines, got %d", maxLogLines, len(lines))
+	}
+
+	if lines[len(lines)-1] != "last one" {
+		t.Errorf("Expected last line %q, got %q", "last one", lines[len(lines)-1])
+	}
+}
+
+func TestInspectorView(t *testing.T) {
+	d := &Dashboard{inspecting: true, request: 5}
+	exposure := exporter.ExposureStatus{Service: "api (ns: default)", PublicURL: "https://api.ngrok.io"}
+	exchanges := []exporter.Exchange{
+		{ID: 1, Method: "GET", URL: "https://api.ngrok.io/health", Status: 200},
+		{
+			ID:              2,
+			Method:          "POST",
+			URL:             "https://api.ngrok.io/hook?x=1",
+			Proto:           "HTTP/1.1",
+			RequestHeaders:  http.Header{"X-Signature": {"abc"}},
+			RequestBody:     []byte("{\"event\":\"paid\"}\x1b[2J"),
+			Status:          502,
+			ResponseHeaders: http.Header{},
+			Error:           "connection refused",
+		},
+	}
+
+	view := d.inspectorView(exposure, exchanges)
+
+	if d.request != 1 {
+		t.Errorf("Highlighted request should be clamped to the list, got %d", d.request)
+	}
+
+	for _, expected := range []string{
+		"Requests for api (ns: default)",
+		"POST    /hook?x=1 → 502",
+		"▸ " + exchanges[0].StartedAt.Format(time.TimeOnly) + " GET     /health → 200",
+		"GET https://api.ngrok.io/health",
+	} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("view should contain %q, got:\n%s", expected, view)
+		}
+	}
+
+	d.request = 0
+	view = d.inspectorView(exposure, exchanges)
+	for _, expected := range []string{
+		"X-Signature: abc",
+		`{"event":"paid"}?[2J`,
+		"502 Bad Gateway",
+		"connection refused",
+	} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("view should contain %q, got:\n%s", expected, view)
+		}
+	}
+}
+
+func TestWriteBody(t *testing.T) {
+	var b strings.Builder
+	writeBody(&b, []byte{0xff, 0x00, 0xfe}, false)
+	if !strings.Contains(b.String(), "<3 bytes of binary data>") {
+		t.Errorf("Binary body should not be printed, got %q", b.String())
+	}
+
+	b.Reset()
+	// "é" is two bytes, cut in the middle by the capture limit
+	writeBody(&b, []byte("caf\xc3"), true)
+	if !strings.Contains(b.String(), "caf\n… (truncated)") {
+		t.Errorf("Truncated text body should be printed, got %q", b.String())
+	}
+}
+
+func TestToggleFavorite(t *testing.T) {
+	exposure := exporter.ExposureStatus{Service: "api (ns: web)", ServicePort: 80}
+	d := &Dashboard{}
+
+	if message := d.toggleFavorite(exposure); message != "Favorites are not available" {
+		t.Errorf("Unexpected message without favorites %q", message)
+	}
+
+	starred := false
+	d.SetFavorite(func(exporter.ExposureStatus) (bool, error) {
+		starred = !starred
+		return starred, nil
+	})
+	if message := d.toggleFavorite(exposure); message != "📌 Added api (ns: web) port 80 to favorites" {
+		t.Errorf("Unexpected message %q", message)
+	}
+	if message := d.toggleFavorite(exposure); message != "Removed api (ns: web) port 80 from favorites" {
+		t.Errorf("Unexpected message %q", message)
+	}
+}
+
+// restartService restarts tunnels once released
+type restartService struct {
+	Service
+	release chan struct{}
+}
+
+func (f *restartService) Exposures() []exporter.ExposureStatus {
+	return []exporter.ExposureStatus{{Service: "api (ns: web)", LocalPort: 8000, PublicURL: "https://old.ngrok.io"}}
+}
+
+func (f *restartService) RestartTunnel(ctx context.Context, localPort int) (string, error) {
+	<-f.release
+	return "https://new.ngrok.io", nil
+}
+
+func TestHandleKey_RestartInBackground(t *testing.T) {
+	svc := &restartService{release: make(chan struct{})}
+	d := New(svc, nil)
+
+	// The key is handled while the restart is still running
+	d.handleKey(context.Background(), keyRestart)
+	if d.message != "🔁 Restarting tunnel..." {
+		t.Errorf("Unexpected message while restarting %q", d.message)
+	}
+
+	close(svc.release)
+	select {
+	case message := <-d.messages:
+		if message != "🌐 Tunnel restarted: https://new.ngrok.io" {
+			t.Errorf("Unexpected message once restarted %q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the restart to report its message")
+	}
+}
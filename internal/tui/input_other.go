@@ -0,0 +1,27 @@
+//go:build !unix
+
+package tui
+
+import (
+	"errors"
+	"os"
+)
+
+// keyInput reads the keypresses from the terminal input, whose pending read cannot be cancelled here
+type keyInput struct {
+	in *os.File
+}
+
+// newKeyInput returns in for reading keypresses
+func newKeyInput(in *os.File) (*keyInput, error) {
+	return &keyInput{in: in}, nil
+}
+
+func (k *keyInput) Read(p []byte) (int, error) {
+	return k.in.Read(p)
+}
+
+// Close cannot cancel a pending read, which returns with the next keypress
+func (k *keyInput) Close() error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package tui
+
+import (
+	"os"
+	"syscall"
+)
+
+// keyInput reads the keypresses from a non-blocking duplicate of the terminal input,
+// so that closing it cancels a pending read instead of leaving it to steal the next keypress
+type keyInput struct {
+	in   *os.File
+	file *os.File
+}
+
+// newKeyInput duplicates in for reading keypresses
+func newKeyInput(in *os.File) (*keyInput, error) {
+	fd, err := syscall.Dup(int(in.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	// The duplicate shares the blocking mode of in, Close restores it
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return &keyInput{in: in, file: os.NewFile(uintptr(fd), in.Name())}, nil
+}
+
+func (k *keyInput) Read(p []byte) (int, error) {
+	return k.file.Read(p)
+}
+
+// Close cancels a pending read and switches in back to blocking mode for the prompts
+func (k *keyInput) Close() error {
+	err := k.file.Close()
+	if blockErr := syscall.SetNonblock(int(k.in.Fd()), false); err == nil {
+		err = blockErr
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+//go:build unix
+
+package tui
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestKeyInput_Close(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	input, err := newKeyInput(r)
+	if err != nil {
+		t.Fatalf("newKeyInput should not return an error: %v", err)
+	}
+
+	keys := make(chan key)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readKeys(input, keys, make(chan struct{}), stop)
+	}()
+
+	// Let the reader block in its read
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	if err := input.Close(); err != nil {
+		t.Fatalf("Close should not return an error: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Close to cancel the pending read")
+	}
+
+	// The next reader gets the first keypress
+	if _, err := w.Write([]byte("q")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	if n, err := r.Read(buf); err != nil || string(buf[:n]) != "q" {
+		t.Errorf("Expected the keypress to be read after Close, got %q %v", buf[:n], err)
+	}
+}